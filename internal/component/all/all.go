@@ -56,6 +56,7 @@ import (
 	_ "github.com/grafana/agent/internal/component/loki/source/syslog"                       // Import loki.source.syslog
 	_ "github.com/grafana/agent/internal/component/loki/source/windowsevent"                 // Import loki.source.windowsevent
 	_ "github.com/grafana/agent/internal/component/loki/write"                               // Import loki.write
+	_ "github.com/grafana/agent/internal/component/mimir/rules/file"                         // Import mimir.rules.file
 	_ "github.com/grafana/agent/internal/component/mimir/rules/kubernetes"                   // Import mimir.rules.kubernetes
 	_ "github.com/grafana/agent/internal/component/module/file"                              // Import module.file
 	_ "github.com/grafana/agent/internal/component/module/git"                               // Import module.git
@@ -133,6 +134,8 @@ import (
 	_ "github.com/grafana/agent/internal/component/prometheus/scrape"                        // Import prometheus.scrape
 	_ "github.com/grafana/agent/internal/component/pyroscope/ebpf"                           // Import pyroscope.ebpf
 	_ "github.com/grafana/agent/internal/component/pyroscope/java"                           // Import pyroscope.java
+	_ "github.com/grafana/agent/internal/component/pyroscope/receive_http"                   // Import pyroscope.receive_http
+	_ "github.com/grafana/agent/internal/component/pyroscope/relabel"                        // Import pyroscope.relabel
 	_ "github.com/grafana/agent/internal/component/pyroscope/scrape"                         // Import pyroscope.scrape
 	_ "github.com/grafana/agent/internal/component/pyroscope/write"                          // Import pyroscope.write
 	_ "github.com/grafana/agent/internal/component/remote/http"                              // Import remote.http
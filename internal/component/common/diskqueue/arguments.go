@@ -0,0 +1,58 @@
+package diskqueue
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/alecthomas/units"
+)
+
+// Arguments configures the disk_queue block of a component endpoint.
+type Arguments struct {
+	MaxSize units.Base2Bytes `river:"max_size,attr,optional"`
+	MaxAge  time.Duration    `river:"max_age,attr,optional"`
+}
+
+// DefaultArguments holds the default settings of a disk_queue block.
+var DefaultArguments = Arguments{
+	MaxSize: 1 * units.GiB,
+	MaxAge:  24 * time.Hour,
+}
+
+// SetToDefault implements river.Defaulter.
+func (a *Arguments) SetToDefault() {
+	*a = DefaultArguments
+}
+
+// Validate implements river.Validator.
+func (a *Arguments) Validate() error {
+	switch {
+	case a.MaxSize < 0:
+		return fmt.Errorf("max_size must not be negative")
+	case a.MaxAge < 0:
+		return fmt.Errorf("max_age must not be negative")
+	}
+	return nil
+}
+
+// Options returns the options of a Queue configured by a.
+func (a Arguments) Options() Options {
+	return Options{
+		MaxBytes: int64(a.MaxSize),
+		MaxAge:   a.MaxAge,
+	}
+}
+
+// Name returns the name of the queue used for an endpoint: the name of the
+// endpoint if set, otherwise a hash of its URL. Unlike client names, it
+// doesn't change when other options of the endpoint change, so queued data is
+// kept across configuration changes.
+func Name(endpointName, url string) string {
+	if endpointName != "" {
+		return endpointName
+	}
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:])[:6]
+}
@@ -0,0 +1,79 @@
+package diskqueue
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// EndpointStats holds the stats of the queue of an endpoint.
+type EndpointStats struct {
+	Endpoint string
+	Stats
+}
+
+// Collector exposes the stats of the queues of all endpoints of a component.
+type Collector struct {
+	stats func() []EndpointStats
+
+	bytes     *prometheus.Desc
+	entries   *prometheus.Desc
+	oldestAge *prometheus.Desc
+	evicted   *prometheus.Desc
+}
+
+var _ prometheus.Collector = (*Collector)(nil)
+
+// NewCollector returns a Collector for the queues returned by stats. Metrics
+// are prefixed with namespace, and entry and entries are the singular and
+// plural names used for queue entries in metric names, such as "batch" and
+// "batches".
+func NewCollector(namespace, entry, entries string, stats func() []EndpointStats) *Collector {
+	return &Collector{
+		stats: stats,
+		bytes: prometheus.NewDesc(
+			namespace+"_disk_queue_bytes",
+			"Size in bytes of unsent "+entries+" in the disk queue.",
+			[]string{"endpoint"}, nil,
+		),
+		entries: prometheus.NewDesc(
+			namespace+"_disk_queue_"+entries,
+			"Number of unsent "+entries+" in the disk queue.",
+			[]string{"endpoint"}, nil,
+		),
+		oldestAge: prometheus.NewDesc(
+			namespace+"_disk_queue_oldest_"+entry+"_age_seconds",
+			"Age of the oldest unsent "+entry+" in the disk queue.",
+			[]string{"endpoint"}, nil,
+		),
+		evicted: prometheus.NewDesc(
+			namespace+"_disk_queue_evicted_"+entries+"_total",
+			"Total number of unsent "+entries+" evicted from the disk queue.",
+			[]string{"endpoint", "reason"}, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.bytes
+	ch <- c.entries
+	ch <- c.oldestAge
+	ch <- c.evicted
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range c.stats() {
+		var age time.Duration
+		if !s.Oldest.IsZero() {
+			age = time.Since(s.Oldest)
+		}
+
+		ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.GaugeValue, float64(s.Bytes), s.Endpoint)
+		ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(s.Entries), s.Endpoint)
+		ch <- prometheus.MustNewConstMetric(c.oldestAge, prometheus.GaugeValue, age.Seconds(), s.Endpoint)
+		ch <- prometheus.MustNewConstMetric(c.evicted, prometheus.CounterValue, float64(s.EvictedMaxBytes), s.Endpoint, "max_size")
+		ch <- prometheus.MustNewConstMetric(c.evicted, prometheus.CounterValue, float64(s.EvictedMaxAge), s.Endpoint, "max_age")
+	}
+}
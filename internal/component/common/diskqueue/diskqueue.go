@@ -0,0 +1,668 @@
+// Package diskqueue implements a durable, size-bounded, append-only FIFO queue
+// backed by segment files on disk.
+//
+// Entries are appended to the newest segment file and read back in order from
+// a read position which is persisted next to the segments, so that unsent
+// entries are replayed after a restart. The oldest entries are evicted once
+// the queue grows beyond its configured size or once entries become older
+// than the configured maximum age.
+package diskqueue
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	segmentSuffix = ".seg"
+	positionFile  = "position.json"
+
+	// headerSize is the size of the record header: length (4 bytes), CRC32 (4
+	// bytes) and timestamp in unix nanoseconds (8 bytes).
+	headerSize = 16
+
+	// DefaultSegmentSize is the default size at which a new segment is started.
+	DefaultSegmentSize = 8 << 20
+)
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrClosed is returned when operating on a closed Queue.
+var ErrClosed = errors.New("disk queue is closed")
+
+// errCorrupted is returned when a record fails validation.
+var errCorrupted = errors.New("corrupted record")
+
+// Options configures a Queue.
+type Options struct {
+	// MaxBytes is the maximum size of unread entries on disk, including
+	// headers. The oldest entries are evicted when MaxBytes is exceeded. 0
+	// disables the limit.
+	MaxBytes int64
+
+	// MaxAge is the maximum age of an entry. Entries older than MaxAge are
+	// evicted when read. 0 disables the limit.
+	MaxAge time.Duration
+
+	// SegmentSize is the size at which a new segment file is started. Defaults
+	// to DefaultSegmentSize.
+	SegmentSize int64
+}
+
+// Entry is a single entry read from a Queue.
+type Entry struct {
+	Timestamp time.Time
+	Data      []byte
+
+	next position // Position directly after the entry.
+}
+
+// Stats holds statistics about a Queue.
+type Stats struct {
+	Bytes           int64     // Size of unread entries on disk, including headers.
+	Entries         int       // Number of unread entries.
+	Oldest          time.Time // Timestamp of the oldest unread entry; zero if empty.
+	EvictedMaxBytes uint64    // Entries evicted because of MaxBytes since the queue was opened.
+	EvictedMaxAge   uint64    // Entries evicted because of MaxAge since the queue was opened.
+}
+
+// position identifies a location within the queue.
+type position struct {
+	Segment  int   `json:"segment"`
+	Offset   int64 `json:"offset"`
+	Consumed int   `json:"consumed"` // Number of entries before Offset in Segment.
+}
+
+type segment struct {
+	index   int
+	size    int64
+	entries int
+}
+
+// Queue is a durable FIFO queue. Queue is safe for concurrent use by one
+// writer and one reader.
+type Queue struct {
+	dir  string
+	opts Options
+	now  func() time.Time
+
+	mut      sync.Mutex
+	closed   bool
+	segments []*segment // Sorted by index; the first segment holds pos.
+	pos      position   // Current read position.
+	writer   *os.File   // Open handle to the last segment.
+	reader   *os.File   // Open handle to the segment being read, if any.
+	readIdx  int        // Index of the segment open in reader.
+	oldest   time.Time  // Cached timestamp of the entry at pos.
+	notify   chan struct{}
+
+	evictedMaxBytes uint64
+	evictedMaxAge   uint64
+}
+
+// Open opens or creates a Queue in dir. Segments left behind by a previous
+// Queue in the same directory are replayed starting from the persisted read
+// position. Torn records at the end of a segment are truncated.
+func Open(dir string, opts Options) (*Queue, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = DefaultSegmentSize
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("creating queue directory: %w", err)
+	}
+
+	q := &Queue{
+		dir:    dir,
+		opts:   opts,
+		now:    time.Now,
+		notify: make(chan struct{}, 1),
+	}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *Queue) load() error {
+	indices, err := listSegments(q.dir)
+	if err != nil {
+		return err
+	}
+
+	pos, err := readPosition(filepath.Join(q.dir, positionFile))
+	if err != nil {
+		return err
+	}
+
+	for _, idx := range indices {
+		if idx < pos.Segment {
+			// Segments before the read position have been fully read.
+			if err := os.Remove(q.segmentPath(idx)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("removing consumed segment: %w", err)
+			}
+			continue
+		}
+
+		seg, err := q.scanSegment(idx)
+		if err != nil {
+			return err
+		}
+		q.segments = append(q.segments, seg)
+	}
+
+	switch {
+	case len(q.segments) == 0:
+		// Nothing to replay; start a new segment after the previous position.
+		next := pos.Segment + 1
+		q.segments = []*segment{{index: next}}
+		q.pos = position{Segment: next}
+	case q.segments[0].index != pos.Segment || pos.Offset > q.segments[0].size:
+		// The segment holding the read position is gone or shorter than
+		// expected; start reading from the oldest remaining data.
+		q.pos = position{Segment: q.segments[0].index}
+	default:
+		q.pos = pos
+	}
+
+	last := q.segments[len(q.segments)-1]
+	f, err := os.OpenFile(q.segmentPath(last.index), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("opening segment: %w", err)
+	}
+	q.writer = f
+
+	if err := q.writePosition(); err != nil {
+		return err
+	}
+	return q.refreshOldest()
+}
+
+// scanSegment validates a segment, truncating any torn or corrupted records
+// at its end, and returns its size and number of entries.
+func (q *Queue) scanSegment(idx int) (*segment, error) {
+	f, err := os.OpenFile(q.segmentPath(idx), os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("opening segment: %w", err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("opening segment: %w", err)
+	}
+
+	seg := &segment{index: idx}
+	for {
+		_, n, err := readRecord(f, seg.size, q.recordLimit(fi.Size()-seg.size))
+		if err != nil {
+			break
+		}
+		seg.size += n
+		seg.entries++
+	}
+
+	if fi.Size() != seg.size {
+		if err := f.Truncate(seg.size); err != nil {
+			return nil, fmt.Errorf("truncating corrupted segment: %w", err)
+		}
+	}
+	return seg, nil
+}
+
+// Append appends data to the queue with the current time as its timestamp.
+func (q *Queue) Append(data []byte) error {
+	return q.AppendAt(q.now(), data)
+}
+
+// AppendAt appends data to the queue with the given timestamp. The entry is
+// synced to disk before AppendAt returns. The oldest entries are evicted if
+// the queue exceeds its maximum size afterwards, and entries which are larger
+// than the maximum size on their own are evicted right away.
+func (q *Queue) AppendAt(ts time.Time, data []byte) error {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+
+	if q.opts.MaxBytes > 0 && headerSize+int64(len(data)) > q.opts.MaxBytes {
+		// The entry would be evicted immediately; drop it without evicting
+		// the entries which are already queued.
+		q.evictedMaxBytes++
+		return nil
+	}
+
+	last := q.segments[len(q.segments)-1]
+	if last.size > 0 && last.size+headerSize+int64(len(data)) > q.opts.SegmentSize {
+		if err := q.rotate(); err != nil {
+			return err
+		}
+		last = q.segments[len(q.segments)-1]
+	}
+
+	buf := make([]byte, headerSize+len(data))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint64(buf[8:16], uint64(ts.UnixNano()))
+	copy(buf[headerSize:], data)
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(buf[8:], castagnoliTable))
+
+	if _, err := q.writer.Write(buf); err != nil {
+		return fmt.Errorf("writing entry: %w", err)
+	}
+	if err := q.writer.Sync(); err != nil {
+		return fmt.Errorf("syncing entry: %w", err)
+	}
+	last.size += int64(len(buf))
+	last.entries++
+
+	if q.oldest.IsZero() {
+		q.oldest = ts
+	}
+
+	if err := q.enforceMaxBytes(); err != nil {
+		return err
+	}
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// rotate starts a new segment. mut must be held.
+func (q *Queue) rotate() error {
+	if err := q.writer.Close(); err != nil {
+		return fmt.Errorf("closing segment: %w", err)
+	}
+
+	next := q.segments[len(q.segments)-1].index + 1
+	f, err := os.OpenFile(q.segmentPath(next), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("creating segment: %w", err)
+	}
+	q.writer = f
+	q.segments = append(q.segments, &segment{index: next})
+	return nil
+}
+
+// enforceMaxBytes evicts the oldest entries until the queue is within
+// MaxBytes. mut must be held.
+func (q *Queue) enforceMaxBytes() error {
+	if q.opts.MaxBytes <= 0 || q.bytes() <= q.opts.MaxBytes {
+		return nil
+	}
+
+	for q.bytes() > q.opts.MaxBytes {
+		next, ok, err := q.skip(q.pos)
+		if err != nil {
+			return err
+		} else if !ok {
+			break
+		}
+		q.evictedMaxBytes++
+		if err := q.setPosition(next); err != nil {
+			return err
+		}
+	}
+	return q.writePosition()
+}
+
+// Peek returns up to max unread entries without removing them from the
+// queue. Entries older than MaxAge at the head of the queue are evicted.
+// Call Ack to remove returned entries.
+func (q *Queue) Peek(max int) ([]Entry, error) {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+
+	if q.closed {
+		return nil, ErrClosed
+	}
+
+	var (
+		entries []Entry
+		pos     = q.pos
+		evicted bool
+	)
+	for len(entries) < max {
+		e, ok, err := q.read(pos)
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			break
+		}
+
+		if len(entries) == 0 && q.expired(e.Timestamp) {
+			q.evictedMaxAge++
+			evicted = true
+			if err := q.setPosition(e.next); err != nil {
+				return nil, err
+			}
+			pos = e.next
+			continue
+		}
+
+		entries = append(entries, e)
+		pos = e.next
+	}
+
+	if evicted {
+		if err := q.writePosition(); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// Ack removes all entries up to and including e from the queue and persists
+// the new read position. e must have been returned by Peek.
+func (q *Queue) Ack(e Entry) error {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+
+	// Ignore stale acknowledgements for entries that were already evicted.
+	if e.next.Segment < q.pos.Segment || (e.next.Segment == q.pos.Segment && e.next.Offset <= q.pos.Offset) {
+		return nil
+	}
+	if err := q.setPosition(e.next); err != nil {
+		return err
+	}
+	return q.writePosition()
+}
+
+// Notify returns a channel which receives a value whenever new entries are
+// appended to the queue.
+func (q *Queue) Notify() <-chan struct{} { return q.notify }
+
+// Stats returns current statistics about the queue.
+func (q *Queue) Stats() Stats {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+
+	return Stats{
+		Bytes:           q.bytes(),
+		Entries:         q.entries(),
+		Oldest:          q.oldest,
+		EvictedMaxBytes: q.evictedMaxBytes,
+		EvictedMaxAge:   q.evictedMaxAge,
+	}
+}
+
+// SetOptions changes the limits of the queue. The segment size of an open
+// queue can't be changed, so opts.SegmentSize is ignored. The new MaxBytes is
+// enforced on the next append.
+func (q *Queue) SetOptions(opts Options) {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+
+	q.opts.MaxBytes = opts.MaxBytes
+	q.opts.MaxAge = opts.MaxAge
+}
+
+// Close closes the queue. Unread entries remain on disk and are replayed the
+// next time the queue is opened.
+func (q *Queue) Close() error {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	q.closeReader()
+	return q.writer.Close()
+}
+
+func (q *Queue) expired(ts time.Time) bool {
+	return q.opts.MaxAge > 0 && q.now().Sub(ts) > q.opts.MaxAge
+}
+
+// bytes returns the number of unread bytes. mut must be held.
+func (q *Queue) bytes() int64 {
+	var total int64
+	for _, seg := range q.segments {
+		total += seg.size
+	}
+	return total - q.pos.Offset
+}
+
+// entries returns the number of unread entries. mut must be held.
+func (q *Queue) entries() int {
+	var total int
+	for _, seg := range q.segments {
+		total += seg.entries
+	}
+	return total - q.pos.Consumed
+}
+
+// read reads the entry at pos, moving on to the next segment when the end of
+// a segment is reached. ok is false if there are no more entries. mut must
+// be held.
+func (q *Queue) read(pos position) (e Entry, ok bool, err error) {
+	for i, seg := range q.segments {
+		if seg.index < pos.Segment {
+			continue
+		}
+		offset, consumed := int64(0), 0
+		if seg.index == pos.Segment {
+			offset, consumed = pos.Offset, pos.Consumed
+		}
+		if offset >= seg.size {
+			continue
+		}
+
+		f, err := q.openReader(seg.index)
+		if err != nil {
+			return Entry{}, false, err
+		}
+		rec, n, err := readRecord(f, offset, q.recordLimit(seg.size-offset))
+		if err != nil {
+			return Entry{}, false, fmt.Errorf("reading segment %d at offset %d: %w", seg.index, offset, err)
+		}
+
+		rec.next = position{Segment: seg.index, Offset: offset + n, Consumed: consumed + 1}
+		// Move to the start of the next segment if this was the last entry, so
+		// that fully read segments can be removed.
+		if rec.next.Offset >= seg.size && i < len(q.segments)-1 {
+			rec.next = position{Segment: q.segments[i+1].index}
+		}
+		return rec, true, nil
+	}
+	return Entry{}, false, nil
+}
+
+// openReader returns a read handle to the segment with the given index,
+// reusing the handle from the previous read when possible. mut must be held.
+func (q *Queue) openReader(idx int) (*os.File, error) {
+	if q.reader != nil && q.readIdx == idx {
+		return q.reader, nil
+	}
+	q.closeReader()
+
+	f, err := os.Open(q.segmentPath(idx))
+	if err != nil {
+		return nil, fmt.Errorf("opening segment: %w", err)
+	}
+	q.reader, q.readIdx = f, idx
+	return f, nil
+}
+
+// closeReader closes the read handle, if any. mut must be held.
+func (q *Queue) closeReader() {
+	if q.reader != nil {
+		_ = q.reader.Close()
+		q.reader = nil
+	}
+}
+
+// recordLimit returns the maximum size on disk of a valid record, given the
+// number of bytes remaining in its segment. mut must be held.
+func (q *Queue) recordLimit(remaining int64) int64 {
+	if q.opts.MaxBytes > 0 && q.opts.MaxBytes+headerSize < remaining {
+		// Records larger than MaxBytes are evicted as soon as they're
+		// appended, so they never need to be read back.
+		return q.opts.MaxBytes + headerSize
+	}
+	return remaining
+}
+
+// skip returns the position after the entry at pos. mut must be held.
+func (q *Queue) skip(pos position) (position, bool, error) {
+	e, ok, err := q.read(pos)
+	return e.next, ok, err
+}
+
+// setPosition moves the read position, removing segments which have been
+// fully read. mut must be held.
+func (q *Queue) setPosition(pos position) error {
+	for len(q.segments) > 1 && q.segments[0].index < pos.Segment {
+		if q.reader != nil && q.readIdx == q.segments[0].index {
+			q.closeReader()
+		}
+		if err := os.Remove(q.segmentPath(q.segments[0].index)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing consumed segment: %w", err)
+		}
+		q.segments = q.segments[1:]
+	}
+	q.pos = pos
+	return q.refreshOldest()
+}
+
+// refreshOldest updates the cached timestamp of the entry at the read
+// position. mut must be held.
+func (q *Queue) refreshOldest() error {
+	e, ok, err := q.read(q.pos)
+	if err != nil {
+		return err
+	}
+	q.oldest = time.Time{}
+	if ok {
+		q.oldest = e.Timestamp
+	}
+	return nil
+}
+
+// writePosition atomically persists the read position and syncs it to disk.
+// mut must be held.
+func (q *Queue) writePosition() error {
+	bb, err := json.Marshal(q.pos)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(q.dir, positionFile)
+	tmp := path + ".tmp"
+	if err := writeFileSync(tmp, bb, 0o640); err != nil {
+		return fmt.Errorf("writing position: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("writing position: %w", err)
+	}
+	return nil
+}
+
+// writeFileSync is like os.WriteFile, but syncs the file before closing it.
+func writeFileSync(name string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (q *Queue) segmentPath(idx int) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%08d%s", idx, segmentSuffix))
+}
+
+// readRecord reads the record at offset in r and returns it along with its
+// size on disk. Records larger than limit bytes on disk are treated as
+// corrupted, so that a corrupted length never causes a large allocation.
+func readRecord(r io.ReaderAt, offset int64, limit int64) (Entry, int64, error) {
+	var header [headerSize]byte
+	if _, err := r.ReadAt(header[:], offset); err != nil {
+		return Entry{}, 0, err
+	}
+
+	var (
+		length = binary.BigEndian.Uint32(header[0:4])
+		sum    = binary.BigEndian.Uint32(header[4:8])
+		ts     = int64(binary.BigEndian.Uint64(header[8:16]))
+	)
+	if headerSize+int64(length) > limit {
+		return Entry{}, 0, fmt.Errorf("%w: length %d exceeds limit of %d bytes", errCorrupted, length, limit-headerSize)
+	}
+
+	data := make([]byte, length)
+	if _, err := r.ReadAt(data, offset+headerSize); err != nil {
+		return Entry{}, 0, err
+	}
+
+	crc := crc32.Update(crc32.Checksum(header[8:16], castagnoliTable), castagnoliTable, data)
+	if crc != sum {
+		return Entry{}, 0, fmt.Errorf("%w: checksum mismatch", errCorrupted)
+	}
+
+	return Entry{Timestamp: time.Unix(0, ts), Data: data}, headerSize + int64(length), nil
+}
+
+func readPosition(path string) (position, error) {
+	bb, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return position{}, nil
+	} else if err != nil {
+		return position{}, fmt.Errorf("reading position: %w", err)
+	}
+
+	var pos position
+	if err := json.Unmarshal(bb, &pos); err != nil {
+		// A corrupted position file is not fatal; replay all remaining data.
+		return position{}, nil
+	}
+	return pos, nil
+}
+
+func listSegments(dir string) ([]int, error) {
+	dirents, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("listing segments: %w", err)
+	}
+
+	var indices []int
+	for _, de := range dirents {
+		name := de.Name()
+		if de.IsDir() || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		idx, err := strconv.Atoi(strings.TrimSuffix(name, segmentSuffix))
+		if err != nil {
+			continue
+		}
+		indices = append(indices, idx)
+	}
+	sort.Ints(indices)
+	return indices, nil
+}
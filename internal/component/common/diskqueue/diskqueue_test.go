@@ -0,0 +1,190 @@
+package diskqueue
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueue_AppendPeekAck(t *testing.T) {
+	q, err := Open(t.TempDir(), Options{SegmentSize: 64})
+	require.NoError(t, err)
+	defer q.Close()
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, q.Append([]byte(fmt.Sprintf("entry-%d", i))))
+	}
+	require.Equal(t, 10, q.Stats().Entries)
+
+	entries, err := q.Peek(3)
+	require.NoError(t, err)
+	require.Equal(t, []string{"entry-0", "entry-1", "entry-2"}, entryData(entries))
+
+	// Peeking again without acknowledging returns the same entries.
+	entries, err = q.Peek(3)
+	require.NoError(t, err)
+	require.Equal(t, []string{"entry-0", "entry-1", "entry-2"}, entryData(entries))
+
+	require.NoError(t, q.Ack(entries[len(entries)-1]))
+	require.Equal(t, 7, q.Stats().Entries)
+
+	entries, err = q.Peek(100)
+	require.NoError(t, err)
+	require.Len(t, entries, 7)
+	require.Equal(t, "entry-3", string(entries[0].Data))
+
+	require.NoError(t, q.Ack(entries[len(entries)-1]))
+	stats := q.Stats()
+	require.Equal(t, 0, stats.Entries)
+	require.Equal(t, int64(0), stats.Bytes)
+	require.True(t, stats.Oldest.IsZero())
+}
+
+func TestQueue_Replay(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := Open(dir, Options{SegmentSize: 64})
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, q.Append([]byte(fmt.Sprintf("entry-%d", i))))
+	}
+	entries, err := q.Peek(4)
+	require.NoError(t, err)
+	require.NoError(t, q.Ack(entries[len(entries)-1]))
+	require.NoError(t, q.Close())
+
+	q, err = Open(dir, Options{SegmentSize: 64})
+	require.NoError(t, err)
+	defer q.Close()
+
+	require.Equal(t, 6, q.Stats().Entries)
+	entries, err = q.Peek(100)
+	require.NoError(t, err)
+	require.Equal(t, []string{"entry-4", "entry-5", "entry-6", "entry-7", "entry-8", "entry-9"}, entryData(entries))
+
+	// Fully read segments are removed from disk.
+	segments, err := listSegments(dir)
+	require.NoError(t, err)
+	require.NotContains(t, segments, 1)
+}
+
+func TestQueue_TruncatesTornWrites(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := Open(dir, Options{})
+	require.NoError(t, err)
+	require.NoError(t, q.Append([]byte("complete")))
+	require.NoError(t, q.Close())
+
+	// Simulate a crash in the middle of writing a record.
+	f, err := os.OpenFile(filepath.Join(dir, "00000001.seg"), os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0, 0, 0, 42, 1, 2})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	q, err = Open(dir, Options{})
+	require.NoError(t, err)
+	defer q.Close()
+
+	require.NoError(t, q.Append([]byte("after restart")))
+	entries, err := q.Peek(10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"complete", "after restart"}, entryData(entries))
+}
+
+func TestQueue_TruncatesCorruptedLength(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := Open(dir, Options{})
+	require.NoError(t, err)
+	require.NoError(t, q.Append([]byte("complete")))
+	require.NoError(t, q.Close())
+
+	// Write a full header whose length is far larger than the segment.
+	f, err := os.OpenFile(filepath.Join(dir, "00000001.seg"), os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0xff, 0xff, 0xff, 0xf0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	q, err = Open(dir, Options{})
+	require.NoError(t, err)
+	defer q.Close()
+
+	entries, err := q.Peek(10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"complete"}, entryData(entries))
+	require.Equal(t, int64(headerSize+len("complete")), q.Stats().Bytes)
+}
+
+func TestQueue_MaxBytes(t *testing.T) {
+	q, err := Open(t.TempDir(), Options{SegmentSize: 64, MaxBytes: 3 * (headerSize + 7)})
+	require.NoError(t, err)
+	defer q.Close()
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, q.Append([]byte(fmt.Sprintf("entry-%d", i))))
+	}
+
+	stats := q.Stats()
+	require.Equal(t, 3, stats.Entries)
+	require.Equal(t, uint64(7), stats.EvictedMaxBytes)
+
+	entries, err := q.Peek(10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"entry-7", "entry-8", "entry-9"}, entryData(entries))
+
+	// An entry larger than MaxBytes is evicted without evicting the queued
+	// entries.
+	require.NoError(t, q.Append(make([]byte, 3*(headerSize+7))))
+	stats = q.Stats()
+	require.Equal(t, 3, stats.Entries)
+	require.Equal(t, uint64(8), stats.EvictedMaxBytes)
+}
+
+func TestQueue_MaxAge(t *testing.T) {
+	q, err := Open(t.TempDir(), Options{MaxAge: time.Hour})
+	require.NoError(t, err)
+	defer q.Close()
+
+	now := time.Now()
+	require.NoError(t, q.AppendAt(now.Add(-2*time.Hour), []byte("old-1")))
+	require.NoError(t, q.AppendAt(now.Add(-90*time.Minute), []byte("old-2")))
+	require.NoError(t, q.AppendAt(now.Add(-time.Minute), []byte("new")))
+	require.Equal(t, now.Add(-2*time.Hour).UnixNano(), q.Stats().Oldest.UnixNano())
+
+	entries, err := q.Peek(10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"new"}, entryData(entries))
+
+	stats := q.Stats()
+	require.Equal(t, uint64(2), stats.EvictedMaxAge)
+	require.Equal(t, 1, stats.Entries)
+	require.Equal(t, now.Add(-time.Minute).UnixNano(), stats.Oldest.UnixNano())
+}
+
+func TestQueue_Notify(t *testing.T) {
+	q, err := Open(t.TempDir(), Options{})
+	require.NoError(t, err)
+	defer q.Close()
+
+	require.NoError(t, q.Append([]byte("entry")))
+	select {
+	case <-q.Notify():
+	case <-time.After(time.Second):
+		require.FailNow(t, "expected notification")
+	}
+}
+
+func entryData(entries []Entry) []string {
+	res := make([]string, 0, len(entries))
+	for _, e := range entries {
+		res = append(res, string(e.Data))
+	}
+	return res
+}
@@ -0,0 +1,213 @@
+package diskqueue
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Sender sends the entries of the queue of an endpoint.
+type Sender interface {
+	// Start starts sending entries in the background.
+	Start()
+	// Stop stops sending entries and waits for the sender to exit. Stop
+	// doesn't close the queue.
+	Stop()
+}
+
+// EndpointConfig configures an endpoint managed by Endpoints.
+type EndpointConfig[C any] struct {
+	// Name is the name of the queue of the endpoint, as returned by Name.
+	Name string
+	// Options configures the queue of the endpoint.
+	Options Options
+	// Config is the configuration of the sender of the endpoint. The sender
+	// is only rebuilt when Config changes.
+	Config C
+}
+
+// Endpoint is an endpoint managed by Endpoints.
+type Endpoint[C any, S Sender] struct {
+	Name   string
+	Config C
+	Queue  *Queue
+	Sender S
+}
+
+// Endpoints manages the queues and senders of the endpoints of a component.
+// Each queue is stored in a subdirectory of the data directory named after
+// its endpoint, and is kept open while the endpoint exists, even if its
+// sender is rebuilt.
+type Endpoints[C any, S Sender] struct {
+	dir       string
+	newSender func(name string, cfg C, q *Queue) (S, error)
+
+	mut       sync.RWMutex
+	endpoints map[string]*Endpoint[C, S] // Queue name -> endpoint
+}
+
+// NewEndpoints returns an Endpoints storing its queues in dir. newSender
+// builds the sender for an endpoint; it must not start sending.
+func NewEndpoints[C any, S Sender](dir string, newSender func(name string, cfg C, q *Queue) (S, error)) *Endpoints[C, S] {
+	return &Endpoints[C, S]{
+		dir:       dir,
+		newSender: newSender,
+		endpoints: make(map[string]*Endpoint[C, S]),
+	}
+}
+
+// Update is a set of endpoints built by Endpoints.Prepare which hasn't been
+// applied yet. Exactly one of Commit or Abort must be called.
+type Update[C any, S Sender] struct {
+	e         *Endpoints[C, S]
+	endpoints map[string]*Endpoint[C, S]
+	opened    []*Queue           // Queues opened for new endpoints.
+	built     []*Endpoint[C, S]  // Endpoints with a new sender.
+	options   map[*Queue]Options // Options of reused queues.
+}
+
+// Prepare opens the queues of new endpoints and builds the senders of new
+// and changed endpoints without touching the running ones, so that a failure
+// leaves the current endpoints as they are. Prepare must not be called again
+// until the returned Update is committed or aborted.
+func (e *Endpoints[C, S]) Prepare(configs []EndpointConfig[C]) (*Update[C, S], error) {
+	names := make(map[string]struct{}, len(configs))
+	for _, cfg := range configs {
+		if _, dup := names[cfg.Name]; dup {
+			return nil, fmt.Errorf("multiple endpoints with a disk_queue use the name %q; set a unique name for each endpoint", cfg.Name)
+		}
+		names[cfg.Name] = struct{}{}
+	}
+
+	e.mut.RLock()
+	current := e.endpoints
+	e.mut.RUnlock()
+
+	u := &Update[C, S]{
+		e:         e,
+		endpoints: make(map[string]*Endpoint[C, S], len(configs)),
+		options:   make(map[*Queue]Options),
+	}
+	for _, cfg := range configs {
+		existing, ok := current[cfg.Name]
+		if ok && reflect.DeepEqual(existing.Config, cfg.Config) {
+			u.endpoints[cfg.Name] = existing
+			u.options[existing.Queue] = cfg.Options
+			continue
+		}
+
+		var q *Queue
+		if ok {
+			// The sender changed; reuse the open queue, which the running
+			// sender keeps reading from until the update is committed.
+			q = existing.Queue
+			u.options[q] = cfg.Options
+		} else {
+			var err error
+			q, err = Open(filepath.Join(e.dir, cfg.Name), cfg.Options)
+			if err != nil {
+				u.Abort()
+				return nil, fmt.Errorf("opening disk queue for endpoint %q: %w", cfg.Name, err)
+			}
+			u.opened = append(u.opened, q)
+		}
+
+		sender, err := e.newSender(cfg.Name, cfg.Config, q)
+		if err != nil {
+			u.Abort()
+			return nil, fmt.Errorf("creating disk queue sender for endpoint %q: %w", cfg.Name, err)
+		}
+		ep := &Endpoint[C, S]{Name: cfg.Name, Config: cfg.Config, Queue: q, Sender: sender}
+		u.endpoints[cfg.Name] = ep
+		u.built = append(u.built, ep)
+	}
+	return u, nil
+}
+
+// Commit replaces the current endpoints with the prepared ones. Senders of
+// changed and removed endpoints are stopped, queues of removed endpoints are
+// closed, and the new senders are started. Queued entries of removed
+// endpoints are kept on disk and resumed if the endpoint is added back.
+func (u *Update[C, S]) Commit() error {
+	u.e.mut.Lock()
+	old := u.e.endpoints
+	u.e.endpoints = u.endpoints
+	u.e.mut.Unlock()
+
+	var errs []error
+	for name, ep := range old {
+		if next, ok := u.endpoints[name]; ok && next == ep {
+			continue
+		}
+		ep.Sender.Stop()
+		if _, ok := u.endpoints[name]; !ok {
+			if err := ep.Queue.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("closing disk queue for endpoint %q: %w", name, err))
+			}
+		}
+	}
+	for q, opts := range u.options {
+		q.SetOptions(opts)
+	}
+	for _, ep := range u.built {
+		ep.Sender.Start()
+	}
+	return errors.Join(errs...)
+}
+
+// Abort discards the prepared endpoints, closing the queues opened for new
+// endpoints. The current endpoints are left as they are.
+func (u *Update[C, S]) Abort() {
+	for _, q := range u.opened {
+		_ = q.Close()
+	}
+}
+
+// Range calls f for every endpoint. Endpoints must not be updated from f.
+func (e *Endpoints[C, S]) Range(f func(ep *Endpoint[C, S])) {
+	e.mut.RLock()
+	defer e.mut.RUnlock()
+	for _, ep := range e.endpoints {
+		f(ep)
+	}
+}
+
+// Len returns the number of endpoints.
+func (e *Endpoints[C, S]) Len() int {
+	e.mut.RLock()
+	defer e.mut.RUnlock()
+	return len(e.endpoints)
+}
+
+// Stats returns the stats of the queue of every endpoint, ordered by name.
+func (e *Endpoints[C, S]) Stats() []EndpointStats {
+	e.mut.RLock()
+	defer e.mut.RUnlock()
+
+	res := make([]EndpointStats, 0, len(e.endpoints))
+	for name, ep := range e.endpoints {
+		res = append(res, EndpointStats{Endpoint: name, Stats: ep.Queue.Stats()})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Endpoint < res[j].Endpoint })
+	return res
+}
+
+// Close stops all senders and closes their queues.
+func (e *Endpoints[C, S]) Close() error {
+	e.mut.Lock()
+	old := e.endpoints
+	e.endpoints = make(map[string]*Endpoint[C, S])
+	e.mut.Unlock()
+
+	var errs []error
+	for name, ep := range old {
+		ep.Sender.Stop()
+		if err := ep.Queue.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("closing disk queue for endpoint %q: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
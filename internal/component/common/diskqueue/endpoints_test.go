@@ -0,0 +1,86 @@
+package diskqueue
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSender struct {
+	config  string
+	queue   *Queue
+	running bool
+}
+
+func (s *fakeSender) Start() { s.running = true }
+func (s *fakeSender) Stop()  { s.running = false }
+
+func newFakeEndpoints(t *testing.T) *Endpoints[string, *fakeSender] {
+	return NewEndpoints(t.TempDir(), func(_ string, cfg string, q *Queue) (*fakeSender, error) {
+		if cfg == "invalid" {
+			return nil, errors.New("invalid config")
+		}
+		return &fakeSender{config: cfg, queue: q}, nil
+	})
+}
+
+func currentSenders(e *Endpoints[string, *fakeSender]) map[string]*fakeSender {
+	res := make(map[string]*fakeSender)
+	e.Range(func(ep *Endpoint[string, *fakeSender]) {
+		res[ep.Name] = ep.Sender
+	})
+	return res
+}
+
+func TestEndpoints_Update(t *testing.T) {
+	e := newFakeEndpoints(t)
+	defer e.Close()
+
+	u, err := e.Prepare([]EndpointConfig[string]{{Name: "a", Config: "1"}, {Name: "b", Config: "1"}})
+	require.NoError(t, err)
+	require.Zero(t, e.Len(), "endpoints are only applied on commit")
+	require.NoError(t, u.Commit())
+
+	before := currentSenders(e)
+	require.True(t, before["a"].running)
+	require.True(t, before["b"].running)
+
+	// Rebuild the sender of a, keep b, and add c.
+	u, err = e.Prepare([]EndpointConfig[string]{{Name: "a", Config: "2"}, {Name: "b", Config: "1"}, {Name: "c", Config: "1"}})
+	require.NoError(t, err)
+	require.True(t, before["a"].running, "running senders are only stopped on commit")
+	require.NoError(t, u.Commit())
+
+	after := currentSenders(e)
+	require.False(t, before["a"].running)
+	require.True(t, after["a"].running)
+	require.Same(t, before["a"].queue, after["a"].queue, "the queue is kept open for the new sender")
+	require.Same(t, before["b"], after["b"])
+	require.True(t, after["c"].running)
+
+	// Remove c.
+	u, err = e.Prepare([]EndpointConfig[string]{{Name: "a", Config: "2"}, {Name: "b", Config: "1"}})
+	require.NoError(t, err)
+	require.NoError(t, u.Commit())
+	require.False(t, after["c"].running)
+	require.ErrorIs(t, after["c"].queue.Append(nil), ErrClosed)
+}
+
+func TestEndpoints_PrepareError(t *testing.T) {
+	e := newFakeEndpoints(t)
+	defer e.Close()
+
+	u, err := e.Prepare([]EndpointConfig[string]{{Name: "a", Config: "1"}})
+	require.NoError(t, err)
+	require.NoError(t, u.Commit())
+	before := currentSenders(e)
+
+	_, err = e.Prepare([]EndpointConfig[string]{{Name: "a", Config: "2"}, {Name: "b", Config: "invalid"}})
+	require.Error(t, err)
+	require.Equal(t, before, currentSenders(e))
+	require.True(t, before["a"].running)
+
+	_, err = e.Prepare([]EndpointConfig[string]{{Name: "a", Config: "1"}, {Name: "a", Config: "2"}})
+	require.ErrorContains(t, err, `multiple endpoints with a disk_queue use the name "a"`)
+}
@@ -1,6 +1,8 @@
 package client
 
 import (
+	"bytes"
+	"compress/gzip"
 	"fmt"
 	"strconv"
 	"strings"
@@ -9,6 +11,9 @@ import (
 	"github.com/gogo/protobuf/proto"
 	"github.com/golang/snappy"
 	"github.com/prometheus/common/model"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
 	"golang.org/x/exp/slices"
 
 	"github.com/grafana/agent/internal/component/common/loki"
@@ -31,6 +36,8 @@ type SentDataMarkerHandler interface {
 // streams for each tenant are stored in a dedicated batch.
 type batch struct {
 	streams map[string]*logproto.Stream
+	// labels holds the label set of each stream, keyed the same way as streams.
+	labels map[string]model.LabelSet
 	// totalBytes holds the total amounts of bytes, across the log lines in this batch.
 	totalBytes int
 	createdAt  time.Time
@@ -44,6 +51,7 @@ type batch struct {
 func newBatch(maxStreams int, entries ...loki.Entry) *batch {
 	b := &batch{
 		streams:        map[string]*logproto.Stream{},
+		labels:         map[string]model.LabelSet{},
 		totalBytes:     0,
 		createdAt:      time.Now(),
 		maxStreams:     maxStreams,
@@ -79,6 +87,7 @@ func (b *batch) add(entry loki.Entry) error {
 		Labels:  labels,
 		Entries: []logproto.Entry{entry.Entry},
 	}
+	b.labels[labels] = entry.Labels.Clone()
 	return nil
 }
 
@@ -105,6 +114,7 @@ func (b *batch) addFromWAL(lbs model.LabelSet, entry logproto.Entry, segmentNum
 		Labels:  labels,
 		Entries: []logproto.Entry{entry},
 	}
+	b.labels[labels] = lbs.Clone()
 	b.countForSegment(segmentNum)
 
 	return nil
@@ -171,6 +181,63 @@ func (b *batch) encode() ([]byte, int, error) {
 	return buf, entriesCount, nil
 }
 
+// encodeOTLP encodes the batch as a gzip-compressed OTLP logs export request,
+// and returns the encoded bytes and the number of encoded entries. Each stream
+// becomes a resource whose attributes are the labels of the stream, and the
+// structured metadata of each entry becomes the attributes of its log record.
+func (b *batch) encodeOTLP() ([]byte, int, error) {
+	var (
+		logs         = plog.NewLogs()
+		entriesCount int
+		observed     = pcommon.NewTimestampFromTime(time.Now())
+	)
+	for key, stream := range b.streams {
+		rl := logs.ResourceLogs().AppendEmpty()
+		for name, value := range b.labels[key] {
+			if name == ReservedLabelTenantID {
+				continue
+			}
+			rl.Resource().Attributes().PutStr(string(name), string(value))
+		}
+
+		records := rl.ScopeLogs().AppendEmpty().LogRecords()
+		records.EnsureCapacity(len(stream.Entries))
+		for _, entry := range stream.Entries {
+			lr := records.AppendEmpty()
+			lr.SetTimestamp(pcommon.NewTimestampFromTime(entry.Timestamp))
+			lr.SetObservedTimestamp(observed)
+			lr.Body().SetStr(entry.Line)
+			for _, md := range entry.StructuredMetadata {
+				lr.Attributes().PutStr(md.Name, md.Value)
+			}
+		}
+		entriesCount += len(stream.Entries)
+	}
+
+	raw, err := plogotlp.NewExportRequestFromLogs(logs).MarshalProto()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write(raw); err != nil {
+		return nil, 0, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, 0, err
+	}
+	return buf.Bytes(), entriesCount, nil
+}
+
+// encodeBatch encodes a batch in the given format.
+func encodeBatch(b *batch, format string) ([]byte, int, error) {
+	if format == FormatOTLP {
+		return b.encodeOTLP()
+	}
+	return b.encode()
+}
+
 // creates push request and returns it, together with number of entries
 func (b *batch) createPushRequest() (*logproto.PushRequest, int) {
 	req := logproto.PushRequest{
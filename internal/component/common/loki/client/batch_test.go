@@ -1,16 +1,21 @@
 package client
 
 import (
+	"bytes"
+	"compress/gzip"
 	"fmt"
+	"io"
 	"testing"
 	"time"
 
 	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
 
 	"github.com/grafana/agent/internal/component/common/loki"
 	"github.com/grafana/loki/pkg/logproto"
+	"github.com/grafana/loki/pkg/push"
 )
 
 func TestBatch_MaxStreams(t *testing.T) {
@@ -134,6 +139,42 @@ func TestBatch_encode(t *testing.T) {
 	}
 }
 
+func TestBatch_encodeOTLP(t *testing.T) {
+	b := newBatch(0,
+		loki.Entry{Labels: model.LabelSet{"type": "a", ReservedLabelTenantID: "tenant"}, Entry: logproto.Entry{
+			Timestamp: time.Unix(1, 0).UTC(),
+			Line:      "line1",
+			StructuredMetadata: push.LabelsAdapter{
+				{Name: "trace_id", Value: "123"},
+			},
+		}},
+		loki.Entry{Labels: model.LabelSet{"type": "a", ReservedLabelTenantID: "tenant"}, Entry: logproto.Entry{Timestamp: time.Unix(2, 0).UTC(), Line: "line2"}},
+	)
+
+	buf, entriesCount, err := b.encodeOTLP()
+	require.NoError(t, err)
+	require.Equal(t, 2, entriesCount)
+
+	gr, err := gzip.NewReader(bytes.NewReader(buf))
+	require.NoError(t, err)
+	raw, err := io.ReadAll(gr)
+	require.NoError(t, err)
+
+	req := plogotlp.NewExportRequest()
+	require.NoError(t, req.UnmarshalProto(raw))
+	logs := req.Logs()
+	require.Equal(t, 1, logs.ResourceLogs().Len())
+	require.Equal(t, map[string]any{"type": "a"}, logs.ResourceLogs().At(0).Resource().Attributes().AsRaw())
+
+	records := logs.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords()
+	require.Equal(t, 2, records.Len())
+	require.Equal(t, "line1", records.At(0).Body().Str())
+	require.Equal(t, time.Unix(1, 0).UTC(), records.At(0).Timestamp().AsTime())
+	require.Equal(t, map[string]any{"trace_id": "123"}, records.At(0).Attributes().AsRaw())
+	require.Equal(t, "line2", records.At(1).Body().Str())
+	require.Equal(t, 0, records.At(1).Attributes().Len())
+}
+
 func TestHashCollisions(t *testing.T) {
 	b := newBatch(0)
 
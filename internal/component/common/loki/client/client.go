@@ -159,6 +159,9 @@ type client struct {
 	maxStreams          int
 	maxLineSize         int
 	maxLineSizeTruncate bool
+
+	// dq is set if the disk queue is enabled.
+	dq *diskQueue
 }
 
 // Tripperware can wrap a roundtripper.
@@ -209,6 +212,14 @@ func newClient(metrics *Metrics, cfg Config, maxStreams, maxLineSize int, maxLin
 
 	c.client.Timeout = cfg.Timeout
 
+	if cfg.DiskQueue.Enabled {
+		c.dq, err = openDiskQueue(cfg.DiskQueue)
+		if err != nil {
+			return nil, fmt.Errorf("opening disk queue: %w", err)
+		}
+		go c.runDiskQueue()
+	}
+
 	// Initialize counters to 0 so the metrics are exported before the first
 	// occurrence of incrementing to avoid missing metrics.
 	for _, counter := range c.metrics.countersWithHost {
@@ -269,7 +280,7 @@ func (c *client) run() {
 		maxWaitCheck.Stop()
 		// Send all pending batches
 		for tenantID, batch := range batches {
-			c.sendBatch(tenantID, batch)
+			c.flushBatch(tenantID, batch)
 		}
 
 		c.wg.Done()
@@ -309,7 +320,7 @@ func (c *client) run() {
 			// If adding the entry to the batch will increase the size over the max
 			// size allowed, we do send the current batch and then create a new one
 			if batch.sizeBytesAfter(e.Entry) > c.cfg.BatchSize {
-				c.sendBatch(tenantID, batch)
+				c.flushBatch(tenantID, batch)
 
 				batches[tenantID] = newBatch(c.maxStreams, e)
 				break
@@ -334,7 +345,7 @@ func (c *client) run() {
 					continue
 				}
 
-				c.sendBatch(tenantID, batch)
+				c.flushBatch(tenantID, batch)
 				delete(batches, tenantID)
 			}
 		}
@@ -349,8 +360,17 @@ func batchIsRateLimited(status int) bool {
 	return status == 429
 }
 
+// flushBatch sends a batch, or writes it to the disk queue if enabled.
+func (c *client) flushBatch(tenantID string, batch *batch) {
+	if c.dq != nil {
+		c.enqueueBatch(tenantID, batch)
+		return
+	}
+	c.sendBatch(tenantID, batch)
+}
+
 func (c *client) sendBatch(tenantID string, batch *batch) {
-	buf, entriesCount, err := batch.encode()
+	buf, entriesCount, err := encodeBatch(batch, c.cfg.Format)
 	if err != nil {
 		level.Error(c.logger).Log("msg", "error encoding batch", "error", err)
 		return
@@ -363,7 +383,7 @@ func (c *client) sendBatch(tenantID string, batch *batch) {
 	for {
 		start := time.Now()
 		// send uses `timeout` internally, so `context.Background` is good enough.
-		status, err = c.send(context.Background(), tenantID, buf)
+		status, err = c.send(context.Background(), tenantID, c.cfg.Format, buf)
 
 		c.metrics.requestDuration.WithLabelValues(strconv.Itoa(status), c.cfg.URL.Host).Observe(time.Since(start).Seconds())
 
@@ -410,7 +430,7 @@ func (c *client) sendBatch(tenantID string, batch *batch) {
 	}
 }
 
-func (c *client) send(ctx context.Context, tenantID string, buf []byte) (int, error) {
+func (c *client) send(ctx context.Context, tenantID, format string, buf []byte) (int, error) {
 	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
 	defer cancel()
 	req, err := http.NewRequestWithContext(ctx, "POST", c.cfg.URL.String(), bytes.NewReader(buf))
@@ -418,6 +438,9 @@ func (c *client) send(ctx context.Context, tenantID string, buf []byte) (int, er
 		return -1, err
 	}
 	req.Header.Set("Content-Type", contentType)
+	if format == FormatOTLP {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
 	req.Header.Set("User-Agent", userAgent)
 
 	// If the tenant ID is not empty promtail is running in multi-tenant mode, so
@@ -474,6 +497,12 @@ func (c *client) getTenantID(labels model.LabelSet) string {
 func (c *client) Stop() {
 	c.once.Do(func() { close(c.entries) })
 	c.wg.Wait()
+
+	// Pending batches have been written to the disk queue, which stops the
+	// sender without waiting for the queue to be drained.
+	if c.dq != nil {
+		c.dq.stop(c.cancel, c.logger)
+	}
 }
 
 // StopNow stops the client without retries
@@ -21,6 +21,15 @@ const (
 	Timeout        = 10 * time.Second
 )
 
+// Formats in which batches can be sent.
+const (
+	// FormatLoki sends batches as snappy-compressed Loki push requests.
+	FormatLoki = "loki"
+	// FormatOTLP sends batches as gzip-compressed OTLP/HTTP logs export
+	// requests.
+	FormatOTLP = "otlp"
+)
+
 // Config describes configuration for an HTTP pusher client.
 type Config struct {
 	Name      string `yaml:"name,omitempty"`
@@ -45,8 +54,36 @@ type Config struct {
 	// prevent HOL blocking in multitenant deployments.
 	DropRateLimitedBatches bool `yaml:"drop_rate_limited_batches"`
 
+	// Format is the format batches are sent in. An empty format means
+	// FormatLoki.
+	Format string
+
 	// Queue controls configuration parameters specific to the queue client
 	Queue QueueConfig
+
+	// DiskQueue controls the persistent on-disk queue batches are buffered in
+	// before being sent.
+	DiskQueue DiskQueueConfig
+}
+
+// DiskQueueConfig holds configurations for the persistent on-disk queue of a
+// client. When enabled, batches are written to the queue once full, and sent
+// from it in order. Batches which fail to be sent with a recoverable error are
+// retried until they succeed or are evicted from the queue.
+type DiskQueueConfig struct {
+	Enabled bool
+
+	// Dir is the directory holding the queue and the position of the client
+	// in it. Each client must use its own directory.
+	Dir string
+
+	// MaxSize is the maximum size in bytes of unsent data in the queue. The
+	// oldest batches are evicted once it's exceeded. 0 means no limit.
+	MaxSize int64
+
+	// MaxAge is the maximum age of unsent batches. Older batches are evicted.
+	// 0 means no limit.
+	MaxAge time.Duration
 }
 
 // QueueConfig holds configurations for the queue-based remote-write client.
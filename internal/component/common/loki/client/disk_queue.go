@@ -0,0 +1,243 @@
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/internal/component/common/diskqueue"
+	"github.com/grafana/agent/internal/flow/logging/level"
+	"github.com/grafana/dskit/backoff"
+	"go.uber.org/atomic"
+)
+
+// diskQueue holds the state of a client which buffers batches on disk.
+type diskQueue struct {
+	queue *diskqueue.Queue
+	done  chan struct{}
+	once  sync.Once
+
+	sentEntries    atomic.Uint64
+	droppedEntries atomic.Uint64
+	lastError      atomic.String
+}
+
+func openDiskQueue(cfg DiskQueueConfig) (*diskQueue, error) {
+	queue, err := diskqueue.Open(cfg.Dir, diskqueue.Options{
+		MaxBytes: cfg.MaxSize,
+		MaxAge:   cfg.MaxAge,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &diskQueue{
+		queue: queue,
+		done:  make(chan struct{}),
+	}, nil
+}
+
+// stop cancels the sender, waits for it to exit and closes the queue.
+func (dq *diskQueue) stop(cancel context.CancelFunc, logger log.Logger) {
+	dq.once.Do(func() {
+		cancel()
+		<-dq.done
+		if err := dq.queue.Close(); err != nil {
+			level.Warn(logger).Log("msg", "failed to close disk queue", "err", err)
+		}
+	})
+}
+
+// enqueueBatch encodes a batch and writes it to the disk queue.
+func (c *client) enqueueBatch(tenantID string, batch *batch) {
+	buf, entriesCount, err := encodeBatch(batch, c.cfg.Format)
+	if err != nil {
+		level.Error(c.logger).Log("msg", "error encoding batch", "error", err)
+		return
+	}
+	c.metrics.encodedBytes.WithLabelValues(c.cfg.URL.Host).Add(float64(len(buf)))
+
+	entry := encodeDiskQueueEntry(diskQueueBatch{
+		TenantID:     tenantID,
+		Format:       c.cfg.Format,
+		EntriesCount: entriesCount,
+		Buf:          buf,
+	})
+	if err := c.dq.queue.Append(entry); err != nil {
+		level.Error(c.logger).Log("msg", "failed to write batch to disk queue", "tenant", tenantID, "error", err)
+		c.metrics.droppedBytes.WithLabelValues(c.cfg.URL.Host, tenantID, ReasonGeneric).Add(float64(len(buf)))
+		c.metrics.droppedEntries.WithLabelValues(c.cfg.URL.Host, tenantID, ReasonGeneric).Add(float64(entriesCount))
+		c.dq.droppedEntries.Add(uint64(entriesCount))
+	}
+}
+
+// runDiskQueue sends the batches in the disk queue in order until the client
+// is stopped. A batch is only removed from the queue once it has been sent,
+// or failed with an error that can't be retried. Retries aren't limited by
+// the max retries of the backoff config, since the queue is bounded by its own
+// size and age limits instead.
+func (c *client) runDiskQueue() {
+	defer close(c.dq.done)
+
+	bo := backoff.New(c.ctx, backoff.Config{
+		MinBackoff: c.cfg.BackoffConfig.MinBackoff,
+		MaxBackoff: c.cfg.BackoffConfig.MaxBackoff,
+	})
+
+	for c.ctx.Err() == nil {
+		entries, err := c.dq.queue.Peek(1)
+		if err != nil {
+			level.Error(c.logger).Log("msg", "failed to read from disk queue", "error", err)
+			bo.Wait()
+			continue
+		}
+		if len(entries) == 0 {
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-c.dq.queue.Notify():
+			}
+			continue
+		}
+
+		entry := entries[0]
+		b, err := decodeDiskQueueEntry(entry.Data)
+		if err != nil {
+			level.Error(c.logger).Log("msg", "dropping corrupted disk queue entry", "error", err)
+			c.ackDiskQueue(entry)
+			continue
+		}
+		tenantID, entriesCount := b.TenantID, b.EntriesCount
+		bufBytes := float64(len(b.Buf))
+
+		start := time.Now()
+		status, err := c.send(c.ctx, tenantID, b.Format, b.Buf)
+		c.metrics.requestDuration.WithLabelValues(strconv.Itoa(status), c.cfg.URL.Host).Observe(time.Since(start).Seconds())
+
+		switch {
+		case err == nil:
+			c.metrics.sentBytes.WithLabelValues(c.cfg.URL.Host).Add(bufBytes)
+			c.metrics.sentEntries.WithLabelValues(c.cfg.URL.Host).Add(float64(entriesCount))
+			c.dq.sentEntries.Add(uint64(entriesCount))
+			c.dq.lastError.Store("")
+			c.ackDiskQueue(entry)
+			bo.Reset()
+
+		case c.ctx.Err() != nil:
+			// The request was canceled because the client is stopping. The batch
+			// stays in the queue and is sent once the client is started again.
+			return
+
+		case c.cfg.DropRateLimitedBatches && batchIsRateLimited(status),
+			status > 0 && !batchIsRateLimited(status) && status/100 != 5:
+			// Only 429s, 500s and connection-level errors are retried.
+			dropReason := ReasonGeneric
+			if batchIsRateLimited(status) {
+				dropReason = ReasonRateLimited
+			}
+			level.Error(c.logger).Log("msg", "dropping batch from disk queue", "status", status, "tenant", tenantID, "error", err)
+			c.metrics.droppedBytes.WithLabelValues(c.cfg.URL.Host, tenantID, dropReason).Add(bufBytes)
+			c.metrics.droppedEntries.WithLabelValues(c.cfg.URL.Host, tenantID, dropReason).Add(float64(entriesCount))
+			c.dq.droppedEntries.Add(uint64(entriesCount))
+			c.dq.lastError.Store(err.Error())
+			c.ackDiskQueue(entry)
+
+		default:
+			level.Warn(c.logger).Log("msg", "error sending batch from disk queue, will retry", "status", status, "tenant", tenantID, "error", err)
+			c.metrics.batchRetries.WithLabelValues(c.cfg.URL.Host, tenantID).Inc()
+			c.dq.lastError.Store(err.Error())
+			bo.Wait()
+		}
+	}
+}
+
+func (c *client) ackDiskQueue(e diskqueue.Entry) {
+	if err := c.dq.queue.Ack(e); err != nil {
+		level.Error(c.logger).Log("msg", "failed to update disk queue position", "error", err)
+	}
+}
+
+// diskQueueBatch is an encoded batch stored in the disk queue. The format is
+// stored with the batch, since the format of the endpoint may change before
+// the batch is sent.
+type diskQueueBatch struct {
+	TenantID     string
+	Format       string
+	EntriesCount int
+	Buf          []byte
+}
+
+// encodeDiskQueueEntry encodes b as a single disk queue entry.
+func encodeDiskQueueEntry(b diskQueueBatch) []byte {
+	data := make([]byte, 0, 3*binary.MaxVarintLen64+len(b.TenantID)+len(b.Format)+len(b.Buf))
+	data = binary.AppendUvarint(data, uint64(len(b.TenantID)))
+	data = append(data, b.TenantID...)
+	data = binary.AppendUvarint(data, uint64(len(b.Format)))
+	data = append(data, b.Format...)
+	data = binary.AppendUvarint(data, uint64(b.EntriesCount))
+	return append(data, b.Buf...)
+}
+
+var errCorruptedDiskQueueEntry = errors.New("corrupted disk queue entry")
+
+// decodeDiskQueueEntry decodes an entry written by encodeDiskQueueEntry.
+func decodeDiskQueueEntry(data []byte) (diskQueueBatch, error) {
+	var (
+		b   diskQueueBatch
+		err error
+	)
+	if b.TenantID, data, err = decodeDiskQueueString(data); err != nil {
+		return diskQueueBatch{}, err
+	}
+	if b.Format, data, err = decodeDiskQueueString(data); err != nil {
+		return diskQueueBatch{}, err
+	}
+
+	count, n := binary.Uvarint(data)
+	if n <= 0 {
+		return diskQueueBatch{}, errCorruptedDiskQueueEntry
+	}
+	b.EntriesCount, b.Buf = int(count), data[n:]
+	return b, nil
+}
+
+// decodeDiskQueueString decodes a length-prefixed string from data and
+// returns the remaining data.
+func decodeDiskQueueString(data []byte) (string, []byte, error) {
+	l, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < l {
+		return "", nil, errCorruptedDiskQueueEntry
+	}
+	data = data[n:]
+	return string(data[:l]), data[l:], nil
+}
+
+// DiskQueueStatus reports the state of the disk queue of a client.
+type DiskQueueStatus struct {
+	Name string
+	URL  string
+	diskqueue.Stats
+
+	// SentEntries and DroppedEntries count log entries sent from, or dropped
+	// by, the queue since the client was created.
+	SentEntries    uint64
+	DroppedEntries uint64
+
+	// LastSendFailure is the error of the last failed send, and is cleared
+	// once a batch is sent successfully.
+	LastSendFailure string
+}
+
+func (c *client) diskQueueStatus() DiskQueueStatus {
+	return DiskQueueStatus{
+		Name:            c.name,
+		URL:             c.cfg.URL.String(),
+		Stats:           c.dq.queue.Stats(),
+		SentEntries:     c.dq.sentEntries.Load(),
+		DroppedEntries:  c.dq.droppedEntries.Load(),
+		LastSendFailure: c.dq.lastError.Load(),
+	}
+}
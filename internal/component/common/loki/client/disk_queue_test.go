@@ -0,0 +1,21 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskQueueEntryEncoding(t *testing.T) {
+	for _, b := range []diskQueueBatch{
+		{EntriesCount: 42, Buf: []byte("batch")},
+		{TenantID: "tenant-1", Format: FormatOTLP, EntriesCount: 42, Buf: []byte("batch")},
+	} {
+		got, err := decodeDiskQueueEntry(encodeDiskQueueEntry(b))
+		require.NoError(t, err)
+		require.Equal(t, b, got)
+	}
+
+	_, err := decodeDiskQueueEntry([]byte{0x10, 'a'})
+	require.ErrorIs(t, err, errCorruptedDiskQueueEntry)
+}
@@ -241,6 +241,18 @@ func (m *Manager) StopWithDrain(drain bool) {
 	stopWG.Wait()
 }
 
+// DiskQueues returns the status of the disk queue of every client which has
+// one, in the order of the client configs.
+func (m *Manager) DiskQueues() []DiskQueueStatus {
+	var res []DiskQueueStatus
+	for _, c := range m.clients {
+		if c, ok := c.(*client); ok && c.dq != nil {
+			res = append(res, c.diskQueueStatus())
+		}
+	}
+	return res
+}
+
 // GetClientName computes the specific name for each client config. The name is either the configured Name setting in Config,
 // or a hash of the config as whole, this allows us to detect repeated configs.
 func GetClientName(cfg Config) string {
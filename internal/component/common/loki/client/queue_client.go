@@ -448,7 +448,7 @@ func (c *queueClient) enqueuePendingBatches(ctx context.Context) {
 }
 
 func (c *queueClient) sendBatch(ctx context.Context, tenantID string, batch *batch) {
-	buf, entriesCount, err := batch.encode()
+	buf, entriesCount, err := encodeBatch(batch, c.cfg.Format)
 	if err != nil {
 		level.Error(c.logger).Log("msg", "error encoding batch", "error", err)
 		return
@@ -517,6 +517,9 @@ func (c *queueClient) send(ctx context.Context, tenantID string, buf []byte) (in
 	}
 	req = req.WithContext(ctx)
 	req.Header.Set("Content-Type", contentType)
+	if c.cfg.Format == FormatOTLP {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
 	req.Header.Set("User-Agent", userAgent)
 
 	// If the tenant ID is not empty promtail is running in multi-tenant mode, so
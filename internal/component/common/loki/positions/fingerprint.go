@@ -0,0 +1,97 @@
+package positions
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Fingerprint identifies a file by its device and inode numbers, and by a
+// hash of its first bytes.
+type Fingerprint struct {
+	// Dev and Ino identify the file on disk. They're always zero on
+	// platforms without inodes.
+	Dev, Ino uint64
+	// Size is the number of bytes at the start of the file Hash was computed
+	// from.
+	Size int64
+	// Hash is the hex-encoded SHA-256 hash of the first Size bytes of the
+	// file.
+	Hash string
+}
+
+// parseFingerprint parses a Fingerprint from the representation returned by
+// Fingerprint.String.
+func parseFingerprint(s string) (Fingerprint, error) {
+	var fp Fingerprint
+	if _, err := fmt.Sscanf(s, "%d:%d:%d:%s", &fp.Dev, &fp.Ino, &fp.Size, &fp.Hash); err != nil {
+		return Fingerprint{}, fmt.Errorf("invalid fingerprint %q: %w", s, err)
+	}
+	return fp, nil
+}
+
+// String returns the representation of fp saved in the positions file.
+func (fp Fingerprint) String() string {
+	return fmt.Sprintf("%d:%d:%d:%s", fp.Dev, fp.Ino, fp.Size, fp.Hash)
+}
+
+// SameInode reports whether fi describes the file on disk fp was computed
+// from.
+func (fp Fingerprint) SameInode(fi os.FileInfo) bool {
+	dev, ino := inode(fi)
+	return fp.Dev == dev && fp.Ino == ino
+}
+
+// Matches reports whether the content read from r starts with the bytes fp
+// was computed from.
+func (fp Fingerprint) Matches(r io.Reader) (bool, error) {
+	buf := make([]byte, fp.Size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return false, nil
+		}
+		return false, err
+	}
+	return hash(buf) == fp.Hash, nil
+}
+
+// fileFingerprint returns the fingerprint of the file at path, hashing up to
+// its first size bytes. It also reports whether the file still matches the
+// content of prev, if prev isn't nil.
+func fileFingerprint(path string, size int, prev *Fingerprint) (fp Fingerprint, matchesPrev bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Fingerprint{}, false, err
+	}
+	defer f.Close()
+
+	if prev != nil {
+		if matchesPrev, err = prev.Matches(f); err != nil {
+			return Fingerprint{}, false, err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return Fingerprint{}, false, err
+		}
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		return Fingerprint{}, false, err
+	}
+	buf, err := io.ReadAll(io.LimitReader(f, int64(size)))
+	if err != nil {
+		return Fingerprint{}, false, err
+	}
+
+	fp = Fingerprint{Size: int64(len(buf)), Hash: hash(buf)}
+	fp.Dev, fp.Ino = inode(fi)
+	return fp, matchesPrev, nil
+}
+
+func hash(buf []byte) string {
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,37 @@
+package positions
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFingerprint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	require.NoError(t, os.WriteFile(path, []byte("hello\n"), 0644))
+
+	fp, _, err := fileFingerprint(path, 1024, nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(6), fp.Size)
+
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	require.True(t, fp.SameInode(fi))
+
+	parsed, err := parseFingerprint(fp.String())
+	require.NoError(t, err)
+	require.Equal(t, fp, parsed)
+
+	ok, err := fp.Matches(strings.NewReader("hello\nworld\n"))
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = fp.Matches(strings.NewReader("world\n"))
+	require.NoError(t, err)
+	require.False(t, ok)
+	ok, err = fp.Matches(strings.NewReader("hell"))
+	require.NoError(t, err)
+	require.False(t, ok)
+}
@@ -31,6 +31,12 @@ type Config struct {
 	PositionsFile     string        `mapstructure:"filename" yaml:"filename"`
 	IgnoreInvalidYaml bool          `mapstructure:"ignore_invalid_yaml" yaml:"ignore_invalid_yaml"`
 	ReadOnly          bool          `mapstructure:"-" yaml:"-"`
+
+	// FingerprintSize enables saving a fingerprint of each file, hashing up
+	// to its first FingerprintSize bytes, along with its position. Positions
+	// of files which no longer match their fingerprint, because they were
+	// truncated or replaced, are discarded.
+	FingerprintSize int `mapstructure:"-" yaml:"-"`
 }
 
 // RegisterFlagsWithPrefix registers flags where every name is prefixed by
@@ -48,12 +54,13 @@ func (cfg *Config) RegisterFlags(flags *flag.FlagSet) {
 
 // Positions tracks how far through each file we've read.
 type positions struct {
-	logger    log.Logger
-	cfg       Config
-	mtx       sync.Mutex
-	positions map[Entry]string
-	quit      chan struct{}
-	done      chan struct{}
+	logger       log.Logger
+	cfg          Config
+	mtx          sync.Mutex
+	positions    map[Entry]string
+	fingerprints map[Entry]Fingerprint
+	quit         chan struct{}
+	done         chan struct{}
 }
 
 // Entry describes a positions file entry consisting of an absolute file path and
@@ -71,6 +78,10 @@ type Entry struct {
 // File format for the positions data.
 type File struct {
 	Positions map[Entry]string `yaml:"positions"`
+	// Fingerprints holds the fingerprints of the files of entries in
+	// Positions. Files written before fingerprints were introduced don't have
+	// any, and entries gain one once their position is updated.
+	Fingerprints map[Entry]string `yaml:"fingerprints,omitempty"`
 }
 
 type Positions interface {
@@ -80,14 +91,21 @@ type Positions interface {
 	// offset.
 	GetString(path, labels string) string
 	// Get returns how far we've read through a file. Returns an error
-	// if the value stored for the file is not an integer.
+	// if the value stored for the file is not an integer. If fingerprints
+	// are enabled and the file no longer matches the fingerprint saved
+	// with its position, the position is removed and 0 is returned.
 	Get(path, labels string) (int64, error)
 	// PutString records (asynchronously) how far we've read through a file.
 	// Unlike Put, it records a string offset and is only useful for
 	// JournalTargets which doesn't have integer offsets.
 	PutString(path, labels string, pos string)
-	// Put records (asynchronously) how far we've read through a file.
+	// Put records (asynchronously) how far we've read through a file. If
+	// fingerprints are enabled, the fingerprint of the file is recorded as
+	// well.
 	Put(path, labels string, pos int64)
+	// GetFingerprint returns the fingerprint saved with the position of a
+	// file, and whether there is one.
+	GetFingerprint(path, labels string) (Fingerprint, bool)
 	// Remove removes the position tracking for a filepath
 	Remove(path, labels string)
 	// SyncPeriod returns how often the positions file gets resynced
@@ -126,7 +144,7 @@ func ConvertLegacyPositionsFile(legacyPath, newPath string, l log.Logger) {
 		}] = v
 	}
 	// After conversion remove the file.
-	err = writePositionFile(newPath, newPositions)
+	err = writePositionFile(newPath, File{Positions: newPositions})
 	if err != nil {
 		level.Error(l).Log("msg", "error writing new positions file from legacy", "path", newPath, "error", err)
 	}
@@ -162,12 +180,23 @@ func New(logger log.Logger, cfg Config) (Positions, error) {
 		return nil, err
 	}
 
+	fingerprints := make(map[Entry]Fingerprint, len(positionData.Fingerprints))
+	for e, s := range positionData.Fingerprints {
+		fp, err := parseFingerprint(s)
+		if err != nil {
+			level.Warn(logger).Log("msg", "ignoring invalid fingerprint in positions file", "path", e.Path, "error", err)
+			continue
+		}
+		fingerprints[e] = fp
+	}
+
 	p := &positions{
-		logger:    logger,
-		cfg:       cfg,
-		positions: positionData,
-		quit:      make(chan struct{}),
-		done:      make(chan struct{}),
+		logger:       logger,
+		cfg:          cfg,
+		positions:    positionData.Positions,
+		fingerprints: fingerprints,
+		quit:         make(chan struct{}),
+		done:         make(chan struct{}),
 	}
 
 	go p.run()
@@ -186,22 +215,79 @@ func (p *positions) PutString(path, labels string, pos string) {
 }
 
 func (p *positions) Put(path, labels string, pos int64) {
+	if p.cfg.FingerprintSize > 0 && !isCursor(path) {
+		p.updateFingerprint(Entry{path, labels}, pos)
+	}
 	p.PutString(path, labels, strconv.FormatInt(pos, 10))
 }
 
+// updateFingerprint updates the fingerprint of the file of e, before its
+// position is updated to pos.
+//
+// As the file at the path of e may be replaced while the old file is still
+// being read, the fingerprint is only replaced by the fingerprint of a
+// different file if pos moved backwards, which happens when reading the new
+// file starts. Otherwise, the fingerprint is only extended while the file
+// grows up to the fingerprint size.
+func (p *positions) updateFingerprint(e Entry, pos int64) {
+	p.mtx.Lock()
+	prev, hasPrev := p.fingerprints[e]
+	prevPos, _ := strconv.ParseInt(p.positions[e], 10, 64)
+	p.mtx.Unlock()
+
+	sameFile := hasPrev && pos >= prevPos
+	if sameFile && prev.Size >= int64(p.cfg.FingerprintSize) {
+		return
+	}
+
+	var prevFP *Fingerprint
+	if sameFile {
+		prevFP = &prev
+	}
+	fp, matchesPrev, err := fileFingerprint(e.Path, p.cfg.FingerprintSize, prevFP)
+	if err != nil {
+		level.Debug(p.logger).Log("msg", "failed to compute fingerprint of file", "path", e.Path, "error", err)
+		return
+	}
+	if sameFile && !matchesPrev {
+		return
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.fingerprints[e] = fp
+}
+
 func (p *positions) GetString(path, labels string) string {
 	p.mtx.Lock()
 	defer p.mtx.Unlock()
 	return p.positions[Entry{path, labels}]
 }
 
-func (p *positions) Get(path, labels string) (int64, error) {
+func (p *positions) GetFingerprint(path, labels string) (Fingerprint, bool) {
 	p.mtx.Lock()
 	defer p.mtx.Unlock()
+	fp, ok := p.fingerprints[Entry{path, labels}]
+	return fp, ok
+}
+
+func (p *positions) Get(path, labels string) (int64, error) {
+	p.mtx.Lock()
 	pos, ok := p.positions[Entry{path, labels}]
+	fp, hasFP := p.fingerprints[Entry{path, labels}]
+	p.mtx.Unlock()
 	if !ok {
 		return 0, nil
 	}
+
+	if p.cfg.FingerprintSize > 0 && hasFP {
+		_, matches, err := fileFingerprint(path, 0, &fp)
+		if err == nil && !matches {
+			level.Info(p.logger).Log("msg", "file no longer matches its fingerprint, discarding its position", "path", path, "labels", labels)
+			p.Remove(path, labels)
+			return 0, nil
+		}
+	}
 	return strconv.ParseInt(pos, 10, 64)
 }
 
@@ -213,6 +299,7 @@ func (p *positions) Remove(path, labels string) {
 
 func (p *positions) remove(path, labels string) {
 	delete(p.positions, Entry{path, labels})
+	delete(p.fingerprints, Entry{path, labels})
 }
 
 func (p *positions) SyncPeriod() time.Duration {
@@ -243,13 +330,19 @@ func (p *positions) save() {
 		return
 	}
 	p.mtx.Lock()
-	positions := make(map[Entry]string, len(p.positions))
+	file := File{Positions: make(map[Entry]string, len(p.positions))}
 	for k, v := range p.positions {
-		positions[k] = v
+		file.Positions[k] = v
+	}
+	if len(p.fingerprints) > 0 {
+		file.Fingerprints = make(map[Entry]string, len(p.fingerprints))
+		for k, v := range p.fingerprints {
+			file.Fingerprints[k] = v.String()
+		}
 	}
 	p.mtx.Unlock()
 
-	if err := writePositionFile(p.cfg.PositionsFile, positions); err != nil {
+	if err := writePositionFile(p.cfg.PositionsFile, file); err != nil {
 		level.Error(p.logger).Log("msg", "error writing positions file", "error", err)
 	}
 }
@@ -264,10 +357,7 @@ func (p *positions) cleanup() {
 	defer p.mtx.Unlock()
 	toRemove := []Entry{}
 	for k := range p.positions {
-		// If the position file is prefixed with cursor, it's a
-		// cursor and not a file on disk.
-		// We still have to support journal files, so we keep the previous check to avoid breaking change.
-		if strings.HasPrefix(k.Path, cursorKeyPrefix) || strings.HasPrefix(k.Path, journalKeyPrefix) {
+		if isCursor(k.Path) {
 			continue
 		}
 
@@ -287,14 +377,25 @@ func (p *positions) cleanup() {
 	}
 }
 
-func readPositionsFile(cfg Config, logger log.Logger) (map[Entry]string, error) {
+// isCursor reports whether path is a key for a cursor rather than a file on
+// disk.
+func isCursor(path string) bool {
+	// If the position file is prefixed with cursor, it's a
+	// cursor and not a file on disk.
+	// We still have to support journal files, so we keep the previous check to avoid breaking change.
+	return strings.HasPrefix(path, cursorKeyPrefix) || strings.HasPrefix(path, journalKeyPrefix)
+}
+
+func readPositionsFile(cfg Config, logger log.Logger) (File, error) {
+	empty := File{Positions: map[Entry]string{}}
+
 	cleanfn := filepath.Clean(cfg.PositionsFile)
 	buf, err := os.ReadFile(cleanfn)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return map[Entry]string{}, nil
+			return empty, nil
 		}
-		return nil, err
+		return File{}, err
 	}
 
 	var p File
@@ -303,10 +404,10 @@ func readPositionsFile(cfg Config, logger log.Logger) (map[Entry]string, error)
 		// return empty if cfg option enabled
 		if cfg.IgnoreInvalidYaml {
 			level.Debug(logger).Log("msg", "ignoring invalid positions file", "file", cleanfn, "error", err)
-			return map[Entry]string{}, nil
+			return empty, nil
 		}
 
-		return nil, fmt.Errorf("invalid yaml positions file [%s]: %v", cleanfn, err)
+		return File{}, fmt.Errorf("invalid yaml positions file [%s]: %v", cleanfn, err)
 	}
 
 	// p.Positions will be nil if the file exists but is empty
@@ -314,5 +415,5 @@ func readPositionsFile(cfg Config, logger log.Logger) (map[Entry]string, error)
 		p.Positions = map[Entry]string{}
 	}
 
-	return p.Positions, nil
+	return p, nil
 }
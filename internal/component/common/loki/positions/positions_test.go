@@ -62,8 +62,8 @@ func TestLegacyConversion(t *testing.T) {
 		PositionsFile: positionsPath,
 	}, log.NewNopLogger())
 	require.NoError(t, err)
-	require.Len(t, ps, 1)
-	for k, v := range ps {
+	require.Len(t, ps.Positions, 1)
+	for k, v := range ps.Positions {
 		require.True(t, k.Path == "/tmp/random.log")
 		require.True(t, v == "17623")
 	}
@@ -74,9 +74,9 @@ func TestLegacyConversionWithNewFile(t *testing.T) {
 	legacy := writeLegacy(t, tmpDir)
 	// Write a new file.
 	positionsPath := filepath.Join(tmpDir, "positions")
-	err := writePositionFile(positionsPath, map[Entry]string{
+	err := writePositionFile(positionsPath, File{Positions: map[Entry]string{
 		{Path: "/tmp/newrandom.log", Labels: ""}: "100",
-	})
+	}})
 	require.NoError(t, err)
 
 	// In this state nothing should be overwritten.
@@ -85,8 +85,8 @@ func TestLegacyConversionWithNewFile(t *testing.T) {
 		PositionsFile: positionsPath,
 	}, log.NewNopLogger())
 	require.NoError(t, err)
-	require.Len(t, ps, 1)
-	for k, v := range ps {
+	require.Len(t, ps.Positions, 1)
+	for k, v := range ps.Positions {
 		require.True(t, k.Path == "/tmp/newrandom.log")
 		require.True(t, v == "100")
 	}
@@ -97,9 +97,9 @@ func TestLegacyConversionWithNoLegacyFile(t *testing.T) {
 	legacy := filepath.Join(tmpDir, "legacy")
 	positionsPath := filepath.Join(tmpDir, "positions")
 	// Write a new file.
-	err := writePositionFile(positionsPath, map[Entry]string{
+	err := writePositionFile(positionsPath, File{Positions: map[Entry]string{
 		{Path: "/tmp/newrandom.log", Labels: ""}: "100",
-	})
+	}})
 	require.NoError(t, err)
 
 	ConvertLegacyPositionsFile(legacy, positionsPath, log.NewNopLogger())
@@ -107,8 +107,8 @@ func TestLegacyConversionWithNoLegacyFile(t *testing.T) {
 		PositionsFile: positionsPath,
 	}, log.NewNopLogger())
 	require.NoError(t, err)
-	require.Len(t, ps, 1)
-	for k, v := range ps {
+	require.Len(t, ps.Positions, 1)
+	for k, v := range ps.Positions {
 		require.True(t, k.Path == "/tmp/newrandom.log")
 		require.True(t, v == "100")
 	}
@@ -136,7 +136,7 @@ positions:
 	}, log.NewNopLogger())
 
 	require.NoError(t, err)
-	require.Equal(t, "17623", pos[Entry{
+	require.Equal(t, "17623", pos.Positions[Entry{
 		Path:   "/tmp/random.log",
 		Labels: `{job="tmp"}`,
 	}])
@@ -159,7 +159,7 @@ func TestReadPositionsEmptyFile(t *testing.T) {
 	}, log.NewNopLogger())
 
 	require.NoError(t, err)
-	require.NotNil(t, pos)
+	require.NotNil(t, pos.Positions)
 }
 
 func TestReadPositionsFromDir(t *testing.T) {
@@ -229,7 +229,7 @@ positions:
 	}, log.NewNopLogger())
 
 	require.NoError(t, err)
-	require.Equal(t, map[Entry]string{}, out)
+	require.Equal(t, map[Entry]string{}, out.Positions)
 }
 
 func Test_ReadOnly(t *testing.T) {
@@ -273,7 +273,7 @@ positions:
 	require.NoError(t, err)
 	require.Equal(t, map[Entry]string{
 		{Path: "/tmp/random.log", Labels: `{job="tmp"}`}: "17623",
-	}, out)
+	}, out.Positions)
 }
 
 func TestWriteEmptyLabels(t *testing.T) {
@@ -322,7 +322,7 @@ positions:
 		{Path: "/tmp/bar/nolabels.log", Labels: ""}:       "10060",
 		{Path: "/tmp/foo/emptylabels.log", Labels: `{}`}:  "10050",
 		{Path: "/tmp/foo/nolabels.log", Labels: ""}:       "10040",
-	}, out)
+	}, out.Positions)
 }
 
 func TestReadEmptyLabels(t *testing.T) {
@@ -352,16 +352,83 @@ positions:
 	}, log.NewNopLogger())
 
 	require.NoError(t, err)
-	require.Equal(t, "10020", pos[Entry{
+	require.Equal(t, "10020", pos.Positions[Entry{
 		Path:   "/tmp/nolabels.log",
 		Labels: ``,
 	}])
-	require.Equal(t, "10030", pos[Entry{
+	require.Equal(t, "10030", pos.Positions[Entry{
 		Path:   "/tmp/emptylabels.log",
 		Labels: `{}`,
 	}])
-	require.Equal(t, "10040", pos[Entry{
+	require.Equal(t, "10040", pos.Positions[Entry{
 		Path:   "/tmp/missinglabels.log",
 		Labels: ``,
 	}])
 }
+
+func TestFingerprints(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "app.log")
+	require.NoError(t, os.WriteFile(logPath, []byte("hello\n"), 0644))
+
+	// Positions files without fingerprints are migrated once positions are
+	// updated.
+	positionsPath := filepath.Join(dir, "positions.yml")
+	require.NoError(t, writePositionFile(positionsPath, File{Positions: map[Entry]string{
+		{Path: logPath, Labels: "{}"}: "6",
+	}}))
+
+	newPositions := func() *positions {
+		p, err := New(util_log.Logger, Config{
+			SyncPeriod:      20 * time.Second,
+			PositionsFile:   positionsPath,
+			FingerprintSize: 8,
+		})
+		require.NoError(t, err)
+		return p.(*positions)
+	}
+	p := newPositions()
+	pos, err := p.Get(logPath, "{}")
+	require.NoError(t, err)
+	require.Equal(t, int64(6), pos)
+
+	p.Put(logPath, "{}", 6)
+	require.Equal(t, int64(6), p.fingerprints[Entry{logPath, "{}"}].Size)
+
+	// The fingerprint is extended while the file grows.
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString("world\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	p.Put(logPath, "{}", 12)
+	require.Equal(t, int64(8), p.fingerprints[Entry{logPath, "{}"}].Size)
+
+	p.Stop()
+	out, err := readPositionsFile(Config{PositionsFile: positionsPath}, log.NewNopLogger())
+	require.NoError(t, err)
+	require.Len(t, out.Fingerprints, 1)
+
+	// The fingerprint of a replaced file isn't saved while the position
+	// moves forward, as the old file is still being read.
+	p = newPositions()
+	defer p.Stop()
+	fp := p.fingerprints[Entry{logPath, "{}"}]
+	require.NoError(t, os.WriteFile(logPath, []byte("replaced\n"), 0644))
+	p.Put(logPath, "{}", 20)
+	require.Equal(t, fp, p.fingerprints[Entry{logPath, "{}"}])
+
+	// The position of a file which doesn't match its fingerprint is
+	// discarded.
+	pos, err = p.Get(logPath, "{}")
+	require.NoError(t, err)
+	require.Equal(t, int64(0), pos)
+	require.Equal(t, "", p.GetString(logPath, "{}"))
+
+	// The fingerprint of the new file is saved once it's read.
+	p.Put(logPath, "{}", 9)
+	require.NotEqual(t, fp, p.fingerprints[Entry{logPath, "{}"}])
+	pos, err = p.Get(logPath, "{}")
+	require.NoError(t, err)
+	require.Equal(t, int64(9), pos)
+}
@@ -8,6 +8,7 @@ import (
 	flow_relabel "github.com/grafana/agent/internal/component/common/relabel"
 	"github.com/grafana/agent/internal/component/discovery"
 	"github.com/grafana/agent/internal/featuregate"
+	"github.com/grafana/agent/internal/service/livedebugging"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/relabel"
 )
@@ -46,13 +47,18 @@ type Component struct {
 
 	mut sync.RWMutex
 	rcs []*relabel.Config
+
+	debugDataPublisher livedebugging.DebugDataPublisher
 }
 
 var _ component.Component = (*Component)(nil)
 
 // New creates a new discovery.relabel component.
 func New(o component.Options, args Arguments) (*Component, error) {
-	c := &Component{opts: o}
+	c := &Component{
+		opts:               o,
+		debugDataPublisher: livedebugging.GetPublisher(o.GetServiceData),
+	}
 
 	// Call to Update() to set the output once at the start
 	if err := c.Update(args); err != nil {
@@ -79,11 +85,20 @@ func (c *Component) Update(args component.Arguments) error {
 	relabelConfigs := flow_relabel.ComponentToPromRelabelConfigs(newArgs.RelabelConfigs)
 	c.rcs = relabelConfigs
 
+	debugging := c.debugDataPublisher.IsActive(c.opts.ID)
 	for _, t := range newArgs.Targets {
 		lset := componentMapToPromLabels(t)
-		lset, keep := relabel.Process(lset, relabelConfigs...)
+		relabelled, keep := relabel.Process(lset, relabelConfigs...)
 		if keep {
-			targets = append(targets, promLabelsToComponent(lset))
+			targets = append(targets, promLabelsToComponent(relabelled))
+		}
+
+		if debugging {
+			result := "dropped"
+			if keep {
+				result = relabelled.String()
+			}
+			c.debugDataPublisher.Publish(c.opts.ID, labels.New(lset...).String()+" => "+result)
 		}
 	}
 
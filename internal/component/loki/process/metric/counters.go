@@ -23,6 +23,7 @@ type CounterConfig struct {
 	Source      string        `river:"source,attr,optional"`
 	Prefix      string        `river:"prefix,attr,optional"`
 	MaxIdle     time.Duration `river:"max_idle_duration,attr,optional"`
+	MaxSeries   int           `river:"max_series,attr,optional"`
 	Value       string        `river:"value,attr,optional"`
 
 	// Counter-specific fields
@@ -46,6 +47,9 @@ func (c *CounterConfig) Validate() error {
 	if c.MaxIdle < 1*time.Second {
 		return fmt.Errorf("max_idle_duration must be greater or equal than 1s")
 	}
+	if c.MaxSeries < 0 {
+		return fmt.Errorf("max_series must be greater or equal than 0")
+	}
 
 	if c.Source == "" {
 		c.Source = c.Name
@@ -80,7 +84,7 @@ func NewCounters(name string, config *CounterConfig) (*Counters, error) {
 			}),
 				0,
 			}
-		}, int64(config.MaxIdle.Seconds())),
+		}, int64(config.MaxIdle.Seconds()), config.MaxSeries),
 		Cfg: config,
 	}, nil
 }
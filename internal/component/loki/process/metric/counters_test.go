@@ -138,6 +138,44 @@ func TestCounterExpiration(t *testing.T) {
 	assert.Contains(t, cnt.metrics, lbl2.Fingerprint())
 }
 
+func TestCounterMaxSeries(t *testing.T) {
+	t.Parallel()
+	cfg := &CounterConfig{
+		Action:    "inc",
+		MaxIdle:   1 * time.Second,
+		MaxSeries: 2,
+	}
+
+	cnt, err := NewCounters("test1", cfg)
+	assert.Nil(t, err)
+
+	var overflows int
+	cnt.OnOverflow(func() { overflows++ })
+
+	lbl1 := model.LabelSet{"test": "1"}
+	lbl2 := model.LabelSet{"test": "2"}
+	lbl3 := model.LabelSet{"test": "3"}
+	lbl4 := model.LabelSet{"test": "4"}
+	cnt.With(lbl1).Inc()
+	cnt.With(lbl2).Inc()
+	cnt.With(lbl3).Inc()
+	cnt.With(lbl4).Inc()
+	cnt.With(lbl1).Inc()
+
+	// New series beyond the limit share the overflow series.
+	assert.Len(t, cnt.metrics, 3)
+	assert.Contains(t, cnt.metrics, OverflowLabels.Fingerprint())
+	assert.NotContains(t, cnt.metrics, lbl3.Fingerprint())
+	assert.Equal(t, 2, overflows)
+
+	// Once series expire, new series can be created again.
+	time.Sleep(1100 * time.Millisecond) // Wait just past our max idle of 1 sec
+	cnt.Prune()
+	assert.Empty(t, cnt.metrics)
+	cnt.With(lbl3).Inc()
+	assert.Contains(t, cnt.metrics, lbl3.Fingerprint())
+}
+
 func collect(c prometheus.Collector) {
 	done := make(chan struct{})
 	collector := make(chan prometheus.Metric)
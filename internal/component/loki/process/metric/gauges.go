@@ -34,6 +34,7 @@ type GaugeConfig struct {
 	Source      string        `river:"source,attr,optional"`
 	Prefix      string        `river:"prefix,attr,optional"`
 	MaxIdle     time.Duration `river:"max_idle_duration,attr,optional"`
+	MaxSeries   int           `river:"max_series,attr,optional"`
 	Value       string        `river:"value,attr,optional"`
 
 	// Gauge-specific fields
@@ -50,6 +51,9 @@ func (g *GaugeConfig) Validate() error {
 	if g.MaxIdle < 1*time.Second {
 		return fmt.Errorf("max_idle_duration must be greater or equal than 1s")
 	}
+	if g.MaxSeries < 0 {
+		return fmt.Errorf("max_series must be greater or equal than 0")
+	}
 
 	if g.Source == "" {
 		g.Source = g.Name
@@ -79,7 +83,7 @@ func NewGauges(name string, config *GaugeConfig) (*Gauges, error) {
 			}),
 				0,
 			}
-		}, int64(config.MaxIdle.Seconds())),
+		}, int64(config.MaxIdle.Seconds()), config.MaxSeries),
 		Cfg: config,
 	}, nil
 }
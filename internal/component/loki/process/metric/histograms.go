@@ -23,6 +23,7 @@ type HistogramConfig struct {
 	Source      string        `river:"source,attr,optional"`
 	Prefix      string        `river:"prefix,attr,optional"`
 	MaxIdle     time.Duration `river:"max_idle_duration,attr,optional"`
+	MaxSeries   int           `river:"max_series,attr,optional"`
 	Value       string        `river:"value,attr,optional"`
 
 	// Histogram-specific fields
@@ -39,6 +40,9 @@ func (h *HistogramConfig) Validate() error {
 	if h.MaxIdle < 1*time.Second {
 		return fmt.Errorf("max_idle_duration must be greater or equal than 1s")
 	}
+	if h.MaxSeries < 0 {
+		return fmt.Errorf("max_series must be greater or equal than 0")
+	}
 
 	if h.Source == "" {
 		h.Source = h.Name
@@ -64,7 +68,7 @@ func NewHistograms(name string, config *HistogramConfig) (*Histograms, error) {
 			}),
 				0,
 			}
-		}, int64(config.MaxIdle.Seconds())),
+		}, int64(config.MaxIdle.Seconds()), config.MaxSeries),
 		Cfg: config,
 	}, nil
 }
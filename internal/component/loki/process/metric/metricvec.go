@@ -18,21 +18,38 @@ type Expirable interface {
 	HasExpired(currentTimeSec int64, maxAgeSec int64) bool
 }
 
+// OverflowLabels is the label set of the series which receives the updates
+// of new series once a vector holds its maximum number of series.
+var OverflowLabels = model.LabelSet{"overflow": "true"}
+
+var overflowFingerprint = OverflowLabels.Fingerprint()
+
 type metricVec struct {
-	factory   func(labels map[string]string) prometheus.Metric
-	mtx       sync.Mutex
-	metrics   map[model.Fingerprint]prometheus.Metric
-	maxAgeSec int64
+	factory    func(labels map[string]string) prometheus.Metric
+	mtx        sync.Mutex
+	metrics    map[model.Fingerprint]prometheus.Metric
+	maxAgeSec  int64
+	maxSeries  int
+	onOverflow func()
 }
 
-func newMetricVec(factory func(labels map[string]string) prometheus.Metric, maxAgeSec int64) *metricVec {
+func newMetricVec(factory func(labels map[string]string) prometheus.Metric, maxAgeSec int64, maxSeries int) *metricVec {
 	return &metricVec{
 		metrics:   map[model.Fingerprint]prometheus.Metric{},
 		factory:   factory,
 		maxAgeSec: maxAgeSec,
+		maxSeries: maxSeries,
 	}
 }
 
+// OnOverflow sets a function which is called every time an update goes to
+// the overflow series.
+func (c *metricVec) OnOverflow(f func()) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.onOverflow = f
+}
+
 // Describe implements prometheus.Collector and doesn't declare any metrics on purpose to bypass prometheus validation.
 // see https://godoc.org/github.com/prometheus/client_golang/prometheus#hdr-Custom_Collectors_and_constant_Metrics search for "unchecked"
 func (c *metricVec) Describe(ch chan<- *prometheus.Desc) {}
@@ -47,20 +64,42 @@ func (c *metricVec) Collect(ch chan<- prometheus.Metric) {
 	c.prune()
 }
 
-// With returns the metric associated with the labelset.
+// With returns the metric associated with the labelset. If the vector
+// already holds its maximum number of series, the metric of the overflow
+// series is returned for new label sets.
 func (c *metricVec) With(labels model.LabelSet) prometheus.Metric {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 	fp := labels.Fingerprint()
 	var ok bool
 	var metric prometheus.Metric
-	if metric, ok = c.metrics[fp]; !ok {
-		metric = c.factory(util.ModelLabelSetToMap(cleanLabels(labels)))
-		c.metrics[fp] = metric
+	if metric, ok = c.metrics[fp]; ok {
+		return metric
+	}
+	if c.maxSeries > 0 && c.seriesCount() >= c.maxSeries {
+		fp, labels = overflowFingerprint, OverflowLabels
+		if c.onOverflow != nil {
+			c.onOverflow()
+		}
+		if metric, ok = c.metrics[fp]; ok {
+			return metric
+		}
 	}
+	metric = c.factory(util.ModelLabelSetToMap(cleanLabels(labels)))
+	c.metrics[fp] = metric
 	return metric
 }
 
+// seriesCount returns the number of series, not counting the overflow
+// series. It does not take out a lock on the metrics map so whoever calls
+// this function should do so.
+func (c *metricVec) seriesCount() int {
+	if _, ok := c.metrics[overflowFingerprint]; ok {
+		return len(c.metrics) - 1
+	}
+	return len(c.metrics)
+}
+
 // cleanLabels removes labels whose label name is not a valid prometheus one, or has the reserved `__` prefix.
 func cleanLabels(set model.LabelSet) model.LabelSet {
 	out := make(model.LabelSet, len(set))
@@ -92,6 +131,14 @@ func (c *metricVec) DeleteAll() {
 	c.metrics = map[model.Fingerprint]prometheus.Metric{}
 }
 
+// Prune removes the series which have been idle for longer than their
+// maximum age.
+func (c *metricVec) Prune() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.prune()
+}
+
 // prune will remove all metrics which implement the Expirable interface and have expired
 // it does not take out a lock on the metrics map so whoever calls this function should do so.
 func (c *metricVec) prune() {
@@ -5,13 +5,16 @@ package process
 
 import (
 	"context"
+	"fmt"
 	"reflect"
 	"sync"
+	"time"
 
 	"github.com/grafana/agent/internal/component"
 	"github.com/grafana/agent/internal/component/common/loki"
 	"github.com/grafana/agent/internal/component/loki/process/stages"
 	"github.com/grafana/agent/internal/featuregate"
+	"github.com/grafana/agent/internal/service/livedebugging"
 )
 
 // TODO(thampiotr): We should reconsider which parts of this component should be exported and which should
@@ -61,12 +64,15 @@ type Component struct {
 
 	fanoutMut sync.RWMutex
 	fanout    []loki.LogsReceiver
+
+	debugDataPublisher livedebugging.DebugDataPublisher
 }
 
 // New creates a new loki.process component.
 func New(o component.Options, args Arguments) (*Component, error) {
 	c := &Component{
-		opts: o,
+		opts:               o,
+		debugDataPublisher: livedebugging.GetPublisher(o.GetServiceData),
 	}
 
 	// Create and immediately export the receiver which remains the same for
@@ -149,6 +155,7 @@ func (c *Component) handleIn(ctx context.Context, wg *sync.WaitGroup) {
 		case <-ctx.Done():
 			return
 		case entry := <-c.receiver.Chan():
+			c.publishDebugData("in", entry)
 			c.mut.RLock()
 			select {
 			case <-ctx.Done():
@@ -172,6 +179,7 @@ func (c *Component) handleOut(shutdownCh chan struct{}, wg *sync.WaitGroup) {
 		case <-shutdownCh:
 			return
 		case entry := <-c.processOut:
+			c.publishDebugData("out", entry)
 			c.fanoutMut.RLock()
 			fanout := c.fanout
 			c.fanoutMut.RUnlock()
@@ -187,6 +195,15 @@ func (c *Component) handleOut(shutdownCh chan struct{}, wg *sync.WaitGroup) {
 	}
 }
 
+// publishDebugData publishes entries entering and leaving the pipeline, so
+// that the effect of stages can be watched live.
+func (c *Component) publishDebugData(direction string, entry loki.Entry) {
+	if !c.debugDataPublisher.IsActive(c.opts.ID) {
+		return
+	}
+	c.debugDataPublisher.Publish(c.opts.ID, fmt.Sprintf("%s: %s %s %s", direction, entry.Timestamp.Format(time.RFC3339Nano), entry.Labels, entry.Line))
+}
+
 func stagesChanged(prev, next []stages.StageConfig) bool {
 	if len(prev) != len(next) {
 		return true
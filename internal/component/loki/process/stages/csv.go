@@ -0,0 +1,253 @@
+package stages
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/internal/flow/logging/level"
+)
+
+// Config Errors
+const (
+	ErrCSVColumnsRequired  = "csv stage columns are required"
+	ErrCSVDuplicateColumn  = "csv stage column %q is defined more than once"
+	ErrCSVUnknownColumn    = "csv stage expression %q refers to unknown column %q"
+	ErrCSVInvalidDelimiter = "csv stage delimiter must be a single character"
+	ErrCSVInvalidQuote     = "csv stage quote must be empty or a single character different from the delimiter"
+	ErrEmptyCSVStageSource = "empty source"
+	ErrMalformedCSV        = "malformed csv"
+)
+
+const (
+	defaultCSVDelimiter = ","
+	defaultCSVQuote     = `"`
+)
+
+// CSVConfig represents a CSV Stage configuration
+type CSVConfig struct {
+	Columns       []string          `river:"columns,attr"`
+	Expressions   map[string]string `river:"expressions,attr,optional"`
+	Source        *string           `river:"source,attr,optional"`
+	Delimiter     string            `river:"delimiter,attr,optional"`
+	Quote         string            `river:"quote,attr,optional"`
+	TrimSpace     bool              `river:"trim_space,attr,optional"`
+	DropMalformed bool              `river:"drop_malformed,attr,optional"`
+}
+
+// SetToDefault implements river.Defaulter.
+func (c *CSVConfig) SetToDefault() {
+	*c = CSVConfig{
+		Delimiter: defaultCSVDelimiter,
+		Quote:     defaultCSVQuote,
+	}
+}
+
+// validateCSVConfig validates a csv config and returns a mapping of names in
+// the extracted map to column indexes.
+func validateCSVConfig(c *CSVConfig) (map[string]int, error) {
+	if len(c.Columns) == 0 {
+		return nil, errors.New(ErrCSVColumnsRequired)
+	}
+
+	if c.Source != nil && *c.Source == "" {
+		return nil, errors.New(ErrEmptyCSVStageSource)
+	}
+
+	if utf8.RuneCountInString(c.Delimiter) != 1 {
+		return nil, errors.New(ErrCSVInvalidDelimiter)
+	}
+	if utf8.RuneCountInString(c.Quote) > 1 || c.Quote == c.Delimiter {
+		return nil, errors.New(ErrCSVInvalidQuote)
+	}
+
+	indexes := make(map[string]int, len(c.Columns))
+	for i, column := range c.Columns {
+		if _, ok := indexes[column]; ok {
+			return nil, fmt.Errorf(ErrCSVDuplicateColumn, column)
+		}
+		indexes[column] = i
+	}
+
+	// Without expressions, every named column is extracted. Columns with an
+	// empty name are skipped.
+	if len(c.Expressions) == 0 {
+		mapping := make(map[string]int, len(c.Columns))
+		for column, i := range indexes {
+			if column != "" {
+				mapping[column] = i
+			}
+		}
+		return mapping, nil
+	}
+
+	mapping := make(map[string]int, len(c.Expressions))
+	for n, column := range c.Expressions {
+		// If there is no column, use the name as the column.
+		if column == "" {
+			column = n
+		}
+		i, ok := indexes[column]
+		if !ok || column == "" {
+			return nil, fmt.Errorf(ErrCSVUnknownColumn, n, column)
+		}
+		mapping[n] = i
+	}
+	return mapping, nil
+}
+
+// csvStage sets extracted data from the columns of CSV records
+type csvStage struct {
+	cfg       *CSVConfig
+	mapping   map[string]int
+	delimiter rune
+	quote     rune // 0 if quoting is disabled.
+	logger    log.Logger
+}
+
+// newCSVStage creates a new csv pipeline stage from a config.
+func newCSVStage(logger log.Logger, cfg CSVConfig) (Stage, error) {
+	mapping, err := validateCSVConfig(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	delimiter, _ := utf8.DecodeRuneInString(cfg.Delimiter)
+	var quote rune
+	if cfg.Quote != "" {
+		quote, _ = utf8.DecodeRuneInString(cfg.Quote)
+	}
+	return &csvStage{
+		cfg:       &cfg,
+		mapping:   mapping,
+		delimiter: delimiter,
+		quote:     quote,
+		logger:    log.With(logger, "component", "stage", "type", "csv"),
+	}, nil
+}
+
+func (c *csvStage) Run(in chan Entry) chan Entry {
+	out := make(chan Entry)
+	go func() {
+		defer close(out)
+		for e := range in {
+			err := c.processEntry(e.Extracted, &e.Line)
+			if err != nil && c.cfg.DropMalformed {
+				continue
+			}
+			out <- e
+		}
+	}()
+	return out
+}
+
+func (c *csvStage) processEntry(extracted map[string]interface{}, entry *string) error {
+	// If a source key is provided, the csv stage should process it
+	// from the extracted map, otherwise should fall back to the entry
+	input := entry
+
+	if c.cfg.Source != nil {
+		if _, ok := extracted[*c.cfg.Source]; !ok {
+			if Debug {
+				level.Debug(c.logger).Log("msg", "source does not exist in the set of extracted values", "source", *c.cfg.Source)
+			}
+			return nil
+		}
+
+		value, err := getString(extracted[*c.cfg.Source])
+		if err != nil {
+			if Debug {
+				level.Debug(c.logger).Log("msg", "failed to convert source value to string", "source", *c.cfg.Source, "err", err, "type", reflect.TypeOf(extracted[*c.cfg.Source]))
+			}
+			return nil
+		}
+
+		input = &value
+	}
+
+	if input == nil {
+		if Debug {
+			level.Debug(c.logger).Log("msg", "cannot parse a nil entry")
+		}
+		return nil
+	}
+
+	fields, err := splitCSVRecord(*input, c.delimiter, c.quote)
+	if err != nil {
+		if Debug {
+			level.Debug(c.logger).Log("msg", "failed to parse log line as csv", "err", err)
+		}
+		return errors.New(ErrMalformedCSV)
+	}
+
+	// Records with fewer fields than columns populate the columns they have.
+	for n, i := range c.mapping {
+		if i >= len(fields) {
+			continue
+		}
+		value := fields[i]
+		if c.cfg.TrimSpace {
+			value = strings.TrimSpace(value)
+		}
+		extracted[n] = value
+	}
+	if Debug {
+		level.Debug(c.logger).Log("msg", "extracted data debug in csv stage", "extracted data", fmt.Sprintf("%v", extracted))
+	}
+	return nil
+}
+
+// splitCSVRecord splits a single CSV record into its fields. A field which
+// starts with quote may contain the delimiter, and quotes inside it are
+// escaped by doubling them. If quote is 0, quoting is disabled.
+func splitCSVRecord(record string, delimiter, quote rune) ([]string, error) {
+	var (
+		fields []string
+		field  strings.Builder
+	)
+	for i := 0; ; {
+		if quote != 0 && strings.HasPrefix(record[i:], string(quote)) {
+			i += utf8.RuneLen(quote)
+			for {
+				j := strings.IndexRune(record[i:], quote)
+				if j < 0 {
+					return nil, errors.New("unterminated quoted field")
+				}
+				field.WriteString(record[i : i+j])
+				i += j + utf8.RuneLen(quote)
+				// A doubled quote is an escaped quote.
+				if !strings.HasPrefix(record[i:], string(quote)) {
+					break
+				}
+				field.WriteRune(quote)
+				i += utf8.RuneLen(quote)
+			}
+		}
+
+		// The rest of the field, including anything between a closing quote
+		// and the next delimiter, is kept as is.
+		end := strings.IndexRune(record[i:], delimiter)
+		if end < 0 {
+			field.WriteString(record[i:])
+			fields = append(fields, field.String())
+			break
+		}
+		field.WriteString(record[i : i+end])
+		fields = append(fields, field.String())
+		field.Reset()
+		i += end + utf8.RuneLen(delimiter)
+	}
+	return fields, nil
+}
+
+// Name implements Stage
+func (c *csvStage) Name() string {
+	return StageTypeCSV
+}
+
+// Cleanup implements Stage.
+func (*csvStage) Cleanup() {
+	// no-op
+}
@@ -0,0 +1,197 @@
+package stages
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/internal/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testCSVRiverSingleStageWithoutSource = `
+stage.csv {
+    columns = ["time", "user", "action", "", "result"]
+}
+`
+
+var testCSVRiverWithExpressions = `
+stage.csv {
+    columns     = ["time", "user", "action", "target", "result"]
+    expressions = { who = "user", result = "" }
+    delimiter   = ";"
+    quote       = "'"
+    trim_space  = true
+}
+`
+
+func TestPipeline_CSV(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		config          string
+		entry           string
+		expectedExtract map[string]interface{}
+	}{
+		"all named columns": {
+			testCSVRiverSingleStageWithoutSource,
+			`2024-01-01T00:00:00Z,jane,"delete, recursive",/tmp,"said ""ok"""`,
+			map[string]interface{}{
+				"time":   "2024-01-01T00:00:00Z",
+				"user":   "jane",
+				"action": "delete, recursive",
+				"result": `said "ok"`,
+			},
+		},
+		"expressions with custom delimiter and quote": {
+			testCSVRiverWithExpressions,
+			`2024-01-01T00:00:00Z; jane ;'login; sso';/;  success`,
+			map[string]interface{}{
+				"who":    "jane",
+				"result": "success",
+			},
+		},
+		"fewer fields than columns": {
+			testCSVRiverSingleStageWithoutSource,
+			`2024-01-01T00:00:00Z,jane`,
+			map[string]interface{}{
+				"time": "2024-01-01T00:00:00Z",
+				"user": "jane",
+			},
+		},
+	}
+
+	for testName, testData := range tests {
+		testData := testData
+
+		t.Run(testName, func(t *testing.T) {
+			t.Parallel()
+
+			logger := util.TestFlowLogger(t)
+			pl, err := NewPipeline(logger, loadConfig(testData.config), nil, prometheus.DefaultRegisterer)
+			require.NoError(t, err)
+
+			out := processEntries(pl, newEntry(nil, nil, testData.entry, time.Now()))[0]
+			assert.Equal(t, testData.expectedExtract, out.Extracted)
+		})
+	}
+}
+
+func TestCSVConfig_validate(t *testing.T) {
+	t.Parallel()
+	emptySource := ""
+
+	tests := map[string]struct {
+		config func(c *CSVConfig)
+		err    string
+	}{
+		"no columns": {
+			func(c *CSVConfig) {},
+			ErrCSVColumnsRequired,
+		},
+		"duplicate column": {
+			func(c *CSVConfig) { c.Columns = []string{"a", "a"} },
+			fmt.Sprintf(ErrCSVDuplicateColumn, "a"),
+		},
+		"unknown column": {
+			func(c *CSVConfig) {
+				c.Columns = []string{"a"}
+				c.Expressions = map[string]string{"b": ""}
+			},
+			fmt.Sprintf(ErrCSVUnknownColumn, "b", "b"),
+		},
+		"invalid delimiter": {
+			func(c *CSVConfig) {
+				c.Columns = []string{"a"}
+				c.Delimiter = "||"
+			},
+			ErrCSVInvalidDelimiter,
+		},
+		"quote same as delimiter": {
+			func(c *CSVConfig) {
+				c.Columns = []string{"a"}
+				c.Quote = ","
+			},
+			ErrCSVInvalidQuote,
+		},
+		"empty source": {
+			func(c *CSVConfig) {
+				c.Columns = []string{"a"}
+				c.Source = &emptySource
+			},
+			ErrEmptyCSVStageSource,
+		},
+		"valid": {
+			func(c *CSVConfig) {
+				c.Columns = []string{"a", "b"}
+				c.Expressions = map[string]string{"x": "a"}
+			},
+			"",
+		},
+	}
+	for tName, tt := range tests {
+		tt := tt
+		t.Run(tName, func(t *testing.T) {
+			var c CSVConfig
+			c.SetToDefault()
+			tt.config(&c)
+
+			_, err := validateCSVConfig(&c)
+			if tt.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSplitCSVRecord(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		record    string
+		quote     rune
+		expect    []string
+		expectErr bool
+	}{
+		{record: "", quote: '"', expect: []string{""}},
+		{record: "a,b,", quote: '"', expect: []string{"a", "b", ""}},
+		{record: `"a,b",c`, quote: '"', expect: []string{"a,b", "c"}},
+		{record: `"a""b"`, quote: '"', expect: []string{`a"b`}},
+		{record: `"a"b,c`, quote: '"', expect: []string{"ab", "c"}},
+		{record: `a"b,c`, quote: '"', expect: []string{`a"b`, "c"}},
+		{record: `"a,b`, quote: '"', expectErr: true},
+		{record: `"a,b",c`, quote: 0, expect: []string{`"a`, `b"`, "c"}},
+	}
+	for _, tt := range tests {
+		fields, err := splitCSVRecord(tt.record, ',', tt.quote)
+		if tt.expectErr {
+			require.Error(t, err, tt.record)
+			continue
+		}
+		require.NoError(t, err, tt.record)
+		require.Equal(t, tt.expect, fields, tt.record)
+	}
+}
+
+func TestCSVStage_Malformed(t *testing.T) {
+	t.Parallel()
+
+	var cfg CSVConfig
+	cfg.SetToDefault()
+	cfg.Columns = []string{"a"}
+	cfg.DropMalformed = true
+
+	s, err := newCSVStage(util.TestFlowLogger(t), cfg)
+	require.NoError(t, err)
+
+	out := processEntries(s,
+		newEntry(nil, nil, `"unterminated`, time.Now()),
+		newEntry(nil, nil, `ok`, time.Now()),
+	)
+	require.Len(t, out, 1)
+	require.Equal(t, map[string]interface{}{"a": "ok"}, out[0].Extracted)
+}
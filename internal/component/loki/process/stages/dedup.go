@@ -0,0 +1,254 @@
+package stages
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/internal/flow/logging/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// Configuration errors.
+var (
+	ErrDedupStageInvalidWindow     = errors.New("dedup stage `window` must be greater than 0")
+	ErrDedupStageInvalidMaxEntries = errors.New("dedup stage `max_entries` must be greater than 0")
+)
+
+var defaultDedupDropReason = "dedup_stage"
+
+// DedupConfig contains the configuration for a dedupStage.
+type DedupConfig struct {
+	Labels           []string      `river:"labels,attr,optional"`
+	IncludeTimestamp bool          `river:"include_timestamp,attr,optional"`
+	Window           time.Duration `river:"window,attr,optional"`
+	MaxEntries       int           `river:"max_entries,attr,optional"`
+	Summary          bool          `river:"summary,attr,optional"`
+	DropReason       string        `river:"drop_counter_reason,attr,optional"`
+}
+
+// DefaultDedupConfig holds the default values of a DedupConfig.
+var DefaultDedupConfig = DedupConfig{
+	Window:     time.Minute,
+	MaxEntries: 100000,
+	DropReason: defaultDedupDropReason,
+}
+
+// SetToDefault implements river.Defaulter.
+func (c *DedupConfig) SetToDefault() {
+	*c = DefaultDedupConfig
+}
+
+// Validate implements river.Validator.
+func (c *DedupConfig) Validate() error {
+	if c.Window <= 0 {
+		return ErrDedupStageInvalidWindow
+	}
+	if c.MaxEntries <= 0 {
+		return ErrDedupStageInvalidMaxEntries
+	}
+	if c.DropReason == "" {
+		c.DropReason = defaultDedupDropReason
+	}
+	return nil
+}
+
+// newDedupStage creates a dedupStage from config.
+func newDedupStage(logger log.Logger, config DedupConfig, registerer prometheus.Registerer) (Stage, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	labels := append([]string(nil), config.Labels...)
+	sort.Strings(labels)
+
+	return &dedupStage{
+		logger:    log.With(logger, "component", "stage", "type", "dedup"),
+		cfg:       config,
+		labels:    labels,
+		dropCount: getDropCountMetric(registerer),
+		now:       time.Now,
+	}, nil
+}
+
+// dedupStage drops entries which were already seen within a time window.
+type dedupStage struct {
+	logger    log.Logger
+	cfg       DedupConfig
+	labels    []string // Sorted names of the labels to hash; all labels if empty.
+	dropCount *prometheus.CounterVec
+	now       func() time.Time
+}
+
+// dedupEntry tracks an entry seen by the stage.
+type dedupEntry struct {
+	hash       uint64
+	expiresAt  time.Time
+	duplicates int
+	first      *Entry    // The first occurrence of the entry, only kept when summaries are enabled.
+	lastSeen   time.Time // The timestamp of the last duplicate.
+}
+
+// dedupState is the state of a running dedup stage. Since the window is the
+// same for every entry, entries are kept in the order they expire in.
+type dedupState struct {
+	entries map[uint64]*list.Element
+	order   *list.List
+}
+
+// Run implements Stage.
+func (d *dedupStage) Run(in chan Entry) chan Entry {
+	out := make(chan Entry)
+	go func() {
+		defer close(out)
+
+		state := &dedupState{
+			entries: make(map[uint64]*list.Element),
+			order:   list.New(),
+		}
+
+		// Expire entries periodically so that summaries are sent even when no
+		// new entries arrive.
+		interval := d.cfg.Window
+		if interval > time.Second {
+			interval = time.Second
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case e, ok := <-in:
+				if !ok {
+					// Send the remaining summaries before shutting down.
+					for state.order.Len() > 0 {
+						d.evict(state, state.order.Front(), out)
+					}
+					return
+				}
+				now := d.now()
+				d.expire(state, now, out)
+				if d.isDuplicate(state, e, now, out) {
+					if Debug {
+						level.Debug(d.logger).Log("msg", "dropping duplicate entry", "labels", e.Labels.String())
+					}
+					d.dropCount.WithLabelValues(d.cfg.DropReason).Inc()
+					continue
+				}
+				out <- e
+			case <-ticker.C:
+				d.expire(state, d.now(), out)
+			}
+		}
+	}()
+	return out
+}
+
+// isDuplicate returns whether e was already seen within the window, and
+// starts tracking it otherwise.
+func (d *dedupStage) isDuplicate(state *dedupState, e Entry, now time.Time, out chan Entry) bool {
+	hash := d.hash(e)
+	if elem, ok := state.entries[hash]; ok {
+		de := elem.Value.(*dedupEntry)
+		de.duplicates++
+		de.lastSeen = e.Timestamp
+		return true
+	}
+
+	// Stay within the memory budget by evicting the entries which would
+	// expire first.
+	for state.order.Len() >= d.cfg.MaxEntries {
+		d.evict(state, state.order.Front(), out)
+	}
+
+	de := &dedupEntry{hash: hash, expiresAt: now.Add(d.cfg.Window)}
+	if d.cfg.Summary {
+		// Later stages may modify the entry, so keep a copy of it.
+		first := e
+		first.Labels = e.Labels.Clone()
+		first.Extracted = make(map[string]interface{}, len(e.Extracted))
+		for k, v := range e.Extracted {
+			first.Extracted[k] = v
+		}
+		de.first = &first
+	}
+	state.entries[hash] = state.order.PushBack(de)
+	return false
+}
+
+// expire evicts the entries whose window has ended.
+func (d *dedupStage) expire(state *dedupState, now time.Time, out chan Entry) {
+	for state.order.Len() > 0 {
+		front := state.order.Front()
+		if now.Before(front.Value.(*dedupEntry).expiresAt) {
+			return
+		}
+		d.evict(state, front, out)
+	}
+}
+
+// evict stops tracking an entry, and sends a summary of its duplicates if
+// summaries are enabled.
+func (d *dedupStage) evict(state *dedupState, elem *list.Element, out chan Entry) {
+	de := elem.Value.(*dedupEntry)
+	state.order.Remove(elem)
+	delete(state.entries, de.hash)
+
+	if de.first == nil || de.duplicates == 0 {
+		return
+	}
+	summary := *de.first
+	summary.Timestamp = de.lastSeen
+	summary.Line = fmt.Sprintf("%s (repeated %d times)", de.first.Line, de.duplicates)
+	out <- summary
+}
+
+// hash returns the hash of the labels, line, and optionally the timestamp of
+// an entry.
+func (d *dedupStage) hash(e Entry) uint64 {
+	h := xxhash.New()
+	writeLabel := func(name model.LabelName, value model.LabelValue) {
+		_, _ = h.WriteString(string(name))
+		_, _ = h.Write([]byte{0xff})
+		_, _ = h.WriteString(string(value))
+		_, _ = h.Write([]byte{0xff})
+	}
+
+	if len(d.labels) == 0 {
+		names := make([]string, 0, len(e.Labels))
+		for name := range e.Labels {
+			names = append(names, string(name))
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			writeLabel(model.LabelName(name), e.Labels[model.LabelName(name)])
+		}
+	} else {
+		for _, name := range d.labels {
+			writeLabel(model.LabelName(name), e.Labels[model.LabelName(name)])
+		}
+	}
+
+	_, _ = h.WriteString(e.Line)
+	if d.cfg.IncludeTimestamp {
+		_, _ = h.Write([]byte{0xff})
+		_, _ = h.WriteString(strconv.FormatInt(e.Timestamp.UnixNano(), 10))
+	}
+	return h.Sum64()
+}
+
+// Name implements Stage.
+func (d *dedupStage) Name() string {
+	return StageTypeDedup
+}
+
+// Cleanup implements Stage.
+func (*dedupStage) Cleanup() {
+	// no-op
+}
@@ -0,0 +1,147 @@
+package stages
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+
+	util_log "github.com/grafana/loki/pkg/util/log"
+)
+
+var testDedupRiver = `
+stage.dedup {
+  labels = ["job"]
+}
+`
+
+var testDedupRiverSummary = `
+stage.dedup {
+  summary = true
+}
+`
+
+func TestDedupPipeline(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	pl, err := NewPipeline(util_log.Logger, loadConfig(testDedupRiver), &plName, registry)
+	require.NoError(t, err)
+
+	ts := time.Unix(1, 0)
+	out := processEntries(pl,
+		newEntry(nil, model.LabelSet{"job": "a", "replica": "1"}, "hello", ts),
+		newEntry(nil, model.LabelSet{"job": "a", "replica": "2"}, "hello", ts.Add(time.Second)),
+		newEntry(nil, model.LabelSet{"job": "b", "replica": "1"}, "hello", ts),
+		newEntry(nil, model.LabelSet{"job": "a", "replica": "1"}, "world", ts),
+	)
+
+	// Only the job label is compared, so the entry from the second replica is
+	// a duplicate.
+	require.Len(t, out, 3)
+	require.Equal(t, model.LabelValue("1"), out[0].Labels["replica"])
+	require.Equal(t, model.LabelValue("b"), out[1].Labels["job"])
+	require.Equal(t, "world", out[2].Line)
+	require.Equal(t, 1.0, testutil.ToFloat64(getDropCountMetric(registry).WithLabelValues(defaultDedupDropReason)))
+}
+
+func TestDedupPipeline_Summary(t *testing.T) {
+	pl, err := NewPipeline(util_log.Logger, loadConfig(testDedupRiverSummary), &plName, prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	ts := time.Unix(1, 0)
+	out := processEntries(pl,
+		newEntry(nil, model.LabelSet{"job": "a"}, "hello", ts),
+		newEntry(nil, model.LabelSet{"job": "a"}, "hello", ts.Add(time.Second)),
+		newEntry(nil, model.LabelSet{"job": "a"}, "hello", ts.Add(2*time.Second)),
+		newEntry(nil, model.LabelSet{"job": "a"}, "world", ts),
+	)
+
+	// Summaries of pending entries are sent when the stage shuts down.
+	require.Len(t, out, 3)
+	require.Equal(t, "hello", out[0].Line)
+	require.Equal(t, "world", out[1].Line)
+	require.Equal(t, "hello (repeated 2 times)", out[2].Line)
+	require.Equal(t, ts.Add(2*time.Second), out[2].Timestamp)
+	require.Equal(t, model.LabelSet{"job": "a"}, out[2].Labels)
+}
+
+func TestDedupStage_Window(t *testing.T) {
+	cfg := DefaultDedupConfig
+	cfg.Summary = true
+	cfg.IncludeTimestamp = true
+
+	s, err := newDedupStage(util_log.Logger, cfg, prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	var now atomic.Int64
+	now.Store(time.Unix(100, 0).UnixNano())
+	s.(*dedupStage).now = func() time.Time { return time.Unix(0, now.Load()) }
+
+	in := make(chan Entry)
+	out := s.Run(in)
+	send := func(line string, ts time.Time) {
+		in <- newEntry(nil, model.LabelSet{"job": "a"}, line, ts)
+	}
+
+	ts := time.Unix(1, 0)
+	send("hello", ts)
+	require.Equal(t, "hello", (<-out).Line)
+
+	// Entries with a different timestamp aren't duplicates.
+	send("hello", ts.Add(time.Second))
+	require.Equal(t, "hello", (<-out).Line)
+
+	now.Add(int64(30 * time.Second))
+	send("hello", ts)
+
+	// Once the window ends, the summary is sent and the entry is no longer a
+	// duplicate.
+	now.Add(int64(31 * time.Second))
+	go send("hello", ts) // The summary may be sent before the entry is received.
+	require.Equal(t, "hello (repeated 1 times)", (<-out).Line)
+	require.Equal(t, "hello", (<-out).Line)
+
+	close(in)
+	_, ok := <-out
+	require.False(t, ok)
+}
+
+func TestDedupStage_MaxEntries(t *testing.T) {
+	cfg := DefaultDedupConfig
+	cfg.MaxEntries = 2
+
+	s, err := newDedupStage(util_log.Logger, cfg, prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	ts := time.Unix(1, 0)
+	out := processEntries(s,
+		newEntry(nil, nil, "a", ts),
+		newEntry(nil, nil, "b", ts),
+		newEntry(nil, nil, "c", ts),
+		// "a" was evicted to make room for "c", so it's no longer a duplicate.
+		newEntry(nil, nil, "a", ts),
+		newEntry(nil, nil, "c", ts),
+	)
+
+	var lines []string
+	for _, e := range out {
+		lines = append(lines, e.Line)
+	}
+	require.Equal(t, []string{"a", "b", "c", "a"}, lines)
+}
+
+func TestDedupConfig_Validate(t *testing.T) {
+	cfg := DefaultDedupConfig
+	cfg.Window = 0
+	require.ErrorIs(t, cfg.Validate(), ErrDedupStageInvalidWindow)
+
+	cfg = DefaultDedupConfig
+	cfg.MaxEntries = 0
+	require.ErrorIs(t, cfg.Validate(), ErrDedupStageInvalidMaxEntries)
+
+	cfg = DefaultDedupConfig
+	require.NoError(t, cfg.Validate())
+}
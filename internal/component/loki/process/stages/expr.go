@@ -0,0 +1,322 @@
+package stages
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/internal/flow/logging/level"
+	"github.com/grafana/loki/pkg/push"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// Config errors.
+const (
+	ErrExprStageNoStatements     = "expr stage requires at least one statement"
+	ErrExprStageInvalidTimeout   = "expr stage timeout must be greater than zero"
+	ErrExprStageInvalidBudget    = "expr stage memory_budget must be greater than zero"
+	ErrExprStageInvalidStatement = "expr stage statement %d could not be compiled: %v"
+)
+
+// Runtime errors.
+var (
+	errExprStageTimeout      = errors.New("expr stage timeout exceeded")
+	errExprStageInvalidLabel = errors.New("invalid label name or value")
+)
+
+// Reasons used by the errors metric of the expr stage.
+const (
+	exprErrorReasonRuntime = "runtime"
+	exprErrorReasonTimeout = "timeout"
+)
+
+var (
+	defaultExprTimeout      = 10 * time.Millisecond
+	defaultExprMemoryBudget = uint(1e6)
+	defaultExprDropReason   = "expr_stage"
+)
+
+// ExprConfig configures a stage which runs a list of statements written in
+// the expr language against every log entry.
+type ExprConfig struct {
+	Statements   []string      `river:"statements,attr"`
+	Timeout      time.Duration `river:"timeout,attr,optional"`
+	MemoryBudget uint          `river:"memory_budget,attr,optional"`
+	DropOnError  bool          `river:"drop_on_error,attr,optional"`
+	DropReason   string        `river:"drop_counter_reason,attr,optional"`
+}
+
+// SetToDefault implements river.Defaulter.
+func (c *ExprConfig) SetToDefault() {
+	*c = ExprConfig{
+		Timeout:      defaultExprTimeout,
+		MemoryBudget: defaultExprMemoryBudget,
+		DropReason:   defaultExprDropReason,
+	}
+}
+
+// Validate implements river.Validator.
+func (c *ExprConfig) Validate() error {
+	_, err := compileExprStatements(*c)
+	return err
+}
+
+// compileExprStatements validates the config and returns the compiled
+// statements in the order they must run.
+func compileExprStatements(c ExprConfig) ([]*vm.Program, error) {
+	if len(c.Statements) == 0 {
+		return nil, errors.New(ErrExprStageNoStatements)
+	}
+	if c.Timeout <= 0 {
+		return nil, errors.New(ErrExprStageInvalidTimeout)
+	}
+	if c.MemoryBudget == 0 {
+		return nil, errors.New(ErrExprStageInvalidBudget)
+	}
+
+	programs := make([]*vm.Program, 0, len(c.Statements))
+	for i, s := range c.Statements {
+		p, err := expr.Compile(s, expr.Env(&exprEnv{}))
+		if err != nil {
+			return nil, fmt.Errorf(ErrExprStageInvalidStatement, i, err)
+		}
+		programs = append(programs, p)
+	}
+	return programs, nil
+}
+
+// exprEnv is the environment the statements of the expr stage run against.
+// Fields hold a copy of the entry being processed, and functions modify that
+// copy. Changes are only applied to the entry once every statement ran
+// successfully.
+type exprEnv struct {
+	Line      string                 `expr:"line"`
+	Labels    map[string]string      `expr:"labels"`
+	Metadata  map[string]string      `expr:"metadata"`
+	Timestamp time.Time              `expr:"timestamp"`
+	Extracted map[string]interface{} `expr:"extracted"`
+
+	SetLine         func(line string) bool                    `expr:"set_line"`
+	SetLabel        func(name, value string) (bool, error)    `expr:"set_label"`
+	DeleteLabel     func(name string) bool                    `expr:"delete_label"`
+	SetMetadata     func(name, value string) (bool, error)    `expr:"set_metadata"`
+	DeleteMetadata  func(name string) bool                    `expr:"delete_metadata"`
+	SetTimestamp    func(ts time.Time) bool                   `expr:"set_timestamp"`
+	SetExtracted    func(name string, value interface{}) bool `expr:"set_extracted"`
+	DeleteExtracted func(name string) bool                    `expr:"delete_extracted"`
+	Drop            func() bool                               `expr:"drop"`
+
+	metadataModified bool
+	dropped          bool
+}
+
+// newExprEnv returns an environment whose functions modify it in place.
+func newExprEnv() *exprEnv {
+	env := &exprEnv{}
+	env.SetLine = func(line string) bool {
+		env.Line = line
+		return true
+	}
+	env.SetLabel = func(name, value string) (bool, error) {
+		if !model.LabelName(name).IsValid() || !model.LabelValue(value).IsValid() {
+			return false, fmt.Errorf("%w: %q=%q", errExprStageInvalidLabel, name, value)
+		}
+		if value == "" {
+			delete(env.Labels, name)
+			return true, nil
+		}
+		env.Labels[name] = value
+		return true, nil
+	}
+	env.DeleteLabel = func(name string) bool {
+		delete(env.Labels, name)
+		return true
+	}
+	env.SetMetadata = func(name, value string) (bool, error) {
+		if !model.LabelName(name).IsValid() || !model.LabelValue(value).IsValid() {
+			return false, fmt.Errorf("%w: %q=%q", errExprStageInvalidLabel, name, value)
+		}
+		env.Metadata[name] = value
+		env.metadataModified = true
+		return true, nil
+	}
+	env.DeleteMetadata = func(name string) bool {
+		if _, ok := env.Metadata[name]; ok {
+			delete(env.Metadata, name)
+			env.metadataModified = true
+		}
+		return true
+	}
+	env.SetTimestamp = func(ts time.Time) bool {
+		env.Timestamp = ts
+		return true
+	}
+	env.SetExtracted = func(name string, value interface{}) bool {
+		env.Extracted[name] = value
+		return true
+	}
+	env.DeleteExtracted = func(name string) bool {
+		delete(env.Extracted, name)
+		return true
+	}
+	env.Drop = func() bool {
+		env.dropped = true
+		return true
+	}
+	return env
+}
+
+// reset copies e into the environment.
+func (env *exprEnv) reset(e *Entry) {
+	env.Line = e.Line
+	env.Timestamp = e.Timestamp
+	env.metadataModified = false
+	env.dropped = false
+
+	env.Labels = make(map[string]string, len(e.Labels))
+	for k, v := range e.Labels {
+		env.Labels[string(k)] = string(v)
+	}
+	env.Metadata = make(map[string]string, len(e.StructuredMetadata))
+	for _, l := range e.StructuredMetadata {
+		env.Metadata[l.Name] = l.Value
+	}
+	env.Extracted = make(map[string]interface{}, len(e.Extracted))
+	for k, v := range e.Extracted {
+		env.Extracted[k] = v
+	}
+}
+
+// apply copies the environment into e.
+func (env *exprEnv) apply(e *Entry) {
+	e.Line = env.Line
+	e.Timestamp = env.Timestamp
+	e.Extracted = env.Extracted
+
+	e.Labels = make(model.LabelSet, len(env.Labels))
+	for k, v := range env.Labels {
+		e.Labels[model.LabelName(k)] = model.LabelValue(v)
+	}
+
+	// Structured metadata is only rebuilt when it changed to keep the
+	// original order otherwise.
+	if env.metadataModified {
+		metadata := make(push.LabelsAdapter, 0, len(env.Metadata))
+		for k, v := range env.Metadata {
+			metadata = append(metadata, push.LabelAdapter{Name: k, Value: v})
+		}
+		sort.Slice(metadata, func(i, j int) bool { return metadata[i].Name < metadata[j].Name })
+		e.StructuredMetadata = metadata
+	}
+}
+
+// exprStage runs expr statements against log entries.
+type exprStage struct {
+	cfg        ExprConfig
+	programs   []*vm.Program
+	logger     log.Logger
+	dropCount  *prometheus.CounterVec
+	errorCount *prometheus.CounterVec
+
+	// now is used to enforce the timeout and can be replaced in tests.
+	now func() time.Time
+}
+
+// newExprStage creates a new expr pipeline stage from a config.
+func newExprStage(logger log.Logger, cfg ExprConfig, registerer prometheus.Registerer) (Stage, error) {
+	programs, err := compileExprStatements(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &exprStage{
+		cfg:        cfg,
+		programs:   programs,
+		logger:     log.With(logger, "component", "stage", "type", "expr"),
+		dropCount:  getDropCountMetric(registerer),
+		errorCount: getExprErrorsMetric(registerer),
+		now:        time.Now,
+	}, nil
+}
+
+// Run implements Stage.
+func (s *exprStage) Run(in chan Entry) chan Entry {
+	out := make(chan Entry)
+	go func() {
+		defer close(out)
+
+		// Entries are processed one at a time, so the environment and the VM
+		// are reused.
+		var (
+			env     = newExprEnv()
+			machine = vm.VM{MemoryBudget: s.cfg.MemoryBudget}
+		)
+		for e := range in {
+			env.reset(&e)
+			if err := s.run(&machine, env); err != nil {
+				if Debug {
+					level.Debug(s.logger).Log("msg", "failed to run expr statements", "err", err)
+				}
+				if s.cfg.DropOnError {
+					s.dropCount.WithLabelValues(s.cfg.DropReason).Inc()
+					continue
+				}
+				// The entry is sent unmodified.
+				out <- e
+				continue
+			}
+			if env.dropped {
+				s.dropCount.WithLabelValues(s.cfg.DropReason).Inc()
+				continue
+			}
+			env.apply(&e)
+			out <- e
+		}
+	}()
+	return out
+}
+
+// run runs every statement against env, stopping early if the entry is
+// dropped. Each statement is limited by the memory budget of the VM, which
+// bounds the number of iterations over collections.
+//
+// The VM can't be interrupted, so the timeout is checked after each statement
+// completes and a running statement is only bounded by the memory budget.
+// Exceeding the timeout fails the entry, even after the last statement.
+func (s *exprStage) run(machine *vm.VM, env *exprEnv) error {
+	start := s.now()
+	for i, p := range s.programs {
+		if _, err := machine.Run(p, env); err != nil {
+			s.errorCount.WithLabelValues(exprErrorReasonRuntime).Inc()
+			return fmt.Errorf("statement %d: %w", i, err)
+		}
+		if s.now().Sub(start) > s.cfg.Timeout {
+			s.errorCount.WithLabelValues(exprErrorReasonTimeout).Inc()
+			return fmt.Errorf("statement %d: %w", i, errExprStageTimeout)
+		}
+		if env.dropped {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Name implements Stage.
+func (s *exprStage) Name() string {
+	return StageTypeExpr
+}
+
+// Cleanup implements Stage.
+func (*exprStage) Cleanup() {
+	// no-op
+}
+
+func getExprErrorsMetric(registerer prometheus.Registerer) *prometheus.CounterVec {
+	return registerCounterVec(registerer, "loki_process", "expr_errors_total",
+		"A count of all log entries the expr stage failed to process, by reason",
+		[]string{"reason"})
+}
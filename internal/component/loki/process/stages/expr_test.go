@@ -0,0 +1,191 @@
+package stages
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/loki/pkg/push"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+
+	util_log "github.com/grafana/loki/pkg/util/log"
+)
+
+var testExprRiver = `
+stage.logfmt {
+  mapping = { level = "", msg = "", ts = "" }
+}
+stage.expr {
+  statements = [
+    "extracted.level == 'debug' ? drop() : nil",
+    "set_label('level', upper(extracted.level))",
+    "set_timestamp(date(extracted.ts))",
+    "set_metadata('file', labels.filename ?? ''); delete_label('filename')",
+    "set_line(extracted.msg); set_extracted('original_length', len(line))",
+  ]
+}
+`
+
+func TestExprPipeline(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	pl, err := NewPipeline(util_log.Logger, loadConfig(testExprRiver), &plName, registry)
+	require.NoError(t, err)
+
+	labels := model.LabelSet{"job": "app", "filename": "/var/log/app.log"}
+	out := processEntries(pl,
+		newEntry(nil, labels.Clone(), `level=debug msg="noisy" ts=2024-01-01T00:00:00Z`, time.Now()),
+		newEntry(nil, labels.Clone(), `level=warn msg="disk almost full" ts=2024-01-01T00:00:01Z`, time.Now()),
+	)
+
+	require.Len(t, out, 1)
+	require.Equal(t, "disk almost full", out[0].Line)
+	require.Equal(t, model.LabelSet{"job": "app", "level": "WARN"}, out[0].Labels)
+	require.Equal(t, push.LabelsAdapter{{Name: "file", Value: "/var/log/app.log"}}, out[0].StructuredMetadata)
+	require.True(t, time.Date(2024, 1, 1, 0, 0, 1, 0, time.UTC).Equal(out[0].Timestamp))
+	// The length is computed after the line was replaced in the same statement.
+	require.Equal(t, 16, out[0].Extracted["original_length"])
+	require.Equal(t, 1.0, testutil.ToFloat64(getDropCountMetric(registry).WithLabelValues(defaultExprDropReason)))
+}
+
+func TestExprStage_Errors(t *testing.T) {
+	for _, dropOnError := range []bool{false, true} {
+		var cfg ExprConfig
+		cfg.SetToDefault()
+		cfg.Statements = []string{
+			"set_line('modified')",
+			"set_label('invalid-name', 'value')",
+		}
+		cfg.DropOnError = dropOnError
+
+		registry := prometheus.NewRegistry()
+		s, err := newExprStage(util_log.Logger, cfg, registry)
+		require.NoError(t, err)
+
+		out := processEntries(s, newEntry(nil, model.LabelSet{"job": "app"}, "original", time.Now()))
+		if dropOnError {
+			require.Empty(t, out)
+		} else {
+			// Changes made before the error aren't applied.
+			require.Len(t, out, 1)
+			require.Equal(t, "original", out[0].Line)
+			require.Equal(t, model.LabelSet{"job": "app"}, out[0].Labels)
+		}
+		require.Equal(t, 1.0, testutil.ToFloat64(getExprErrorsMetric(registry).WithLabelValues(exprErrorReasonRuntime)))
+	}
+}
+
+func TestExprStage_MemoryBudget(t *testing.T) {
+	var cfg ExprConfig
+	cfg.SetToDefault()
+	cfg.Statements = []string{"set_extracted('n', len(filter(1..100000, # % 2 == 0)))"}
+	cfg.MemoryBudget = 1000
+
+	registry := prometheus.NewRegistry()
+	s, err := newExprStage(util_log.Logger, cfg, registry)
+	require.NoError(t, err)
+
+	out := processEntries(s, newEntry(nil, nil, "line", time.Now()))
+	require.Len(t, out, 1)
+	require.NotContains(t, out[0].Extracted, "n")
+	require.Equal(t, 1.0, testutil.ToFloat64(getExprErrorsMetric(registry).WithLabelValues(exprErrorReasonRuntime)))
+}
+
+func TestExprStage_Timeout(t *testing.T) {
+	var cfg ExprConfig
+	cfg.SetToDefault()
+	cfg.Statements = []string{"set_line('first')", "set_line('second')"}
+
+	registry := prometheus.NewRegistry()
+	s, err := newExprStage(util_log.Logger, cfg, registry)
+	require.NoError(t, err)
+
+	// Every call to now advances the clock past the timeout.
+	now := time.Unix(0, 0)
+	s.(*exprStage).now = func() time.Time {
+		now = now.Add(cfg.Timeout + time.Millisecond)
+		return now
+	}
+
+	out := processEntries(s, newEntry(nil, nil, "original", time.Now()))
+	require.Len(t, out, 1)
+	require.Equal(t, "original", out[0].Line)
+	require.Equal(t, 1.0, testutil.ToFloat64(getExprErrorsMetric(registry).WithLabelValues(exprErrorReasonTimeout)))
+}
+
+func TestExprStage_TimeoutDropOnError(t *testing.T) {
+	var cfg ExprConfig
+	cfg.SetToDefault()
+	cfg.Statements = []string{"set_line('first')"}
+	cfg.DropOnError = true
+
+	registry := prometheus.NewRegistry()
+	s, err := newExprStage(util_log.Logger, cfg, registry)
+	require.NoError(t, err)
+
+	now := time.Unix(0, 0)
+	s.(*exprStage).now = func() time.Time {
+		now = now.Add(cfg.Timeout + time.Millisecond)
+		return now
+	}
+
+	// A timeout in the last statement is handled like any other timeout.
+	out := processEntries(s, newEntry(nil, nil, "original", time.Now()))
+	require.Empty(t, out)
+	require.Equal(t, 1.0, testutil.ToFloat64(getExprErrorsMetric(registry).WithLabelValues(exprErrorReasonTimeout)))
+	require.Equal(t, 1.0, testutil.ToFloat64(getDropCountMetric(registry).WithLabelValues(defaultExprDropReason)))
+}
+
+func TestExprConfig_Validate(t *testing.T) {
+	tests := map[string]struct {
+		config func(c *ExprConfig)
+		err    string
+	}{
+		"no statements": {
+			func(c *ExprConfig) {},
+			ErrExprStageNoStatements,
+		},
+		"invalid timeout": {
+			func(c *ExprConfig) {
+				c.Statements = []string{"drop()"}
+				c.Timeout = 0
+			},
+			ErrExprStageInvalidTimeout,
+		},
+		"invalid memory budget": {
+			func(c *ExprConfig) {
+				c.Statements = []string{"drop()"}
+				c.MemoryBudget = 0
+			},
+			ErrExprStageInvalidBudget,
+		},
+		"unknown function": {
+			func(c *ExprConfig) { c.Statements = []string{"drop()", "set_unknown('a')"} },
+			"expr stage statement 1 could not be compiled",
+		},
+		"wrong argument type": {
+			func(c *ExprConfig) { c.Statements = []string{"set_line(1)"} },
+			"expr stage statement 0 could not be compiled",
+		},
+		"valid": {
+			func(c *ExprConfig) { c.Statements = []string{"line contains 'x' ? drop() : nil"} },
+			"",
+		},
+	}
+	for tName, tt := range tests {
+		tt := tt
+		t.Run(tName, func(t *testing.T) {
+			var c ExprConfig
+			c.SetToDefault()
+			tt.config(&c)
+
+			err := c.Validate()
+			if tt.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tt.err)
+			}
+		})
+	}
+}
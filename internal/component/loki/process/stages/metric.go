@@ -1,6 +1,7 @@
 package stages
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math"
@@ -12,7 +13,12 @@ import (
 	"github.com/grafana/agent/internal/component/loki/process/metric"
 	"github.com/grafana/agent/internal/flow/logging/level"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/storage"
 )
 
 // Metric types.
@@ -22,6 +28,9 @@ const (
 	MetricTypeHistogram = "histogram"
 
 	defaultMetricsPrefix = "loki_process_custom_"
+
+	// metricsPruneInterval is how often idle series are removed.
+	metricsPruneInterval = 10 * time.Second
 )
 
 // Configuration errors.
@@ -30,6 +39,7 @@ var (
 	ErrMetricsStageInvalidType = errors.New("invalid metric type: must be one of 'counter', 'gauge', or 'histogram'")
 	ErrInvalidIdleDur          = errors.New("max_idle_duration could not be parsed as a time.Duration")
 	ErrSubSecIdleDur           = errors.New("max_idle_duration less than 1s not allowed")
+	ErrInvalidForwardInterval  = errors.New("forward_interval must be greater than 0")
 )
 
 // MetricConfig is a single metrics configuration.
@@ -42,7 +52,27 @@ type MetricConfig struct {
 
 // MetricsConfig is a set of configured metrics.
 type MetricsConfig struct {
-	Metrics []MetricConfig `river:"metric,enum,optional"`
+	Metrics         []MetricConfig       `river:"metric,enum,optional"`
+	ForwardTo       []storage.Appendable `river:"forward_to,attr,optional"`
+	ForwardInterval time.Duration        `river:"forward_interval,attr,optional"`
+}
+
+// DefaultMetricsConfig sets the defaults for a MetricsConfig.
+var DefaultMetricsConfig = MetricsConfig{
+	ForwardInterval: 15 * time.Second,
+}
+
+// SetToDefault implements river.Defaulter.
+func (m *MetricsConfig) SetToDefault() {
+	*m = DefaultMetricsConfig
+}
+
+// Validate implements river.Validator.
+func (m *MetricsConfig) Validate() error {
+	if len(m.ForwardTo) > 0 && m.ForwardInterval <= 0 {
+		return ErrInvalidForwardInterval
+	}
+	return nil
 }
 
 type cfgCollector struct {
@@ -50,12 +80,34 @@ type cfgCollector struct {
 	collector prometheus.Collector
 }
 
+// metricVec is implemented by the vectors of every metric type.
+type metricVec interface {
+	prometheus.Collector
+	OnOverflow(f func())
+	Prune()
+}
+
 // newMetricStage creates a new set of metrics to process for each log entry
 func newMetricStage(logger log.Logger, config MetricsConfig, registry prometheus.Registerer) (Stage, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	// When series are forwarded, they are also gathered from a registry
+	// private to the stage.
+	var gatherer *prometheus.Registry
+	if len(config.ForwardTo) > 0 {
+		gatherer = prometheus.NewRegistry()
+	}
+	overflows := getMetricSeriesOverflowsMetric(registry)
+
 	metrics := map[string]cfgCollector{}
 	for _, cfg := range config.Metrics {
-		var collector prometheus.Collector
-		var err error
+		var (
+			name      string
+			collector metricVec
+			err       error
+		)
 
 		switch {
 		case cfg.Counter != nil:
@@ -65,13 +117,11 @@ func newMetricStage(logger log.Logger, config MetricsConfig, registry prometheus
 			} else {
 				customPrefix = defaultMetricsPrefix
 			}
+			name = cfg.Counter.Name
 			collector, err = metric.NewCounters(customPrefix+cfg.Counter.Name, cfg.Counter)
 			if err != nil {
 				return nil, err
 			}
-			// It is safe to .MustRegister here because the metric created above is unchecked.
-			registry.MustRegister(collector)
-			metrics[cfg.Counter.Name] = cfgCollector{cfg: cfg, collector: collector}
 		case cfg.Gauge != nil:
 			customPrefix := ""
 			if cfg.Gauge.Prefix != "" {
@@ -79,13 +129,11 @@ func newMetricStage(logger log.Logger, config MetricsConfig, registry prometheus
 			} else {
 				customPrefix = defaultMetricsPrefix
 			}
+			name = cfg.Gauge.Name
 			collector, err = metric.NewGauges(customPrefix+cfg.Gauge.Name, cfg.Gauge)
 			if err != nil {
 				return nil, err
 			}
-			// It is safe to .MustRegister here because the metric created above is unchecked.
-			registry.MustRegister(collector)
-			metrics[cfg.Gauge.Name] = cfgCollector{cfg: cfg, collector: collector}
 		case cfg.Histogram != nil:
 			customPrefix := ""
 			if cfg.Histogram.Prefix != "" {
@@ -93,35 +141,47 @@ func newMetricStage(logger log.Logger, config MetricsConfig, registry prometheus
 			} else {
 				customPrefix = defaultMetricsPrefix
 			}
+			name = cfg.Histogram.Name
 			collector, err = metric.NewHistograms(customPrefix+cfg.Histogram.Name, cfg.Histogram)
 			if err != nil {
 				return nil, err
 			}
-			// It is safe to .MustRegister here because the metric created above is unchecked.
-			registry.MustRegister(collector)
-			metrics[cfg.Histogram.Name] = cfgCollector{cfg: cfg, collector: collector}
 		default:
 			return nil, fmt.Errorf("undefined stage type in '%v', exiting", cfg)
 		}
+
+		collector.OnOverflow(func() { overflows.WithLabelValues(name).Inc() })
+
+		// It is safe to .MustRegister here because the metric created above is unchecked.
+		registry.MustRegister(collector)
+		if gatherer != nil {
+			gatherer.MustRegister(collector)
+		}
+		metrics[name] = cfgCollector{cfg: cfg, collector: collector}
 	}
 	return &metricStage{
-		logger:  logger,
-		cfg:     config,
-		metrics: metrics,
+		logger:   logger,
+		cfg:      config,
+		metrics:  metrics,
+		gatherer: gatherer,
 	}, nil
 }
 
 // metricStage creates and updates prometheus metrics based on extracted pipeline data
 type metricStage struct {
-	logger  log.Logger
-	cfg     MetricsConfig
-	metrics map[string]cfgCollector
+	logger   log.Logger
+	cfg      MetricsConfig
+	metrics  map[string]cfgCollector
+	gatherer *prometheus.Registry // Only set when series are forwarded.
 }
 
 func (m *metricStage) Run(in chan Entry) chan Entry {
 	out := make(chan Entry)
+	done := make(chan struct{})
+	go m.maintain(done)
 	go func() {
 		defer close(out)
+		defer close(done)
 
 		for e := range in {
 			m.Process(e.Labels, e.Extracted, &e.Timestamp, &e.Line)
@@ -131,6 +191,142 @@ func (m *metricStage) Run(in chan Entry) chan Entry {
 	return out
 }
 
+// maintain removes idle series, and forwards series to the configured
+// appendables if there are any, until done is closed.
+func (m *metricStage) maintain(done chan struct{}) {
+	pruneTicker := time.NewTicker(metricsPruneInterval)
+	defer pruneTicker.Stop()
+
+	var forwardC <-chan time.Time
+	if m.gatherer != nil {
+		forwardTicker := time.NewTicker(m.cfg.ForwardInterval)
+		defer forwardTicker.Stop()
+		forwardC = forwardTicker.C
+	}
+
+	// forwarded holds the series sent by the last forward, so that the series
+	// which are gone can be marked as stale.
+	var forwarded map[uint64]labels.Labels
+	for {
+		select {
+		case <-done:
+			if len(forwarded) > 0 {
+				m.appendSamples(nil, forwarded, time.Now())
+			}
+			return
+		case <-pruneTicker.C:
+			for _, cc := range m.metrics {
+				cc.collector.(metricVec).Prune()
+			}
+		case <-forwardC:
+			forwarded = m.forward(forwarded, time.Now())
+		}
+	}
+}
+
+// forwardedSample is a sample of a forwarded series.
+type forwardedSample struct {
+	labels labels.Labels
+	value  float64
+}
+
+// forward appends the current value of every series to the forward_to
+// appendables, along with stale markers for the series in prev which are
+// gone. It returns the series which were appended.
+func (m *metricStage) forward(prev map[uint64]labels.Labels, now time.Time) map[uint64]labels.Labels {
+	// Gathering prunes idle series.
+	families, err := m.gatherer.Gather()
+	if err != nil {
+		level.Warn(m.logger).Log("msg", "failed to gather metrics to forward", "err", err)
+	}
+
+	var samples []forwardedSample
+	for _, mf := range families {
+		samples = appendFamilySamples(samples, mf)
+	}
+
+	current := make(map[uint64]labels.Labels, len(samples))
+	for _, s := range samples {
+		current[s.labels.Hash()] = s.labels
+	}
+	stale := make(map[uint64]labels.Labels)
+	for h, l := range prev {
+		if _, ok := current[h]; !ok {
+			stale[h] = l
+		}
+	}
+
+	m.appendSamples(samples, stale, now)
+	return current
+}
+
+// appendSamples appends samples and stale markers for the stale series to
+// every forward_to appendable.
+func (m *metricStage) appendSamples(samples []forwardedSample, stale map[uint64]labels.Labels, now time.Time) {
+	ts := timestamp.FromTime(now)
+	for _, appendable := range m.cfg.ForwardTo {
+		app := appendable.Appender(context.Background())
+		for _, s := range samples {
+			if _, err := app.Append(0, s.labels, ts, s.value); err != nil {
+				level.Warn(m.logger).Log("msg", "failed to append forwarded sample", "series", s.labels, "err", err)
+			}
+		}
+		for _, l := range stale {
+			if _, err := app.Append(0, l, ts, math.Float64frombits(value.StaleNaN)); err != nil {
+				level.Warn(m.logger).Log("msg", "failed to append stale marker", "series", l, "err", err)
+			}
+		}
+		if err := app.Commit(); err != nil {
+			level.Warn(m.logger).Log("msg", "failed to commit forwarded samples", "err", err)
+		}
+	}
+}
+
+// appendFamilySamples appends a sample for every series of mf to samples.
+// Histograms are converted to their _bucket, _sum and _count series.
+func appendFamilySamples(samples []forwardedSample, mf *dto.MetricFamily) []forwardedSample {
+	name := mf.GetName()
+	for _, m := range mf.GetMetric() {
+		lb := labels.NewScratchBuilder(len(m.GetLabel()) + 2)
+		for _, l := range m.GetLabel() {
+			lb.Add(l.GetName(), l.GetValue())
+		}
+		series := func(suffix string, extra ...string) labels.Labels {
+			b := labels.NewBuilder(lb.Labels())
+			b.Set(model.MetricNameLabel, name+suffix)
+			for i := 0; i+1 < len(extra); i += 2 {
+				b.Set(extra[i], extra[i+1])
+			}
+			return b.Labels()
+		}
+
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			samples = append(samples, forwardedSample{series(""), m.GetCounter().GetValue()})
+		case dto.MetricType_GAUGE:
+			samples = append(samples, forwardedSample{series(""), m.GetGauge().GetValue()})
+		case dto.MetricType_HISTOGRAM:
+			h := m.GetHistogram()
+			hasInf := false
+			for _, b := range h.GetBucket() {
+				le := strconv.FormatFloat(b.GetUpperBound(), 'g', -1, 64)
+				if math.IsInf(b.GetUpperBound(), 1) {
+					le, hasInf = "+Inf", true
+				}
+				samples = append(samples, forwardedSample{series("_bucket", model.BucketLabel, le), float64(b.GetCumulativeCount())})
+			}
+			if !hasInf {
+				samples = append(samples, forwardedSample{series("_bucket", model.BucketLabel, "+Inf"), float64(h.GetSampleCount())})
+			}
+			samples = append(samples,
+				forwardedSample{series("_sum"), h.GetSampleSum()},
+				forwardedSample{series("_count"), float64(h.GetSampleCount())},
+			)
+		}
+	}
+	return samples
+}
+
 // Process implements Stage
 func (m *metricStage) Process(labels model.LabelSet, extracted map[string]interface{}, t *time.Time, entry *string) {
 	for name, cc := range m.metrics {
@@ -302,6 +498,12 @@ func (m *metricStage) recordHistogram(name string, histogram *metric.Histograms,
 	histogram.With(labels).Observe(f)
 }
 
+func getMetricSeriesOverflowsMetric(registerer prometheus.Registerer) *prometheus.CounterVec {
+	return registerCounterVec(registerer, "loki_process", "metric_series_overflows_total",
+		"A count of all metric updates sent to the overflow series because max_series was reached, by metric",
+		[]string{"name"})
+}
+
 // getFloat will take the provided value and return a float64 if possible
 func getFloat(unk interface{}) (float64, error) {
 	switch i := unk.(type) {
@@ -3,15 +3,21 @@ package stages
 import (
 	"bytes"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/go-kit/log"
 	"github.com/grafana/agent/internal/component/loki/process/metric"
+	prom "github.com/grafana/agent/internal/component/prometheus"
+	"github.com/grafana/agent/internal/service/labelstore"
 	util_log "github.com/grafana/loki/pkg/util/log"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/storage"
 	"github.com/stretchr/testify/require"
 )
 
@@ -570,3 +576,55 @@ loki_process_custom_response_time_seconds_count{baz="fu",fu="baz"} 1.0
 loki_process_custom_total_keys{bar="foo",foo="bar"} 8.0
 loki_process_custom_total_keys{baz="fu",fu="baz"} 8.0
 `
+
+func TestMetricStage_Forward(t *testing.T) {
+	var (
+		mut     sync.Mutex
+		samples = map[string]float64{}
+	)
+	appendable := prom.NewInterceptor(nil, labelstore.New(nil, prometheus.NewRegistry()),
+		prom.WithAppendHook(func(ref storage.SeriesRef, l labels.Labels, _ int64, v float64, _ storage.Appender) (storage.SeriesRef, error) {
+			mut.Lock()
+			defer mut.Unlock()
+			samples[l.String()] = v
+			return ref, nil
+		}))
+
+	cfg := DefaultMetricsConfig
+	cfg.ForwardTo = []storage.Appendable{appendable}
+	cfg.Metrics = []MetricConfig{
+		{Counter: &metric.CounterConfig{Name: "lines", MatchAll: true, Action: metric.CounterInc, MaxIdle: time.Minute, MaxSeries: 1}},
+		{Histogram: &metric.HistogramConfig{Name: "size", Source: "size", Buckets: []float64{10}, MaxIdle: time.Minute}},
+	}
+
+	registry := prometheus.NewRegistry()
+	s, err := newMetricStage(util_log.Logger, cfg, registry)
+	require.NoError(t, err)
+
+	processEntries(s,
+		newEntry(map[string]interface{}{"size": 5}, model.LabelSet{"app": "a"}, "line", time.Now()),
+		newEntry(map[string]interface{}{"size": 20}, model.LabelSet{"app": "b"}, "line", time.Now()),
+	)
+	require.Equal(t, 1.0, testutil.ToFloat64(getMetricSeriesOverflowsMetric(registry).WithLabelValues("lines")))
+
+	ms := s.(*metricStage)
+	forwarded := ms.forward(nil, time.Now())
+	require.Equal(t, map[string]float64{
+		`{__name__="loki_process_custom_lines", app="a"}`:                  1,
+		`{__name__="loki_process_custom_lines", overflow="true"}`:          1,
+		`{__name__="loki_process_custom_size_bucket", app="a", le="10"}`:   1,
+		`{__name__="loki_process_custom_size_bucket", app="a", le="+Inf"}`: 1,
+		`{__name__="loki_process_custom_size_sum", app="a"}`:               5,
+		`{__name__="loki_process_custom_size_count", app="a"}`:             1,
+		`{__name__="loki_process_custom_size_bucket", app="b", le="10"}`:   0,
+		`{__name__="loki_process_custom_size_bucket", app="b", le="+Inf"}`: 1,
+		`{__name__="loki_process_custom_size_sum", app="b"}`:               20,
+		`{__name__="loki_process_custom_size_count", app="b"}`:             1,
+	}, samples)
+
+	// Series which are gone are marked as stale.
+	ms.metrics["size"].collector.(*metric.Histograms).DeleteAll()
+	ms.forward(forwarded, time.Now())
+	require.True(t, value.IsStaleNaN(samples[`{__name__="loki_process_custom_size_count", app="b"}`]))
+	require.Equal(t, 1.0, samples[`{__name__="loki_process_custom_lines", app="a"}`])
+}
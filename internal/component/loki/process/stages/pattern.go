@@ -0,0 +1,121 @@
+package stages
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/internal/flow/logging/level"
+	"github.com/grafana/loki/pkg/logql/log/pattern"
+	"github.com/prometheus/common/model"
+)
+
+// Config Errors.
+var (
+	ErrPatternRequired         = errors.New("pattern is required")
+	ErrCouldNotCompilePattern  = errors.New("could not compile pattern")
+	ErrEmptyPatternStageSource = errors.New("empty source")
+)
+
+// PatternConfig configures a processing stage which uses LogQL pattern
+// expressions to extract values from log lines into the shared values map.
+type PatternConfig struct {
+	Pattern string  `river:"pattern,attr"`
+	Source  *string `river:"source,attr,optional"`
+}
+
+// validatePatternConfig validates the config and returns a pattern matcher.
+func validatePatternConfig(c PatternConfig) (pattern.Matcher, error) {
+	if c.Pattern == "" {
+		return nil, ErrPatternRequired
+	}
+
+	if c.Source != nil && *c.Source == "" {
+		return nil, ErrEmptyPatternStageSource
+	}
+
+	matcher, err := pattern.New(c.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", ErrCouldNotCompilePattern, err)
+	}
+
+	// Use the same validation as the pattern parser in LogQL, so that a
+	// pattern which works in a query also works here and vice versa.
+	for _, name := range matcher.Names() {
+		if !model.LabelName(name).IsValid() {
+			return nil, fmt.Errorf("%v: invalid capture name %q", ErrCouldNotCompilePattern, name)
+		}
+	}
+
+	return matcher, nil
+}
+
+// patternStage sets extracted data using LogQL pattern expressions.
+type patternStage struct {
+	config  *PatternConfig
+	matcher pattern.Matcher
+	logger  log.Logger
+}
+
+// newPatternStage creates a new pattern stage.
+func newPatternStage(logger log.Logger, config PatternConfig) (Stage, error) {
+	matcher, err := validatePatternConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return toStage(&patternStage{
+		config:  &config,
+		matcher: matcher,
+		logger:  log.With(logger, "component", "stage", "type", "pattern"),
+	}), nil
+}
+
+// Process implements Stage
+func (p *patternStage) Process(labels model.LabelSet, extracted map[string]interface{}, t *time.Time, entry *string) {
+	// If a source key is provided, the pattern stage should process it
+	// from the extracted map, otherwise should fall back to the entry
+	input := entry
+
+	if p.config.Source != nil {
+		if _, ok := extracted[*p.config.Source]; !ok {
+			level.Debug(p.logger).Log("msg", "source does not exist in the set of extracted values", "source", *p.config.Source)
+			return
+		}
+
+		value, err := getString(extracted[*p.config.Source])
+		if err != nil {
+			level.Debug(p.logger).Log("msg", "failed to convert source value to string", "source", *p.config.Source, "err", err, "type", reflect.TypeOf(extracted[*p.config.Source]))
+			return
+		}
+
+		input = &value
+	}
+
+	if input == nil {
+		level.Debug(p.logger).Log("msg", "cannot parse a nil entry")
+		return
+	}
+
+	// Matches reuses the slice it returns between calls, which is safe since
+	// a stage processes one entry at a time. Like in LogQL, a line which
+	// doesn't contain every literal still populates the captures before the
+	// first missing literal.
+	matches := p.matcher.Matches([]byte(*input))
+	if len(matches) == 0 {
+		level.Debug(p.logger).Log("msg", "pattern did not match", "input", *input, "pattern", p.config.Pattern)
+		return
+	}
+
+	names := p.matcher.Names()
+	for i, match := range matches {
+		extracted[names[i]] = string(match)
+	}
+	level.Debug(p.logger).Log("msg", "extracted data debug in pattern stage", "extracted data", fmt.Sprintf("%v", extracted))
+}
+
+// Name implements Stage
+func (p *patternStage) Name() string {
+	return StageTypePattern
+}
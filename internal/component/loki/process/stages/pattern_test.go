@@ -0,0 +1,241 @@
+package stages
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/internal/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testPatternRiverSingleStageWithoutSource = "\n" +
+	"stage.pattern {\n" +
+	"    pattern = `<ip> - <user> [<timestamp>] \"<method> <path> <protocol>\" <status> <size> \"<referer>\" \"<useragent>\"`\n" +
+	"}\n"
+
+var testPatternRiverMultiStageWithSource = testPatternRiverSingleStageWithoutSource + `
+stage.pattern {
+    pattern = "HTTP/<protocol_version>"
+    source  = "protocol"
+}
+`
+
+func TestPipeline_Pattern(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		config          string
+		entry           string
+		expectedExtract map[string]interface{}
+	}{
+		"successfully run a pipeline with 1 pattern stage without source": {
+			testPatternRiverSingleStageWithoutSource,
+			testRegexLogLine,
+			map[string]interface{}{
+				"ip":        "11.11.11.11",
+				"user":      "frank",
+				"timestamp": "25/Jan/2000:14:00:01 -0500",
+				"method":    "GET",
+				"path":      "/1986.js",
+				"protocol":  "HTTP/1.1",
+				"status":    "200",
+				"size":      "932",
+				"referer":   "-",
+				"useragent": "Mozilla/5.0 (Windows; U; Windows NT 5.1; de; rv:1.9.1.7) Gecko/20091221 Firefox/3.5.7 GTB6",
+			},
+		},
+		"successfully run a pipeline with 2 pattern stages with source": {
+			testPatternRiverMultiStageWithSource,
+			testRegexLogLine,
+			map[string]interface{}{
+				"ip":               "11.11.11.11",
+				"user":             "frank",
+				"timestamp":        "25/Jan/2000:14:00:01 -0500",
+				"method":           "GET",
+				"path":             "/1986.js",
+				"protocol":         "HTTP/1.1",
+				"protocol_version": "1.1",
+				"status":           "200",
+				"size":             "932",
+				"referer":          "-",
+				"useragent":        "Mozilla/5.0 (Windows; U; Windows NT 5.1; de; rv:1.9.1.7) Gecko/20091221 Firefox/3.5.7 GTB6",
+			},
+		},
+	}
+
+	for testName, testData := range tests {
+		testData := testData
+
+		t.Run(testName, func(t *testing.T) {
+			t.Parallel()
+
+			logger := util.TestFlowLogger(t)
+			pl, err := NewPipeline(logger, loadConfig(testData.config), nil, prometheus.DefaultRegisterer)
+			require.NoError(t, err)
+
+			out := processEntries(pl, newEntry(nil, nil, testData.entry, time.Now()))[0]
+			assert.Equal(t, testData.expectedExtract, out.Extracted)
+		})
+	}
+}
+
+func TestPatternConfig_validate(t *testing.T) {
+	t.Parallel()
+	emptySource := ""
+
+	tests := map[string]struct {
+		config PatternConfig
+		err    string
+	}{
+		"missing pattern": {
+			PatternConfig{},
+			ErrPatternRequired.Error(),
+		},
+		"no captures": {
+			PatternConfig{Pattern: "<_> foo"},
+			"could not compile pattern: at least one capture is required",
+		},
+		"consecutive captures": {
+			PatternConfig{Pattern: "<foo><bar>"},
+			"could not compile pattern: found consecutive capture '<foo><bar>': invalid expression",
+		},
+		"duplicate captures": {
+			PatternConfig{Pattern: "<foo> <foo>"},
+			"could not compile pattern: duplicate capture name (foo): invalid expression",
+		},
+		"empty source": {
+			PatternConfig{Pattern: "<foo> bar", Source: &emptySource},
+			ErrEmptyPatternStageSource.Error(),
+		},
+		"valid without source": {
+			PatternConfig{Pattern: "<foo> bar"},
+			"",
+		},
+		"valid with source": {
+			PatternConfig{Pattern: "<foo> bar", Source: &protocolStr},
+			"",
+		},
+	}
+	for tName, tt := range tests {
+		tt := tt
+		t.Run(tName, func(t *testing.T) {
+			_, err := validatePatternConfig(tt.config)
+			if tt.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestPatternParser_Parse(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		config          PatternConfig
+		extracted       map[string]interface{}
+		entry           string
+		expectedExtract map[string]interface{}
+	}{
+		"successfully match pattern on entry": {
+			PatternConfig{
+				Pattern: `<ip> - <_> [<_>] "<method> <path> <_>" <status> <_>`,
+			},
+			map[string]interface{}{},
+			testRegexLogLine,
+			map[string]interface{}{
+				"ip":     "11.11.11.11",
+				"method": "GET",
+				"path":   "/1986.js",
+				"status": "200",
+			},
+		},
+		"successfully match pattern on extracted[source]": {
+			PatternConfig{
+				Pattern: "HTTP/<protocol_version>",
+				Source:  &protocolStr,
+			},
+			map[string]interface{}{
+				"protocol": "HTTP/1.1",
+			},
+			testRegexLogLine,
+			map[string]interface{}{
+				"protocol":         "HTTP/1.1",
+				"protocol_version": "1.1",
+			},
+		},
+		"partial match captures the rest of the line": {
+			PatternConfig{
+				Pattern: "<level> <msg> [<component>]",
+			},
+			map[string]interface{}{},
+			"info starting up",
+			map[string]interface{}{
+				"level": "info",
+				"msg":   "starting up",
+			},
+		},
+		"failed to match leading literal": {
+			PatternConfig{
+				Pattern: "level=<level> <_>",
+			},
+			map[string]interface{}{},
+			"msg=starting level=info",
+			map[string]interface{}{},
+		},
+		"missing extracted[source]": {
+			PatternConfig{
+				Pattern: "HTTP/<protocol_version>",
+				Source:  &protocolStr,
+			},
+			map[string]interface{}{},
+			"blahblahblah",
+			map[string]interface{}{},
+		},
+		"invalid data type in extracted[source]": {
+			PatternConfig{
+				Pattern: "HTTP/<protocol_version>",
+				Source:  &protocolStr,
+			},
+			map[string]interface{}{
+				"protocol": true,
+			},
+			"unknown/unknown",
+			map[string]interface{}{
+				"protocol": true,
+			},
+		},
+	}
+	for tName, tt := range tests {
+		tt := tt
+		t.Run(tName, func(t *testing.T) {
+			t.Parallel()
+			logger := util.TestFlowLogger(t)
+			p, err := New(logger, nil, StageConfig{PatternConfig: &tt.config}, nil)
+			require.NoError(t, err)
+			out := processEntries(p, newEntry(tt.extracted, nil, tt.entry, time.Now()))[0]
+			assert.Equal(t, tt.expectedExtract, out.Extracted)
+		})
+	}
+}
+
+func BenchmarkPatternStage(b *testing.B) {
+	logger := util.TestFlowLogger(b)
+	stage, err := New(logger, nil, StageConfig{PatternConfig: &PatternConfig{
+		Pattern: `<ip> - <user> [<timestamp>] "<method> <path> <protocol>" <status> <size> "<referer>" "<useragent>"`,
+	}}, nil)
+	require.NoError(b, err)
+
+	in := make(chan Entry)
+	out := stage.Run(in)
+	go func() {
+		for range out {
+		}
+	}()
+	for i := 0; i < b.N; i++ {
+		in <- newEntry(nil, nil, testRegexLogLine, time.Now())
+	}
+	close(in)
+}
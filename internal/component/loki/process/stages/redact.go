@@ -0,0 +1,361 @@
+package stages
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/internal/flow/logging/level"
+	"github.com/grafana/river/rivertypes"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Config errors.
+const (
+	ErrRedactStageInvalidAction  = "redact stage action must be one of %q, %q or %q, received %q"
+	ErrRedactStageUnknownRule    = "redact stage rule %q does not exist"
+	ErrRedactStageNoRules        = "redact stage must have at least one rule"
+	ErrRedactStageEmptyRuleName  = "redact stage custom_rule must have a name"
+	ErrRedactStageDuplicateRule  = "redact stage rule %q is defined more than once"
+	ErrRedactStageInvalidRegex   = "redact stage custom_rule %q regex compilation error: %v"
+	ErrRedactStageMissingHashKey = "redact stage hash_salt is required when action is %q"
+)
+
+// Actions supported by the redact stage.
+const (
+	RedactActionMask = "mask"
+	RedactActionHash = "hash"
+	RedactActionDrop = "drop"
+)
+
+// redactSecretGroup is the name of the capture group which limits redaction
+// to a part of the match.
+const redactSecretGroup = "secret"
+
+var (
+	defaultRedactReplacement = "**REDACTED**"
+	defaultRedactDropReason  = "redact_stage"
+)
+
+// redactRule is a rule used by the redact stage to find sensitive data.
+type redactRule struct {
+	name  string
+	regex *regexp.Regexp
+	// valid, if set, further checks a match of regex at input[start:end].
+	valid func(input string, start, end int) bool
+}
+
+// builtinRedactRules are the rules which the redact stage uses by default,
+// in the order they are applied. When the matches of two rules overlap, the
+// match of the rule which comes first wins.
+var builtinRedactRules = []redactRule{
+	{
+		name:  "private_key",
+		regex: regexp.MustCompile(`(?s)-----BEGIN[A-Z ]*PRIVATE KEY( BLOCK)?-----.*?-----END[A-Z ]*PRIVATE KEY( BLOCK)?-----`),
+	},
+	{
+		name:  "aws_access_key_id",
+		regex: regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16}\b`),
+	},
+	{
+		name:  "aws_secret_access_key",
+		regex: regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?(?P<secret>[A-Za-z0-9/+]{40})\b`),
+	},
+	{
+		name:  "gcp_api_key",
+		regex: regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}\b`),
+	},
+	{
+		name:  "azure_storage_key",
+		regex: regexp.MustCompile(`(?i)AccountKey=(?P<secret>[A-Za-z0-9+/]{86}==)`),
+	},
+	{
+		name:  "jwt",
+		regex: regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]+\.eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+`),
+	},
+	{
+		name:  "bearer_token",
+		regex: regexp.MustCompile(`(?i)\bbearer\s+(?P<secret>[A-Za-z0-9\-._~+/]+=*)`),
+	},
+	{
+		name:  "email",
+		regex: regexp.MustCompile(`\b[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}\b`),
+	},
+	{
+		name:  "ipv4",
+		regex: regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])\.){3}(?:25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])\b`),
+	},
+	{
+		// RE2 can't express the IPv6 grammar concisely, so candidates are
+		// checked with the standard library parser.
+		name:  "ipv6",
+		regex: regexp.MustCompile(`(?i)(?:[0-9a-f]{0,4}:){2,7}(?:(?:[0-9]{1,3}\.){3}[0-9]{1,3}|[0-9a-f]{0,4})`),
+		valid: isIPv6,
+	},
+}
+
+// isIPv6 reports whether input[start:end] is a standalone IPv6 address.
+func isIPv6(input string, start, end int) bool {
+	isPart := func(c byte) bool {
+		return c == ':' || c == '.' || c == '_' ||
+			('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+	}
+	if (start > 0 && isPart(input[start-1])) || (end < len(input) && isPart(input[end])) {
+		return false
+	}
+	addr, err := netip.ParseAddr(input[start:end])
+	return err == nil && addr.Is6()
+}
+
+// RedactConfig configures a stage which redacts sensitive data from log
+// lines.
+type RedactConfig struct {
+	Rules       []string          `river:"rules,attr,optional"`
+	CustomRules []RedactRule      `river:"custom_rule,block,optional"`
+	Action      string            `river:"action,attr,optional"`
+	Replacement string            `river:"replacement,attr,optional"`
+	HashSalt    rivertypes.Secret `river:"hash_salt,attr,optional"`
+	DropReason  string            `river:"drop_counter_reason,attr,optional"`
+}
+
+// RedactRule configures a custom rule of the redact stage.
+type RedactRule struct {
+	Name  string `river:"name,attr"`
+	Regex string `river:"regex,attr"`
+}
+
+// SetToDefault implements river.Defaulter.
+func (c *RedactConfig) SetToDefault() {
+	*c = RedactConfig{
+		Action:      RedactActionMask,
+		Replacement: defaultRedactReplacement,
+		DropReason:  defaultRedactDropReason,
+	}
+	for _, r := range builtinRedactRules {
+		c.Rules = append(c.Rules, r.name)
+	}
+}
+
+// Validate implements river.Validator.
+func (c *RedactConfig) Validate() error {
+	_, err := buildRedactRules(*c)
+	return err
+}
+
+// buildRedactRules validates the config and returns the rules to apply in
+// order: the enabled built-in rules followed by the custom rules.
+func buildRedactRules(c RedactConfig) ([]redactRule, error) {
+	switch c.Action {
+	case RedactActionMask, RedactActionDrop:
+	case RedactActionHash:
+		if c.HashSalt == "" {
+			return nil, fmt.Errorf(ErrRedactStageMissingHashKey, RedactActionHash)
+		}
+	default:
+		return nil, fmt.Errorf(ErrRedactStageInvalidAction, RedactActionMask, RedactActionHash, RedactActionDrop, c.Action)
+	}
+
+	var (
+		rules []redactRule
+		seen  = make(map[string]struct{})
+	)
+	addRule := func(r redactRule) error {
+		if _, ok := seen[r.name]; ok {
+			return fmt.Errorf(ErrRedactStageDuplicateRule, r.name)
+		}
+		seen[r.name] = struct{}{}
+		rules = append(rules, r)
+		return nil
+	}
+
+	enabled := make(map[string]struct{}, len(c.Rules))
+	for _, name := range c.Rules {
+		if !isBuiltinRedactRule(name) {
+			return nil, fmt.Errorf(ErrRedactStageUnknownRule, name)
+		}
+		enabled[name] = struct{}{}
+	}
+	// Built-in rules are always applied in their predefined order, regardless
+	// of the order they're listed in.
+	for _, r := range builtinRedactRules {
+		if _, ok := enabled[r.name]; !ok {
+			continue
+		}
+		if err := addRule(r); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, cr := range c.CustomRules {
+		if cr.Name == "" {
+			return nil, errors.New(ErrRedactStageEmptyRuleName)
+		}
+		re, err := regexp.Compile(cr.Regex)
+		if err != nil {
+			return nil, fmt.Errorf(ErrRedactStageInvalidRegex, cr.Name, err)
+		}
+		if err := addRule(redactRule{name: cr.Name, regex: re}); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(rules) == 0 {
+		return nil, errors.New(ErrRedactStageNoRules)
+	}
+	return rules, nil
+}
+
+func isBuiltinRedactRule(name string) bool {
+	for _, r := range builtinRedactRules {
+		if r.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// newRedactStage creates a new redact stage from config.
+func newRedactStage(logger log.Logger, config RedactConfig, registerer prometheus.Registerer) (Stage, error) {
+	rules, err := buildRedactRules(config)
+	if err != nil {
+		return nil, err
+	}
+	return &redactStage{
+		logger:    log.With(logger, "component", "stage", "type", "redact"),
+		cfg:       config,
+		rules:     rules,
+		matches:   getRedactMatchesMetric(registerer),
+		dropCount: getDropCountMetric(registerer),
+	}, nil
+}
+
+// redactStage replaces sensitive data in log lines, or drops the lines which
+// contain it.
+type redactStage struct {
+	logger    log.Logger
+	cfg       RedactConfig
+	rules     []redactRule
+	matches   *prometheus.CounterVec
+	dropCount *prometheus.CounterVec
+}
+
+// redactSpan is a part of a log line matched by a rule.
+type redactSpan struct {
+	start, end int
+	rule       string
+}
+
+// Run implements Stage.
+func (r *redactStage) Run(in chan Entry) chan Entry {
+	out := make(chan Entry)
+	go func() {
+		defer close(out)
+		for e := range in {
+			spans := r.findSpans(e.Line)
+			if len(spans) == 0 {
+				out <- e
+				continue
+			}
+			for _, s := range spans {
+				r.matches.WithLabelValues(s.rule).Inc()
+			}
+
+			if r.cfg.Action == RedactActionDrop {
+				if Debug {
+					level.Debug(r.logger).Log("msg", "dropping line with sensitive data", "rule", spans[0].rule)
+				}
+				r.dropCount.WithLabelValues(r.cfg.DropReason).Inc()
+				continue
+			}
+			e.Line = r.redact(e.Line, spans)
+			out <- e
+		}
+	}()
+	return out
+}
+
+// findSpans returns the non-overlapping parts of line matched by the rules,
+// sorted by position. Every rule is applied to the original line, so a rule
+// never matches the replacement of another one.
+func (r *redactStage) findSpans(line string) []redactSpan {
+	var spans []redactSpan
+	overlaps := func(start, end int) bool {
+		for _, s := range spans {
+			if start < s.end && s.start < end {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, rule := range r.rules {
+		secretIdx := rule.regex.SubexpIndex(redactSecretGroup)
+		for _, m := range rule.regex.FindAllStringSubmatchIndex(line, -1) {
+			if rule.valid != nil && !rule.valid(line, m[0], m[1]) {
+				continue
+			}
+			start, end := m[0], m[1]
+			if secretIdx > 0 {
+				start, end = m[2*secretIdx], m[2*secretIdx+1]
+			}
+			if start < 0 || start == end || overlaps(start, end) {
+				continue
+			}
+			spans = append(spans, redactSpan{start: start, end: end, rule: rule.name})
+		}
+	}
+
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	return spans
+}
+
+// redact replaces the spans of line according to the configured action.
+func (r *redactStage) redact(line string, spans []redactSpan) string {
+	var (
+		sb   strings.Builder
+		last int
+	)
+	for _, s := range spans {
+		sb.WriteString(line[last:s.start])
+		switch r.cfg.Action {
+		case RedactActionHash:
+			sb.WriteString(r.hash(line[s.start:s.end]))
+		default:
+			sb.WriteString(r.cfg.Replacement)
+		}
+		last = s.end
+	}
+	sb.WriteString(line[last:])
+	return sb.String()
+}
+
+// hash returns a keyed hash of value, so that equal values can still be
+// correlated without being revealed.
+func (r *redactStage) hash(value string) string {
+	mac := hmac.New(sha256.New, []byte(r.cfg.HashSalt))
+	mac.Write([]byte(value))
+	return "**HASHED:" + hex.EncodeToString(mac.Sum(nil))[:16] + "**"
+}
+
+// Name implements Stage.
+func (r *redactStage) Name() string {
+	return StageTypeRedact
+}
+
+// Cleanup implements Stage.
+func (*redactStage) Cleanup() {
+	// no-op
+}
+
+func getRedactMatchesMetric(registerer prometheus.Registerer) *prometheus.CounterVec {
+	return registerCounterVec(registerer, "loki_process", "redacted_matches_total",
+		"A count of all sensitive data matched by the redact stage, by rule",
+		[]string{"rule"})
+}
@@ -16,11 +16,14 @@ import (
 // TODO(@tpaschalis) Let's use this as the list of stages we need to port over.
 const (
 	StageTypeCRI        = "cri"
+	StageTypeCSV        = "csv"
 	StageTypeDecolorize = "decolorize"
+	StageTypeDedup      = "dedup"
 	StageTypeDocker     = "docker"
 	StageTypeDrop       = "drop"
 	//TODO(thampiotr): Add support for eventlogmessage stage
 	StageTypeEventLogMessage    = "eventlogmessage"
+	StageTypeExpr               = "expr"
 	StageTypeGeoIP              = "geoip"
 	StageTypeJSON               = "json"
 	StageTypeLabel              = "labels"
@@ -34,7 +37,9 @@ const (
 	StageTypeMultiline          = "multiline"
 	StageTypeOutput             = "output"
 	StageTypePack               = "pack"
+	StageTypePattern            = "pattern"
 	StageTypePipeline           = "pipeline"
+	StageTypeRedact             = "redact"
 	StageTypeRegex              = "regex"
 	StageTypeReplace            = "replace"
 	StageTypeSampling           = "sampling"
@@ -43,6 +48,7 @@ const (
 	StageTypeTemplate           = "template"
 	StageTypeTenant             = "tenant"
 	StageTypeTimestamp          = "timestamp"
+	StageTypeXML                = "xml"
 )
 
 // Processor takes an existing set of labels, timestamp and log entry and returns either a possibly mutated
@@ -133,6 +139,16 @@ func New(logger log.Logger, jobName *string, cfg StageConfig, registerer prometh
 		if err != nil {
 			return nil, err
 		}
+	case cfg.XMLConfig != nil:
+		s, err = newXMLStage(logger, *cfg.XMLConfig)
+		if err != nil {
+			return nil, err
+		}
+	case cfg.CSVConfig != nil:
+		s, err = newCSVStage(logger, *cfg.CSVConfig)
+		if err != nil {
+			return nil, err
+		}
 	case cfg.LogfmtConfig != nil:
 		s, err = newLogfmtStage(logger, *cfg.LogfmtConfig)
 		if err != nil {
@@ -163,6 +179,11 @@ func New(logger log.Logger, jobName *string, cfg StageConfig, registerer prometh
 		if err != nil {
 			return nil, err
 		}
+	case cfg.PatternConfig != nil:
+		s, err = newPatternStage(logger, *cfg.PatternConfig)
+		if err != nil {
+			return nil, err
+		}
 	case cfg.TimestampConfig != nil:
 		s, err = newTimestampStage(logger, *cfg.TimestampConfig)
 		if err != nil {
@@ -193,6 +214,21 @@ func New(logger log.Logger, jobName *string, cfg StageConfig, registerer prometh
 		if err != nil {
 			return nil, err
 		}
+	case cfg.RedactConfig != nil:
+		s, err = newRedactStage(logger, *cfg.RedactConfig, registerer)
+		if err != nil {
+			return nil, err
+		}
+	case cfg.ExprConfig != nil:
+		s, err = newExprStage(logger, *cfg.ExprConfig, registerer)
+		if err != nil {
+			return nil, err
+		}
+	case cfg.DedupConfig != nil:
+		s, err = newDedupStage(logger, *cfg.DedupConfig, registerer)
+		if err != nil {
+			return nil, err
+		}
 	case cfg.LimitConfig != nil:
 		s, err = newLimitStage(logger, *cfg.LimitConfig, registerer)
 		if err != nil {
@@ -0,0 +1,154 @@
+package stages
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/internal/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testXMLRiverSingleStageWithoutSource = `
+stage.xml {
+    expressions = {
+        event_id = "/Event/System/EventID",
+        Level    = "",
+        provider = "/Event/System/Provider/@Name",
+        user     = "//Data[@Name='TargetUserName']",
+        data     = "count(//Data)",
+        missing  = "/Event/System/Missing",
+    }
+}
+`
+
+var testXMLRiverMultiStageWithSource = `
+stage.json {
+    expressions = { payload = "" }
+}
+stage.xml {
+    expressions = { order_id = "/order/@id", total = "/order/total" }
+    source      = "payload"
+}
+`
+
+var testXMLLogLine = `<Event xmlns="http://schemas.microsoft.com/win/2004/08/events/event">` +
+	`<System><Provider Name="Microsoft-Windows-Security-Auditing"/><EventID>4624</EventID><Level>0</Level></System>` +
+	`<EventData><Data Name="SubjectUserName">-</Data><Data Name="TargetUserName">jane</Data></EventData>` +
+	`</Event>`
+
+func TestPipeline_XML(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		config          string
+		entry           string
+		expectedExtract map[string]interface{}
+	}{
+		"successfully run a pipeline with 1 xml stage without source": {
+			testXMLRiverSingleStageWithoutSource,
+			testXMLLogLine,
+			map[string]interface{}{
+				"event_id": "4624",
+				"Level":    "0",
+				"provider": "Microsoft-Windows-Security-Auditing",
+				"user":     "jane",
+				"data":     float64(2),
+			},
+		},
+		"successfully run a pipeline with xml stage with source": {
+			testXMLRiverMultiStageWithSource,
+			`{"payload": "<order id=\"42\"><total>9.99</total></order>"}`,
+			map[string]interface{}{
+				"payload":  `<order id="42"><total>9.99</total></order>`,
+				"order_id": "42",
+				"total":    "9.99",
+			},
+		},
+	}
+
+	for testName, testData := range tests {
+		testData := testData
+
+		t.Run(testName, func(t *testing.T) {
+			t.Parallel()
+
+			logger := util.TestFlowLogger(t)
+			pl, err := NewPipeline(logger, loadConfig(testData.config), nil, prometheus.DefaultRegisterer)
+			require.NoError(t, err)
+
+			out := processEntries(pl, newEntry(nil, nil, testData.entry, time.Now()))[0]
+			assert.Equal(t, testData.expectedExtract, out.Extracted)
+		})
+	}
+}
+
+func TestXMLConfig_validate(t *testing.T) {
+	t.Parallel()
+	emptySource := ""
+
+	tests := map[string]struct {
+		config *XMLConfig
+		err    string
+	}{
+		"empty config": {
+			nil,
+			ErrEmptyXMLStageConfig,
+		},
+		"no expressions": {
+			&XMLConfig{},
+			ErrXPathExpressionsRequired,
+		},
+		"invalid expression": {
+			&XMLConfig{Expressions: map[string]string{"a": "/a["}},
+			ErrCouldNotCompileXPath,
+		},
+		"empty source": {
+			&XMLConfig{Expressions: map[string]string{"a": "/a"}, Source: &emptySource},
+			ErrEmptyXMLStageSource,
+		},
+		"valid": {
+			&XMLConfig{Expressions: map[string]string{"a": "/a", "b": ""}},
+			"",
+		},
+	}
+	for tName, tt := range tests {
+		tt := tt
+		t.Run(tName, func(t *testing.T) {
+			_, err := validateXMLConfig(tt.config)
+			if tt.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestXMLStage_Malformed(t *testing.T) {
+	t.Parallel()
+
+	for _, dropMalformed := range []bool{false, true} {
+		logger := util.TestFlowLogger(t)
+		s, err := newXMLStage(logger, XMLConfig{
+			Expressions:   map[string]string{"a": "/a"},
+			DropMalformed: dropMalformed,
+		})
+		require.NoError(t, err)
+
+		out := processEntries(s,
+			newEntry(nil, nil, "<a>unterminated", time.Now()),
+			newEntry(nil, nil, "not xml at all", time.Now()),
+			newEntry(nil, nil, "<a>ok</a>", time.Now()),
+		)
+		if dropMalformed {
+			require.Len(t, out, 1)
+			require.Equal(t, map[string]interface{}{"a": "ok"}, out[0].Extracted)
+		} else {
+			require.Len(t, out, 3)
+			require.Empty(t, out[0].Extracted)
+			require.Empty(t, out[1].Extracted)
+		}
+	}
+}
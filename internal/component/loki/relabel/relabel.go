@@ -10,6 +10,7 @@ import (
 	flow_relabel "github.com/grafana/agent/internal/component/common/relabel"
 	"github.com/grafana/agent/internal/featuregate"
 	"github.com/grafana/agent/internal/flow/logging/level"
+	"github.com/grafana/agent/internal/service/livedebugging"
 	lru "github.com/hashicorp/golang-lru"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/labels"
@@ -70,6 +71,8 @@ type Component struct {
 
 	cache        *lru.Cache
 	maxCacheSize int
+
+	debugDataPublisher livedebugging.DebugDataPublisher
 }
 
 var (
@@ -88,6 +91,8 @@ func New(o component.Options, args Arguments) (*Component, error) {
 		metrics:      newMetrics(o.Registerer),
 		cache:        cache,
 		maxCacheSize: args.MaxCacheSize,
+
+		debugDataPublisher: livedebugging.GetPublisher(o.GetServiceData),
 	}
 
 	// Create and immediately export the receiver which remains the same for
@@ -112,6 +117,7 @@ func (c *Component) Run(ctx context.Context) error {
 		case entry := <-c.receiver.Chan():
 			c.metrics.entriesProcessed.Inc()
 			lbls := c.relabel(entry)
+			c.publishDebugData(entry.Labels, lbls)
 			if len(lbls) == 0 {
 				level.Debug(c.opts.Logger).Log("msg", "dropping entry after relabeling", "labels", entry.Labels.String())
 				continue
@@ -156,6 +162,19 @@ func (c *Component) Update(args component.Arguments) error {
 	return nil
 }
 
+// publishDebugData publishes the labels of an entry before and after
+// relabeling. An empty label set means the entry was dropped.
+func (c *Component) publishDebugData(before, after model.LabelSet) {
+	if !c.debugDataPublisher.IsActive(c.opts.ID) {
+		return
+	}
+	result := "dropped"
+	if len(after) > 0 {
+		result = after.String()
+	}
+	c.debugDataPublisher.Publish(c.opts.ID, before.String()+" => "+result)
+}
+
 func relabelingChanged(prev, next []*relabel.Config) bool {
 	if len(prev) != len(next) {
 		return true
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -44,6 +45,8 @@ type Arguments struct {
 	Encoding            string              `river:"encoding,attr,optional"`
 	DecompressionConfig DecompressionConfig `river:"decompression,block,optional"`
 	FileWatch           FileWatch           `river:"file_watch,block,optional"`
+	Rotation            Rotation            `river:"rotation,block,optional"`
+	FingerprintSize     int                 `river:"fingerprint_size,attr,optional"`
 	TailFromEnd         bool                `river:"tail_from_end,attr,optional"`
 	LegacyPositionsFile string              `river:"legacy_positions_file,attr,optional"`
 }
@@ -65,6 +68,30 @@ func (a *Arguments) SetToDefault() {
 	*a = DefaultArguments
 }
 
+// Validate implements river.Validator.
+func (a *Arguments) Validate() error {
+	if a.Rotation.Enabled && a.DecompressionConfig.Enabled {
+		return fmt.Errorf("the rotation block can't be enabled together with the decompression block")
+	}
+	if a.FingerprintSize < 0 {
+		return fmt.Errorf("fingerprint_size must not be negative")
+	}
+	return nil
+}
+
+// defaultRotationFingerprintSize is the fingerprint size used to find
+// rotated files when fingerprint_size isn't set.
+const defaultRotationFingerprintSize = 1024
+
+// fingerprintSize returns the maximum number of bytes at the start of each
+// file its fingerprint is computed from.
+func (a *Arguments) fingerprintSize() int {
+	if a.FingerprintSize == 0 && a.Rotation.Enabled {
+		return defaultRotationFingerprintSize
+	}
+	return a.FingerprintSize
+}
+
 type DecompressionConfig struct {
 	Enabled      bool              `river:"enabled,attr"`
 	InitialDelay time.Duration     `river:"initial_delay,attr,optional"`
@@ -84,6 +111,7 @@ type Component struct {
 	args      Arguments
 	handler   loki.LogsReceiver
 	receivers []loki.LogsReceiver
+	posPath   string
 	posFile   positions.Positions
 	readers   map[positions.Entry]reader
 }
@@ -99,12 +127,7 @@ func New(o component.Options, args Arguments) (*Component, error) {
 	if args.LegacyPositionsFile != "" {
 		positions.ConvertLegacyPositionsFile(args.LegacyPositionsFile, newPositionsPath, o.Logger)
 	}
-	positionsFile, err := positions.New(o.Logger, positions.Config{
-		SyncPeriod:        10 * time.Second,
-		PositionsFile:     newPositionsPath,
-		IgnoreInvalidYaml: false,
-		ReadOnly:          false,
-	})
+	positionsFile, err := newPositions(o, newPositionsPath, args)
 	if err != nil {
 		return nil, err
 	}
@@ -113,8 +136,10 @@ func New(o component.Options, args Arguments) (*Component, error) {
 		opts:    o,
 		metrics: newMetrics(o.Registerer),
 
+		args:      args,
 		handler:   loki.NewLogsReceiver(),
 		receivers: args.ForwardTo,
+		posPath:   newPositionsPath,
 		posFile:   positionsFile,
 		readers:   make(map[positions.Entry]reader),
 	}
@@ -127,6 +152,17 @@ func New(o component.Options, args Arguments) (*Component, error) {
 	return c, nil
 }
 
+// newPositions creates the positions file at path for args.
+func newPositions(o component.Options, path string, args Arguments) (positions.Positions, error) {
+	return positions.New(o.Logger, positions.Config{
+		SyncPeriod:        10 * time.Second,
+		PositionsFile:     path,
+		IgnoreInvalidYaml: false,
+		ReadOnly:          false,
+		FingerprintSize:   args.fingerprintSize(),
+	})
+}
+
 // Run implements component.Component.
 // TODO(@tpaschalis). Should we periodically re-check? What happens if a target
 // comes alive _after_ it's been passed to us and we never receive another
@@ -188,6 +224,18 @@ func (c *Component) Update(args component.Arguments) error {
 
 	c.mut.Lock()
 	defer c.mut.Unlock()
+
+	// The positions file is recreated when fingerprinting is reconfigured,
+	// which is safe as all readers using it were stopped above.
+	if newArgs.fingerprintSize() != c.args.fingerprintSize() {
+		c.posFile.Stop()
+		posFile, err := newPositions(c.opts, c.posPath, newArgs)
+		if err != nil {
+			return err
+		}
+		c.posFile = posFile
+	}
+
 	c.args = newArgs
 	c.receivers = newArgs.ForwardTo
 
@@ -198,6 +246,15 @@ func (c *Component) Update(args component.Arguments) error {
 		return nil
 	}
 
+	type fileTarget struct {
+		path    string
+		labels  model.LabelSet
+		rotated *rotatedFile
+	}
+	var (
+		targets     = make([]fileTarget, 0, len(newArgs.Targets))
+		rotatedPath = make(map[string]struct{})
+	)
 	for _, target := range newArgs.Targets {
 		path := target[pathLabel]
 
@@ -209,6 +266,26 @@ func (c *Component) Update(args component.Arguments) error {
 			labels[model.LabelName(k)] = model.LabelValue(v)
 		}
 
+		var rotated *rotatedFile
+		if newArgs.Rotation.Enabled {
+			rotated = c.checkRotation(path, labels.String())
+		}
+		if rotated != nil {
+			rotatedPath[rotated.path] = struct{}{}
+		}
+		targets = append(targets, fileTarget{path: path, labels: labels, rotated: rotated})
+	}
+
+	for _, target := range targets {
+		path, labels := target.path, target.labels
+
+		// Rotated copies of other targets which also match the glob of a
+		// target are read by the target they were rotated from.
+		if _, ok := rotatedPath[path]; ok {
+			level.Info(c.opts.Logger).Log("msg", "not tailing rotated file, it is read by the file it was rotated from", "filename", path)
+			continue
+		}
+
 		// Deduplicate targets which have the same public label set.
 		readersKey := positions.Entry{Path: path, Labels: labels.String()}
 		if _, exist := c.readers[readersKey]; exist {
@@ -218,7 +295,7 @@ func (c *Component) Update(args component.Arguments) error {
 		c.reportSize(path, labels.String())
 
 		handler := loki.AddLabelsMiddleware(labels).Wrap(loki.NewEntryHandler(c.handler.Chan(), func() {}))
-		reader, err := c.startTailing(path, labels, handler)
+		reader, err := c.startTailing(path, labels, handler, target.rotated)
 		if err != nil {
 			continue
 		}
@@ -272,7 +349,9 @@ func (c *Component) stopReaders() map[positions.Entry]struct{} {
 func (c *Component) DebugInfo() interface{} {
 	var res readerDebugInfo
 	for e, reader := range c.readers {
-		offset, _ := c.posFile.Get(e.Path, e.Labels)
+		// GetString is used as Get may discard positions of files which no
+		// longer match their fingerprint.
+		offset, _ := strconv.ParseInt(c.posFile.GetString(e.Path, e.Labels), 10, 64)
 		res.TargetsInfo = append(res.TargetsInfo, targetInfo{
 			Path:       e.Path,
 			Labels:     e.Labels,
@@ -307,8 +386,10 @@ func missing(as map[positions.Entry]reader, bs map[positions.Entry]struct{}) map
 
 // startTailing starts and returns a reader for the given path. For most files,
 // this will be a tailer implementation. If the file suffix alludes to it being
-// a compressed file, then a decompressor will be started instead.
-func (c *Component) startTailing(path string, labels model.LabelSet, handler loki.EntryHandler) (reader, error) {
+// a compressed file, then a decompressor will be started instead. If rotated
+// isn't nil, the tailer reads the unread lines of the rotated copy of the file
+// first.
+func (c *Component) startTailing(path string, labels model.LabelSet, handler loki.EntryHandler, rotated *rotatedFile) (reader, error) {
 	fi, err := os.Stat(path)
 	if err != nil {
 		level.Error(c.opts.Logger).Log("msg", "failed to tail file, stat failed", "error", err, "filename", path)
@@ -356,6 +437,7 @@ func (c *Component) startTailing(path string, labels model.LabelSet, handler lok
 			c.args.Encoding,
 			pollOptions,
 			c.args.TailFromEnd,
+			rotated,
 		)
 		if err != nil {
 			level.Error(c.opts.Logger).Log("msg", "failed to start tailer", "error", err, "filename", path)
@@ -17,6 +17,7 @@ type metrics struct {
 	readLines        *prometheus.CounterVec
 	encodingFailures *prometheus.CounterVec
 	filesActive      prometheus.Gauge
+	rotatedFilesRead prometheus.Counter
 }
 
 // newMetrics creates a new set of file metrics. If reg is non-nil, the metrics
@@ -45,6 +46,10 @@ func newMetrics(reg prometheus.Registerer) *metrics {
 		Name: "loki_source_file_files_active_total",
 		Help: "Number of active files.",
 	})
+	m.rotatedFilesRead = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "loki_source_file_rotated_files_read_total",
+		Help: "Number of rotated files read to catch up with their unread lines.",
+	})
 
 	if reg != nil {
 		reg.MustRegister(
@@ -53,6 +58,7 @@ func newMetrics(reg prometheus.Registerer) *metrics {
 			m.readLines,
 			m.encodingFailures,
 			m.filesActive,
+			m.rotatedFilesRead,
 		)
 	}
 
@@ -0,0 +1,216 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/internal/component/common/loki/positions"
+	"github.com/grafana/agent/internal/flow/logging/level"
+)
+
+// Rotation configures how files rotated while they weren't tailed are found
+// and caught up with.
+type Rotation struct {
+	Enabled bool   `river:"enabled,attr,optional"`
+	Glob    string `river:"glob,attr,optional"`
+}
+
+// rotatedFile is a rotated copy of a tailed file with unread lines.
+type rotatedFile struct {
+	path string
+	// offset is the offset of the first unread byte of the decompressed
+	// content of the file.
+	offset int64
+	// format is the compression format of the file. It's empty for
+	// uncompressed files.
+	format CompressionFormat
+}
+
+// rotatedGlob returns the glob used to find rotated copies of the file at
+// path.
+func (r Rotation) rotatedGlob(path string) string {
+	switch {
+	case r.Glob == "":
+		return path + ".*"
+	case filepath.IsAbs(r.Glob):
+		return r.Glob
+	default:
+		return filepath.Join(filepath.Dir(path), r.Glob)
+	}
+}
+
+// checkRotation checks whether the file at path was rotated since its
+// position was last saved, by comparing it with the fingerprint saved along
+// with its position. If it was, it returns the rotated copy of the file the
+// unread lines can be read from, or nil if there aren't any or the rotated
+// copy can't be found.
+func (c *Component) checkRotation(path, labels string) *rotatedFile {
+	logger := log.With(c.opts.Logger, "filename", path)
+
+	saved, ok := c.posFile.GetFingerprint(path, labels)
+	if !ok {
+		return nil
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		level.Warn(logger).Log("msg", "failed to stat file", "error", err)
+		return nil
+	}
+	if saved.SameInode(fi) && matchesFile(saved, path, "") {
+		return nil
+	}
+
+	// The position is read with GetString, as Get discards positions of
+	// files which no longer match their fingerprint.
+	pos, err := strconv.ParseInt(c.posFile.GetString(path, labels), 10, 64)
+	if err != nil || pos == 0 {
+		// There's nothing left to read from the rotated file.
+		c.posFile.Remove(path, labels)
+		return nil
+	}
+
+	rotated := findRotated(saved, c.args.Rotation.rotatedGlob(path), path)
+	if rotated == nil {
+		level.Warn(logger).Log("msg", "file was rotated, but its rotated copy wasn't found; lines which weren't read yet are lost", "glob", c.args.Rotation.rotatedGlob(path))
+		c.posFile.Remove(path, labels)
+		return nil
+	}
+	rotated.offset = pos
+
+	level.Info(logger).Log("msg", "file was rotated, reading unread lines from its rotated copy", "rotated_filename", rotated.path, "offset", pos)
+	return rotated
+}
+
+// findRotated returns the file matching glob whose content was identified
+// by fp, ignoring the file at path. Files which are the same file on disk are
+// preferred over uncompressed copies, which are preferred over compressed
+// copies. It returns nil if there's no such file.
+func findRotated(fp positions.Fingerprint, glob string, path string) *rotatedFile {
+	matches, err := filepath.Glob(glob)
+	if err != nil {
+		return nil
+	}
+	sort.Strings(matches)
+
+	var candidates []*rotatedFile
+	for _, match := range matches {
+		if match == path {
+			continue
+		}
+		fi, err := os.Stat(match)
+		if err != nil || fi.IsDir() {
+			continue
+		}
+
+		format := CompressionFormat(strings.TrimPrefix(filepath.Ext(match), "."))
+		if _, ok := supportedCompressedFormats()[format.String()]; !ok {
+			format = ""
+		}
+		if !matchesFile(fp, match, format) {
+			continue
+		}
+
+		candidate := &rotatedFile{path: match, format: format}
+		if format == "" && fp.SameInode(fi) {
+			return candidate
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].format == "" && candidates[j].format != ""
+	})
+	if len(candidates) == 0 {
+		return nil
+	}
+	return candidates[0]
+}
+
+// matchesFile reports whether the content of the file at path, decompressed
+// using format, matches fp.
+func matchesFile(fp positions.Fingerprint, path string, format CompressionFormat) bool {
+	r, closer, err := openRotated(path, format)
+	if err != nil {
+		return false
+	}
+	defer closer.Close()
+
+	ok, err := fp.Matches(r)
+	return err == nil && ok
+}
+
+// openRotated opens the file at path, decompressing it using format if it
+// isn't empty.
+func openRotated(path string, format CompressionFormat) (io.Reader, io.Closer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if format == "" {
+		return f, f, nil
+	}
+
+	r, err := mountReader(f, log.NewNopLogger(), format)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return r, f, nil
+}
+
+// readRotated reads the lines of rotated starting from its offset, calling fn
+// with each line and the offset following it. Reading stops early if fn
+// returns false. The last line is passed to fn even if it isn't terminated by
+// a newline, as no more lines are written to rotated files.
+//
+// readRotated returns the number of lines up to where reading stopped,
+// including the lines before the offset of rotated.
+func readRotated(rotated *rotatedFile, fn func(line string, offset int64) bool) (int64, error) {
+	r, closer, err := openRotated(rotated.path, rotated.format)
+	if err != nil {
+		return 0, err
+	}
+	defer closer.Close()
+
+	var skipped lineCounter
+	if _, err := io.CopyN(&skipped, r, rotated.offset); err != nil {
+		return 0, fmt.Errorf("failed to skip to offset %d: %w", rotated.offset, err)
+	}
+
+	var (
+		br     = bufio.NewReader(r)
+		offset = rotated.offset
+		lines  = int64(skipped)
+	)
+	for {
+		line, err := br.ReadString('\n')
+		if len(line) > 0 {
+			offset += int64(len(line))
+			lines++
+			if !fn(strings.TrimSuffix(line, "\n"), offset) {
+				return lines, nil
+			}
+		}
+		if err == io.EOF {
+			return lines, nil
+		} else if err != nil {
+			return lines, err
+		}
+	}
+}
+
+// lineCounter is an io.Writer counting the lines written to it.
+type lineCounter int64
+
+func (c *lineCounter) Write(p []byte) (int, error) {
+	*c += lineCounter(bytes.Count(p, []byte{'\n'}))
+	return len(p), nil
+}
@@ -0,0 +1,202 @@
+package file
+
+import (
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/internal/component"
+	"github.com/grafana/agent/internal/component/common/loki"
+	"github.com/grafana/agent/internal/component/discovery"
+	"github.com/grafana/agent/internal/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotation(t *testing.T) {
+	tests := map[string]struct {
+		// rotate rotates the file at path while the component isn't running.
+		rotate func(t *testing.T, path string)
+		// rotatedTarget is set when the rotated file is a target as well,
+		// as if it matched the same glob as the file it was rotated from.
+		rotatedTarget bool
+	}{
+		"renamed": {
+			rotate: func(t *testing.T, path string) {
+				require.NoError(t, os.Rename(path, path+".1"))
+			},
+		},
+		"renamed to a target": {
+			rotate: func(t *testing.T, path string) {
+				require.NoError(t, os.Rename(path, path+".1"))
+			},
+			rotatedTarget: true,
+		},
+		"compressed": {
+			rotate: func(t *testing.T, path string) {
+				content, err := os.ReadFile(path)
+				require.NoError(t, err)
+				f, err := os.Create(path + ".1.gz")
+				require.NoError(t, err)
+				gw := gzip.NewWriter(f)
+				_, err = gw.Write(content)
+				require.NoError(t, err)
+				require.NoError(t, gw.Close())
+				require.NoError(t, f.Close())
+				require.NoError(t, os.Remove(path))
+			},
+		},
+		"copied and truncated": {
+			rotate: func(t *testing.T, path string) {
+				content, err := os.ReadFile(path)
+				require.NoError(t, err)
+				require.NoError(t, os.WriteFile(path+".1", content, 0644))
+				require.NoError(t, os.Truncate(path, 0))
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "app.log")
+			require.NoError(t, os.WriteFile(path, []byte("line 1\n"), 0644))
+
+			ch := loki.NewLogsReceiver()
+			args := Arguments{
+				Targets:   []discovery.Target{{"__path__": path, "foo": "bar"}},
+				ForwardTo: []loki.LogsReceiver{ch},
+				FileWatch: DefaultArguments.FileWatch,
+				Rotation:  Rotation{Enabled: true},
+			}
+			runComponent := func() func() {
+				c, err := New(component.Options{
+					Logger:        util.TestFlowLogger(t),
+					Registerer:    prometheus.NewRegistry(),
+					OnStateChange: func(e component.Exports) {},
+					DataPath:      filepath.Join(dir, "data"),
+				}, args)
+				require.NoError(t, err)
+				ctx, cancel := context.WithCancel(context.Background())
+				done := make(chan struct{})
+				go func() {
+					defer close(done)
+					require.NoError(t, c.Run(ctx))
+				}()
+				return func() {
+					cancel()
+					<-done
+				}
+			}
+			receive := func(want ...string) {
+				for _, line := range want {
+					select {
+					case entry := <-ch.Chan():
+						require.Equal(t, line, entry.Line)
+						require.Equal(t, path, string(entry.Labels[filenameLabel]))
+					case <-time.After(5 * time.Second):
+						require.FailNow(t, "failed waiting for log line", line)
+					}
+				}
+			}
+
+			stop := runComponent()
+			receive("line 1")
+			stop()
+
+			// Lines written before the rotation while the component isn't
+			// running are read from the rotated file before the new file.
+			f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+			require.NoError(t, err)
+			_, err = f.WriteString("line 2\nline 3\n")
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+			tc.rotate(t, path)
+			require.NoError(t, os.WriteFile(path, []byte("line 4\n"), 0644))
+			if tc.rotatedTarget {
+				args.Targets = append(args.Targets, discovery.Target{"__path__": path + ".1", "foo": "bar"})
+			}
+
+			stop = runComponent()
+			receive("line 2", "line 3", "line 4")
+			stop()
+
+			// The new file isn't mistaken for a rotated file after another
+			// restart.
+			stop = runComponent()
+			defer stop()
+			select {
+			case entry := <-ch.Chan():
+				require.FailNow(t, "unexpected log line", entry.Line)
+			case <-time.After(100 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestRotationArguments(t *testing.T) {
+	args := Arguments{
+		Rotation:            Rotation{Enabled: true},
+		DecompressionConfig: DecompressionConfig{Enabled: true, Format: "gz"},
+	}
+	require.ErrorContains(t, args.Validate(), "can't be enabled together")
+
+	require.Equal(t, "/var/log/app.log.*", Rotation{}.rotatedGlob("/var/log/app.log"))
+	require.Equal(t, filepath.Join("/var/log", "app-*.log.gz"), Rotation{Glob: "app-*.log.gz"}.rotatedGlob("/var/log/app.log"))
+}
+
+// TestFingerprintSize ensures that files replaced while they weren't tailed
+// are read from their start when fingerprints are enabled.
+func TestFingerprintSize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	require.NoError(t, os.WriteFile(path, []byte("old\n"), 0644))
+
+	ch := loki.NewLogsReceiver()
+	args := Arguments{
+		Targets:         []discovery.Target{{"__path__": path}},
+		ForwardTo:       []loki.LogsReceiver{ch},
+		FileWatch:       DefaultArguments.FileWatch,
+		FingerprintSize: 16,
+	}
+	runComponent := func() func() {
+		c, err := New(component.Options{
+			Logger:        util.TestFlowLogger(t),
+			Registerer:    prometheus.NewRegistry(),
+			OnStateChange: func(e component.Exports) {},
+			DataPath:      filepath.Join(dir, "data"),
+		}, args)
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			require.NoError(t, c.Run(ctx))
+		}()
+		return func() {
+			cancel()
+			<-done
+		}
+	}
+	receive := func(want string) {
+		select {
+		case entry := <-ch.Chan():
+			require.Equal(t, want, entry.Line)
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "failed waiting for log line", want)
+		}
+	}
+
+	stop := runComponent()
+	receive("old")
+	stop()
+
+	require.NoError(t, os.WriteFile(path, []byte("replaced\n"), 0644))
+
+	stop = runComponent()
+	defer stop()
+	receive("replaced")
+}
@@ -36,6 +36,10 @@ type tailer struct {
 	labels string
 	tail   *tail.Tail
 
+	// rotated is the rotated copy of the tailed file which is read before
+	// the tailed file. It's nil once it's been read.
+	rotated *rotatedFile
+
 	posAndSizeMtx sync.Mutex
 	stopOnce      sync.Once
 
@@ -47,25 +51,35 @@ type tailer struct {
 	decoder *encoding.Decoder
 }
 
+// newTailer creates a tailer for the file at path. If rotated isn't nil, the
+// unread lines of the rotated copy of the file are read before the file,
+// which is then read from its start.
 func newTailer(metrics *metrics, logger log.Logger, handler loki.EntryHandler, positions positions.Positions, path string,
-	labels string, encoding string, pollOptions watch.PollingFileWatcherOptions, tailFromEnd bool) (*tailer, error) {
+	labels string, encoding string, pollOptions watch.PollingFileWatcherOptions, tailFromEnd bool,
+	rotated *rotatedFile) (*tailer, error) {
 	// Simple check to make sure the file we are tailing doesn't
 	// have a position already saved which is past the end of the file.
 	fi, err := os.Stat(path)
 	if err != nil {
 		return nil, err
 	}
-	pos, err := positions.Get(path, labels)
-	if err != nil {
-		return nil, err
-	}
 
-	if fi.Size() < pos {
-		positions.Remove(path, labels)
+	// The saved position and fingerprint belong to the rotated copy of the
+	// file, if there is one, and are kept until the rotated copy has been
+	// read. Get isn't used then, as it would discard them.
+	var pos int64
+	if rotated == nil {
+		pos, err = positions.Get(path, labels)
+		if err != nil {
+			return nil, err
+		}
+		if fi.Size() < pos {
+			positions.Remove(path, labels)
+		}
 	}
 
 	// If no cached position is found and the tailFromEnd option is enabled.
-	if pos == 0 && tailFromEnd {
+	if pos == 0 && tailFromEnd && rotated == nil {
 		pos, err = getLastLinePosition(path)
 		if err != nil {
 			level.Error(logger).Log("msg", "failed to get a position from the end of the file, default to start of file", err)
@@ -104,6 +118,8 @@ func newTailer(metrics *metrics, logger log.Logger, handler loki.EntryHandler, p
 		posquit:   make(chan struct{}),
 		posdone:   make(chan struct{}),
 		done:      make(chan struct{}),
+
+		rotated: rotated,
 	}
 
 	if encoding != "" {
@@ -232,6 +248,15 @@ func (t *tailer) readLines() {
 		// Shut down the position marker thread
 		close(t.posquit)
 	}()
+	if !t.readRotated() {
+		// The tailer is stopping before the rotated copy of the file has been
+		// read. Lines already read from the tailed file are dropped, as they
+		// are read again after the rotated copy once the tailer restarts.
+		for range t.tail.Lines {
+		}
+		return
+	}
+
 	entries := t.handler.Chan()
 	for {
 		line, ok := <-t.tail.Lines
@@ -270,11 +295,94 @@ func (t *tailer) readLines() {
 	}
 }
 
+// readRotated reads the unread lines of the rotated copy of the tailed file,
+// if there is one. It returns false if the tailer was stopped before all
+// lines were read.
+func (t *tailer) readRotated() bool {
+	t.posAndSizeMtx.Lock()
+	rotated := t.rotated
+	t.posAndSizeMtx.Unlock()
+	if rotated == nil {
+		return true
+	}
+
+	level.Info(t.logger).Log("msg", "tail routine: reading rotated file", "path", t.path, "rotated_path", rotated.path, "offset", rotated.offset)
+	entries := t.handler.Chan()
+	stopped := false
+	lines, err := readRotated(rotated, func(line string, offset int64) bool {
+		select {
+		case <-t.tail.Dying():
+			stopped = true
+			return false
+		default:
+		}
+
+		text := line
+		if t.decoder != nil {
+			var err error
+			text, err = t.convertToUTF8(line)
+			if err != nil {
+				level.Debug(t.logger).Log("msg", "failed to convert encoding", "error", err)
+				t.metrics.encodingFailures.WithLabelValues(t.path).Inc()
+				text = fmt.Sprintf("the requested encoding conversion for this line failed in Grafana Agent Flow: %s", err.Error())
+			}
+		}
+
+		t.metrics.readLines.WithLabelValues(t.path).Inc()
+		entries <- loki.Entry{
+			Labels: model.LabelSet{},
+			Entry: logproto.Entry{
+				Timestamp: time.Now(),
+				Line:      text,
+			},
+		}
+
+		t.posAndSizeMtx.Lock()
+		rotated.offset = offset
+		t.posAndSizeMtx.Unlock()
+		return true
+	})
+	if stopped {
+		return false
+	}
+	if err != nil {
+		level.Error(t.logger).Log("msg", "tail routine: error reading rotated file, skipping the rest of it", "path", t.path, "rotated_path", rotated.path, "error", err)
+	}
+
+	t.posAndSizeMtx.Lock()
+	t.rotated = nil
+	// Reading the tailed file from its start replaces the fingerprint of the
+	// rotated copy with the fingerprint of the tailed file.
+	t.positions.Put(t.path, t.labels, 0)
+	// Mark the rotated copy as read in case it's tailed by itself as well.
+	// Compressed files are read by a decompressor, which counts lines
+	// instead of bytes.
+	if rotated.format == "" {
+		t.positions.Put(rotated.path, t.labels, rotated.offset)
+	} else {
+		t.positions.Put(rotated.path, t.labels, lines)
+	}
+	t.posAndSizeMtx.Unlock()
+
+	t.metrics.rotatedFilesRead.Inc()
+	level.Info(t.logger).Log("msg", "tail routine: finished reading rotated file", "path", t.path, "rotated_path", rotated.path)
+	return true
+}
+
 func (t *tailer) MarkPositionAndSize() error {
 	// Lock this update as there are 2 timers calling this routine, the sync in filetarget and the positions sync in this file.
 	t.posAndSizeMtx.Lock()
 	defer t.posAndSizeMtx.Unlock()
 
+	if t.rotated != nil {
+		// Until the rotated copy of the file has been read, its position is
+		// saved instead, so that reading it is resumed after a restart. The
+		// fingerprint of the rotated copy is kept, as the position doesn't
+		// move backwards.
+		t.positions.Put(t.path, t.labels, t.rotated.offset)
+		return nil
+	}
+
 	size, err := t.tail.Size()
 	if err != nil {
 		// If the file no longer exists, no need to save position information
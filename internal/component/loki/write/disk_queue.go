@@ -0,0 +1,69 @@
+package write
+
+import (
+	"time"
+
+	"github.com/grafana/agent/internal/component/common/diskqueue"
+)
+
+// diskQueueDebugInfo reports the state of the disk queue of an endpoint.
+type diskQueueDebugInfo struct {
+	Name            string        `river:"name,attr"`
+	URL             string        `river:"url,attr"`
+	Bytes           int64         `river:"bytes,attr"`
+	Batches         int           `river:"batches,attr"`
+	OldestBatchAge  time.Duration `river:"oldest_batch_age,attr,optional"`
+	SentEntries     uint64        `river:"sent_entries,attr"`
+	DroppedEntries  uint64        `river:"dropped_entries,attr"`
+	EvictedMaxSize  uint64        `river:"evicted_batches_max_size,attr"`
+	EvictedMaxAge   uint64        `river:"evicted_batches_max_age,attr"`
+	LastSendFailure string        `river:"last_send_failure,attr,optional"`
+}
+
+// diskQueueDebugInfo returns the debug info of the disk queue of every
+// endpoint which has one.
+func (c *Component) diskQueueDebugInfo() []diskQueueDebugInfo {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	if c.clientManger == nil {
+		return nil
+	}
+
+	var res []diskQueueDebugInfo
+	for _, status := range c.clientManger.DiskQueues() {
+		var age time.Duration
+		if !status.Oldest.IsZero() {
+			age = time.Since(status.Oldest)
+		}
+
+		res = append(res, diskQueueDebugInfo{
+			Name:            status.Name,
+			URL:             status.URL,
+			Bytes:           status.Bytes,
+			Batches:         status.Entries,
+			OldestBatchAge:  age,
+			SentEntries:     status.SentEntries,
+			DroppedEntries:  status.DroppedEntries,
+			EvictedMaxSize:  status.EvictedMaxBytes,
+			EvictedMaxAge:   status.EvictedMaxAge,
+			LastSendFailure: status.LastSendFailure,
+		})
+	}
+	return res
+}
+
+// diskQueueStats returns the stats of the disk queue of every endpoint which
+// has one.
+func (c *Component) diskQueueStats() []diskqueue.EndpointStats {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	if c.clientManger == nil {
+		return nil
+	}
+
+	var res []diskqueue.EndpointStats
+	for _, status := range c.clientManger.DiskQueues() {
+		res = append(res, diskqueue.EndpointStats{Endpoint: status.Name, Stats: status.Stats})
+	}
+	return res
+}
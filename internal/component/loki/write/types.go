@@ -3,8 +3,10 @@ package write
 import (
 	"fmt"
 	"net/url"
+	"path/filepath"
 	"time"
 
+	"github.com/grafana/agent/internal/component/common/diskqueue"
 	"github.com/grafana/agent/internal/component/common/loki/client"
 	"github.com/grafana/agent/internal/component/common/loki/utils"
 
@@ -19,6 +21,7 @@ import (
 type EndpointOptions struct {
 	Name              string                  `river:"name,attr,optional"`
 	URL               string                  `river:"url,attr"`
+	Format            string                  `river:"format,attr,optional"`
 	BatchWait         time.Duration           `river:"batch_wait,attr,optional"`
 	BatchSize         units.Base2Bytes        `river:"batch_size,attr,optional"`
 	RemoteTimeout     time.Duration           `river:"remote_timeout,attr,optional"`
@@ -30,6 +33,7 @@ type EndpointOptions struct {
 	RetryOnHTTP429    bool                    `river:"retry_on_http_429,attr,optional"`
 	HTTPClientConfig  *types.HTTPClientConfig `river:",squash"`
 	QueueConfig       QueueConfig             `river:"queue_config,block,optional"`
+	DiskQueue         *diskqueue.Arguments    `river:"disk_queue,block,optional"`
 }
 
 // GetDefaultEndpointOptions defines the default settings for sending logs to a
@@ -39,6 +43,7 @@ type EndpointOptions struct {
 // For a total time of 511.5s (8.5m) before logs are lost.
 func GetDefaultEndpointOptions() EndpointOptions {
 	var defaultEndpointOptions = EndpointOptions{
+		Format:            client.FormatLoki,
 		BatchWait:         1 * time.Second,
 		BatchSize:         1 * units.MiB,
 		RemoteTimeout:     10 * time.Second,
@@ -63,6 +68,12 @@ func (r *EndpointOptions) Validate() error {
 		return fmt.Errorf("failed to parse remote url %q: %w", r.URL, err)
 	}
 
+	switch r.Format {
+	case client.FormatLoki, client.FormatOTLP:
+	default:
+		return fmt.Errorf("unsupported format %q, must be one of %q or %q", r.Format, client.FormatLoki, client.FormatOTLP)
+	}
+
 	// We must explicitly Validate because HTTPClientConfig is squashed and it won't run otherwise
 	if r.HTTPClientConfig != nil {
 		return r.HTTPClientConfig.Validate()
@@ -86,13 +97,14 @@ func (q *QueueConfig) SetToDefault() {
 	}
 }
 
-func (args Arguments) convertClientConfigs() []client.Config {
+func (args Arguments) convertClientConfigs(dataPath string) []client.Config {
 	var res []client.Config
 	for _, cfg := range args.Endpoints {
 		url, _ := url.Parse(cfg.URL)
 		cc := client.Config{
 			Name:      cfg.Name,
 			URL:       flagext.URLValue{URL: url},
+			Format:    cfg.Format,
 			Headers:   cfg.Headers,
 			BatchWait: cfg.BatchWait,
 			BatchSize: int(cfg.BatchSize),
@@ -111,6 +123,14 @@ func (args Arguments) convertClientConfigs() []client.Config {
 				DrainTimeout: cfg.QueueConfig.DrainTimeout,
 			},
 		}
+		if cfg.DiskQueue != nil {
+			cc.DiskQueue = client.DiskQueueConfig{
+				Enabled: true,
+				Dir:     filepath.Join(dataPath, "queue", diskqueue.Name(cfg.Name, cfg.URL)),
+				MaxSize: int64(cfg.DiskQueue.MaxSize),
+				MaxAge:  cfg.DiskQueue.MaxAge,
+			}
+		}
 		res = append(res, cc)
 	}
 
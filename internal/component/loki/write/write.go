@@ -9,6 +9,7 @@ import (
 
 	"github.com/grafana/agent/internal/agentseed"
 	"github.com/grafana/agent/internal/component"
+	"github.com/grafana/agent/internal/component/common/diskqueue"
 	"github.com/grafana/agent/internal/component/common/loki"
 	"github.com/grafana/agent/internal/component/common/loki/client"
 	"github.com/grafana/agent/internal/component/common/loki/limit"
@@ -37,6 +38,25 @@ type Arguments struct {
 	WAL            WalArguments      `river:"wal,block,optional"`
 }
 
+// Validate implements river.Validator.
+func (a *Arguments) Validate() error {
+	queues := make(map[string]struct{})
+	for _, ep := range a.Endpoints {
+		if ep.DiskQueue == nil {
+			continue
+		}
+		if a.WAL.Enabled {
+			return fmt.Errorf("disk_queue blocks can't be used when the WAL is enabled")
+		}
+		name := diskqueue.Name(ep.Name, ep.URL)
+		if _, dup := queues[name]; dup {
+			return fmt.Errorf("multiple endpoints with a disk_queue use the name %q; set a unique name for each endpoint", name)
+		}
+		queues[name] = struct{}{}
+	}
+	return nil
+}
+
 // WalArguments holds the settings for configuring the Write-Ahead Log (WAL) used
 // by the underlying remote write client.
 type WalArguments struct {
@@ -73,7 +93,8 @@ type Exports struct {
 }
 
 var (
-	_ component.Component = (*Component)(nil)
+	_ component.Component      = (*Component)(nil)
+	_ component.DebugComponent = (*Component)(nil)
 )
 
 // Component implements the loki.write component.
@@ -106,6 +127,10 @@ func New(o component.Options, args Arguments) (*Component, error) {
 	c.receiver = loki.NewLogsReceiver()
 	o.OnStateChange(Exports{Receiver: c.receiver})
 
+	if err := o.Registerer.Register(diskqueue.NewCollector("loki_write", "batch", "batches", c.diskQueueStats)); err != nil {
+		return nil, err
+	}
+
 	// Call to Update() to start readers and set receivers once at the start.
 	if err := c.Update(args); err != nil {
 		return nil, err
@@ -161,7 +186,7 @@ func (c *Component) Update(args component.Arguments) error {
 		c.clientManger.Stop()
 	}
 
-	cfgs := newArgs.convertClientConfigs()
+	cfgs := newArgs.convertClientConfigs(c.opts.DataPath)
 
 	uid := agentseed.Get().UID
 	for i := range cfgs {
@@ -213,3 +238,12 @@ func (c *Component) Update(args component.Arguments) error {
 
 	return err
 }
+
+// DebugInfo implements component.DebugComponent.
+func (c *Component) DebugInfo() interface{} {
+	return debugInfo{DiskQueues: c.diskQueueDebugInfo()}
+}
+
+type debugInfo struct {
+	DiskQueues []diskQueueDebugInfo `river:"disk_queue,block,optional"`
+}
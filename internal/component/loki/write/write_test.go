@@ -1,8 +1,10 @@
 package write
 
 import (
+	"compress/gzip"
 	"context"
 	"fmt"
+	"io"
 	"math"
 	"net/http"
 	"net/http/httptest"
@@ -10,6 +12,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/grafana/agent/internal/component"
+	"github.com/grafana/agent/internal/component/common/diskqueue"
 	"github.com/grafana/agent/internal/component/common/loki"
 	"github.com/grafana/agent/internal/component/common/loki/wal"
 	"github.com/grafana/agent/internal/component/discovery"
@@ -17,8 +21,10 @@ import (
 	"github.com/grafana/agent/internal/flow/componenttest"
 	"github.com/grafana/agent/internal/util"
 	"github.com/grafana/river"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
 	"go.uber.org/atomic"
 
 	"github.com/grafana/loki/pkg/logproto"
@@ -310,6 +316,216 @@ func testMultipleEndpoint(t *testing.T, alterArgs func(arguments *Arguments)) {
 	}
 }
 
+// TestDiskQueue ensures that batches of endpoints with a disk_queue block are
+// retried beyond max_backoff_retries and are sent after a restart, in the
+// format they were queued in.
+func TestDiskQueue(t *testing.T) {
+	var up atomic.Bool
+	ch := make(chan logproto.PushRequest, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		var pushReq logproto.PushRequest
+		require.Empty(t, r.Header.Get("Content-Encoding"))
+		require.NoError(t, loki_util.ParseProtoReader(context.Background(), r.Body, int(r.ContentLength), math.MaxInt32, &pushReq, loki_util.RawSnappy))
+		require.Equal(t, "tenant-1", r.Header.Get("X-Scope-OrgID"))
+		ch <- pushReq
+	}))
+	defer srv.Close()
+
+	cfg := fmt.Sprintf(`
+		endpoint {
+			url                 = "%s"
+			batch_wait          = "10ms"
+			tenant_id           = "tenant-1"
+			min_backoff_period  = "10ms"
+			max_backoff_period  = "20ms"
+			max_backoff_retries = 1
+
+			disk_queue {
+				max_size = "10MiB"
+			}
+		}
+	`, srv.URL)
+	var args Arguments
+	require.NoError(t, river.Unmarshal([]byte(cfg), &args))
+
+	dataPath := t.TempDir()
+	startComponent := func() (*Component, func()) {
+		c, err := New(component.Options{
+			Logger:        util.TestFlowLogger(t),
+			Registerer:    prometheus.NewRegistry(),
+			DataPath:      dataPath,
+			OnStateChange: func(e component.Exports) {},
+		}, args)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			require.NoError(t, c.Run(ctx))
+		}()
+		return c, func() {
+			cancel()
+			<-done
+		}
+	}
+	queueInfo := func(c *Component) diskQueueDebugInfo {
+		info := c.DebugInfo().(debugInfo)
+		require.Len(t, info.DiskQueues, 1)
+		return info.DiskQueues[0]
+	}
+
+	c, stop := startComponent()
+	logEntry := loki.Entry{
+		Labels: model.LabelSet{"foo": "bar"},
+		Entry: logproto.Entry{
+			Timestamp: time.Now(),
+			Line:      "very important log",
+		},
+	}
+	c.receiver.Chan() <- logEntry
+	c.receiver.Chan() <- logEntry
+
+	// The batch is retried more than max_backoff_retries times and kept in
+	// the queue.
+	require.Eventually(t, func() bool {
+		info := queueInfo(c)
+		return info.Batches == 1 && info.LastSendFailure != ""
+	}, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, 1, queueInfo(c).Batches)
+	stop()
+
+	// The queued batch is sent once the component is restarted and the
+	// endpoint is available. It's still sent in the format it was queued in
+	// after the format of the endpoint changed.
+	up.Store(true)
+	args.Endpoints[0].Format = "otlp"
+	c, stop = startComponent()
+	defer stop()
+
+	select {
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "failed waiting for logs")
+	case req := <-ch:
+		require.Len(t, req.Streams, 1)
+		require.Equal(t, logEntry.Labels.String(), req.Streams[0].Labels)
+		require.Len(t, req.Streams[0].Entries, 2)
+	}
+	require.Eventually(t, func() bool {
+		info := queueInfo(c)
+		return info.Batches == 0 && info.SentEntries == 2
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestDiskQueueArguments(t *testing.T) {
+	var args Arguments
+	err := river.Unmarshal([]byte(`
+		endpoint {
+			url = "http://localhost:3100/loki/api/v1/push"
+			disk_queue {}
+		}
+		wal {
+			enabled = true
+		}
+	`), &args)
+	require.ErrorContains(t, err, "disk_queue blocks can't be used when the WAL is enabled")
+
+	args = Arguments{}
+	err = river.Unmarshal([]byte(`
+		endpoint {
+			url = "http://localhost:3100/loki/api/v1/push"
+			disk_queue {}
+		}
+		endpoint {
+			url       = "http://localhost:3100/loki/api/v1/push"
+			tenant_id = "other"
+			disk_queue {}
+		}
+	`), &args)
+	require.ErrorContains(t, err, "multiple endpoints with a disk_queue use the name")
+
+	args = Arguments{}
+	require.NoError(t, river.Unmarshal([]byte(`
+		endpoint {
+			url = "http://localhost:3100/loki/api/v1/push"
+			disk_queue {
+				max_age = "1h"
+			}
+		}
+	`), &args))
+	require.Equal(t, &diskqueue.Arguments{MaxSize: diskqueue.DefaultArguments.MaxSize, MaxAge: time.Hour}, args.Endpoints[0].DiskQueue)
+}
+
+// TestWriteOTLP ensures that endpoints with the otlp format send logs as
+// OTLP/HTTP logs export requests.
+func TestWriteOTLP(t *testing.T) {
+	ch := make(chan plogotlp.ExportRequest, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		gr, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		raw, err := io.ReadAll(gr)
+		require.NoError(t, err)
+
+		req := plogotlp.NewExportRequest()
+		require.NoError(t, req.UnmarshalProto(raw))
+		ch <- req
+	}))
+	defer srv.Close()
+
+	var args Arguments
+	require.NoError(t, river.Unmarshal([]byte(fmt.Sprintf(`
+		endpoint {
+			url        = "%s"
+			format     = "otlp"
+			batch_wait = "10ms"
+		}
+	`, srv.URL)), &args))
+
+	tc, err := componenttest.NewControllerFromID(util.TestLogger(t), "loki.write")
+	require.NoError(t, err)
+	go func() {
+		require.NoError(t, tc.Run(componenttest.TestContext(t), args))
+	}()
+	require.NoError(t, tc.WaitExports(time.Second))
+
+	tc.Exports().(Exports).Receiver.Chan() <- loki.Entry{
+		Labels: model.LabelSet{"foo": "bar"},
+		Entry: logproto.Entry{
+			Timestamp: time.Now(),
+			Line:      "very important log",
+		},
+	}
+
+	select {
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "failed waiting for logs")
+	case req := <-ch:
+		logs := req.Logs()
+		require.Equal(t, 1, logs.ResourceLogs().Len())
+		require.Equal(t, map[string]any{"foo": "bar"}, logs.ResourceLogs().At(0).Resource().Attributes().AsRaw())
+		records := logs.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords()
+		require.Equal(t, 1, records.Len())
+		require.Equal(t, "very important log", records.At(0).Body().Str())
+	}
+}
+
+func TestBadFormat(t *testing.T) {
+	var args Arguments
+	err := river.Unmarshal([]byte(`
+		endpoint {
+			url    = "http://localhost:3100/loki/api/v1/push"
+			format = "json"
+		}
+	`), &args)
+	require.ErrorContains(t, err, `unsupported format "json"`)
+}
+
 type testCase struct {
 	linesCount  int
 	seriesCount int
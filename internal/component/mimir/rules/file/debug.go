@@ -0,0 +1,45 @@
+package rules
+
+import "sort"
+
+type DebugInfo struct {
+	RuleFiles           []DebugRuleFile       `river:"rule_file,block,optional"`
+	MimirRuleNamespaces []DebugMimirNamespace `river:"mimir_rule_namespace,block,optional"`
+}
+
+type DebugRuleFile struct {
+	Name          string `river:"name,attr"`
+	Source        string `river:"source,attr"`
+	NumRuleGroups int    `river:"num_rule_groups,attr"`
+}
+
+type DebugMimirNamespace struct {
+	Name          string `river:"name,attr"`
+	NumRuleGroups int    `river:"num_rule_groups,attr"`
+}
+
+func (c *Component) DebugInfo() interface{} {
+	c.stateMut.RLock()
+	defer c.stateMut.RUnlock()
+
+	var output DebugInfo
+	for _, rn := range c.desiredState {
+		output.RuleFiles = append(output.RuleFiles, DebugRuleFile{
+			Name:          rn.name,
+			Source:        rn.source,
+			NumRuleGroups: len(rn.groups),
+		})
+	}
+
+	for ns, groups := range c.currentState {
+		output.MimirRuleNamespaces = append(output.MimirRuleNamespaces, DebugMimirNamespace{
+			Name:          ns,
+			NumRuleGroups: len(groups),
+		})
+	}
+	sort.Slice(output.MimirRuleNamespaces, func(i, j int) bool {
+		return output.MimirRuleNamespaces[i].Name < output.MimirRuleNamespaces[j].Name
+	})
+
+	return output
+}
@@ -0,0 +1,172 @@
+package rules
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bmatcuk/doublestar"
+	"github.com/hashicorp/go-multierror"
+	"github.com/prometheus/prometheus/model/rulefmt"
+)
+
+// contentSource is the source reported for rule namespaces loaded from the
+// content argument.
+const contentSource = "content"
+
+// ruleNamespace is a set of rule groups loaded from a single rule file or
+// content string, which are stored in a single Mimir namespace.
+type ruleNamespace struct {
+	name   string
+	source string
+	groups []rulefmt.RuleGroup
+}
+
+// loadRuleNamespaces loads the rule groups of all rule files and content
+// strings in args. Each rule file is named after its base name without the
+// extension, and each content string after its key. An error is returned if
+// any rule file can't be loaded or two sources have the same name, so that no
+// changes are applied based on a partial view of the rules.
+func loadRuleNamespaces(args Arguments) ([]ruleNamespace, error) {
+	var (
+		res   []ruleNamespace
+		seen  = make(map[string]string) // Name -> source
+		errs  error
+		paths []string
+	)
+
+	add := func(name, source string, groups []rulefmt.RuleGroup) {
+		if other, ok := seen[name]; ok {
+			errs = multierror.Append(errs, fmt.Errorf("rules from %q and %q use the same name %q", other, source, name))
+			return
+		}
+		seen[name] = source
+		res = append(res, ruleNamespace{name: name, source: source, groups: groups})
+	}
+
+	for _, pattern := range args.Files {
+		matches, err := globRuleFiles(pattern)
+		if err != nil {
+			errs = multierror.Append(errs, err)
+			continue
+		}
+		paths = append(paths, matches...)
+	}
+	sort.Strings(paths)
+
+	for i, path := range paths {
+		if i > 0 && paths[i-1] == path {
+			// Matched by more than one pattern.
+			continue
+		}
+
+		name := ruleFileName(path)
+		if err := validateRuleNamespaceName(name); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("invalid rule file %q: %w", path, err))
+			continue
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed to read rule file: %w", err))
+			continue
+		}
+		groups, err := parseRuleGroups(content)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("invalid rule file %q: %w", path, err))
+			continue
+		}
+		add(name, path, groups)
+	}
+
+	names := make([]string, 0, len(args.Content))
+	for name := range args.Content {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		groups, err := parseRuleGroups([]byte(args.Content[name]))
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("invalid rules for %q: %w", name, err))
+			continue
+		}
+		add(name, contentSource, groups)
+	}
+
+	if errs != nil {
+		return nil, errs
+	}
+	return res, nil
+}
+
+// globRuleFiles returns the regular files matching pattern. Patterns without
+// glob characters must match an existing file.
+func globRuleFiles(pattern string) ([]string, error) {
+	if !strings.ContainsAny(pattern, "*?[{") {
+		return []string{pattern}, nil
+	}
+
+	matches, err := doublestar.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file pattern %q: %w", pattern, err)
+	}
+
+	res := matches[:0]
+	for _, m := range matches {
+		fi, err := os.Stat(m)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat rule file: %w", err)
+		}
+		if fi.Mode().IsRegular() {
+			res = append(res, m)
+		}
+	}
+	return res, nil
+}
+
+// ruleFileName returns the name of a rule file: its base name without the
+// extension.
+func ruleFileName(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// validateRuleNamespaceName checks that name can be used as the last part of
+// a managed Mimir namespace.
+func validateRuleNamespaceName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("name must not be empty")
+	case strings.Contains(name, "/"):
+		return fmt.Errorf("name must not contain %q", "/")
+	}
+	return nil
+}
+
+// parseRuleGroups parses and validates rule groups in the Prometheus rule file
+// format, including the PromQL expressions of all rules.
+func parseRuleGroups(content []byte) ([]rulefmt.RuleGroup, error) {
+	groups, errs := rulefmt.Parse(content)
+	if len(errs) > 0 {
+		return nil, multierror.Append(nil, errs...)
+	}
+	return groups.Groups, nil
+}
+
+// mimirNamespaceForRules returns the Mimir namespace that the rules with the
+// given name are stored in. This function, along with
+// isManagedMimirNamespace, is used to determine if a Mimir namespace is
+// managed by the component.
+func mimirNamespaceForRules(prefix, name string) string {
+	return prefix + "/" + name
+}
+
+// isManagedMimirNamespace returns true if the namespace is managed by the
+// component. Unmanaged namespaces, including the namespaces managed by
+// mimir.rules.kubernetes, are left as is.
+func isManagedMimirNamespace(prefix, namespace string) bool {
+	name, ok := strings.CutPrefix(namespace, prefix+"/")
+	return ok && validateRuleNamespaceName(name) == nil
+}
@@ -0,0 +1,295 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/internal/component"
+	commonK8s "github.com/grafana/agent/internal/component/common/kubernetes"
+	"github.com/grafana/agent/internal/featuregate"
+	"github.com/grafana/agent/internal/flow/logging/level"
+	mimirClient "github.com/grafana/agent/internal/mimir/client"
+	"github.com/grafana/dskit/instrument"
+	"github.com/hashicorp/go-multierror"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:      "mimir.rules.file",
+		Stability: featuregate.StabilityBeta,
+		Args:      Arguments{},
+		Exports:   nil,
+		Build: func(o component.Options, c component.Arguments) (component.Component, error) {
+			return New(o, c.(Arguments))
+		},
+	})
+}
+
+type Component struct {
+	log  log.Logger
+	opts component.Options
+
+	mut         sync.RWMutex
+	args        Arguments
+	mimirClient mimirClient.Interface
+
+	updated chan struct{}
+
+	stateMut     sync.RWMutex
+	desiredState []ruleNamespace
+	currentState commonK8s.RuleGroupsByNamespace
+
+	metrics   *metrics
+	healthMut sync.RWMutex
+	health    component.Health
+}
+
+type metrics struct {
+	configUpdatesTotal prometheus.Counter
+	syncsTotal         prometheus.Counter
+	syncsFailed        prometheus.Counter
+
+	mimirClientTiming *prometheus.HistogramVec
+}
+
+func (m *metrics) Register(r prometheus.Registerer) error {
+	r.MustRegister(
+		m.configUpdatesTotal,
+		m.syncsTotal,
+		m.syncsFailed,
+		m.mimirClientTiming,
+	)
+	return nil
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		configUpdatesTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Subsystem: "mimir_rules",
+			Name:      "config_updates_total",
+			Help:      "Total number of times the configuration has been updated.",
+		}),
+		syncsTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Subsystem: "mimir_rules",
+			Name:      "syncs_total",
+			Help:      "Total number of times the rules were synced to Mimir.",
+		}),
+		syncsFailed: prometheus.NewCounter(prometheus.CounterOpts{
+			Subsystem: "mimir_rules",
+			Name:      "syncs_failed_total",
+			Help:      "Total number of times syncing the rules to Mimir failed.",
+		}),
+		mimirClientTiming: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Subsystem: "mimir_rules",
+			Name:      "mimir_client_request_duration_seconds",
+			Help:      "Duration of requests to the Mimir API.",
+			Buckets:   instrument.DefBuckets,
+		}, instrument.HistogramCollectorBuckets),
+	}
+}
+
+var _ component.Component = (*Component)(nil)
+var _ component.DebugComponent = (*Component)(nil)
+var _ component.HealthComponent = (*Component)(nil)
+
+func New(o component.Options, args Arguments) (*Component, error) {
+	metrics := newMetrics()
+	err := metrics.Register(o.Registerer)
+	if err != nil {
+		return nil, fmt.Errorf("registering metrics failed: %w", err)
+	}
+
+	c := &Component{
+		log:     o.Logger,
+		opts:    o,
+		updated: make(chan struct{}, 1),
+		metrics: metrics,
+	}
+
+	if err := c.Update(args); err != nil {
+		return nil, fmt.Errorf("initializing component failed: %w", err)
+	}
+
+	return c, nil
+}
+
+func (c *Component) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.syncInterval())
+	defer ticker.Stop()
+
+	// The rules are synced right away, including the configuration passed to
+	// New.
+	select {
+	case <-c.updated:
+	default:
+	}
+
+	for {
+		c.metrics.syncsTotal.Inc()
+		if err := c.sync(ctx); err != nil {
+			c.metrics.syncsFailed.Inc()
+			level.Error(c.log).Log("msg", "failed to sync rules", "err", err)
+			c.reportUnhealthy(err)
+		} else {
+			c.reportHealthy()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.updated:
+			ticker.Reset(c.syncInterval())
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Component) Update(newConfig component.Arguments) error {
+	args := newConfig.(Arguments)
+	level.Info(c.log).Log("msg", "initializing with new configuration")
+
+	httpClient := args.HTTPClientConfig.Convert()
+	client, err := mimirClient.New(c.log, mimirClient.Config{
+		ID:                   args.TenantID,
+		Address:              args.Address,
+		UseLegacyRoutes:      args.UseLegacyRoutes,
+		PrometheusHTTPPrefix: args.PrometheusHTTPPrefix,
+		HTTPClientConfig:     *httpClient,
+	}, c.metrics.mimirClientTiming)
+	if err != nil {
+		return err
+	}
+
+	c.mut.Lock()
+	c.args = args
+	c.mimirClient = client
+	c.mut.Unlock()
+
+	c.metrics.configUpdatesTotal.Inc()
+
+	// Sync immediately with the new configuration.
+	select {
+	case c.updated <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (c *Component) syncInterval() time.Duration {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	return c.args.SyncInterval
+}
+
+// sync loads the rules and applies the differences to the rules currently
+// stored in the managed namespaces of the Mimir ruler.
+func (c *Component) sync(ctx context.Context) error {
+	c.mut.RLock()
+	args, client := c.args, c.mimirClient
+	c.mut.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, args.SyncInterval)
+	defer cancel()
+
+	ruleNamespaces, err := loadRuleNamespaces(args)
+	if err != nil {
+		return fmt.Errorf("failed to load rules: %w", err)
+	}
+
+	desiredState := make(commonK8s.RuleGroupsByNamespace, len(ruleNamespaces))
+	for _, rn := range ruleNamespaces {
+		desiredState[mimirNamespaceForRules(args.MimirNameSpacePrefix, rn.name)] = rn.groups
+	}
+
+	currentState, err := listManagedRules(ctx, client, args.MimirNameSpacePrefix)
+	if err != nil {
+		return err
+	}
+
+	c.stateMut.Lock()
+	c.desiredState = ruleNamespaces
+	c.currentState = currentState
+	c.stateMut.Unlock()
+
+	diffs := commonK8s.DiffRuleState(desiredState, currentState)
+	if len(diffs) == 0 {
+		return nil
+	}
+
+	namespaces := make([]string, 0, len(diffs))
+	for ns := range diffs {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	var result error
+	for _, ns := range namespaces {
+		if err := c.applyChanges(ctx, client, ns, diffs[ns]); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+
+	// Resync the current state after applying changes.
+	currentState, err = listManagedRules(ctx, client, args.MimirNameSpacePrefix)
+	if err != nil {
+		return multierror.Append(result, err)
+	}
+	c.stateMut.Lock()
+	c.currentState = currentState
+	c.stateMut.Unlock()
+
+	return result
+}
+
+// listManagedRules returns the rule groups of all namespaces managed by the
+// component.
+func listManagedRules(ctx context.Context, client mimirClient.Interface, prefix string) (commonK8s.RuleGroupsByNamespace, error) {
+	rulesByNamespace, err := client.ListRules(ctx, "")
+	if errors.Is(err, mimirClient.ErrResourceNotFound) {
+		// The ruler doesn't have any rules for the tenant yet.
+		return commonK8s.RuleGroupsByNamespace{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to list rules from mimir: %w", err)
+	}
+
+	for ns := range rulesByNamespace {
+		if !isManagedMimirNamespace(prefix, ns) {
+			delete(rulesByNamespace, ns)
+		}
+	}
+	return rulesByNamespace, nil
+}
+
+func (c *Component) applyChanges(ctx context.Context, client mimirClient.Interface, namespace string, diffs []commonK8s.RuleGroupDiff) error {
+	for _, diff := range diffs {
+		switch diff.Kind {
+		case commonK8s.RuleGroupDiffKindAdd:
+			err := client.CreateRuleGroup(ctx, namespace, diff.Desired)
+			if err != nil {
+				return err
+			}
+			level.Info(c.log).Log("msg", "added rule group", "namespace", namespace, "group", diff.Desired.Name)
+		case commonK8s.RuleGroupDiffKindRemove:
+			err := client.DeleteRuleGroup(ctx, namespace, diff.Actual.Name)
+			if err != nil {
+				return err
+			}
+			level.Info(c.log).Log("msg", "removed rule group", "namespace", namespace, "group", diff.Actual.Name)
+		case commonK8s.RuleGroupDiffKindUpdate:
+			err := client.CreateRuleGroup(ctx, namespace, diff.Desired)
+			if err != nil {
+				return err
+			}
+			level.Info(c.log).Log("msg", "updated rule group", "namespace", namespace, "group", diff.Desired.Name)
+		default:
+			level.Error(c.log).Log("msg", "unknown rule group diff kind", "kind", diff.Kind)
+		}
+	}
+	return nil
+}
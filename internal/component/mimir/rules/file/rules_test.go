@@ -0,0 +1,241 @@
+package rules
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/grafana/agent/internal/component"
+	mimirClient "github.com/grafana/agent/internal/mimir/client"
+	"github.com/grafana/agent/internal/util"
+	"github.com/grafana/river"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const testRules = `
+groups:
+  - name: example
+    rules:
+      - record: job:up:sum
+        expr: sum by (job) (up)
+`
+
+type fakeMimirClient struct {
+	rulesMut sync.RWMutex
+	rules    map[string][]rulefmt.RuleGroup
+}
+
+var _ mimirClient.Interface = &fakeMimirClient{}
+
+func (m *fakeMimirClient) CreateRuleGroup(_ context.Context, namespace string, rule rulefmt.RuleGroup) error {
+	m.rulesMut.Lock()
+	defer m.rulesMut.Unlock()
+	m.deleteLocked(namespace, rule.Name)
+	m.rules[namespace] = append(m.rules[namespace], rule)
+	return nil
+}
+
+func (m *fakeMimirClient) DeleteRuleGroup(_ context.Context, namespace, group string) error {
+	m.rulesMut.Lock()
+	defer m.rulesMut.Unlock()
+	m.deleteLocked(namespace, group)
+	return nil
+}
+
+func (m *fakeMimirClient) deleteLocked(namespace, group string) {
+	for i, g := range m.rules[namespace] {
+		if g.Name == group {
+			m.rules[namespace] = append(m.rules[namespace][:i], m.rules[namespace][i+1:]...)
+			if len(m.rules[namespace]) == 0 {
+				delete(m.rules, namespace)
+			}
+			return
+		}
+	}
+}
+
+func (m *fakeMimirClient) ListRules(_ context.Context, _ string) (map[string][]rulefmt.RuleGroup, error) {
+	m.rulesMut.RLock()
+	defer m.rulesMut.RUnlock()
+	if len(m.rules) == 0 {
+		return nil, mimirClient.ErrResourceNotFound
+	}
+	output := make(map[string][]rulefmt.RuleGroup)
+	for ns, v := range m.rules {
+		output[ns] = append([]rulefmt.RuleGroup(nil), v...)
+	}
+	return output, nil
+}
+
+func (m *fakeMimirClient) namespaces() []string {
+	m.rulesMut.RLock()
+	defer m.rulesMut.RUnlock()
+	var res []string
+	for ns := range m.rules {
+		res = append(res, ns)
+	}
+	return res
+}
+
+func TestRiverConfig(t *testing.T) {
+	var exampleRiverConfig = `
+	address = "GRAFANA_CLOUD_METRICS_URL"
+	files   = ["/etc/rules/*.yaml"]
+	content = {
+		"recording" = "groups: []",
+	}
+	basic_auth {
+		username = "GRAFANA_CLOUD_USER"
+		password = "GRAFANA_CLOUD_API_KEY"
+	}
+`
+
+	var args Arguments
+	err := river.Unmarshal([]byte(exampleRiverConfig), &args)
+	require.NoError(t, err)
+}
+
+func TestBadRiverConfig(t *testing.T) {
+	tests := map[string]struct {
+		config string
+		err    string
+	}{
+		"invalid PromQL": {
+			config: `
+			address = "GRAFANA_CLOUD_METRICS_URL"
+			content = {
+				"recording" = "groups: [{name: example, rules: [{record: job:up:sum, expr: 'sum by (job) (up'}]}]",
+			}`,
+			err: `invalid rules for "recording"`,
+		},
+		"invalid name": {
+			config: `
+			address = "GRAFANA_CLOUD_METRICS_URL"
+			content = {
+				"team/recording" = "groups: []",
+			}`,
+			err: `name must not contain "/"`,
+		},
+		"invalid HTTP client config": {
+			config: `
+			address = "GRAFANA_CLOUD_METRICS_URL"
+			bearer_token = "token"
+			bearer_token_file = "/path/to/file.token"`,
+			err: "at most one of basic_auth, authorization, oauth2, bearer_token & bearer_token_file must be configured",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var args Arguments
+			err := river.Unmarshal([]byte(tc.config), &args)
+			require.ErrorContains(t, err, tc.err)
+		})
+	}
+}
+
+func TestLoadRuleNamespaces(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "team-a"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "team-a", "recording.yaml"), []byte(testRules), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "alerts.yml"), []byte("groups: []"), 0644))
+
+	args := DefaultArguments
+	args.Files = []string{filepath.Join(dir, "**", "*.yaml"), filepath.Join(dir, "alerts.yml")}
+	args.Content = map[string]string{"extra": testRules}
+
+	rns, err := loadRuleNamespaces(args)
+	require.NoError(t, err)
+	require.Len(t, rns, 3)
+	require.Equal(t, "alerts", rns[0].name)
+	require.Empty(t, rns[0].groups)
+	require.Equal(t, "recording", rns[1].name)
+	require.Equal(t, filepath.Join(dir, "team-a", "recording.yaml"), rns[1].source)
+	require.Len(t, rns[1].groups, 1)
+	require.Equal(t, "extra", rns[2].name)
+	require.Equal(t, contentSource, rns[2].source)
+
+	// Files which don't exist, are invalid, or have the same name as another
+	// source fail loading.
+	args.Content = map[string]string{"recording": testRules}
+	_, err = loadRuleNamespaces(args)
+	require.ErrorContains(t, err, `use the same name "recording"`)
+
+	args.Content = nil
+	args.Files = []string{filepath.Join(dir, "missing.yaml")}
+	_, err = loadRuleNamespaces(args)
+	require.ErrorContains(t, err, "failed to read rule file")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "alerts.yml"), []byte("groups: [{name: a, rules: [{alert: A, expr: 'up =='}]}]"), 0644))
+	args.Files = []string{filepath.Join(dir, "alerts.yml")}
+	_, err = loadRuleNamespaces(args)
+	require.ErrorContains(t, err, "invalid rule file")
+}
+
+func TestIsManagedMimirNamespace(t *testing.T) {
+	require.True(t, isManagedMimirNamespace("agent", "agent/recording"))
+	require.False(t, isManagedMimirNamespace("agent", "agent/"))
+	require.False(t, isManagedMimirNamespace("agent", "other/recording"))
+	require.False(t, isManagedMimirNamespace("agent", "agentx/recording"))
+	// Namespaces managed by mimir.rules.kubernetes.
+	require.False(t, isManagedMimirNamespace("agent", "agent/default/rules/64aab764-c95e-4ee9-a932-cd63ba57e6cf"))
+}
+
+func TestSync(t *testing.T) {
+	var groups rulefmt.RuleGroups
+	require.NoError(t, yaml.Unmarshal([]byte(testRules), &groups))
+	foreign := []string{
+		"other/recording",
+		"agent/default/rules/64aab764-c95e-4ee9-a932-cd63ba57e6cf",
+	}
+
+	client := &fakeMimirClient{rules: map[string][]rulefmt.RuleGroup{
+		foreign[0]:    groups.Groups,
+		foreign[1]:    groups.Groups,
+		"agent/stale": groups.Groups,
+	}}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "recording.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testRules), 0644))
+
+	args := DefaultArguments
+	args.Address = "http://localhost:9009"
+	args.Files = []string{path}
+	args.Content = map[string]string{"extra": testRules}
+
+	c, err := New(component.Options{
+		Logger:     util.TestFlowLogger(t),
+		Registerer: prometheus.NewRegistry(),
+	}, args)
+	require.NoError(t, err)
+	c.mimirClient = client
+
+	require.NoError(t, c.sync(context.Background()))
+	require.ElementsMatch(t, append([]string{"agent/recording", "agent/extra"}, foreign...), client.namespaces())
+
+	debugInfo := c.DebugInfo().(DebugInfo)
+	require.Equal(t, []DebugRuleFile{
+		{Name: "recording", Source: path, NumRuleGroups: 1},
+		{Name: "extra", Source: contentSource, NumRuleGroups: 1},
+	}, debugInfo.RuleFiles)
+	require.Equal(t, []DebugMimirNamespace{
+		{Name: "agent/extra", NumRuleGroups: 1},
+		{Name: "agent/recording", NumRuleGroups: 1},
+	}, debugInfo.MimirRuleNamespaces)
+
+	// Nothing is changed if a rule file can't be loaded.
+	require.NoError(t, os.Remove(path))
+	require.Error(t, c.sync(context.Background()))
+	require.ElementsMatch(t, append([]string{"agent/recording", "agent/extra"}, foreign...), client.namespaces())
+
+	// Rules of removed sources are deleted.
+	c.args.Files = nil
+	require.NoError(t, c.sync(context.Background()))
+	require.ElementsMatch(t, append([]string{"agent/extra"}, foreign...), client.namespaces())
+}
@@ -0,0 +1,64 @@
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/grafana/agent/internal/component/common/config"
+)
+
+type Arguments struct {
+	Address              string                  `river:"address,attr"`
+	TenantID             string                  `river:"tenant_id,attr,optional"`
+	UseLegacyRoutes      bool                    `river:"use_legacy_routes,attr,optional"`
+	PrometheusHTTPPrefix string                  `river:"prometheus_http_prefix,attr,optional"`
+	HTTPClientConfig     config.HTTPClientConfig `river:",squash"`
+	SyncInterval         time.Duration           `river:"sync_interval,attr,optional"`
+	MimirNameSpacePrefix string                  `river:"mimir_namespace_prefix,attr,optional"`
+
+	Files   []string          `river:"files,attr,optional"`
+	Content map[string]string `river:"content,attr,optional"`
+}
+
+var DefaultArguments = Arguments{
+	SyncInterval:         5 * time.Minute,
+	MimirNameSpacePrefix: "agent",
+	HTTPClientConfig:     config.DefaultHTTPClientConfig,
+	PrometheusHTTPPrefix: "/prometheus",
+}
+
+// SetToDefault implements river.Defaulter.
+func (args *Arguments) SetToDefault() {
+	*args = DefaultArguments
+}
+
+// Validate implements river.Validator.
+func (args *Arguments) Validate() error {
+	if args.SyncInterval <= 0 {
+		return fmt.Errorf("sync_interval must be greater than 0")
+	}
+	if args.MimirNameSpacePrefix == "" {
+		return fmt.Errorf("mimir_namespace_prefix must not be empty")
+	}
+
+	// Rules passed as strings are validated upfront, so that invalid rules
+	// are reported as an invalid configuration. Rule files are validated
+	// whenever they are loaded.
+	names := make([]string, 0, len(args.Content))
+	for name := range args.Content {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := validateRuleNamespaceName(name); err != nil {
+			return fmt.Errorf("invalid content key %q: %w", name, err)
+		}
+		if _, err := parseRuleGroups([]byte(args.Content[name])); err != nil {
+			return fmt.Errorf("invalid rules for %q: %w", name, err)
+		}
+	}
+
+	// We must explicitly Validate because HTTPClientConfig is squashed and it won't run otherwise
+	return args.HTTPClientConfig.Validate()
+}
@@ -0,0 +1,146 @@
+// Package livedebuggingconsumer implements consumers which publish a summary
+// of the telemetry passing through them to the live debugging service before
+// forwarding it.
+package livedebuggingconsumer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/grafana/agent/internal/service/livedebugging"
+	otelconsumer "go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+// Traces wraps next so that every span it receives is published for
+// componentID.
+func Traces(publisher livedebugging.DebugDataPublisher, componentID string, next otelconsumer.Traces) otelconsumer.Traces {
+	return &traces{publisher: publisher, componentID: componentID, next: next}
+}
+
+// Metrics wraps next so that every metric it receives is published for
+// componentID.
+func Metrics(publisher livedebugging.DebugDataPublisher, componentID string, next otelconsumer.Metrics) otelconsumer.Metrics {
+	return &metrics{publisher: publisher, componentID: componentID, next: next}
+}
+
+// Logs wraps next so that every log record it receives is published for
+// componentID.
+func Logs(publisher livedebugging.DebugDataPublisher, componentID string, next otelconsumer.Logs) otelconsumer.Logs {
+	return &logs{publisher: publisher, componentID: componentID, next: next}
+}
+
+type traces struct {
+	publisher   livedebugging.DebugDataPublisher
+	componentID string
+	next        otelconsumer.Traces
+}
+
+func (c *traces) Capabilities() otelconsumer.Capabilities {
+	return c.next.Capabilities()
+}
+
+func (c *traces) ConsumeTraces(ctx context.Context, td ptrace.Traces) error {
+	if c.publisher.IsActive(c.componentID) {
+		rss := td.ResourceSpans()
+		for i := 0; i < rss.Len(); i++ {
+			rs := rss.At(i)
+			resource := rs.Resource().Attributes().AsRaw()
+			sss := rs.ScopeSpans()
+			for j := 0; j < sss.Len(); j++ {
+				spans := sss.At(j).Spans()
+				for k := 0; k < spans.Len(); k++ {
+					span := spans.At(k)
+					c.publisher.Publish(c.componentID, fmt.Sprintf(
+						"span trace_id=%s span_id=%s name=%q resource=%v attributes=%v",
+						span.TraceID(), span.SpanID(), span.Name(), resource, span.Attributes().AsRaw(),
+					))
+				}
+			}
+		}
+	}
+	return c.next.ConsumeTraces(ctx, td)
+}
+
+type metrics struct {
+	publisher   livedebugging.DebugDataPublisher
+	componentID string
+	next        otelconsumer.Metrics
+}
+
+func (c *metrics) Capabilities() otelconsumer.Capabilities {
+	return c.next.Capabilities()
+}
+
+func (c *metrics) ConsumeMetrics(ctx context.Context, md pmetric.Metrics) error {
+	if c.publisher.IsActive(c.componentID) {
+		rms := md.ResourceMetrics()
+		for i := 0; i < rms.Len(); i++ {
+			rm := rms.At(i)
+			resource := rm.Resource().Attributes().AsRaw()
+			sms := rm.ScopeMetrics()
+			for j := 0; j < sms.Len(); j++ {
+				ms := sms.At(j).Metrics()
+				for k := 0; k < ms.Len(); k++ {
+					m := ms.At(k)
+					c.publisher.Publish(c.componentID, fmt.Sprintf(
+						"metric name=%q type=%s datapoints=%d resource=%v",
+						m.Name(), m.Type(), dataPointCount(m), resource,
+					))
+				}
+			}
+		}
+	}
+	return c.next.ConsumeMetrics(ctx, md)
+}
+
+func dataPointCount(m pmetric.Metric) int {
+	switch m.Type() {
+	case pmetric.MetricTypeGauge:
+		return m.Gauge().DataPoints().Len()
+	case pmetric.MetricTypeSum:
+		return m.Sum().DataPoints().Len()
+	case pmetric.MetricTypeHistogram:
+		return m.Histogram().DataPoints().Len()
+	case pmetric.MetricTypeExponentialHistogram:
+		return m.ExponentialHistogram().DataPoints().Len()
+	case pmetric.MetricTypeSummary:
+		return m.Summary().DataPoints().Len()
+	default:
+		return 0
+	}
+}
+
+type logs struct {
+	publisher   livedebugging.DebugDataPublisher
+	componentID string
+	next        otelconsumer.Logs
+}
+
+func (c *logs) Capabilities() otelconsumer.Capabilities {
+	return c.next.Capabilities()
+}
+
+func (c *logs) ConsumeLogs(ctx context.Context, ld plog.Logs) error {
+	if c.publisher.IsActive(c.componentID) {
+		rls := ld.ResourceLogs()
+		for i := 0; i < rls.Len(); i++ {
+			rl := rls.At(i)
+			resource := rl.Resource().Attributes().AsRaw()
+			sls := rl.ScopeLogs()
+			for j := 0; j < sls.Len(); j++ {
+				records := sls.At(j).LogRecords()
+				for k := 0; k < records.Len(); k++ {
+					record := records.At(k)
+					c.publisher.Publish(c.componentID, fmt.Sprintf(
+						"log severity=%s body=%q resource=%v attributes=%v",
+						record.SeverityText(), record.Body().AsString(), resource, record.Attributes().AsRaw(),
+					))
+				}
+			}
+		}
+	}
+	return c.next.ConsumeLogs(ctx, ld)
+}
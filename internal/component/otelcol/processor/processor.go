@@ -13,7 +13,9 @@ import (
 	"github.com/grafana/agent/internal/component/otelcol/internal/fanoutconsumer"
 	"github.com/grafana/agent/internal/component/otelcol/internal/lazycollector"
 	"github.com/grafana/agent/internal/component/otelcol/internal/lazyconsumer"
+	"github.com/grafana/agent/internal/component/otelcol/internal/livedebuggingconsumer"
 	"github.com/grafana/agent/internal/component/otelcol/internal/scheduler"
+	"github.com/grafana/agent/internal/service/livedebugging"
 	"github.com/grafana/agent/internal/util/zapadapter"
 	"github.com/prometheus/client_golang/prometheus"
 	otelcomponent "go.opentelemetry.io/collector/component"
@@ -56,6 +58,8 @@ type Processor struct {
 
 	sched     *scheduler.Scheduler
 	collector *lazycollector.Collector
+
+	debugDataPublisher livedebugging.DebugDataPublisher
 }
 
 var (
@@ -96,6 +100,8 @@ func New(opts component.Options, f otelprocessor.Factory, args Arguments) (*Proc
 
 		sched:     scheduler.New(opts.Logger),
 		collector: collector,
+
+		debugDataPublisher: livedebugging.GetPublisher(opts.GetServiceData),
 	}
 	if err := p.Update(args); err != nil {
 		return nil, err
@@ -151,11 +157,13 @@ func (p *Processor) Update(args component.Arguments) error {
 		return err
 	}
 
+	// The output of the processor is published to the live debugging service
+	// before it's passed to the next consumers.
 	var (
 		next        = pargs.NextConsumers()
-		nextTraces  = fanoutconsumer.Traces(next.Traces)
-		nextMetrics = fanoutconsumer.Metrics(next.Metrics)
-		nextLogs    = fanoutconsumer.Logs(next.Logs)
+		nextTraces  = livedebuggingconsumer.Traces(p.debugDataPublisher, p.opts.ID, fanoutconsumer.Traces(next.Traces))
+		nextMetrics = livedebuggingconsumer.Metrics(p.debugDataPublisher, p.opts.ID, fanoutconsumer.Metrics(next.Metrics))
+		nextLogs    = livedebuggingconsumer.Logs(p.debugDataPublisher, p.opts.ID, fanoutconsumer.Logs(next.Logs))
 	)
 
 	// Create instances of the processor from our factory for each of our
@@ -3,6 +3,7 @@ package relabel
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"sync"
 
 	"github.com/grafana/agent/internal/component"
@@ -10,6 +11,7 @@ import (
 	"github.com/grafana/agent/internal/component/prometheus"
 	"github.com/grafana/agent/internal/featuregate"
 	"github.com/grafana/agent/internal/service/labelstore"
+	"github.com/grafana/agent/internal/service/livedebugging"
 	lru "github.com/hashicorp/golang-lru/v2"
 	prometheus_client "github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/prometheus/model/exemplar"
@@ -85,6 +87,8 @@ type Component struct {
 	exited           atomic.Bool
 	ls               labelstore.LabelStore
 
+	debugDataPublisher livedebugging.DebugDataPublisher
+
 	cacheMut sync.RWMutex
 	cache    *lru.Cache[uint64, *labelAndID]
 }
@@ -107,6 +111,8 @@ func New(o component.Options, args Arguments) (*Component, error) {
 		opts:  o,
 		cache: cache,
 		ls:    data.(labelstore.LabelStore),
+
+		debugDataPublisher: livedebugging.GetPublisher(o.GetServiceData),
 	}
 	c.metricsProcessed = prometheus_client.NewCounter(prometheus_client.CounterOpts{
 		Name: "agent_prometheus_relabel_metrics_processed",
@@ -150,6 +156,7 @@ func New(o component.Options, args Arguments) (*Component, error) {
 			}
 
 			newLbl := c.relabel(v, l)
+			c.publishDebugData(l, newLbl, strconv.FormatFloat(v, 'g', -1, 64), t)
 			if newLbl.IsEmpty() {
 				return 0, nil
 			}
@@ -184,6 +191,7 @@ func New(o component.Options, args Arguments) (*Component, error) {
 			}
 
 			newLbl := c.relabel(0, l)
+			c.publishDebugData(l, newLbl, "histogram", t)
 			if newLbl.IsEmpty() {
 				return 0, nil
 			}
@@ -262,6 +270,19 @@ func (c *Component) relabel(val float64, lbls labels.Labels) labels.Labels {
 	return relabelled
 }
 
+// publishDebugData publishes the labels of a sample before and after
+// relabeling. Empty labels mean the sample was dropped.
+func (c *Component) publishDebugData(before, after labels.Labels, value string, t int64) {
+	if !c.debugDataPublisher.IsActive(c.opts.ID) {
+		return
+	}
+	result := "dropped"
+	if !after.IsEmpty() {
+		result = after.String()
+	}
+	c.debugDataPublisher.Publish(c.opts.ID, fmt.Sprintf("%s => %s %s %d", before, result, value, t))
+}
+
 func (c *Component) getFromCache(id uint64) (*labelAndID, bool) {
 	c.cacheMut.RLock()
 	defer c.cacheMut.RUnlock()
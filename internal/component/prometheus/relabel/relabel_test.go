@@ -1,6 +1,7 @@
 package relabel
 
 import (
+	"fmt"
 	"math"
 	"strconv"
 	"testing"
@@ -13,6 +14,7 @@ import (
 	"github.com/grafana/agent/internal/component/prometheus"
 	"github.com/grafana/agent/internal/flow/componenttest"
 	"github.com/grafana/agent/internal/service/labelstore"
+	"github.com/grafana/agent/internal/service/livedebugging"
 	"github.com/grafana/agent/internal/util"
 	"github.com/grafana/river"
 	prom "github.com/prometheus/client_golang/prometheus"
@@ -225,3 +227,53 @@ func TestRuleGetter(t *testing.T) {
 	require.Equal(t, gotUpdated[0].SourceLabels, gotOriginal[0].SourceLabels)
 	require.Equal(t, gotUpdated[0].Regex, gotOriginal[0].Regex)
 }
+
+func TestLiveDebugging(t *testing.T) {
+	ls := labelstore.New(nil, prom.DefaultRegisterer)
+	liveDebugging := livedebugging.New()
+
+	relabeller, err := New(component.Options{
+		ID:            "prometheus.relabel.test",
+		Logger:        util.TestFlowLogger(t),
+		OnStateChange: func(e component.Exports) {},
+		Registerer:    prom.NewRegistry(),
+		GetServiceData: func(name string) (interface{}, error) {
+			switch name {
+			case labelstore.ServiceName:
+				return ls, nil
+			case livedebugging.ServiceName:
+				return liveDebugging.Data(), nil
+			}
+			return nil, fmt.Errorf("no service named %s", name)
+		},
+	}, Arguments{
+		ForwardTo: []storage.Appendable{prometheus.NewInterceptor(nil, ls)},
+		MetricRelabelConfigs: []*flow_relabel.Config{
+			{
+				SourceLabels: []string{"__name__"},
+				Regex:        flow_relabel.Regexp(relabel.MustNewRegexp("go_.*")),
+				Action:       "drop",
+			},
+		},
+		CacheSize: 100,
+	})
+	require.NoError(t, err)
+
+	var published []string
+	remove := liveDebugging.AddCallback("prometheus.relabel.test", func(data string) {
+		published = append(published, data)
+	})
+	defer remove()
+
+	app := relabeller.receiver.Appender(context.Background())
+	_, err = app.Append(0, labels.FromStrings("__name__", "up", "job", "a"), 10, 1)
+	require.NoError(t, err)
+	_, err = app.Append(0, labels.FromStrings("__name__", "go_goroutines", "job", "a"), 10, 5)
+	require.NoError(t, err)
+	require.NoError(t, app.Commit())
+
+	require.Equal(t, []string{
+		`{__name__="up", job="a"} => {__name__="up", job="a"} 1 10`,
+		`{__name__="go_goroutines", job="a"} => dropped 5 10`,
+	}, published)
+}
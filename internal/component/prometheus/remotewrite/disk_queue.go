@@ -0,0 +1,609 @@
+package remotewrite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/grafana/agent/internal/component/common/diskqueue"
+	flow_relabel "github.com/grafana/agent/internal/component/common/relabel"
+	"github.com/grafana/agent/internal/flow/logging/level"
+	"github.com/grafana/dskit/backoff"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/metadata"
+	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/storage/remote"
+	"go.uber.org/atomic"
+)
+
+// diskQueueReadBatch is the maximum number of queued commits merged into a
+// single remote_write request.
+const diskQueueReadBatch = 64
+
+// diskQueueStorage is a storage.Storage which writes appended data to the
+// disk queues of all endpoints which have a disk_queue block. Each endpoint
+// has its own queue and sender, independent of the WAL.
+type diskQueueStorage struct {
+	log       log.Logger
+	cancel    context.CancelFunc
+	endpoints *diskqueue.Endpoints[diskQueueEndpointConfig, *diskQueueEndpoint]
+
+	mut            sync.RWMutex
+	externalLabels labels.Labels
+}
+
+var _ storage.Storage = (*diskQueueStorage)(nil)
+
+// diskQueueEndpointConfig configures the sender of a disk queue endpoint.
+type diskQueueEndpointConfig struct {
+	Options EndpointOptions
+	Headers map[string]string
+}
+
+func newDiskQueueStorage(l log.Logger, dataPath string) *diskQueueStorage {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &diskQueueStorage{
+		log:    l,
+		cancel: cancel,
+		endpoints: diskqueue.NewEndpoints(dataPath, func(name string, cfg diskQueueEndpointConfig, q *diskqueue.Queue) (*diskQueueEndpoint, error) {
+			return newDiskQueueEndpoint(ctx, l, name, cfg, q)
+		}),
+	}
+}
+
+// diskQueueUpdate holds the disk queue endpoints built for new arguments
+// until they're applied.
+type diskQueueUpdate struct {
+	s              *diskQueueStorage
+	update         *diskqueue.Update[diskQueueEndpointConfig, *diskQueueEndpoint]
+	externalLabels labels.Labels
+}
+
+// prepare builds the disk queue endpoints for the endpoints in args which
+// have a disk_queue block, without touching the running ones. The returned
+// update must be committed or aborted.
+func (s *diskQueueStorage) prepare(args Arguments, headers map[string]string) (*diskQueueUpdate, error) {
+	var configs []diskqueue.EndpointConfig[diskQueueEndpointConfig]
+	for _, ep := range args.Endpoints {
+		if ep.DiskQueue == nil {
+			continue
+		}
+		configs = append(configs, diskqueue.EndpointConfig[diskQueueEndpointConfig]{
+			Name:    diskqueue.Name(ep.Name, ep.URL),
+			Options: ep.DiskQueue.Options(),
+			Config:  diskQueueEndpointConfig{Options: *ep, Headers: headers},
+		})
+	}
+
+	u, err := s.endpoints.Prepare(configs)
+	if err != nil {
+		return nil, err
+	}
+	return &diskQueueUpdate{s: s, update: u, externalLabels: toLabels(args.ExternalLabels)}, nil
+}
+
+// Commit replaces the running disk queue endpoints with the prepared ones.
+// Queued data of removed endpoints is kept on disk and resumed if the
+// endpoint is added back.
+func (u *diskQueueUpdate) Commit() error {
+	u.s.mut.Lock()
+	u.s.externalLabels = u.externalLabels
+	u.s.mut.Unlock()
+	return u.update.Commit()
+}
+
+// Abort discards the prepared endpoints.
+func (u *diskQueueUpdate) Abort() {
+	u.update.Abort()
+}
+
+// Appender implements storage.Appendable.
+func (s *diskQueueStorage) Appender(_ context.Context) storage.Appender {
+	return &diskQueueAppender{s: s}
+}
+
+// Querier implements storage.Queryable.
+func (s *diskQueueStorage) Querier(_, _ int64) (storage.Querier, error) {
+	return storage.NoopQuerier(), nil
+}
+
+// ChunkQuerier implements storage.ChunkQueryable.
+func (s *diskQueueStorage) ChunkQuerier(_, _ int64) (storage.ChunkQuerier, error) {
+	return storage.NoopChunkedQuerier(), nil
+}
+
+// StartTime implements storage.Storage.
+func (s *diskQueueStorage) StartTime() (int64, error) {
+	return int64(model.Latest), nil
+}
+
+// Close stops all senders and closes the queues.
+func (s *diskQueueStorage) Close() error {
+	s.cancel()
+	return s.endpoints.Close()
+}
+
+func (s *diskQueueStorage) hasEndpoints() bool {
+	return s.endpoints.Len() > 0
+}
+
+// enqueue encodes the data buffered by a and appends it to the queue of every
+// endpoint.
+func (s *diskQueueStorage) enqueue(a *diskQueueAppender) error {
+	s.mut.RLock()
+	externalLabels := s.externalLabels
+	s.mut.RUnlock()
+
+	var errs []error
+	s.endpoints.Range(func(ep *diskqueue.Endpoint[diskQueueEndpointConfig, *diskQueueEndpoint]) {
+		data, err := ep.Sender.encode(externalLabels, a)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("encoding data for endpoint %q: %w", ep.Name, err))
+			return
+		} else if data == nil {
+			return
+		}
+		if err := ep.Queue.Append(data); err != nil {
+			errs = append(errs, fmt.Errorf("queueing data for endpoint %q: %w", ep.Name, err))
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// debugInfo returns the debug info of every disk queue, ordered by name.
+func (s *diskQueueStorage) debugInfo() []diskQueueDebugInfo {
+	var res []diskQueueDebugInfo
+	s.endpoints.Range(func(ep *diskqueue.Endpoint[diskQueueEndpointConfig, *diskQueueEndpoint]) {
+		res = append(res, ep.Sender.debugInfo())
+	})
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+type diskQueueSample struct {
+	l labels.Labels
+	t int64
+	v float64
+}
+
+type diskQueueHistogram struct {
+	l  labels.Labels
+	t  int64
+	h  *histogram.Histogram
+	fh *histogram.FloatHistogram
+}
+
+type diskQueueExemplar struct {
+	l labels.Labels
+	e exemplar.Exemplar
+}
+
+// diskQueueAppender buffers appended data until Commit, where it is written
+// to the disk queues as a single entry per endpoint.
+type diskQueueAppender struct {
+	s *diskQueueStorage
+
+	samples    []diskQueueSample
+	histograms []diskQueueHistogram
+	exemplars  []diskQueueExemplar
+}
+
+var _ storage.Appender = (*diskQueueAppender)(nil)
+
+func (a *diskQueueAppender) Append(ref storage.SeriesRef, l labels.Labels, t int64, v float64) (storage.SeriesRef, error) {
+	if a.s.hasEndpoints() {
+		a.samples = append(a.samples, diskQueueSample{l: l, t: t, v: v})
+	}
+	return ref, nil
+}
+
+func (a *diskQueueAppender) AppendExemplar(ref storage.SeriesRef, l labels.Labels, e exemplar.Exemplar) (storage.SeriesRef, error) {
+	if a.s.hasEndpoints() {
+		a.exemplars = append(a.exemplars, diskQueueExemplar{l: l, e: e})
+	}
+	return ref, nil
+}
+
+func (a *diskQueueAppender) AppendHistogram(ref storage.SeriesRef, l labels.Labels, t int64, h *histogram.Histogram, fh *histogram.FloatHistogram) (storage.SeriesRef, error) {
+	if a.s.hasEndpoints() {
+		a.histograms = append(a.histograms, diskQueueHistogram{l: l, t: t, h: h, fh: fh})
+	}
+	return ref, nil
+}
+
+func (a *diskQueueAppender) UpdateMetadata(ref storage.SeriesRef, _ labels.Labels, _ metadata.Metadata) (storage.SeriesRef, error) {
+	// Metadata isn't queued; it's resent periodically by the WAL-based queues
+	// only.
+	return ref, nil
+}
+
+func (a *diskQueueAppender) Commit() error {
+	defer a.Rollback()
+	if len(a.samples) == 0 && len(a.histograms) == 0 && len(a.exemplars) == 0 {
+		return nil
+	}
+	return a.s.enqueue(a)
+}
+
+func (a *diskQueueAppender) Rollback() error {
+	a.samples = nil
+	a.histograms = nil
+	a.exemplars = nil
+	return nil
+}
+
+// diskQueueEndpoint sends the entries of the disk queue of a single endpoint
+// in order.
+type diskQueueEndpoint struct {
+	log     log.Logger
+	name    string
+	opts    EndpointOptions
+	relabel []*relabel.Config
+	queue   *diskqueue.Queue
+	client  remote.WriteClient
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	sentSamples    atomic.Uint64
+	droppedSamples atomic.Uint64
+	lastError      atomic.String
+}
+
+func newDiskQueueEndpoint(ctx context.Context, l log.Logger, name string, cfg diskQueueEndpointConfig, q *diskqueue.Queue) (*diskQueueEndpoint, error) {
+	ep := &cfg.Options
+	rwConfig, err := convertEndpoint(ep)
+	if err != nil {
+		return nil, err
+	}
+
+	clientHeaders := make(map[string]string, len(rwConfig.Headers)+len(cfg.Headers))
+	for k, v := range rwConfig.Headers {
+		clientHeaders[k] = v
+	}
+	for k, v := range cfg.Headers {
+		clientHeaders[k] = v
+	}
+
+	client, err := remote.NewWriteClient(name, &remote.ClientConfig{
+		URL:              rwConfig.URL,
+		Timeout:          rwConfig.RemoteTimeout,
+		HTTPClientConfig: rwConfig.HTTPClientConfig,
+		SigV4Config:      rwConfig.SigV4Config,
+		AzureADConfig:    rwConfig.AzureADConfig,
+		Headers:          clientHeaders,
+		RetryOnRateLimit: rwConfig.QueueConfig.RetryOnRateLimit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &diskQueueEndpoint{
+		log:     log.With(l, "subcomponent", "disk_queue", "endpoint", name),
+		name:    name,
+		opts:    *ep,
+		relabel: flow_relabel.ComponentToPromRelabelConfigs(ep.WriteRelabelConfigs),
+		queue:   q,
+		client:  client,
+		ctx:     ctx,
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// Start implements diskqueue.Sender.
+func (e *diskQueueEndpoint) Start() {
+	var ctx context.Context
+	ctx, e.cancel = context.WithCancel(e.ctx)
+	go e.run(ctx)
+}
+
+// Stop implements diskqueue.Sender. The queue is closed by the
+// diskqueue.Endpoints which owns it.
+func (e *diskQueueEndpoint) Stop() {
+	e.cancel()
+	<-e.done
+}
+
+func (e *diskQueueEndpoint) queueOptions() QueueOptions {
+	if e.opts.QueueOptions == nil {
+		return DefaultQueueOptions
+	}
+	return *e.opts.QueueOptions
+}
+
+// encode converts the data buffered by a into a snappy-compressed
+// remote_write request for the endpoint. encode returns nil if all data was
+// dropped by relabeling.
+func (e *diskQueueEndpoint) encode(externalLabels labels.Labels, a *diskQueueAppender) ([]byte, error) {
+	var (
+		req    prompb.WriteRequest
+		series = make(map[uint64]int) // Hash of input labels -> index in req.Timeseries, or -1 if dropped.
+	)
+
+	lookup := func(l labels.Labels) *prompb.TimeSeries {
+		hash := l.Hash()
+		if idx, ok := series[hash]; ok {
+			if idx < 0 {
+				return nil
+			}
+			return &req.Timeseries[idx]
+		}
+
+		ls, keep := relabel.Process(withExternalLabels(l, externalLabels), e.relabel...)
+		if !keep || ls.IsEmpty() {
+			series[hash] = -1
+			return nil
+		}
+
+		req.Timeseries = append(req.Timeseries, prompb.TimeSeries{Labels: toProtoLabels(ls)})
+		series[hash] = len(req.Timeseries) - 1
+		return &req.Timeseries[len(req.Timeseries)-1]
+	}
+
+	for _, s := range a.samples {
+		if ts := lookup(s.l); ts != nil {
+			ts.Samples = append(ts.Samples, prompb.Sample{Value: s.v, Timestamp: s.t})
+		}
+	}
+	if e.opts.SendNativeHistograms {
+		for _, h := range a.histograms {
+			ts := lookup(h.l)
+			switch {
+			case ts == nil:
+			case h.h != nil:
+				ts.Histograms = append(ts.Histograms, remote.HistogramToHistogramProto(h.t, h.h))
+			case h.fh != nil:
+				ts.Histograms = append(ts.Histograms, remote.FloatHistogramToHistogramProto(h.t, h.fh))
+			}
+		}
+	}
+	if e.opts.SendExemplars {
+		for _, ex := range a.exemplars {
+			if ts := lookup(ex.l); ts != nil {
+				ts.Exemplars = append(ts.Exemplars, prompb.Exemplar{
+					Labels:    toProtoLabels(ex.e.Labels),
+					Value:     ex.e.Value,
+					Timestamp: ex.e.Ts,
+				})
+			}
+		}
+	}
+
+	if len(req.Timeseries) == 0 {
+		return nil, nil
+	}
+
+	bb, err := proto.Marshal(&req)
+	if err != nil {
+		return nil, err
+	}
+	return snappy.Encode(nil, bb), nil
+}
+
+// withExternalLabels adds external labels to l for any label name not
+// already set.
+func withExternalLabels(l, externalLabels labels.Labels) labels.Labels {
+	if externalLabels.IsEmpty() {
+		return l
+	}
+	b := labels.NewBuilder(l)
+	externalLabels.Range(func(el labels.Label) {
+		if !l.Has(el.Name) {
+			b.Set(el.Name, el.Value)
+		}
+	})
+	return b.Labels()
+}
+
+func toProtoLabels(l labels.Labels) []prompb.Label {
+	res := make([]prompb.Label, 0, l.Len())
+	l.Range(func(l labels.Label) {
+		res = append(res, prompb.Label{Name: l.Name, Value: l.Value})
+	})
+	return res
+}
+
+// run sends queued entries until ctx is canceled. Entries are only removed
+// from the queue once they have been sent or failed with a non-recoverable
+// error.
+func (e *diskQueueEndpoint) run(ctx context.Context) {
+	defer close(e.done)
+
+	qo := e.queueOptions()
+	bo := backoff.New(ctx, backoff.Config{
+		MinBackoff: qo.MinBackoff,
+		MaxBackoff: qo.MaxBackoff,
+	})
+
+	var attempt int
+	for ctx.Err() == nil {
+		entries, err := e.queue.Peek(diskQueueReadBatch)
+		if err != nil {
+			level.Error(e.log).Log("msg", "failed to read from disk queue", "err", err)
+			bo.Wait()
+			continue
+		}
+		if len(entries) == 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-e.queue.Notify():
+			}
+			continue
+		}
+
+		req, last, samples, err := e.buildRequest(entries, qo.MaxSamplesPerSend)
+		if err != nil {
+			level.Error(e.log).Log("msg", "dropping corrupted disk queue entry", "err", err)
+			e.ack(last)
+			continue
+		}
+
+		err = e.client.Store(ctx, req, attempt)
+		var recoverable remote.RecoverableError
+		switch {
+		case err == nil:
+			e.sentSamples.Add(uint64(samples))
+			e.lastError.Store("")
+			e.ack(last)
+			bo.Reset()
+			attempt = 0
+		case ctx.Err() != nil:
+			return
+		case errors.As(err, &recoverable):
+			level.Warn(e.log).Log("msg", "failed to send batch, retrying", "err", err)
+			e.lastError.Store(err.Error())
+			attempt++
+			bo.Wait()
+		default:
+			level.Error(e.log).Log("msg", "non-recoverable error, dropping batch", "count", samples, "err", err)
+			e.lastError.Store(err.Error())
+			e.droppedSamples.Add(uint64(samples))
+			e.ack(last)
+			attempt = 0
+		}
+	}
+}
+
+func (e *diskQueueEndpoint) ack(last diskqueue.Entry) {
+	if err := e.queue.Ack(last); err != nil {
+		level.Error(e.log).Log("msg", "failed to update disk queue position", "err", err)
+	}
+}
+
+// buildRequest merges queued entries into a single snappy-compressed request
+// of roughly maxSamples samples. It returns the last entry included in the
+// request along with the number of samples. If the first entry can't be
+// decoded, buildRequest returns it along with an error.
+func (e *diskQueueEndpoint) buildRequest(entries []diskqueue.Entry, maxSamples int) ([]byte, diskqueue.Entry, int, error) {
+	var (
+		merged  prompb.WriteRequest
+		last    diskqueue.Entry
+		samples int
+	)
+
+	for i, entry := range entries {
+		var req prompb.WriteRequest
+		err := decodeDiskQueueEntry(entry.Data, &req)
+		if err != nil && i == 0 {
+			return nil, entry, 0, err
+		} else if err != nil {
+			// Send what has been merged so far; the corrupted entry is dropped
+			// on the next call.
+			break
+		}
+
+		merged.Timeseries = append(merged.Timeseries, req.Timeseries...)
+		for _, ts := range req.Timeseries {
+			samples += len(ts.Samples) + len(ts.Histograms)
+		}
+		last = entry
+
+		if maxSamples > 0 && samples >= maxSamples {
+			break
+		}
+	}
+
+	bb, err := proto.Marshal(&merged)
+	if err != nil {
+		return nil, last, samples, err
+	}
+	return snappy.Encode(nil, bb), last, samples, nil
+}
+
+func decodeDiskQueueEntry(data []byte, req *prompb.WriteRequest) error {
+	bb, err := snappy.Decode(nil, data)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(bb, req)
+}
+
+// diskQueueDebugInfo reports the state of a disk queue.
+type diskQueueDebugInfo struct {
+	Name            string        `river:"name,attr"`
+	URL             string        `river:"url,attr"`
+	Bytes           int64         `river:"bytes,attr"`
+	Entries         int           `river:"entries,attr"`
+	OldestEntryAge  time.Duration `river:"oldest_entry_age,attr,optional"`
+	SentSamples     uint64        `river:"sent_samples,attr"`
+	DroppedSamples  uint64        `river:"dropped_samples,attr"`
+	EvictedMaxSize  uint64        `river:"evicted_entries_max_size,attr"`
+	EvictedMaxAge   uint64        `river:"evicted_entries_max_age,attr"`
+	LastSendFailure string        `river:"last_send_failure,attr,optional"`
+}
+
+func (e *diskQueueEndpoint) debugInfo() diskQueueDebugInfo {
+	stats := e.queue.Stats()
+
+	var age time.Duration
+	if !stats.Oldest.IsZero() {
+		age = time.Since(stats.Oldest)
+	}
+
+	return diskQueueDebugInfo{
+		Name:            e.name,
+		URL:             e.opts.URL,
+		Bytes:           stats.Bytes,
+		Entries:         stats.Entries,
+		OldestEntryAge:  age,
+		SentSamples:     e.sentSamples.Load(),
+		DroppedSamples:  e.droppedSamples.Load(),
+		EvictedMaxSize:  stats.EvictedMaxBytes,
+		EvictedMaxAge:   stats.EvictedMaxAge,
+		LastSendFailure: e.lastError.Load(),
+	}
+}
+
+// diskQueueSamplesCollector exposes the number of samples sent and dropped by
+// all disk queues of a component. The state of the queues themselves is
+// exposed by a diskqueue.Collector.
+type diskQueueSamplesCollector struct {
+	s *diskQueueStorage
+
+	sentSamples    *prometheus.Desc
+	droppedSamples *prometheus.Desc
+}
+
+var _ prometheus.Collector = (*diskQueueSamplesCollector)(nil)
+
+func newDiskQueueSamplesCollector(s *diskQueueStorage) *diskQueueSamplesCollector {
+	return &diskQueueSamplesCollector{
+		s: s,
+		sentSamples: prometheus.NewDesc(
+			"prometheus_remote_write_disk_queue_sent_samples_total",
+			"Total number of samples and histograms sent from the disk queue.",
+			[]string{"endpoint"}, nil,
+		),
+		droppedSamples: prometheus.NewDesc(
+			"prometheus_remote_write_disk_queue_dropped_samples_total",
+			"Total number of samples and histograms dropped from the disk queue because of non-recoverable send errors.",
+			[]string{"endpoint"}, nil,
+		),
+	}
+}
+
+func (c *diskQueueSamplesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.sentSamples
+	ch <- c.droppedSamples
+}
+
+func (c *diskQueueSamplesCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, info := range c.s.debugInfo() {
+		ch <- prometheus.MustNewConstMetric(c.sentSamples, prometheus.CounterValue, float64(info.SentSamples), info.Name)
+		ch <- prometheus.MustNewConstMetric(c.droppedSamples, prometheus.CounterValue, float64(info.DroppedSamples), info.Name)
+	}
+}
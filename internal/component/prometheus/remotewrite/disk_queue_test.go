@@ -0,0 +1,59 @@
+package remotewrite
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/internal/component/common/diskqueue"
+	"github.com/grafana/agent/internal/util"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestDiskQueueStorage_PrepareError(t *testing.T) {
+	ignoreCurrent := goleak.IgnoreCurrent()
+
+	dataPath := t.TempDir()
+	// The queue of the second endpoint can't be created, since its directory
+	// is a file.
+	require.NoError(t, os.WriteFile(filepath.Join(dataPath, "second"), nil, 0o644))
+
+	newEndpoint := func(name string) *EndpointOptions {
+		var ep EndpointOptions
+		ep.SetToDefault()
+		ep.Name = name
+		ep.URL = "http://localhost:9009/api/v1/push"
+		ep.DiskQueue = &diskqueue.DefaultArguments
+		return &ep
+	}
+
+	var args Arguments
+	args.SetToDefault()
+	args.Endpoints = []*EndpointOptions{newEndpoint("first")}
+
+	s := newDiskQueueStorage(util.TestFlowLogger(t), dataPath)
+	u, err := s.prepare(args, nil)
+	require.NoError(t, err)
+	require.NoError(t, u.Commit())
+	running := s.debugInfo()
+
+	// Change the first endpoint and add the second one. Since the second one
+	// fails, the first one is left as it is.
+	changed := newEndpoint("first")
+	changed.RemoteTimeout = time.Minute
+	args.Endpoints = []*EndpointOptions{changed, newEndpoint("second")}
+	_, err = s.prepare(args, nil)
+	require.Error(t, err)
+
+	var opts []EndpointOptions
+	s.endpoints.Range(func(ep *diskqueue.Endpoint[diskQueueEndpointConfig, *diskQueueEndpoint]) {
+		opts = append(opts, ep.Sender.opts)
+	})
+	require.Equal(t, []EndpointOptions{*newEndpoint("first")}, opts)
+	require.Equal(t, running, s.debugInfo())
+
+	require.NoError(t, s.Close())
+	goleak.VerifyNone(t, ignoreCurrent)
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/go-kit/log"
 	"github.com/grafana/agent/internal/agentseed"
 	"github.com/grafana/agent/internal/component"
+	"github.com/grafana/agent/internal/component/common/diskqueue"
 	"github.com/grafana/agent/internal/component/prometheus"
 	"github.com/grafana/agent/internal/featuregate"
 	"github.com/grafana/agent/internal/flow/logging/level"
@@ -55,6 +56,7 @@ type Component struct {
 
 	walStore    *wal.Storage
 	remoteStore *remote.Storage
+	diskQueues  *diskQueueStorage
 	storage     storage.Storage
 	exited      atomic.Bool
 
@@ -84,6 +86,16 @@ func New(o component.Options, c Arguments) (*Component, error) {
 	remoteLogger := log.With(o.Logger, "subcomponent", "rw")
 	remoteStore := remote.NewStorage(remoteLogger, o.Registerer, startTime, o.DataPath, remoteFlushDeadline, nil)
 
+	// Endpoints with a disk_queue block are sent from their own queue rather
+	// than from the WAL.
+	diskQueues := newDiskQueueStorage(o.Logger, filepath.Join(o.DataPath, "queue"))
+	if err := o.Registerer.Register(diskqueue.NewCollector("prometheus_remote_write", "entry", "entries", diskQueues.endpoints.Stats)); err != nil {
+		return nil, err
+	}
+	if err := o.Registerer.Register(newDiskQueueSamplesCollector(diskQueues)); err != nil {
+		return nil, err
+	}
+
 	service, err := o.GetServiceData(labelstore.ServiceName)
 	if err != nil {
 		return nil, err
@@ -95,7 +107,8 @@ func New(o component.Options, c Arguments) (*Component, error) {
 		opts:        o,
 		walStore:    walStorage,
 		remoteStore: remoteStore,
-		storage:     storage.NewFanout(o.Logger, walStorage, remoteStore),
+		diskQueues:  diskQueues,
+		storage:     storage.NewFanout(o.Logger, walStorage, remoteStore, diskQueues),
 	}
 	res.receiver = prometheus.NewInterceptor(
 		res.storage,
@@ -169,7 +182,10 @@ func New(o component.Options, c Arguments) (*Component, error) {
 
 func startTime() (int64, error) { return 0, nil }
 
-var _ component.Component = (*Component)(nil)
+var (
+	_ component.Component      = (*Component)(nil)
+	_ component.DebugComponent = (*Component)(nil)
+)
 
 // Run implements Component.
 func (c *Component) Run(ctx context.Context) error {
@@ -240,6 +256,15 @@ func (c *Component) Run(ctx context.Context) error {
 	}
 }
 
+// DebugInfo implements component.DebugComponent.
+func (c *Component) DebugInfo() interface{} {
+	return debugInfo{DiskQueues: c.diskQueues.debugInfo()}
+}
+
+type debugInfo struct {
+	DiskQueues []diskQueueDebugInfo `river:"disk_queue,block,optional"`
+}
+
 func (c *Component) truncateFrequency() time.Duration {
 	c.mut.RLock()
 	defer c.mut.RUnlock()
@@ -253,7 +278,16 @@ func (c *Component) Update(newConfig component.Arguments) error {
 	c.mut.Lock()
 	defer c.mut.Unlock()
 
-	convertedConfig, err := convertConfigs(cfg)
+	// Endpoints with a disk_queue block aren't sent from the WAL.
+	walConfig := cfg
+	walConfig.Endpoints = nil
+	for _, ep := range cfg.Endpoints {
+		if ep.DiskQueue == nil {
+			walConfig.Endpoints = append(walConfig.Endpoints, ep)
+		}
+	}
+
+	convertedConfig, err := convertConfigs(walConfig)
 	if err != nil {
 		return err
 	}
@@ -264,10 +298,20 @@ func (c *Component) Update(newConfig component.Arguments) error {
 		}
 		cfg.Headers[agentseed.HeaderName] = uid
 	}
+	// Build the disk queue endpoints before applying the config to the WAL
+	// queues, so that neither side is changed if the other one fails.
+	diskQueues, err := c.diskQueues.prepare(cfg, map[string]string{agentseed.HeaderName: uid})
+	if err != nil {
+		return err
+	}
 	err = c.remoteStore.ApplyConfig(convertedConfig)
 	if err != nil {
+		diskQueues.Abort()
 		return err
 	}
+	if err := diskQueues.Commit(); err != nil {
+		level.Warn(c.log).Log("msg", "failed to close disk queues of removed endpoints", "err", err)
+	}
 
 	c.cfg = cfg
 	return nil
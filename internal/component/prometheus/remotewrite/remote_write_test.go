@@ -16,6 +16,7 @@ import (
 	"github.com/prometheus/prometheus/prompb"
 	"github.com/prometheus/prometheus/storage/remote"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
 )
 
 // Test is an integration-level test which ensures that metrics can get sent to
@@ -181,6 +182,90 @@ func TestUpdate(t *testing.T) {
 	}})
 }
 
+// TestDiskQueue ensures that endpoints with a disk_queue block retry failed
+// requests from the queue and deliver samples in order.
+func TestDiskQueue(t *testing.T) {
+	writeResult := make(chan *prompb.WriteRequest, 10)
+
+	// Create a remote_write server which fails the first two requests.
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Inc() <= 2 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		req, err := remote.DecodeWriteRequest(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeResult <- req
+	}))
+	defer srv.Close()
+
+	args := testArgsForConfig(t, fmt.Sprintf(`
+		external_labels = {
+			cluster = "local",
+		}
+		endpoint {
+			name           = "test-url"
+			url            = "%s/api/v1/write"
+			remote_timeout = "100ms"
+
+			queue_config {
+				min_backoff = "10ms"
+				max_backoff = "50ms"
+			}
+
+			disk_queue {
+				max_size = "10MiB"
+				max_age  = "1h"
+			}
+		}
+	`, srv.URL))
+	tc, err := componenttest.NewControllerFromID(util.TestLogger(t), "prometheus.remote_write")
+	require.NoError(t, err)
+	go func() {
+		err = tc.Run(componenttest.TestContext(t), args)
+		require.NoError(t, err)
+	}()
+	require.NoError(t, tc.WaitRunning(5*time.Second))
+
+	sampleTimestamp := time.Now().UnixMilli()
+	sendMetric(t, tc, labels.FromStrings("foo", "bar"), sampleTimestamp, 12)
+	sendMetric(t, tc, labels.FromStrings("fizz", "buzz", "cluster", "other"), sampleTimestamp, 34)
+
+	var received []prompb.TimeSeries
+	for len(received) < 2 {
+		select {
+		case <-time.After(time.Minute):
+			require.FailNow(t, "timed out waiting for metrics")
+		case res := <-writeResult:
+			received = append(received, res.Timeseries...)
+		}
+	}
+
+	require.Equal(t, []prompb.TimeSeries{{
+		Labels: []prompb.Label{
+			{Name: "cluster", Value: "local"},
+			{Name: "foo", Value: "bar"},
+		},
+		Samples: []prompb.Sample{
+			{Timestamp: sampleTimestamp, Value: 12},
+		},
+	}, {
+		Labels: []prompb.Label{
+			{Name: "cluster", Value: "other"},
+			{Name: "fizz", Value: "buzz"},
+		},
+		Samples: []prompb.Sample{
+			{Timestamp: sampleTimestamp, Value: 34},
+		},
+	}}, received)
+	require.GreaterOrEqual(t, requests.Load(), int32(3))
+}
+
 func assertReceived(t *testing.T, writeResult chan *prompb.WriteRequest, expect []prompb.TimeSeries) {
 	select {
 	case <-time.After(time.Minute):
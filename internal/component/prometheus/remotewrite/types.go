@@ -7,6 +7,7 @@ import (
 	"time"
 
 	types "github.com/grafana/agent/internal/component/common/config"
+	"github.com/grafana/agent/internal/component/common/diskqueue"
 	flow_relabel "github.com/grafana/agent/internal/component/common/relabel"
 	"github.com/grafana/river/rivertypes"
 
@@ -79,6 +80,7 @@ type EndpointOptions struct {
 	WriteRelabelConfigs  []*flow_relabel.Config  `river:"write_relabel_config,block,optional"`
 	SigV4                *SigV4Config            `river:"sigv4,block,optional"`
 	AzureAD              *AzureADConfig          `river:"azuread,block,optional"`
+	DiskQueue            *diskqueue.Arguments    `river:"disk_queue,block,optional"`
 }
 
 // SetToDefault implements river.Defaulter.
@@ -230,25 +232,11 @@ type Exports struct {
 func convertConfigs(cfg Arguments) (*config.Config, error) {
 	var rwConfigs []*config.RemoteWriteConfig
 	for _, rw := range cfg.Endpoints {
-		parsedURL, err := url.Parse(rw.URL)
+		rwConfig, err := convertEndpoint(rw)
 		if err != nil {
-			return nil, fmt.Errorf("cannot parse remote_write url %q: %w", rw.URL, err)
+			return nil, err
 		}
-		rwConfigs = append(rwConfigs, &config.RemoteWriteConfig{
-			URL:                  &common.URL{URL: parsedURL},
-			RemoteTimeout:        model.Duration(rw.RemoteTimeout),
-			Headers:              rw.Headers,
-			Name:                 rw.Name,
-			SendExemplars:        rw.SendExemplars,
-			SendNativeHistograms: rw.SendNativeHistograms,
-
-			WriteRelabelConfigs: flow_relabel.ComponentToPromRelabelConfigs(rw.WriteRelabelConfigs),
-			HTTPClientConfig:    *rw.HTTPClientConfig.Convert(),
-			QueueConfig:         rw.QueueOptions.toPrometheusType(),
-			MetadataConfig:      rw.MetadataOptions.toPrometheusType(),
-			SigV4Config:         rw.SigV4.toPrometheusType(),
-			AzureADConfig:       rw.AzureAD.toPrometheusType(),
-		})
+		rwConfigs = append(rwConfigs, rwConfig)
 	}
 
 	return &config.Config{
@@ -259,6 +247,28 @@ func convertConfigs(cfg Arguments) (*config.Config, error) {
 	}, nil
 }
 
+func convertEndpoint(rw *EndpointOptions) (*config.RemoteWriteConfig, error) {
+	parsedURL, err := url.Parse(rw.URL)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse remote_write url %q: %w", rw.URL, err)
+	}
+	return &config.RemoteWriteConfig{
+		URL:                  &common.URL{URL: parsedURL},
+		RemoteTimeout:        model.Duration(rw.RemoteTimeout),
+		Headers:              rw.Headers,
+		Name:                 rw.Name,
+		SendExemplars:        rw.SendExemplars,
+		SendNativeHistograms: rw.SendNativeHistograms,
+
+		WriteRelabelConfigs: flow_relabel.ComponentToPromRelabelConfigs(rw.WriteRelabelConfigs),
+		HTTPClientConfig:    *rw.HTTPClientConfig.Convert(),
+		QueueConfig:         rw.QueueOptions.toPrometheusType(),
+		MetadataConfig:      rw.MetadataOptions.toPrometheusType(),
+		SigV4Config:         rw.SigV4.toPrometheusType(),
+		AzureADConfig:       rw.AzureAD.toPrometheusType(),
+	}, nil
+}
+
 func toLabels(in map[string]string) labels.Labels {
 	res := make(labels.Labels, 0, len(in))
 	for k, v := range in {
@@ -2,6 +2,7 @@ package pyroscope
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"time"
 
@@ -14,7 +15,17 @@ const (
 	LabelNameDelta = "__delta__"
 )
 
-var NoopAppendable = AppendableFunc(func(_ context.Context, _ labels.Labels, _ []*RawSample) error { return nil })
+// NoopAppendable discards all profiles.
+var NoopAppendable = noopAppendable{}
+
+var (
+	// ErrIngestNotSupported is returned by AppendableFunc when it receives a
+	// profile sent to /ingest.
+	ErrIngestNotSupported = errors.New("appender doesn't support profiles received on /ingest")
+	// ErrAppendNotSupported is returned by AppendableIngestFunc when it
+	// receives a pushed or scraped profile.
+	ErrAppendNotSupported = errors.New("appender only supports profiles received on /ingest")
+)
 
 type Appendable interface {
 	Appender() Appender
@@ -22,6 +33,7 @@ type Appendable interface {
 
 type Appender interface {
 	Append(ctx context.Context, labels labels.Labels, samples []*RawSample) error
+	AppendIngest(ctx context.Context, profile *IncomingProfile) error
 }
 
 type RawSample struct {
@@ -112,6 +124,22 @@ func (a *appender) Append(ctx context.Context, labels labels.Labels, samples []*
 	return multiErr
 }
 
+// AppendIngest satisfies the Appender interface.
+func (a *appender) AppendIngest(ctx context.Context, profile *IncomingProfile) error {
+	now := time.Now()
+	defer func() {
+		a.writeLatency.Observe(time.Since(now).Seconds())
+	}()
+	var multiErr error
+	for _, x := range a.children {
+		err := x.AppendIngest(ctx, profile)
+		if err != nil {
+			multiErr = multierror.Append(multiErr, err)
+		}
+	}
+	return multiErr
+}
+
 type AppendableFunc func(ctx context.Context, labels labels.Labels, samples []*RawSample) error
 
 func (f AppendableFunc) Append(ctx context.Context, labels labels.Labels, samples []*RawSample) error {
@@ -121,3 +149,35 @@ func (f AppendableFunc) Append(ctx context.Context, labels labels.Labels, sample
 func (f AppendableFunc) Appender() Appender {
 	return f
 }
+
+// AppendIngest satisfies the Appender interface. AppendableFunc can't receive
+// profiles sent to /ingest; use AppendableIngestFunc instead.
+func (f AppendableFunc) AppendIngest(_ context.Context, _ *IncomingProfile) error {
+	return ErrIngestNotSupported
+}
+
+// AppendableIngestFunc is an Appendable which only receives profiles sent to
+// /ingest.
+type AppendableIngestFunc func(ctx context.Context, profile *IncomingProfile) error
+
+func (f AppendableIngestFunc) AppendIngest(ctx context.Context, profile *IncomingProfile) error {
+	return f(ctx, profile)
+}
+
+func (f AppendableIngestFunc) Appender() Appender {
+	return f
+}
+
+// Append satisfies the Appender interface. AppendableIngestFunc can't receive
+// pushed or scraped profiles; use AppendableFunc instead.
+func (f AppendableIngestFunc) Append(_ context.Context, _ labels.Labels, _ []*RawSample) error {
+	return ErrAppendNotSupported
+}
+
+type noopAppendable struct{}
+
+func (noopAppendable) Appender() Appender { return noopAppendable{} }
+
+func (noopAppendable) Append(_ context.Context, _ labels.Labels, _ []*RawSample) error { return nil }
+
+func (noopAppendable) AppendIngest(_ context.Context, _ *IncomingProfile) error { return nil }
@@ -0,0 +1,135 @@
+package pyroscope
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+// labelServiceName is the label identifying the application a profile was
+// collected from.
+const labelServiceName = "service_name"
+
+// IncomingProfile is a profile received on the /ingest endpoint of the
+// Pyroscope HTTP API. It's forwarded as it was received, so that formats and
+// parameters which a RawSample can't hold, such as JFR profiles or the
+// sampleRate parameter, are kept.
+type IncomingProfile struct {
+	// Body is the body of the request.
+	Body []byte
+	// ContentType is the Content-Type header of the request.
+	ContentType string
+	// URL is the URL of the request. Its query holds the parameters of the
+	// profile.
+	URL *url.URL
+	// Labels are the labels parsed from the name parameter of the request.
+	Labels labels.Labels
+}
+
+// ParseIngestName parses the name parameter of an /ingest request, which has
+// the format "app.profile_type{label=value,...}", into the labels of the
+// profile.
+func ParseIngestName(name string) (labels.Labels, error) {
+	if name == "" {
+		return nil, fmt.Errorf("missing name parameter")
+	}
+
+	appName, rawLabels, hasLabels := strings.Cut(name, "{")
+	if hasLabels {
+		if !strings.HasSuffix(rawLabels, "}") {
+			return nil, fmt.Errorf("invalid name %q: missing closing brace", name)
+		}
+		rawLabels = strings.TrimSuffix(rawLabels, "}")
+	}
+	if appName == "" {
+		return nil, fmt.Errorf("invalid name %q: missing application name", name)
+	}
+
+	lb := labels.NewBuilder(nil)
+	for _, pair := range strings.Split(rawLabels, ",") {
+		if pair == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid name %q: invalid label %q", name, pair)
+		}
+		lb.Set(strings.TrimSpace(k), strings.TrimSpace(v))
+	}
+
+	serviceName, suffix := splitIngestAppName(appName)
+	profileName := "process_cpu"
+	if suffix != "" {
+		profileName, _ = profileNameForSuffix(suffix)
+	}
+	lb.Set(labels.MetricName, profileName)
+	lb.Set(labelServiceName, serviceName)
+	return lb.Labels(), nil
+}
+
+// IngestName formats lbls as the name parameter of an /ingest request, in
+// the format parsed by ParseIngestName. The profile type suffix can't be
+// derived from the labels, so it's taken from the original name of the
+// request. Reserved labels are omitted.
+func IngestName(lbls labels.Labels, original string) string {
+	appName, _, _ := strings.Cut(original, "{")
+	if serviceName := lbls.Get(labelServiceName); serviceName != "" {
+		_, suffix := splitIngestAppName(appName)
+		appName = serviceName
+		if suffix != "" {
+			appName += "." + suffix
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(appName)
+	sb.WriteByte('{')
+	first := true
+	for _, l := range lbls {
+		if l.Name == labelServiceName || strings.HasPrefix(l.Name, model.ReservedLabelPrefix) {
+			continue
+		}
+		if !first {
+			sb.WriteByte(',')
+		}
+		first = false
+		sb.WriteString(l.Name)
+		sb.WriteByte('=')
+		sb.WriteString(l.Value)
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+// splitIngestAppName splits the application name of an /ingest request into
+// the service name and the profile type suffix, which is empty if the name
+// has no known suffix.
+func splitIngestAppName(appName string) (serviceName, suffix string) {
+	if i := strings.LastIndexByte(appName, '.'); i > 0 {
+		if _, ok := profileNameForSuffix(appName[i+1:]); ok {
+			return appName[:i], appName[i+1:]
+		}
+	}
+	return appName, ""
+}
+
+// profileNameForSuffix returns the profile name for the profile type suffix
+// of an application name sent to /ingest.
+func profileNameForSuffix(suffix string) (string, bool) {
+	switch suffix {
+	case "cpu", "itimer":
+		return "process_cpu", true
+	case "alloc_objects", "alloc_space", "inuse_objects", "inuse_space":
+		return "memory", true
+	case "goroutines":
+		return "goroutine", true
+	case "mutex_count", "mutex_duration":
+		return "mutex", true
+	case "block_count", "block_duration":
+		return "block", true
+	}
+	return "", false
+}
@@ -0,0 +1,74 @@
+package pyroscope
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIngestName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected labels.Labels
+		err      bool
+	}{
+		{name: "app", expected: labels.FromStrings("__name__", "process_cpu", "service_name", "app")},
+		{name: "my.app", expected: labels.FromStrings("__name__", "process_cpu", "service_name", "my.app")},
+		{name: "app.cpu", expected: labels.FromStrings("__name__", "process_cpu", "service_name", "app")},
+		{name: "app.alloc_space{env=prod,region=eu}", expected: labels.FromStrings("__name__", "memory", "env", "prod", "region", "eu", "service_name", "app")},
+		{name: "app.goroutines{}", expected: labels.FromStrings("__name__", "goroutine", "service_name", "app")},
+		{name: "app.mutex_count{a=b}", expected: labels.FromStrings("__name__", "mutex", "a", "b", "service_name", "app")},
+		{name: "", err: true},
+		{name: "{a=b}", err: true},
+		{name: "app{a=b", err: true},
+		{name: "app{a}", err: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := ParseIngestName(tc.name)
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestIngestName(t *testing.T) {
+	tests := []struct {
+		lbls     labels.Labels
+		original string
+		expected string
+	}{
+		{
+			lbls:     labels.FromStrings("__name__", "memory", "env", "prod", "service_name", "app"),
+			original: "app.alloc_space{env=dev}",
+			expected: "app.alloc_space{env=prod}",
+		},
+		{
+			// The service name was changed by relabeling.
+			lbls:     labels.FromStrings("__name__", "process_cpu", "service_name", "other"),
+			original: "app.cpu",
+			expected: "other.cpu{}",
+		},
+		{
+			lbls:     labels.FromStrings("__name__", "process_cpu", "service_name", "my.app", "__meta_x", "y"),
+			original: "my.app",
+			expected: "my.app{}",
+		},
+		{
+			// The service name was removed by relabeling.
+			lbls:     labels.FromStrings("env", "prod"),
+			original: "app.cpu{env=dev}",
+			expected: "app.cpu{env=prod}",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.expected, func(t *testing.T) {
+			require.Equal(t, tc.expected, IngestName(tc.lbls, tc.original))
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package receive_http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sync"
+
+	"connectrpc.com/connect"
+	"github.com/gorilla/mux"
+	"github.com/grafana/agent/internal/component"
+	fnet "github.com/grafana/agent/internal/component/common/net"
+	flow_relabel "github.com/grafana/agent/internal/component/common/relabel"
+	"github.com/grafana/agent/internal/component/pyroscope"
+	"github.com/grafana/agent/internal/featuregate"
+	"github.com/grafana/agent/internal/flow/logging/level"
+	"github.com/grafana/agent/internal/util"
+	pushv1 "github.com/grafana/pyroscope/api/gen/proto/go/push/v1"
+	"github.com/grafana/pyroscope/api/gen/proto/go/push/v1/pushv1connect"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+)
+
+// maxRequestSize is the maximum size of the body of a request to /ingest or
+// Push.
+const maxRequestSize = 64 << 20
+
+func init() {
+	component.Register(component.Registration{
+		Name:      "pyroscope.receive_http",
+		Stability: featuregate.StabilityBeta,
+		Args:      Arguments{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+// Arguments holds values which are used to configure the
+// pyroscope.receive_http component.
+type Arguments struct {
+	Server       *fnet.ServerConfig     `river:",squash"`
+	ForwardTo    []pyroscope.Appendable `river:"forward_to,attr"`
+	RelabelRules flow_relabel.Rules     `river:"relabel_rules,attr,optional"`
+}
+
+// SetToDefault implements river.Defaulter.
+func (args *Arguments) SetToDefault() {
+	*args = Arguments{
+		Server: fnet.DefaultServerConfig(),
+	}
+}
+
+// Component implements the pyroscope.receive_http component.
+type Component struct {
+	opts               component.Options
+	fanout             *pyroscope.Fanout
+	uncheckedCollector *util.UncheckedCollector
+
+	// relabelMut is separate from updateMut so that requests in flight while
+	// the server shuts down don't wait for Update.
+	relabelMut sync.RWMutex
+	relabel    []*relabel.Config
+
+	updateMut sync.RWMutex
+	args      Arguments
+	server    *fnet.TargetServer
+}
+
+var _ pushv1connect.PusherServiceHandler = (*Component)(nil)
+
+// New creates a new pyroscope.receive_http component.
+func New(opts component.Options, args Arguments) (*Component, error) {
+	uncheckedCollector := util.NewUncheckedCollector(nil)
+	opts.Registerer.MustRegister(uncheckedCollector)
+
+	c := &Component{
+		opts:               opts,
+		fanout:             pyroscope.NewFanout(args.ForwardTo, opts.ID, opts.Registerer),
+		uncheckedCollector: uncheckedCollector,
+	}
+
+	if err := c.Update(args); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Run satisfies the Component interface.
+func (c *Component) Run(ctx context.Context) error {
+	defer func() {
+		c.updateMut.Lock()
+		defer c.updateMut.Unlock()
+		c.shutdownServer()
+	}()
+
+	<-ctx.Done()
+	level.Info(c.opts.Logger).Log("msg", "terminating due to context done")
+	return nil
+}
+
+// Update satisfies the Component interface.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+	c.fanout.UpdateChildren(newArgs.ForwardTo)
+
+	var rcs []*relabel.Config
+	if len(newArgs.RelabelRules) > 0 {
+		rcs = flow_relabel.ComponentToPromRelabelConfigs(newArgs.RelabelRules)
+	}
+	c.relabelMut.Lock()
+	c.relabel = rcs
+	c.relabelMut.Unlock()
+
+	c.updateMut.Lock()
+	defer c.updateMut.Unlock()
+
+	serverNeedsUpdate := !reflect.DeepEqual(c.args.Server, newArgs.Server)
+	if !serverNeedsUpdate {
+		c.args = newArgs
+		return nil
+	}
+	c.shutdownServer()
+
+	s, err := c.createNewServer(newArgs)
+	if err != nil {
+		return err
+	}
+	c.server = s
+
+	err = c.server.MountAndRun(func(router *mux.Router) {
+		router.Path("/ingest").Methods(http.MethodPost).HandlerFunc(c.handleIngest)
+
+		path, handler := pushv1connect.NewPusherServiceHandler(c, connect.WithReadMaxBytes(maxRequestSize))
+		router.PathPrefix(path).Methods(http.MethodPost).Handler(handler)
+	})
+	if err != nil {
+		return err
+	}
+
+	c.args = newArgs
+	return nil
+}
+
+func (c *Component) createNewServer(args Arguments) (*fnet.TargetServer, error) {
+	// [server.Server] registers new metrics every time it is created. To
+	// avoid issues with re-registering metrics with the same name, we create a
+	// new registry for the server every time we create one, and pass it to an
+	// unchecked collector to bypass uniqueness checking.
+	serverRegistry := prometheus.NewRegistry()
+	c.uncheckedCollector.SetCollector(serverRegistry)
+
+	s, err := fnet.NewTargetServer(
+		c.opts.Logger,
+		"pyroscope_receive_http",
+		serverRegistry,
+		args.Server,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create server: %v", err)
+	}
+	return s, nil
+}
+
+// shutdownServer will shut down the currently used server.
+// It is not goroutine-safe and an updateMut write lock must be held when it's called.
+func (c *Component) shutdownServer() {
+	if c.server != nil {
+		c.server.StopAndShutdown()
+		c.server = nil
+	}
+}
+
+// Push implements pushv1connect.PusherServiceHandler, forwarding the
+// profiles of each series in the request to the receivers.
+func (c *Component) Push(ctx context.Context, req *connect.Request[pushv1.PushRequest]) (*connect.Response[pushv1.PushResponse], error) {
+	appender := c.fanout.Appender()
+	for _, series := range req.Msg.Series {
+		lb := labels.NewScratchBuilder(len(series.Labels))
+		for _, l := range series.Labels {
+			lb.Add(l.Name, l.Value)
+		}
+		lb.Sort()
+
+		samples := make([]*pyroscope.RawSample, 0, len(series.Samples))
+		for _, s := range series.Samples {
+			samples = append(samples, &pyroscope.RawSample{RawProfile: s.RawProfile})
+		}
+
+		if err := c.append(ctx, appender, lb.Labels(), samples); err != nil {
+			return nil, connect.NewError(connect.CodeInternal, err)
+		}
+	}
+	return connect.NewResponse(&pushv1.PushResponse{}), nil
+}
+
+// handleIngest handles requests to the /ingest endpoint of the Pyroscope
+// HTTP API, which is used by the Pyroscope SDKs. The request is forwarded as
+// it was received, so every profile format and query parameter is supported.
+// Only the labels in the name parameter are changed by relabeling.
+func (c *Component) handleIngest(w http.ResponseWriter, r *http.Request) {
+	lbls, err := pyroscope.ParseIngestName(r.URL.Query().Get("name"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lbls, keep := c.relabelLabels(lbls)
+	if !keep {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	profile := &pyroscope.IncomingProfile{
+		Body:        body,
+		ContentType: r.Header.Get("Content-Type"),
+		URL:         r.URL,
+		Labels:      lbls,
+	}
+	if err := c.fanout.Appender().AppendIngest(r.Context(), profile); err != nil {
+		level.Error(c.opts.Logger).Log("msg", "failed to forward profile", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// append relabels lbls and appends samples to appender, unless the series is
+// dropped by the relabeling rules.
+func (c *Component) append(ctx context.Context, appender pyroscope.Appender, lbls labels.Labels, samples []*pyroscope.RawSample) error {
+	lbls, keep := c.relabelLabels(lbls)
+	if !keep {
+		return nil
+	}
+	return appender.Append(ctx, lbls, samples)
+}
+
+// relabelLabels applies the relabeling rules to lbls. It returns false if the
+// profile is dropped.
+func (c *Component) relabelLabels(lbls labels.Labels) (labels.Labels, bool) {
+	c.relabelMut.RLock()
+	rcs := c.relabel
+	c.relabelMut.RUnlock()
+
+	if len(rcs) == 0 {
+		return lbls, true
+	}
+	lbls, keep := relabel.Process(lbls, rcs...)
+	return lbls, keep && !lbls.IsEmpty()
+}
@@ -0,0 +1,188 @@
+package receive_http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/grafana/agent/internal/component"
+	fnet "github.com/grafana/agent/internal/component/common/net"
+	flow_relabel "github.com/grafana/agent/internal/component/common/relabel"
+	"github.com/grafana/agent/internal/component/pyroscope"
+	"github.com/grafana/agent/internal/util"
+	pushv1 "github.com/grafana/pyroscope/api/gen/proto/go/push/v1"
+	"github.com/grafana/pyroscope/api/gen/proto/go/push/v1/pushv1connect"
+	typesv1 "github.com/grafana/pyroscope/api/gen/proto/go/types/v1"
+	"github.com/phayes/freeport"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/stretchr/testify/require"
+)
+
+type testProfile struct {
+	labels  labels.Labels
+	profile string
+}
+
+func TestPush(t *testing.T) {
+	profiles := make(chan testProfile, 10)
+	args := testArgs(t, profiles)
+	args.RelabelRules = flow_relabel.Rules{{
+		SourceLabels: []string{"env"},
+		Regex:        flow_relabel.Regexp(relabel.MustNewRegexp("dev")),
+		Action:       flow_relabel.Drop,
+	}}
+	runComponent(t, args)
+
+	client := pushv1connect.NewPusherServiceClient(http.DefaultClient, fmt.Sprintf("http://localhost:%d", args.Server.HTTP.ListenPort))
+	_, err := client.Push(context.Background(), connect.NewRequest(&pushv1.PushRequest{
+		Series: []*pushv1.RawProfileSeries{{
+			Labels: []*typesv1.LabelPair{
+				{Name: "service_name", Value: "app"},
+				{Name: "__name__", Value: "process_cpu"},
+			},
+			Samples: []*pushv1.RawSample{{RawProfile: []byte("profile 1")}},
+		}, {
+			Labels: []*typesv1.LabelPair{
+				{Name: "service_name", Value: "app"},
+				{Name: "env", Value: "dev"},
+			},
+			Samples: []*pushv1.RawSample{{RawProfile: []byte("dropped")}},
+		}},
+	}))
+	require.NoError(t, err)
+
+	require.Equal(t, testProfile{
+		labels:  labels.FromStrings("__name__", "process_cpu", "service_name", "app"),
+		profile: "profile 1",
+	}, receive(t, profiles))
+	require.Empty(t, profiles)
+}
+
+func TestPush_MaxRequestSize(t *testing.T) {
+	profiles := make(chan testProfile, 10)
+	args := testArgs(t, profiles)
+	runComponent(t, args)
+
+	client := pushv1connect.NewPusherServiceClient(http.DefaultClient, fmt.Sprintf("http://localhost:%d", args.Server.HTTP.ListenPort))
+	_, err := client.Push(context.Background(), connect.NewRequest(&pushv1.PushRequest{
+		Series: []*pushv1.RawProfileSeries{{
+			Labels:  []*typesv1.LabelPair{{Name: "service_name", Value: "app"}},
+			Samples: []*pushv1.RawSample{{RawProfile: make([]byte, maxRequestSize+1)}},
+		}},
+	}))
+	require.Equal(t, connect.CodeResourceExhausted, connect.CodeOf(err))
+	require.Empty(t, profiles)
+}
+
+func TestIngest(t *testing.T) {
+	ingested := make(chan *pyroscope.IncomingProfile, 10)
+	args := testArgs(t, nil)
+	args.ForwardTo = []pyroscope.Appendable{pyroscope.AppendableIngestFunc(func(_ context.Context, p *pyroscope.IncomingProfile) error {
+		ingested <- p
+		return nil
+	})}
+	args.RelabelRules = flow_relabel.Rules{{
+		SourceLabels: []string{"env"},
+		Regex:        flow_relabel.Regexp(relabel.MustNewRegexp("dev")),
+		Action:       flow_relabel.Drop,
+	}, {
+		Action:      flow_relabel.Replace,
+		Regex:       flow_relabel.Regexp(relabel.MustNewRegexp("(.*)")),
+		TargetLabel: "cluster",
+		Replacement: "eu-1",
+	}}
+	runComponent(t, args)
+	url := fmt.Sprintf("http://localhost:%d/ingest", args.Server.HTTP.ListenPort)
+
+	// Profiles are forwarded as they were received, whatever their format.
+	resp, err := http.Post(url+"?name=app.cpu{env=prod}&format=jfr&sampleRate=100&spyName=javaspy&from=1&until=2", "application/octet-stream", bytes.NewBufferString("jfr profile"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var p *pyroscope.IncomingProfile
+	select {
+	case p = <-ingested:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "failed waiting for profile")
+	}
+	require.Equal(t, "jfr profile", string(p.Body))
+	require.Equal(t, "application/octet-stream", p.ContentType)
+	require.Equal(t, labels.FromStrings("__name__", "process_cpu", "cluster", "eu-1", "env", "prod", "service_name", "app"), p.Labels)
+	query := p.URL.Query()
+	for param, value := range map[string]string{"format": "jfr", "sampleRate": "100", "spyName": "javaspy", "from": "1", "until": "2"} {
+		require.Equal(t, value, query.Get(param))
+	}
+
+	// Dropped profiles are accepted but not forwarded.
+	resp, err = http.Post(url+"?name=app{env=dev}", "application/octet-stream", bytes.NewBufferString("profile"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Invalid names are rejected.
+	resp, err = http.Post(url+"?name={env=prod}", "application/octet-stream", bytes.NewBufferString("profile"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Empty(t, ingested)
+}
+
+func testArgs(t *testing.T, profiles chan testProfile) Arguments {
+	port, err := freeport.GetFreePort()
+	require.NoError(t, err)
+	grpcPort, err := freeport.GetFreePort()
+	require.NoError(t, err)
+
+	return Arguments{
+		Server: &fnet.ServerConfig{
+			HTTP: &fnet.HTTPConfig{
+				ListenAddress: "localhost",
+				ListenPort:    port,
+			},
+			GRPC: &fnet.GRPCConfig{ListenAddress: "127.0.0.1", ListenPort: grpcPort},
+		},
+		ForwardTo: []pyroscope.Appendable{pyroscope.AppendableFunc(func(_ context.Context, lbls labels.Labels, samples []*pyroscope.RawSample) error {
+			for _, s := range samples {
+				profiles <- testProfile{labels: lbls, profile: string(s.RawProfile)}
+			}
+			return nil
+		})},
+	}
+}
+
+func runComponent(t *testing.T, args Arguments) {
+	comp, err := New(component.Options{
+		ID:         "pyroscope.receive_http.test",
+		Logger:     util.TestFlowLogger(t),
+		Registerer: prometheus.NewRegistry(),
+	}, args)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, comp.Run(ctx))
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func receive(t *testing.T, profiles chan testProfile) testProfile {
+	select {
+	case p := <-profiles:
+		return p
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "failed waiting for profile")
+		return testProfile{}
+	}
+}
@@ -0,0 +1,293 @@
+package relabel
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/grafana/agent/internal/component"
+	flow_relabel "github.com/grafana/agent/internal/component/common/relabel"
+	"github.com/grafana/agent/internal/component/pyroscope"
+	"github.com/grafana/agent/internal/featuregate"
+	"github.com/grafana/agent/internal/service/livedebugging"
+	lru "github.com/hashicorp/golang-lru/v2"
+	prometheus_client "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+	"go.uber.org/atomic"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:      "pyroscope.relabel",
+		Stability: featuregate.StabilityBeta,
+		Args:      Arguments{},
+		Exports:   Exports{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+// Arguments holds values which are used to configure the pyroscope.relabel
+// component.
+type Arguments struct {
+	// Where the relabelled profiles should be forwarded to.
+	ForwardTo []pyroscope.Appendable `river:"forward_to,attr"`
+
+	// The relabelling rules to apply to each profile before it's forwarded.
+	RelabelConfigs []*flow_relabel.Config `river:"rule,block,optional"`
+
+	// Cache size to use for LRU cache.
+	CacheSize int `river:"max_cache_size,attr,optional"`
+}
+
+// SetToDefault implements river.Defaulter.
+func (arg *Arguments) SetToDefault() {
+	*arg = Arguments{
+		CacheSize: 10_000,
+	}
+}
+
+// Validate implements river.Validator.
+func (arg *Arguments) Validate() error {
+	if arg.CacheSize <= 0 {
+		return fmt.Errorf("max_cache_size must be greater than 0 and is %d", arg.CacheSize)
+	}
+	return nil
+}
+
+// Exports holds values which are exported by the pyroscope.relabel component.
+type Exports struct {
+	Receiver pyroscope.Appendable `river:"receiver,attr"`
+	Rules    flow_relabel.Rules   `river:"rules,attr"`
+}
+
+// Component implements the pyroscope.relabel component.
+type Component struct {
+	mut               sync.RWMutex
+	opts              component.Options
+	rcs               []*relabel.Config
+	fanout            *pyroscope.Fanout
+	exited            atomic.Bool
+	profilesProcessed prometheus_client.Counter
+	profilesOutgoing  prometheus_client.Counter
+	cacheHits         prometheus_client.Counter
+	cacheMisses       prometheus_client.Counter
+	cacheSize         prometheus_client.Gauge
+
+	debugDataPublisher livedebugging.DebugDataPublisher
+
+	cacheMut sync.RWMutex
+	cache    *lru.Cache[uint64, []cacheEntry]
+}
+
+var (
+	_ component.Component  = (*Component)(nil)
+	_ pyroscope.Appendable = (*Component)(nil)
+)
+
+// New creates a new pyroscope.relabel component.
+func New(o component.Options, args Arguments) (*Component, error) {
+	cache, err := lru.New[uint64, []cacheEntry](args.CacheSize)
+	if err != nil {
+		return nil, err
+	}
+	c := &Component{
+		opts:   o,
+		cache:  cache,
+		fanout: pyroscope.NewFanout(args.ForwardTo, o.ID, o.Registerer),
+
+		debugDataPublisher: livedebugging.GetPublisher(o.GetServiceData),
+	}
+	c.profilesProcessed = prometheus_client.NewCounter(prometheus_client.CounterOpts{
+		Name: "pyroscope_relabel_profiles_processed",
+		Help: "Total number of profiles processed",
+	})
+	c.profilesOutgoing = prometheus_client.NewCounter(prometheus_client.CounterOpts{
+		Name: "pyroscope_relabel_profiles_written",
+		Help: "Total number of profiles written",
+	})
+	c.cacheMisses = prometheus_client.NewCounter(prometheus_client.CounterOpts{
+		Name: "pyroscope_relabel_cache_misses",
+		Help: "Total number of cache misses",
+	})
+	c.cacheHits = prometheus_client.NewCounter(prometheus_client.CounterOpts{
+		Name: "pyroscope_relabel_cache_hits",
+		Help: "Total number of cache hits",
+	})
+	c.cacheSize = prometheus_client.NewGauge(prometheus_client.GaugeOpts{
+		Name: "pyroscope_relabel_cache_size",
+		Help: "Total size of relabel cache",
+	})
+
+	for _, metric := range []prometheus_client.Collector{c.profilesProcessed, c.profilesOutgoing, c.cacheMisses, c.cacheHits, c.cacheSize} {
+		err = o.Registerer.Register(metric)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Call to Update() to set the relabelling rules once at the start.
+	if err = c.Update(args); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Run implements component.Component.
+func (c *Component) Run(ctx context.Context) error {
+	defer c.exited.Store(true)
+
+	<-ctx.Done()
+	return nil
+}
+
+// Update implements component.Component.
+func (c *Component) Update(args component.Arguments) error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	newArgs := args.(Arguments)
+	c.clearCache(newArgs.CacheSize)
+	c.rcs = flow_relabel.ComponentToPromRelabelConfigs(newArgs.RelabelConfigs)
+	c.fanout.UpdateChildren(newArgs.ForwardTo)
+
+	// The component is the receiver, so the exported receiver remains the
+	// same for the component lifetime.
+	c.opts.OnStateChange(Exports{Receiver: c, Rules: newArgs.RelabelConfigs})
+
+	return nil
+}
+
+// Appender implements pyroscope.Appendable.
+func (c *Component) Appender() pyroscope.Appender {
+	return &appender{
+		component: c,
+		next:      c.fanout.Appender(),
+	}
+}
+
+type appender struct {
+	component *Component
+	next      pyroscope.Appender
+}
+
+// Append relabels the labels of the profile and forwards it, unless it's
+// dropped by the relabeling rules.
+func (a *appender) Append(ctx context.Context, lbls labels.Labels, samples []*pyroscope.RawSample) error {
+	c := a.component
+	if c.exited.Load() {
+		return fmt.Errorf("%s has exited", c.opts.ID)
+	}
+
+	c.profilesProcessed.Inc()
+	newLbls := c.relabel(lbls)
+	c.publishDebugData(lbls, newLbls)
+	if newLbls.IsEmpty() {
+		return nil
+	}
+	c.profilesOutgoing.Inc()
+	return a.next.Append(ctx, newLbls, samples)
+}
+
+// AppendIngest relabels the labels of a profile received on /ingest and
+// forwards it, unless it's dropped by the relabeling rules.
+func (a *appender) AppendIngest(ctx context.Context, profile *pyroscope.IncomingProfile) error {
+	c := a.component
+	if c.exited.Load() {
+		return fmt.Errorf("%s has exited", c.opts.ID)
+	}
+
+	c.profilesProcessed.Inc()
+	newLbls := c.relabel(profile.Labels)
+	c.publishDebugData(profile.Labels, newLbls)
+	if newLbls.IsEmpty() {
+		return nil
+	}
+	c.profilesOutgoing.Inc()
+
+	relabelled := *profile
+	relabelled.Labels = newLbls
+	return a.next.AppendIngest(ctx, &relabelled)
+}
+
+// relabel returns the labels of a profile after relabeling. It returns empty
+// labels if the profile is dropped.
+func (c *Component) relabel(lbls labels.Labels) labels.Labels {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	hash := lbls.Hash()
+	if relabelled, found := c.getFromCache(hash, lbls); found {
+		c.cacheHits.Inc()
+		return relabelled
+	}
+
+	// Relabel against a copy of the labels to prevent modifying the original
+	// slice.
+	relabelled, keep := relabel.Process(lbls.Copy(), c.rcs...)
+	if !keep {
+		relabelled = labels.EmptyLabels()
+	}
+	c.cacheMisses.Inc()
+	c.addToCache(hash, lbls, relabelled)
+	return relabelled
+}
+
+// publishDebugData publishes the labels of a profile before and after
+// relabeling.
+func (c *Component) publishDebugData(before, after labels.Labels) {
+	if !c.debugDataPublisher.IsActive(c.opts.ID) {
+		return
+	}
+	result := "dropped"
+	if !after.IsEmpty() {
+		result = after.String()
+	}
+	c.debugDataPublisher.Publish(c.opts.ID, before.String()+" => "+result)
+}
+
+func (c *Component) getFromCache(hash uint64, lbls labels.Labels) (labels.Labels, bool) {
+	c.cacheMut.RLock()
+	defer c.cacheMut.RUnlock()
+
+	entries, found := c.cache.Get(hash)
+	if !found {
+		return labels.EmptyLabels(), false
+	}
+	for _, entry := range entries {
+		if labels.Equal(entry.original, lbls) {
+			return entry.relabelled, true
+		}
+	}
+	return labels.EmptyLabels(), false
+}
+
+func (c *Component) clearCache(cacheSize int) {
+	c.cacheMut.Lock()
+	defer c.cacheMut.Unlock()
+	cache, _ := lru.New[uint64, []cacheEntry](cacheSize)
+	c.cache = cache
+	c.cacheSize.Set(0)
+}
+
+func (c *Component) addToCache(hash uint64, original, relabelled labels.Labels) {
+	c.cacheMut.Lock()
+	defer c.cacheMut.Unlock()
+
+	entries, _ := c.cache.Get(hash)
+	entries = append(entries, cacheEntry{original: original.Copy(), relabelled: relabelled})
+	c.cache.Add(hash, entries)
+	c.cacheSize.Set(float64(c.cache.Len()))
+}
+
+// cacheEntry stores the labels of a profile before and after relabeling.
+// Entries are stored by the hash of the original labels, and the original
+// labels are kept to tell apart label sets with the same hash.
+type cacheEntry struct {
+	original   labels.Labels
+	relabelled labels.Labels
+}
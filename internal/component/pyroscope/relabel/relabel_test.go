@@ -0,0 +1,216 @@
+package relabel
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/internal/component"
+	flow_relabel "github.com/grafana/agent/internal/component/common/relabel"
+	"github.com/grafana/agent/internal/component/pyroscope"
+	"github.com/grafana/agent/internal/flow/componenttest"
+	"github.com/grafana/agent/internal/service/livedebugging"
+	"github.com/grafana/agent/internal/util"
+	"github.com/grafana/river"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelabel(t *testing.T) {
+	var received []labels.Labels
+	relabeller := generateRelabel(t, pyroscope.AppendableFunc(func(_ context.Context, lbls labels.Labels, _ []*pyroscope.RawSample) error {
+		received = append(received, lbls)
+		return nil
+	}))
+
+	app := relabeller.Appender()
+	samples := []*pyroscope.RawSample{{RawProfile: []byte("profile")}}
+	require.NoError(t, app.Append(context.Background(), labels.FromStrings("service_name", "app"), samples))
+	require.NoError(t, app.Append(context.Background(), labels.FromStrings("service_name", "noisy"), samples))
+	require.NoError(t, app.Append(context.Background(), labels.FromStrings("service_name", "app"), samples))
+
+	require.Equal(t, []labels.Labels{
+		labels.FromStrings("service_name", "app", "env", "prod"),
+		labels.FromStrings("service_name", "app", "env", "prod"),
+	}, received)
+	require.Equal(t, 2, relabeller.cache.Len())
+}
+
+func TestRelabelIngest(t *testing.T) {
+	var received []*pyroscope.IncomingProfile
+	relabeller := generateRelabel(t, pyroscope.AppendableIngestFunc(func(_ context.Context, p *pyroscope.IncomingProfile) error {
+		received = append(received, p)
+		return nil
+	}))
+
+	app := relabeller.Appender()
+	profile := &pyroscope.IncomingProfile{Body: []byte("profile"), Labels: labels.FromStrings("service_name", "app")}
+	require.NoError(t, app.AppendIngest(context.Background(), profile))
+	require.NoError(t, app.AppendIngest(context.Background(), &pyroscope.IncomingProfile{Labels: labels.FromStrings("service_name", "noisy")}))
+
+	require.Len(t, received, 1)
+	require.Equal(t, labels.FromStrings("service_name", "app", "env", "prod"), received[0].Labels)
+	require.Equal(t, profile.Body, received[0].Body)
+	// The original profile isn't modified.
+	require.Equal(t, labels.FromStrings("service_name", "app"), profile.Labels)
+}
+
+func TestUpdateReset(t *testing.T) {
+	relabeller := generateRelabel(t, pyroscope.NoopAppendable)
+	relabeller.relabel(labels.FromStrings("service_name", "app"))
+	require.Equal(t, 1, relabeller.cache.Len())
+	_ = relabeller.Update(Arguments{
+		CacheSize:      10_000,
+		RelabelConfigs: []*flow_relabel.Config{},
+	})
+	require.Equal(t, 0, relabeller.cache.Len())
+}
+
+func TestValidator(t *testing.T) {
+	args := Arguments{CacheSize: 0}
+	err := args.Validate()
+	require.Error(t, err)
+
+	args.CacheSize = 1
+	err = args.Validate()
+	require.NoError(t, err)
+}
+
+func TestLRU(t *testing.T) {
+	relabeller := generateRelabel(t, pyroscope.NoopAppendable)
+
+	for i := 0; i < 20_000; i++ {
+		relabeller.relabel(labels.FromStrings("service_name", "app", "inc", strconv.Itoa(i)))
+	}
+	require.Equal(t, 10_000, relabeller.cache.Len())
+}
+
+func TestExited(t *testing.T) {
+	relabeller := generateRelabel(t, pyroscope.NoopAppendable)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.NoError(t, relabeller.Run(ctx))
+
+	err := relabeller.Appender().Append(context.Background(), labels.FromStrings("service_name", "app"), nil)
+	require.ErrorContains(t, err, "has exited")
+}
+
+func generateRelabel(t *testing.T, forwardTo pyroscope.Appendable) *Component {
+	relabeller, err := New(component.Options{
+		ID:            "1",
+		Logger:        util.TestFlowLogger(t),
+		OnStateChange: func(e component.Exports) {},
+		Registerer:    prom.NewRegistry(),
+	}, Arguments{
+		ForwardTo: []pyroscope.Appendable{forwardTo},
+		RelabelConfigs: []*flow_relabel.Config{
+			{
+				SourceLabels: []string{"service_name"},
+				Regex:        flow_relabel.Regexp(relabel.MustNewRegexp("noisy")),
+				Action:       "drop",
+			},
+			{
+				TargetLabel: "env",
+				Replacement: "prod",
+				Action:      "replace",
+				Regex:       flow_relabel.Regexp(relabel.MustNewRegexp("(.*)")),
+			},
+		},
+		CacheSize: 10_000,
+	})
+	require.NotNil(t, relabeller)
+	require.NoError(t, err)
+	return relabeller
+}
+
+func TestRuleGetter(t *testing.T) {
+	// Set up the component Arguments.
+	originalCfg := `rule {
+		action        = "keep"
+		source_labels = ["service_name"]
+		regex         = "app"
+	}
+	forward_to = []`
+	var args Arguments
+	require.NoError(t, river.Unmarshal([]byte(originalCfg), &args))
+
+	// Set up and start the component.
+	tc, err := componenttest.NewControllerFromID(nil, "pyroscope.relabel")
+	require.NoError(t, err)
+	go func() {
+		err = tc.Run(componenttest.TestContext(t), args)
+		require.NoError(t, err)
+	}()
+	require.NoError(t, tc.WaitExports(time.Second))
+
+	// Use the getter to retrieve the original relabeling rules.
+	exports := tc.Exports().(Exports)
+	gotOriginal := exports.Rules
+	receiver := exports.Receiver
+
+	// Update the component with new relabeling rules and retrieve them.
+	updatedCfg := `rule {
+		action        = "drop"
+		source_labels = ["service_name"]
+		regex         = "app"
+	}
+	forward_to = []`
+	require.NoError(t, river.Unmarshal([]byte(updatedCfg), &args))
+
+	require.NoError(t, tc.Update(args))
+	exports = tc.Exports().(Exports)
+	gotUpdated := exports.Rules
+
+	require.Len(t, gotOriginal, 1)
+	require.Len(t, gotUpdated, 1)
+	require.Equal(t, flow_relabel.Keep, gotOriginal[0].Action)
+	require.Equal(t, flow_relabel.Drop, gotUpdated[0].Action)
+	require.Equal(t, receiver, exports.Receiver)
+}
+
+func TestLiveDebugging(t *testing.T) {
+	liveDebugging := livedebugging.New()
+
+	relabeller, err := New(component.Options{
+		ID:            "pyroscope.relabel.test",
+		Logger:        util.TestFlowLogger(t),
+		OnStateChange: func(e component.Exports) {},
+		Registerer:    prom.NewRegistry(),
+		GetServiceData: func(name string) (interface{}, error) {
+			if name == livedebugging.ServiceName {
+				return liveDebugging.Data(), nil
+			}
+			return nil, fmt.Errorf("no service named %s", name)
+		},
+	}, Arguments{
+		ForwardTo: []pyroscope.Appendable{pyroscope.NoopAppendable},
+		RelabelConfigs: []*flow_relabel.Config{
+			{
+				SourceLabels: []string{"service_name"},
+				Regex:        flow_relabel.Regexp(relabel.MustNewRegexp("noisy")),
+				Action:       "drop",
+			},
+		},
+		CacheSize: 100,
+	})
+	require.NoError(t, err)
+
+	var published []string
+	remove := liveDebugging.AddCallback("pyroscope.relabel.test", func(data string) {
+		published = append(published, data)
+	})
+	defer remove()
+
+	app := relabeller.Appender()
+	require.NoError(t, app.Append(context.Background(), labels.FromStrings("service_name", "app"), nil))
+	require.NoError(t, app.Append(context.Background(), labels.FromStrings("service_name", "noisy"), nil))
+
+	require.Equal(t, []string{
+		`{service_name="app"} => {service_name="app"}`,
+		`{service_name="noisy"} => dropped`,
+	}, published)
+}
@@ -34,27 +34,32 @@ type DeltaProfiler interface {
 	Delta(p []byte, out io.Writer) error
 }
 
-func NewDeltaAppender(appender pyroscope.Appender, labels labels.Labels) pyroscope.Appender {
+// NewDeltaAppender returns an appender which computes the delta of profiles
+// which are cumulative. Compressed profiles which decompress to more than
+// bodySizeLimit bytes are rejected; 0 means no limit.
+func NewDeltaAppender(appender pyroscope.Appender, labels labels.Labels, bodySizeLimit int64) pyroscope.Appender {
 	types, ok := deltaProfiles[labels.Get(model.MetricNameLabel)]
 	if !ok {
 		// for profiles that we don't need to produce delta, just return the appender
 		return appender
 	}
 
-	return newDeltaAppender(appender, types)
+	return newDeltaAppender(appender, types, bodySizeLimit)
 }
 
-func newDeltaAppender(appender pyroscope.Appender, types []fastdelta.ValueType) *deltaAppender {
+func newDeltaAppender(appender pyroscope.Appender, types []fastdelta.ValueType, bodySizeLimit int64) *deltaAppender {
 	delta := &deltaAppender{
-		appender: appender,
-		delta:    fastdelta.NewDeltaComputer(types...),
+		appender:      appender,
+		delta:         fastdelta.NewDeltaComputer(types...),
+		bodySizeLimit: bodySizeLimit,
 	}
 	return delta
 }
 
 type deltaAppender struct {
-	appender pyroscope.Appender
-	delta    DeltaProfiler
+	appender      pyroscope.Appender
+	delta         DeltaProfiler
+	bodySizeLimit int64
 
 	// true if we have seen at least one sample
 	initialized bool
@@ -94,7 +99,10 @@ func (d *gzipBuffer) reset() io.Writer {
 	return d.gzw
 }
 
-func (d *gzipBuffer) uncompress(in []byte) ([]byte, error) {
+// uncompress decompresses in if it is gzip compressed. Profiles which
+// decompress to more than limit bytes fail with a limitError; 0 means no
+// limit.
+func (d *gzipBuffer) uncompress(in []byte, limit int64) ([]byte, error) {
 	if !isGzipData(in) {
 		return in, nil
 	}
@@ -103,11 +111,29 @@ func (d *gzipBuffer) uncompress(in []byte) ([]byte, error) {
 		return nil, err
 	}
 	d.uncompressed.Reset()
-	d.uncompressed.Grow(uncompressedSize(in))
-	_, err := d.uncompressed.ReadFrom(&d.gzr)
+
+	// The size recorded in the gzip trailer isn't trusted beyond the limit.
+	size := int64(uncompressedSize(in))
+	if limit > 0 && size > limit {
+		size = limit
+	}
+	if size > 0 {
+		d.uncompressed.Grow(int(size))
+	}
+
+	// Read up to one byte past the limit to detect profiles which are too
+	// large without decompressing them entirely.
+	r := io.Reader(&d.gzr)
+	if limit > 0 {
+		r = io.LimitReader(r, limit+1)
+	}
+	n, err := d.uncompressed.ReadFrom(r)
 	if err != nil {
 		return nil, fmt.Errorf("decompressing profile: %v", err)
 	}
+	if limit > 0 && n > limit {
+		return nil, &limitError{reasonBodySizeLimit, fmt.Sprintf("decompressed profile is larger than the limit of %d bytes", limit)}
+	}
 	return d.uncompressed.Bytes(), nil
 }
 
@@ -132,6 +158,12 @@ func (d *deltaAppender) Append(ctx context.Context, lbs labels.Labels, samples [
 	return nil
 }
 
+// AppendIngest forwards profiles received on /ingest unchanged. Deltas are
+// only computed for scraped profiles.
+func (d *deltaAppender) AppendIngest(ctx context.Context, profile *pyroscope.IncomingProfile) error {
+	return d.appender.AppendIngest(ctx, profile)
+}
+
 // computeDelta computes the delta between the given profile and the last
 // data is uncompressed if it is gzip compressed.
 // The returned data is always gzip compressed.
@@ -139,7 +171,7 @@ func (d *deltaAppender) computeDelta(data []byte) (b []byte, err error) {
 	gzipBuf := getGzipBuffer()
 	defer putGzipBuffer(gzipBuf)
 
-	data, err = gzipBuf.uncompress(data)
+	data, err = gzipBuf.uncompress(data, d.bodySizeLimit)
 	if err != nil {
 		return nil, err
 	}
@@ -28,7 +28,7 @@ func TestDeltaProfilerAppender(t *testing.T) {
 			// We expect all samples to have the delta label set to false so that the server won't do the delta again.
 			require.Equal(t, "false", lbs.Get(pyroscope.LabelNameDelta))
 			return nil
-		}), lbs)
+		}), lbs, 0)
 
 	// first sample (not compressed) should be dropped
 	first := newMemoryProfile(0, (15 * time.Second).Nanoseconds())
@@ -58,7 +58,7 @@ func TestDeltaProfilerAppenderNoop(t *testing.T) {
 		pyroscope.AppendableFunc(func(ctx context.Context, lbs labels.Labels, samples []*pyroscope.RawSample) error {
 			actual = append(actual, samples...)
 			return nil
-		}), nil)
+		}), nil, 0)
 	in := newMemoryProfile(0, 0)
 	err := appender.Append(context.Background(), nil, []*pyroscope.RawSample{{RawProfile: marshal(t, in)}})
 	require.NoError(t, err)
@@ -66,6 +66,23 @@ func TestDeltaProfilerAppenderNoop(t *testing.T) {
 	require.Equal(t, in, unmarshal(t, actual[0].RawProfile))
 }
 
+func TestDeltaProfilerAppenderBodySizeLimit(t *testing.T) {
+	lbs := labels.Labels{
+		{Name: model.MetricNameLabel, Value: pprofMemory},
+	}
+	profile := marshal(t, newMemoryProfile(0, (15*time.Second).Nanoseconds()))
+
+	appender := NewDeltaAppender(pyroscope.NoopAppendable, lbs, int64(len(profile)-1))
+	err := appender.Append(context.Background(), lbs, []*pyroscope.RawSample{{RawProfile: compress(t, profile)}})
+	var limitErr *limitError
+	require.ErrorAs(t, err, &limitErr)
+	require.Equal(t, reasonBodySizeLimit, limitErr.reason)
+
+	appender = NewDeltaAppender(pyroscope.NoopAppendable, lbs, int64(len(profile)))
+	err = appender.Append(context.Background(), lbs, []*pyroscope.RawSample{{RawProfile: compress(t, profile)}})
+	require.NoError(t, err)
+}
+
 func marshal(t testing.TB, profile *googlev1.Profile) []byte {
 	t.Helper()
 	data, err := profile.MarshalVT()
@@ -176,7 +193,7 @@ var out []byte
 
 func BenchmarkComputeDelta(b *testing.B) {
 	data := compress(b, marshal(b, newMemoryProfile(1, 1)))
-	app := newDeltaAppender(nil, nil)
+	app := newDeltaAppender(nil, nil, 0)
 	b.ResetTimer()
 	b.ReportAllocs()
 
@@ -8,6 +8,7 @@ import (
 	"github.com/go-kit/log"
 	"github.com/grafana/agent/internal/component/pyroscope"
 	"github.com/grafana/agent/internal/flow/logging/level"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/prometheus/discovery/targetgroup"
 )
 
@@ -18,6 +19,7 @@ type Manager struct {
 
 	graceShut  chan struct{}
 	appendable pyroscope.Appendable
+	metrics    *scrapeMetrics
 
 	mtxScrape     sync.Mutex // Guards the fields below.
 	config        Arguments
@@ -27,13 +29,14 @@ type Manager struct {
 	triggerReload chan struct{}
 }
 
-func NewManager(appendable pyroscope.Appendable, logger log.Logger) *Manager {
+func NewManager(appendable pyroscope.Appendable, reg prometheus.Registerer, logger log.Logger) *Manager {
 	if logger == nil {
 		logger = log.NewNopLogger()
 	}
 	return &Manager{
 		logger:        logger,
 		appendable:    appendable,
+		metrics:       newScrapeMetrics(reg),
 		graceShut:     make(chan struct{}),
 		triggerReload: make(chan struct{}, 1),
 		targetsGroups: make(map[string]*scrapePool),
@@ -88,7 +91,7 @@ func (m *Manager) reload() {
 	var wg sync.WaitGroup
 	for setName, groups := range m.targetSets {
 		if _, ok := m.targetsGroups[setName]; !ok {
-			sp, err := newScrapePool(m.config, m.appendable, log.With(m.logger, "scrape_pool", setName))
+			sp, err := newScrapePool(m.config, m.appendable, m.metrics, log.With(m.logger, "scrape_pool", setName))
 			if err != nil {
 				level.Error(m.logger).Log("msg", "error creating new scrape pool", "err", err, "scrape_pool", setName)
 				continue
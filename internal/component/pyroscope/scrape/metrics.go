@@ -0,0 +1,33 @@
+package scrape
+
+import (
+	"github.com/grafana/agent/internal/util"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reasons a scrape fails because it exceeded one of the limits of the
+// component.
+const (
+	reasonBodySizeLimit         = "body_size_limit"
+	reasonTargetLimit           = "target_limit"
+	reasonLabelLimit            = "label_limit"
+	reasonLabelNameLengthLimit  = "label_name_length_limit"
+	reasonLabelValueLengthLimit = "label_value_length_limit"
+)
+
+type scrapeMetrics struct {
+	limitExceeded *prometheus.CounterVec
+}
+
+func newScrapeMetrics(reg prometheus.Registerer) *scrapeMetrics {
+	m := &scrapeMetrics{
+		limitExceeded: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pyroscope_scrape_limit_exceeded_total",
+			Help: "Total number of scrapes which failed because they exceeded a limit, by the limit exceeded.",
+		}, []string{"reason"}),
+	}
+	if reg != nil {
+		m.limitExceeded = util.MustRegisterOrGet(reg, m.limitExceeded).(*prometheus.CounterVec)
+	}
+	return m
+}
@@ -7,6 +7,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/alecthomas/units"
 	"github.com/grafana/agent/internal/component/pyroscope"
 	"github.com/grafana/agent/internal/featuregate"
 	"github.com/grafana/agent/internal/flow/logging/level"
@@ -61,22 +62,20 @@ type Arguments struct {
 	// The URL scheme with which to fetch metrics from targets.
 	Scheme string `river:"scheme,attr,optional"`
 
-	// todo(ctovena): add support for limits.
-	// // An uncompressed response body larger than this many bytes will cause the
-	// // scrape to fail. 0 means no limit.
-	// BodySizeLimit units.Base2Bytes `river:"body_size_limit,attr,optional"`
-	// // More than this many targets after the target relabeling will cause the
-	// // scrapes to fail.
-	// TargetLimit uint `river:"target_limit,attr,optional"`
-	// // More than this many labels post metric-relabeling will cause the scrape
-	// // to fail.
-	// LabelLimit uint `river:"label_limit,attr,optional"`
-	// // More than this label name length post metric-relabeling will cause the
-	// // scrape to fail.
-	// LabelNameLengthLimit uint `river:"label_name_length_limit,attr,optional"`
-	// // More than this label value length post metric-relabeling will cause the
-	// // scrape to fail.
-	// LabelValueLengthLimit uint `river:"label_value_length_limit,attr,optional"`
+	// An uncompressed response body larger than this many bytes will cause the
+	// scrape to fail. 0 means no limit.
+	BodySizeLimit units.Base2Bytes `river:"body_size_limit,attr,optional"`
+	// More than this many targets after the target relabeling will cause the
+	// scrapes to fail.
+	TargetLimit uint `river:"target_limit,attr,optional"`
+	// More than this many labels on a profile will cause the scrape to fail.
+	LabelLimit uint `river:"label_limit,attr,optional"`
+	// More than this label name length on a profile will cause the scrape to
+	// fail.
+	LabelNameLengthLimit uint `river:"label_name_length_limit,attr,optional"`
+	// More than this label value length on a profile will cause the scrape to
+	// fail.
+	LabelValueLengthLimit uint `river:"label_value_length_limit,attr,optional"`
 
 	HTTPClientConfig component_config.HTTPClientConfig `river:",squash"`
 
@@ -210,6 +209,9 @@ func (arg *Arguments) Validate() error {
 	if arg.ScrapeTimeout.Seconds() <= 0 {
 		return fmt.Errorf("scrape_timeout must be greater than 0")
 	}
+	if arg.BodySizeLimit < 0 {
+		return fmt.Errorf("body_size_limit must not be negative")
+	}
 
 	// ScrapeInterval must be at least 2 seconds, because if
 	// ProfilingTarget.Delta is true the ScrapeInterval - 1s is propagated in
@@ -248,7 +250,7 @@ func New(o component.Options, args Arguments) (*Component, error) {
 	clusterData := data.(cluster.Cluster)
 
 	flowAppendable := pyroscope.NewFanout(args.ForwardTo, o.ID, o.Registerer)
-	scraper := NewManager(flowAppendable, o.Logger)
+	scraper := NewManager(flowAppendable, o.Registerer, o.Logger)
 	c := &Component{
 		opts:          o,
 		cluster:       clusterData,
@@ -3,10 +3,12 @@ package scrape
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"reflect"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,7 +17,9 @@ import (
 	"github.com/grafana/agent/internal/flow/logging/level"
 	"github.com/grafana/agent/internal/useragent"
 	commonconfig "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/discovery/targetgroup"
+	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/util/pool"
 	"golang.org/x/net/context/ctxhttp"
 )
@@ -31,13 +35,14 @@ type scrapePool struct {
 	logger       log.Logger
 	scrapeClient *http.Client
 	appendable   pyroscope.Appendable
+	metrics      *scrapeMetrics
 
 	mtx            sync.RWMutex
 	activeTargets  map[uint64]*scrapeLoop
 	droppedTargets []*Target
 }
 
-func newScrapePool(cfg Arguments, appendable pyroscope.Appendable, logger log.Logger) (*scrapePool, error) {
+func newScrapePool(cfg Arguments, appendable pyroscope.Appendable, metrics *scrapeMetrics, logger log.Logger) (*scrapePool, error) {
 	scrapeClient, err := commonconfig.NewClientFromConfig(*cfg.HTTPClientConfig.Convert(), cfg.JobName)
 	if err != nil {
 		return nil, err
@@ -48,6 +53,7 @@ func newScrapePool(cfg Arguments, appendable pyroscope.Appendable, logger log.Lo
 		logger:        logger,
 		scrapeClient:  scrapeClient,
 		appendable:    appendable,
+		metrics:       metrics,
 		activeTargets: map[uint64]*scrapeLoop{},
 	}, nil
 }
@@ -73,13 +79,16 @@ func (tg *scrapePool) sync(groups []*targetgroup.Group) {
 		tg.droppedTargets = append(tg.droppedTargets, dropped...)
 	}
 
+	forcedErr := tg.checkTargetLimit(actives)
 	for _, t := range actives {
 		if _, ok := tg.activeTargets[t.Hash()]; !ok {
-			loop := newScrapeLoop(t, tg.scrapeClient, tg.appendable, tg.config.ScrapeInterval, tg.config.ScrapeTimeout, tg.logger)
+			loop := tg.newLoop(t)
+			loop.setForcedError(forcedErr)
 			tg.activeTargets[t.Hash()] = loop
 			loop.start()
 		} else {
 			tg.activeTargets[t.Hash()].SetDiscoveredLabels(t.DiscoveredLabels())
+			tg.activeTargets[t.Hash()].setForcedError(forcedErr)
 		}
 	}
 
@@ -102,6 +111,7 @@ func (tg *scrapePool) reload(cfg Arguments) error {
 
 	if tg.config.ScrapeInterval == cfg.ScrapeInterval &&
 		tg.config.ScrapeTimeout == cfg.ScrapeTimeout &&
+		limitsFromArguments(tg.config) == limitsFromArguments(cfg) &&
 		reflect.DeepEqual(tg.config.HTTPClientConfig, cfg.HTTPClientConfig) {
 
 		tg.config = cfg
@@ -117,13 +127,39 @@ func (tg *scrapePool) reload(cfg Arguments) error {
 	for hash, t := range tg.activeTargets {
 		// restart the loop with the new configuration
 		t.stop(false)
-		loop := newScrapeLoop(t.Target, tg.scrapeClient, tg.appendable, tg.config.ScrapeInterval, tg.config.ScrapeTimeout, tg.logger)
+		loop := tg.newLoop(t.Target)
+		loop.setForcedError(t.getForcedError())
 		tg.activeTargets[hash] = loop
 		loop.start()
 	}
 	return nil
 }
 
+// newLoop creates a scrape loop for t using the current configuration. It's
+// not goroutine-safe and mtx must be held when it's called.
+func (tg *scrapePool) newLoop(t *Target) *scrapeLoop {
+	return newScrapeLoop(t, tg.scrapeClient, tg.appendable, tg.config.ScrapeInterval, tg.config.ScrapeTimeout, limitsFromArguments(tg.config), tg.metrics, tg.logger)
+}
+
+// checkTargetLimit returns the error the scrapes of all targets fail with if
+// there are more targets than the target limit. Each target is counted once,
+// regardless of the number of profiles scraped from it.
+func (tg *scrapePool) checkTargetLimit(actives []*Target) error {
+	if tg.config.TargetLimit == 0 {
+		return nil
+	}
+	targets := make(map[uint64]struct{}, len(actives))
+	for _, t := range actives {
+		targets[t.Labels().Hash()] = struct{}{}
+	}
+	if len(targets) <= int(tg.config.TargetLimit) {
+		return nil
+	}
+	tg.metrics.limitExceeded.WithLabelValues(reasonTargetLimit).Inc()
+	level.Warn(tg.logger).Log("msg", "target_limit exceeded, all targets of the scrape pool are failing", "targets", len(targets), "limit", tg.config.TargetLimit)
+	return fmt.Errorf("target_limit exceeded (number of targets: %d, limit: %d)", len(targets), tg.config.TargetLimit)
+}
+
 func (tg *scrapePool) stop() {
 	tg.mtx.Lock()
 	defer tg.mtx.Unlock()
@@ -157,6 +193,57 @@ func (tg *scrapePool) DroppedTargets() []*Target {
 	return result
 }
 
+// scrapeLimits holds the limits enforced on each scrape of a target.
+type scrapeLimits struct {
+	bodySizeLimit         int64
+	labelLimit            uint
+	labelNameLengthLimit  uint
+	labelValueLengthLimit uint
+}
+
+func limitsFromArguments(args Arguments) scrapeLimits {
+	return scrapeLimits{
+		bodySizeLimit:         int64(args.BodySizeLimit),
+		labelLimit:            args.LabelLimit,
+		labelNameLengthLimit:  args.LabelNameLengthLimit,
+		labelValueLengthLimit: args.LabelValueLengthLimit,
+	}
+}
+
+// limitError is returned when a scrape exceeds one of its limits.
+type limitError struct {
+	reason string
+	msg    string
+}
+
+func (e *limitError) Error() string {
+	return fmt.Sprintf("%s exceeded: %s", e.reason, e.msg)
+}
+
+// verifyLabels checks lset against the label limits. Only the labels sent
+// with profiles are checked, which excludes internal labels starting with
+// "__" apart from the profile name.
+func (l scrapeLimits) verifyLabels(lset labels.Labels) error {
+	var count uint
+	for _, lbl := range lset {
+		if strings.HasPrefix(lbl.Name, model.ReservedLabelPrefix) && lbl.Name != ProfileName {
+			continue
+		}
+		count++
+
+		if l.labelNameLengthLimit > 0 && uint(len(lbl.Name)) > l.labelNameLengthLimit {
+			return &limitError{reasonLabelNameLengthLimit, fmt.Sprintf("label name %q is %d characters long, limit: %d", lbl.Name, len(lbl.Name), l.labelNameLengthLimit)}
+		}
+		if l.labelValueLengthLimit > 0 && uint(len(lbl.Value)) > l.labelValueLengthLimit {
+			return &limitError{reasonLabelValueLengthLimit, fmt.Sprintf("value of label %q is %d characters long, limit: %d", lbl.Name, len(lbl.Value), l.labelValueLengthLimit)}
+		}
+	}
+	if l.labelLimit > 0 && count > l.labelLimit {
+		return &limitError{reasonLabelLimit, fmt.Sprintf("profile has %d labels, limit: %d", count, l.labelLimit)}
+	}
+	return nil
+}
+
 type scrapeLoop struct {
 	*Target
 
@@ -164,6 +251,13 @@ type scrapeLoop struct {
 
 	scrapeClient *http.Client
 	appender     pyroscope.Appender
+	limits       scrapeLimits
+	metrics      *scrapeMetrics
+
+	// forcedErr is set when the scrapes of the target must fail regardless
+	// of the profile, such as when the target limit is exceeded.
+	forcedErrMtx sync.Mutex
+	forcedErr    error
 
 	req               *http.Request
 	logger            log.Logger
@@ -173,7 +267,7 @@ type scrapeLoop struct {
 	wg                sync.WaitGroup
 }
 
-func newScrapeLoop(t *Target, scrapeClient *http.Client, appendable pyroscope.Appendable, interval, timeout time.Duration, logger log.Logger) *scrapeLoop {
+func newScrapeLoop(t *Target, scrapeClient *http.Client, appendable pyroscope.Appendable, interval, timeout time.Duration, limits scrapeLimits, metrics *scrapeMetrics, logger log.Logger) *scrapeLoop {
 	// if the URL parameter have a seconds parameter, then the collection will
 	// take at least scrape_duration - 1 second, as the HTTP request will block
 	// until the profile is collected.
@@ -185,7 +279,9 @@ func newScrapeLoop(t *Target, scrapeClient *http.Client, appendable pyroscope.Ap
 		Target:       t,
 		logger:       logger,
 		scrapeClient: scrapeClient,
-		appender:     NewDeltaAppender(appendable.Appender(), t.allLabels),
+		appender:     NewDeltaAppender(appendable.Appender(), t.allLabels, limits.bodySizeLimit),
+		limits:       limits,
+		metrics:      metrics,
 		interval:     interval,
 		timeout:      timeout,
 	}
@@ -234,7 +330,22 @@ func (t *scrapeLoop) scrape() {
 			break
 		}
 	}
+	if err := t.getForcedError(); err != nil {
+		t.updateTargetStatus(start, err)
+		return
+	}
+	// The labels of a target don't change between scrapes, so they're
+	// checked before the profile is fetched.
+	if err := t.limits.verifyLabels(t.allLabels); err != nil {
+		t.limitExceeded(start, err)
+		return
+	}
 	if err := t.fetchProfile(scrapeCtx, profileType, buf); err != nil {
+		var limitErr *limitError
+		if errors.As(err, &limitErr) {
+			t.limitExceeded(start, err)
+			return
+		}
 		level.Error(t.logger).Log("msg", "fetch profile failed", "target", t.Labels().String(), "err", err)
 		t.updateTargetStatus(start, err)
 		return
@@ -245,6 +356,11 @@ func (t *scrapeLoop) scrape() {
 		t.lastScrapeSize = len(b)
 	}
 	if err := t.appender.Append(context.Background(), t.allLabels, []*pyroscope.RawSample{{RawProfile: b}}); err != nil {
+		var limitErr *limitError
+		if errors.As(err, &limitErr) {
+			t.limitExceeded(start, err)
+			return
+		}
 		level.Error(t.logger).Log("msg", "push failed", "labels", t.Labels().String(), "err", err)
 		t.updateTargetStatus(start, err)
 		return
@@ -252,6 +368,29 @@ func (t *scrapeLoop) scrape() {
 	t.updateTargetStatus(start, nil)
 }
 
+// limitExceeded reports a scrape which failed because it exceeded one of
+// the limits.
+func (t *scrapeLoop) limitExceeded(start time.Time, err error) {
+	var limitErr *limitError
+	if errors.As(err, &limitErr) {
+		t.metrics.limitExceeded.WithLabelValues(limitErr.reason).Inc()
+	}
+	level.Warn(t.logger).Log("msg", "scrape exceeded a limit", "target", t.Labels().String(), "err", err)
+	t.updateTargetStatus(start, err)
+}
+
+func (t *scrapeLoop) setForcedError(err error) {
+	t.forcedErrMtx.Lock()
+	defer t.forcedErrMtx.Unlock()
+	t.forcedErr = err
+}
+
+func (t *scrapeLoop) getForcedError() error {
+	t.forcedErrMtx.Lock()
+	defer t.forcedErrMtx.Unlock()
+	return t.forcedErr
+}
+
 func (t *scrapeLoop) updateTargetStatus(start time.Time, err error) {
 	t.mtx.Lock()
 	defer t.mtx.Unlock()
@@ -266,7 +405,7 @@ func (t *scrapeLoop) updateTargetStatus(start time.Time, err error) {
 	t.lastScrapeDuration = time.Since(start)
 }
 
-func (t *scrapeLoop) fetchProfile(ctx context.Context, profileType string, buf io.Writer) error {
+func (t *scrapeLoop) fetchProfile(ctx context.Context, profileType string, buf *bytes.Buffer) error {
 	if t.req == nil {
 		req, err := http.NewRequest("GET", t.URL(), nil)
 		if err != nil {
@@ -284,19 +423,34 @@ func (t *scrapeLoop) fetchProfile(ctx context.Context, profileType string, buf i
 	}
 	defer resp.Body.Close()
 
-	b, err := io.ReadAll(io.TeeReader(resp.Body, buf))
+	limit := t.limits.bodySizeLimit
+	if limit > 0 && resp.StatusCode/100 == 2 && resp.ContentLength > limit {
+		return &limitError{reasonBodySizeLimit, fmt.Sprintf("response body is %d bytes, limit: %d", resp.ContentLength, limit)}
+	}
+
+	// The body is read up to one byte past the limit, so that profiles which
+	// are too large fail as soon as the limit is reached instead of being
+	// read entirely first.
+	body := io.Reader(resp.Body)
+	if limit > 0 {
+		body = io.LimitReader(resp.Body, limit+1)
+	}
+	n, err := io.Copy(buf, body)
 	if err != nil {
 		return fmt.Errorf("failed to read body: %w", err)
 	}
 
 	if resp.StatusCode/100 != 2 {
-		if len(b) > 0 {
+		if b := buf.Bytes(); len(b) > 0 {
 			return fmt.Errorf("server returned HTTP status (%d) %v", resp.StatusCode, string(bytes.TrimSpace(b)))
 		}
 		return fmt.Errorf("server returned HTTP status (%d) %v", resp.StatusCode, resp.Status)
 	}
 
-	if len(b) == 0 {
+	if limit > 0 && n > limit {
+		return &limitError{reasonBodySizeLimit, fmt.Sprintf("response body is larger than the limit of %d bytes", limit)}
+	}
+	if n == 0 {
 		return fmt.Errorf("empty %s profile from %s", profileType, t.req.URL.String())
 	}
 	return nil
@@ -14,6 +14,8 @@ import (
 	"github.com/grafana/agent/internal/component/discovery"
 	"github.com/grafana/agent/internal/component/pyroscope"
 	"github.com/grafana/agent/internal/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/discovery/targetgroup"
 	"github.com/prometheus/prometheus/model/labels"
@@ -37,7 +39,7 @@ func TestScrapePool(t *testing.T) {
 		func(ctx context.Context, labels labels.Labels, samples []*pyroscope.RawSample) error {
 			return nil
 		}),
-		util.TestLogger(t))
+		newScrapeMetrics(nil), util.TestLogger(t))
 	require.NoError(t, err)
 
 	defer p.stop()
@@ -191,7 +193,7 @@ func TestScrapeLoop(t *testing.T) {
 			require.Equal(t, []byte("ok"), samples[0].RawProfile)
 			return nil
 		}),
-		200*time.Millisecond, 30*time.Second, util.TestLogger(t))
+		200*time.Millisecond, 30*time.Second, scrapeLimits{}, newScrapeMetrics(nil), util.TestLogger(t))
 	defer loop.stop(true)
 
 	require.Equal(t, HealthUnknown, loop.Health())
@@ -209,6 +211,116 @@ func TestScrapeLoop(t *testing.T) {
 	require.NotEmpty(t, loop.LastScrapeDuration())
 }
 
+func TestScrapeLoopLimits(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreTopFunction("go.opencensus.io/stats/view.(*worker).start"))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/streamed" {
+			// Flushing before the body is complete omits the Content-Length
+			// header, so the limit is only detected while reading the body.
+			w.Write([]byte("profile "))
+			w.(http.Flusher).Flush()
+		}
+		w.Write([]byte("content"))
+	}))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		name   string
+		path   string
+		labels []string
+		limits scrapeLimits
+		reason string
+	}{
+		{name: "within limits", path: "/", limits: scrapeLimits{bodySizeLimit: 7, labelLimit: 2, labelNameLengthLimit: 12, labelValueLengthLimit: 11}},
+		{name: "body size limit", path: "/", limits: scrapeLimits{bodySizeLimit: 6}, reason: reasonBodySizeLimit},
+		{name: "streamed body size limit", path: "/streamed", limits: scrapeLimits{bodySizeLimit: 10}, reason: reasonBodySizeLimit},
+		{name: "label limit", path: "/", labels: []string{"foo", "bar"}, limits: scrapeLimits{labelLimit: 2}, reason: reasonLabelLimit},
+		{name: "label name length limit", path: "/", labels: []string{"long_label_name", "bar"}, limits: scrapeLimits{labelNameLengthLimit: 12}, reason: reasonLabelNameLengthLimit},
+		{name: "label value length limit", path: "/", labels: []string{"foo", "a_very_long_value"}, limits: scrapeLimits{labelValueLengthLimit: 11}, reason: reasonLabelValueLengthLimit},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			appendTotal := atomic.NewInt64(0)
+			metrics := newScrapeMetrics(prometheus.NewRegistry())
+			loop := newScrapeLoop(
+				NewTarget(
+					labels.FromStrings(append([]string{
+						model.SchemeLabel, "http",
+						model.AddressLabel, strings.TrimPrefix(server.URL, "http://"),
+						ProfilePath, tc.path,
+						ProfileName, pprofProcessCPU,
+						serviceNameLabel, "s",
+					}, tc.labels...)...), labels.FromStrings(), url.Values{}),
+				server.Client(),
+				pyroscope.AppendableFunc(func(_ context.Context, labels labels.Labels, samples []*pyroscope.RawSample) error {
+					appendTotal.Inc()
+					return nil
+				}),
+				time.Second, time.Second, tc.limits, metrics, util.TestLogger(t))
+
+			loop.scrape()
+			if tc.reason == "" {
+				require.Equal(t, HealthGood, loop.Health())
+				require.Equal(t, int64(1), appendTotal.Load())
+				return
+			}
+			require.Equal(t, HealthBad, loop.Health())
+			require.ErrorContains(t, loop.LastError(), tc.reason+" exceeded")
+			require.Equal(t, int64(0), appendTotal.Load())
+			require.Equal(t, 1.0, testutil.ToFloat64(metrics.limitExceeded.WithLabelValues(tc.reason)))
+		})
+	}
+}
+
+func TestScrapePoolTargetLimit(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreTopFunction("go.opencensus.io/stats/view.(*worker).start"))
+
+	args := NewDefaultArguments()
+	args.TargetLimit = 1
+	metrics := newScrapeMetrics(prometheus.NewRegistry())
+	p, err := newScrapePool(args, pyroscope.NoopAppendable, metrics, util.TestLogger(t))
+	require.NoError(t, err)
+	defer p.stop()
+
+	forcedErrors := func() (errs []error) {
+		p.mtx.RLock()
+		defer p.mtx.RUnlock()
+		for _, loop := range p.activeTargets {
+			errs = append(errs, loop.getForcedError())
+		}
+		return errs
+	}
+
+	// Each target counts once, regardless of the number of profiles scraped
+	// from it.
+	p.sync([]*targetgroup.Group{{
+		Targets: []model.LabelSet{{model.AddressLabel: "localhost:9090", serviceNameLabel: "s"}},
+	}})
+	require.Len(t, forcedErrors(), 5)
+	for _, err := range forcedErrors() {
+		require.NoError(t, err)
+	}
+
+	p.sync([]*targetgroup.Group{{
+		Targets: []model.LabelSet{
+			{model.AddressLabel: "localhost:9090", serviceNameLabel: "s"},
+			{model.AddressLabel: "localhost:9091", serviceNameLabel: "s"},
+		},
+	}})
+	require.Len(t, forcedErrors(), 10)
+	for _, err := range forcedErrors() {
+		require.EqualError(t, err, "target_limit exceeded (number of targets: 2, limit: 1)")
+	}
+	require.Equal(t, 1.0, testutil.ToFloat64(metrics.limitExceeded.WithLabelValues(reasonTargetLimit)))
+
+	p.sync([]*targetgroup.Group{{
+		Targets: []model.LabelSet{{model.AddressLabel: "localhost:9091", serviceNameLabel: "s"}},
+	}})
+	for _, err := range forcedErrors() {
+		require.NoError(t, err)
+	}
+}
+
 func BenchmarkSync(b *testing.B) {
 	args := NewDefaultArguments()
 	args.Targets = []discovery.Target{}
@@ -217,7 +329,7 @@ func BenchmarkSync(b *testing.B) {
 		func(ctx context.Context, labels labels.Labels, samples []*pyroscope.RawSample) error {
 			return nil
 		}),
-		log.NewNopLogger())
+		newScrapeMetrics(nil), log.NewNopLogger())
 	require.NoError(b, err)
 	groups1 := []*targetgroup.Group{
 		{
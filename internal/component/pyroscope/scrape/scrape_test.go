@@ -9,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/alecthomas/units"
 	"github.com/grafana/agent/internal/component"
 	"github.com/grafana/agent/internal/component/discovery"
 	"github.com/grafana/agent/internal/component/prometheus/scrape"
@@ -142,6 +143,27 @@ func TestUnmarshalConfig(t *testing.T) {
 				return r
 			},
 		},
+		"limits": {
+			in: `
+			targets    = []
+			forward_to = null
+			body_size_limit          = "100MiB"
+			target_limit             = 10
+			label_limit              = 20
+			label_name_length_limit  = 30
+			label_value_length_limit = 40
+			`,
+			expected: func() Arguments {
+				r := NewDefaultArguments()
+				r.Targets = make([]discovery.Target, 0)
+				r.BodySizeLimit = 100 * units.MiB
+				r.TargetLimit = 10
+				r.LabelLimit = 20
+				r.LabelNameLengthLimit = 30
+				r.LabelValueLengthLimit = 40
+				return r
+			},
+		},
 		"invalid cpu scrape_interval": {
 			in: `
 			targets    = []
@@ -0,0 +1,367 @@
+package write
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/internal/component/common/diskqueue"
+	"github.com/grafana/agent/internal/component/pyroscope"
+	"github.com/grafana/agent/internal/flow/logging/level"
+	"github.com/grafana/dskit/backoff"
+	pushv1 "github.com/grafana/pyroscope/api/gen/proto/go/push/v1"
+	"github.com/grafana/pyroscope/api/gen/proto/go/push/v1/pushv1connect"
+	commonconfig "github.com/prometheus/common/config"
+	"go.uber.org/atomic"
+	"google.golang.org/protobuf/proto"
+)
+
+// diskQueueStorage owns the disk queues of all endpoints which have a
+// disk_queue block. Each endpoint has its own queue and sender.
+type diskQueueStorage struct {
+	cancel    context.CancelFunc
+	endpoints *diskqueue.Endpoints[EndpointOptions, *diskQueueEndpoint]
+}
+
+func newDiskQueueStorage(l log.Logger, dataPath string, metrics *metrics) *diskQueueStorage {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &diskQueueStorage{
+		cancel: cancel,
+		endpoints: diskqueue.NewEndpoints(dataPath, func(name string, ep EndpointOptions, q *diskqueue.Queue) (*diskQueueEndpoint, error) {
+			return newDiskQueueEndpoint(ctx, l, name, ep, q, metrics)
+		}),
+	}
+}
+
+// prepare builds the disk queue endpoints for the endpoints in args which
+// have a disk_queue block, without touching the running ones. The returned
+// update must be committed or aborted. Queued profiles of removed endpoints
+// are kept on disk and resumed if the endpoint is added back.
+func (s *diskQueueStorage) prepare(args Arguments) (*diskqueue.Update[EndpointOptions, *diskQueueEndpoint], error) {
+	var configs []diskqueue.EndpointConfig[EndpointOptions]
+	for _, ep := range args.Endpoints {
+		if ep.DiskQueue == nil {
+			continue
+		}
+		configs = append(configs, diskqueue.EndpointConfig[EndpointOptions]{
+			Name:    diskqueue.Name(ep.Name, ep.URL),
+			Options: ep.DiskQueue.Options(),
+			Config:  *ep,
+		})
+	}
+	return s.endpoints.Prepare(configs)
+}
+
+// Close stops all senders and closes the queues.
+func (s *diskQueueStorage) Close() error {
+	s.cancel()
+	return s.endpoints.Close()
+}
+
+// Entries in the disk queue start with their kind.
+const (
+	entryPush   byte = iota // A marshaled PushRequest.
+	entryIngest             // A profile received on /ingest, see encodeIngest.
+)
+
+// enqueue appends req to the queue of every endpoint.
+func (s *diskQueueStorage) enqueue(req *pushv1.PushRequest) error {
+	if s.endpoints.Len() == 0 {
+		return nil
+	}
+
+	data, err := proto.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("encoding profiles for disk queue: %w", err)
+	}
+	return s.append(append([]byte{entryPush}, data...))
+}
+
+// enqueueIngest appends a profile received on /ingest to the queue of every
+// endpoint, to be sent with the given query parameters.
+func (s *diskQueueStorage) enqueueIngest(query url.Values, profile *pyroscope.IncomingProfile) error {
+	if s.endpoints.Len() == 0 {
+		return nil
+	}
+	return s.append(encodeIngest(query, profile))
+}
+
+func (s *diskQueueStorage) append(data []byte) error {
+	var errs []error
+	s.endpoints.Range(func(ep *diskqueue.Endpoint[EndpointOptions, *diskQueueEndpoint]) {
+		if err := ep.Queue.Append(data); err != nil {
+			errs = append(errs, fmt.Errorf("queueing profiles for endpoint %q: %w", ep.Name, err))
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// encodeIngest encodes a profile received on /ingest as the length-prefixed
+// query and content type, followed by the body.
+func encodeIngest(query url.Values, profile *pyroscope.IncomingProfile) []byte {
+	rawQuery := query.Encode()
+	buf := make([]byte, 0, 1+2*binary.MaxVarintLen64+len(rawQuery)+len(profile.ContentType)+len(profile.Body))
+	buf = append(buf, entryIngest)
+	buf = binary.AppendUvarint(buf, uint64(len(rawQuery)))
+	buf = append(buf, rawQuery...)
+	buf = binary.AppendUvarint(buf, uint64(len(profile.ContentType)))
+	buf = append(buf, profile.ContentType...)
+	return append(buf, profile.Body...)
+}
+
+// decodeIngest decodes an entry encoded by encodeIngest, without its kind.
+func decodeIngest(data []byte) (url.Values, *pyroscope.IncomingProfile, error) {
+	readString := func() (string, error) {
+		n, size := binary.Uvarint(data)
+		if size <= 0 || n > uint64(len(data)-size) {
+			return "", errors.New("invalid length")
+		}
+		str := string(data[size : size+int(n)])
+		data = data[size+int(n):]
+		return str, nil
+	}
+
+	rawQuery, err := readString()
+	if err != nil {
+		return nil, nil, err
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, nil, err
+	}
+	contentType, err := readString()
+	if err != nil {
+		return nil, nil, err
+	}
+	return query, &pyroscope.IncomingProfile{Body: data, ContentType: contentType}, nil
+}
+
+// debugInfo returns the debug info of every disk queue, ordered by name.
+func (s *diskQueueStorage) debugInfo() []diskQueueDebugInfo {
+	var res []diskQueueDebugInfo
+	s.endpoints.Range(func(ep *diskqueue.Endpoint[EndpointOptions, *diskQueueEndpoint]) {
+		res = append(res, ep.Sender.debugInfo())
+	})
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+// diskQueueEndpoint sends the entries of the disk queue of a single endpoint
+// in order.
+type diskQueueEndpoint struct {
+	log     log.Logger
+	name    string
+	opts    EndpointOptions
+	queue   *diskqueue.Queue
+	client  pushv1connect.PusherServiceClient
+	http    *http.Client
+	metrics *metrics
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	lastError atomic.String
+}
+
+func newDiskQueueEndpoint(ctx context.Context, l log.Logger, name string, ep EndpointOptions, q *diskqueue.Queue, metrics *metrics) (*diskQueueEndpoint, error) {
+	httpClient, err := commonconfig.NewClientFromConfig(*ep.HTTPClientConfig.Convert(), ep.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &diskQueueEndpoint{
+		log:     log.With(l, "subcomponent", "disk_queue", "endpoint", name),
+		name:    name,
+		opts:    ep,
+		queue:   q,
+		client:  pushv1connect.NewPusherServiceClient(httpClient, ep.URL, WithUserAgent(userAgent)),
+		http:    httpClient,
+		metrics: metrics,
+		ctx:     ctx,
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// Start implements diskqueue.Sender.
+func (e *diskQueueEndpoint) Start() {
+	var ctx context.Context
+	ctx, e.cancel = context.WithCancel(e.ctx)
+	go e.run(ctx)
+}
+
+// Stop implements diskqueue.Sender. The queue is closed by the
+// diskqueue.Endpoints which owns it.
+func (e *diskQueueEndpoint) Stop() {
+	e.cancel()
+	<-e.done
+}
+
+// run sends queued entries until ctx is canceled. Entries are only removed
+// from the queue once they have been sent, failed with a non-retryable error,
+// or were evicted by the limits of the queue. Unlike pushes without a disk
+// queue, sends are retried without a limit.
+func (e *diskQueueEndpoint) run(ctx context.Context) {
+	defer close(e.done)
+
+	bo := backoff.New(ctx, backoff.Config{
+		MinBackoff: e.opts.MinBackoff,
+		MaxBackoff: e.opts.MaxBackoff,
+	})
+
+	for ctx.Err() == nil {
+		entries, err := e.queue.Peek(1)
+		if err != nil {
+			level.Error(e.log).Log("msg", "failed to read from disk queue", "err", err)
+			bo.Wait()
+			continue
+		}
+		if len(entries) == 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-e.queue.Notify():
+			}
+			continue
+		}
+		entry := entries[0]
+
+		req, err := e.decode(entry.Data)
+		if err != nil {
+			level.Error(e.log).Log("msg", "dropping corrupted disk queue entry", "err", err)
+			e.ack(entry)
+			continue
+		}
+
+		retry, err := req.send(ctx)
+		switch {
+		case err == nil:
+			e.metrics.sentBytes.WithLabelValues(e.opts.URL).Add(float64(req.size))
+			e.metrics.sentProfiles.WithLabelValues(e.opts.URL).Add(float64(req.profiles))
+			e.lastError.Store("")
+			e.ack(entry)
+			bo.Reset()
+		case ctx.Err() != nil:
+			return
+		case retry:
+			level.Warn(e.log).Log("msg", "failed to push to endpoint, retrying", "err", err)
+			e.lastError.Store(err.Error())
+			e.metrics.retries.WithLabelValues(e.opts.URL).Inc()
+			bo.Wait()
+		default:
+			level.Error(e.log).Log("msg", "non-retryable error, dropping profiles", "count", req.profiles, "err", err)
+			e.lastError.Store(err.Error())
+			e.metrics.droppedBytes.WithLabelValues(e.opts.URL).Add(float64(req.size))
+			e.metrics.droppedProfiles.WithLabelValues(e.opts.URL).Add(float64(req.profiles))
+			e.ack(entry)
+		}
+	}
+}
+
+// queuedRequest is a request decoded from a disk queue entry.
+type queuedRequest struct {
+	// send sends the request and returns whether a failed request can be
+	// retried.
+	send     func(ctx context.Context) (bool, error)
+	size     int64
+	profiles int64
+}
+
+// decode decodes a disk queue entry into the request to send to the
+// endpoint.
+func (e *diskQueueEndpoint) decode(data []byte) (queuedRequest, error) {
+	if len(data) == 0 {
+		return queuedRequest{}, errors.New("empty entry")
+	}
+
+	switch data[0] {
+	case entryPush:
+		var msg pushv1.PushRequest
+		if err := proto.Unmarshal(data[1:], &msg); err != nil {
+			return queuedRequest{}, err
+		}
+		req := connect.NewRequest(&msg)
+		size, profiles := requestSize(req)
+		return queuedRequest{
+			send: func(ctx context.Context) (bool, error) {
+				err := e.send(ctx, req)
+				return shouldRetry(err), err
+			},
+			size:     size,
+			profiles: profiles,
+		}, nil
+
+	case entryIngest:
+		query, profile, err := decodeIngest(data[1:])
+		if err != nil {
+			return queuedRequest{}, err
+		}
+		return queuedRequest{
+			send: func(ctx context.Context) (bool, error) {
+				return sendIngest(ctx, e.http, &e.opts, query, profile)
+			},
+			size:     int64(len(profile.Body)),
+			profiles: 1,
+		}, nil
+
+	default:
+		return queuedRequest{}, fmt.Errorf("unknown entry kind %d", data[0])
+	}
+}
+
+func (e *diskQueueEndpoint) send(ctx context.Context, req *connect.Request[pushv1.PushRequest]) error {
+	for k, v := range e.opts.Headers {
+		req.Header().Set(k, v)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.opts.RemoteTimeout)
+	defer cancel()
+
+	_, err := e.client.Push(ctx, req)
+	return err
+}
+
+func (e *diskQueueEndpoint) ack(entry diskqueue.Entry) {
+	if err := e.queue.Ack(entry); err != nil {
+		level.Error(e.log).Log("msg", "failed to update disk queue position", "err", err)
+	}
+}
+
+// diskQueueDebugInfo reports the state of a disk queue.
+type diskQueueDebugInfo struct {
+	Name            string        `river:"name,attr"`
+	URL             string        `river:"url,attr"`
+	Bytes           int64         `river:"bytes,attr"`
+	Entries         int           `river:"entries,attr"`
+	OldestEntryAge  time.Duration `river:"oldest_entry_age,attr,optional"`
+	EvictedMaxSize  uint64        `river:"evicted_entries_max_size,attr"`
+	EvictedMaxAge   uint64        `river:"evicted_entries_max_age,attr"`
+	LastSendFailure string        `river:"last_send_failure,attr,optional"`
+}
+
+func (e *diskQueueEndpoint) debugInfo() diskQueueDebugInfo {
+	stats := e.queue.Stats()
+
+	var age time.Duration
+	if !stats.Oldest.IsZero() {
+		age = time.Since(stats.Oldest)
+	}
+
+	return diskQueueDebugInfo{
+		Name:            e.name,
+		URL:             e.opts.URL,
+		Bytes:           stats.Bytes,
+		Entries:         stats.Entries,
+		OldestEntryAge:  age,
+		EvictedMaxSize:  stats.EvictedMaxBytes,
+		EvictedMaxAge:   stats.EvictedMaxAge,
+		LastSendFailure: e.lastError.Load(),
+	}
+}
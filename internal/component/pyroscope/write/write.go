@@ -1,9 +1,16 @@
 package write
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"connectrpc.com/connect"
@@ -20,6 +27,7 @@ import (
 
 	"github.com/grafana/agent/internal/component"
 	"github.com/grafana/agent/internal/component/common/config"
+	"github.com/grafana/agent/internal/component/common/diskqueue"
 	"github.com/grafana/dskit/backoff"
 	pushv1 "github.com/grafana/pyroscope/api/gen/proto/go/push/v1"
 	"github.com/grafana/pyroscope/api/gen/proto/go/push/v1/pushv1connect"
@@ -69,6 +77,7 @@ type EndpointOptions struct {
 	MinBackoff        time.Duration            `river:"min_backoff_period,attr,optional"`  // start backoff at this level
 	MaxBackoff        time.Duration            `river:"max_backoff_period,attr,optional"`  // increase exponentially to this level
 	MaxBackoffRetries int                      `river:"max_backoff_retries,attr,optional"` // give up after this many; zero means infinite retries
+	DiskQueue         *diskqueue.Arguments     `river:"disk_queue,block,optional"`
 }
 
 func GetDefaultEndpointOptions() EndpointOptions {
@@ -100,9 +109,10 @@ func (r *EndpointOptions) Validate() error {
 
 // Component is the pyroscope.write component.
 type Component struct {
-	opts    component.Options
-	cfg     Arguments
-	metrics *metrics
+	opts       component.Options
+	cfg        Arguments
+	metrics    *metrics
+	diskQueues *diskQueueStorage
 }
 
 // Exports are the set of fields exposed by the pyroscope.write component.
@@ -113,17 +123,32 @@ type Exports struct {
 // New creates a new pyroscope.write component.
 func New(o component.Options, c Arguments) (*Component, error) {
 	metrics := newMetrics(o.Registerer)
+	diskQueues := newDiskQueueStorage(o.Logger, filepath.Join(o.DataPath, "queue"), metrics)
+	if err := o.Registerer.Register(diskqueue.NewCollector("pyroscope_write", "entry", "entries", diskQueues.endpoints.Stats)); err != nil {
+		return nil, err
+	}
+	// NewFanOut sets the agent seed header on the endpoints, so the receiver
+	// is built before the disk queue endpoints.
 	receiver, err := NewFanOut(o, c, metrics)
 	if err != nil {
 		return nil, err
 	}
+	receiver.diskQueues = diskQueues
+	diskQueuesUpdate, err := diskQueues.prepare(c)
+	if err != nil {
+		return nil, err
+	}
+	if err := diskQueuesUpdate.Commit(); err != nil {
+		return nil, err
+	}
 	// Immediately export the receiver
 	o.OnStateChange(Exports{Receiver: receiver})
 
 	return &Component{
-		cfg:     c,
-		opts:    o,
-		metrics: metrics,
+		cfg:        c,
+		opts:       o,
+		metrics:    metrics,
+		diskQueues: diskQueues,
 	}, nil
 }
 
@@ -131,25 +156,56 @@ var _ component.Component = (*Component)(nil)
 
 // Run implements Component.
 func (c *Component) Run(ctx context.Context) error {
+	defer c.diskQueues.Close()
 	<-ctx.Done()
 	return ctx.Err()
 }
 
 // Update implements Component.
 func (c *Component) Update(newConfig component.Arguments) error {
-	c.cfg = newConfig.(Arguments)
-	level.Debug(c.opts.Logger).Log("msg", "updating pyroscope.write config", "old", c.cfg, "new", newConfig)
-	receiver, err := NewFanOut(c.opts, newConfig.(Arguments), c.metrics)
+	cfg := newConfig.(Arguments)
+	level.Debug(c.opts.Logger).Log("msg", "updating pyroscope.write config", "old", c.cfg, "new", cfg)
+
+	// Build the new receiver and the disk queue endpoints before applying
+	// either, so that the running endpoints are kept if one of them fails.
+	receiver, err := NewFanOut(c.opts, cfg, c.metrics)
+	if err != nil {
+		return err
+	}
+	receiver.diskQueues = c.diskQueues
+	diskQueuesUpdate, err := c.diskQueues.prepare(cfg)
 	if err != nil {
 		return err
 	}
+	if err := diskQueuesUpdate.Commit(); err != nil {
+		level.Warn(c.opts.Logger).Log("msg", "failed to close disk queues of removed endpoints", "err", err)
+	}
+	c.cfg = cfg
 	c.opts.OnStateChange(Exports{Receiver: receiver})
 	return nil
 }
 
+// DebugInfo implements component.DebugComponent.
+func (c *Component) DebugInfo() interface{} {
+	return debugInfo{DiskQueues: c.diskQueues.debugInfo()}
+}
+
+type debugInfo struct {
+	DiskQueues []diskQueueDebugInfo `river:"disk_queue,block,optional"`
+}
+
 type fanOutClient struct {
-	// The list of push clients to fan out to.
-	clients []pushv1connect.PusherServiceClient
+	// The list of push clients to fan out to, and their endpoints. Endpoints
+	// with a disk_queue block are sent to from their queue instead.
+	clients   []pushv1connect.PusherServiceClient
+	endpoints []*EndpointOptions
+
+	// ingestClients holds the HTTP client of every endpoint in endpoints, used
+	// to send profiles received on /ingest.
+	ingestClients []*http.Client
+
+	// diskQueues receives profiles for endpoints with a disk_queue block.
+	diskQueues *diskQueueStorage
 
 	config  Arguments
 	opts    component.Options
@@ -158,7 +214,11 @@ type fanOutClient struct {
 
 // NewFanOut creates a new fan out client that will fan out to all endpoints.
 func NewFanOut(opts component.Options, config Arguments, metrics *metrics) (*fanOutClient, error) {
-	clients := make([]pushv1connect.PusherServiceClient, 0, len(config.Endpoints))
+	var (
+		clients       = make([]pushv1connect.PusherServiceClient, 0, len(config.Endpoints))
+		endpoints     = make([]*EndpointOptions, 0, len(config.Endpoints))
+		ingestClients = make([]*http.Client, 0, len(config.Endpoints))
+	)
 	uid := agentseed.Get().UID
 	for _, endpoint := range config.Endpoints {
 		if endpoint.Headers == nil {
@@ -169,13 +229,20 @@ func NewFanOut(opts component.Options, config Arguments, metrics *metrics) (*fan
 		if err != nil {
 			return nil, err
 		}
+		if endpoint.DiskQueue != nil {
+			continue
+		}
 		clients = append(clients, pushv1connect.NewPusherServiceClient(httpClient, endpoint.URL, WithUserAgent(userAgent)))
+		ingestClients = append(ingestClients, httpClient)
+		endpoints = append(endpoints, endpoint)
 	}
 	return &fanOutClient{
-		clients: clients,
-		config:  config,
-		opts:    opts,
-		metrics: metrics,
+		clients:       clients,
+		endpoints:     endpoints,
+		ingestClients: ingestClients,
+		config:        config,
+		opts:          opts,
+		metrics:       metrics,
 	}, nil
 }
 
@@ -194,31 +261,31 @@ func (f *fanOutClient) Push(ctx context.Context, req *connect.Request[pushv1.Pus
 			client  = client
 			i       = i
 			backoff = backoff.New(ctx, backoff.Config{
-				MinBackoff: f.config.Endpoints[i].MinBackoff,
-				MaxBackoff: f.config.Endpoints[i].MaxBackoff,
-				MaxRetries: f.config.Endpoints[i].MaxBackoffRetries,
+				MinBackoff: f.endpoints[i].MinBackoff,
+				MaxBackoff: f.endpoints[i].MaxBackoff,
+				MaxRetries: f.endpoints[i].MaxBackoffRetries,
 			})
 			err error
 		)
 		g.Add(func() error {
 			req := connect.NewRequest(req.Msg)
-			for k, v := range f.config.Endpoints[i].Headers {
+			for k, v := range f.endpoints[i].Headers {
 				req.Header().Set(k, v)
 			}
 			for {
 				err = func() error {
-					ctx, cancel := context.WithTimeout(ctx, f.config.Endpoints[i].RemoteTimeout)
+					ctx, cancel := context.WithTimeout(ctx, f.endpoints[i].RemoteTimeout)
 					defer cancel()
 
 					_, err := client.Push(ctx, req)
 					return err
 				}()
 				if err == nil {
-					f.metrics.sentBytes.WithLabelValues(f.config.Endpoints[i].URL).Add(float64(reqSize))
-					f.metrics.sentProfiles.WithLabelValues(f.config.Endpoints[i].URL).Add(float64(profileCount))
+					f.metrics.sentBytes.WithLabelValues(f.endpoints[i].URL).Add(float64(reqSize))
+					f.metrics.sentProfiles.WithLabelValues(f.endpoints[i].URL).Add(float64(profileCount))
 					break
 				}
-				level.Warn(f.opts.Logger).Log("msg", "failed to push to endpoint", "endpoint", f.config.Endpoints[i].URL, "err", err)
+				level.Warn(f.opts.Logger).Log("msg", "failed to push to endpoint", "endpoint", f.endpoints[i].URL, "err", err)
 				if !shouldRetry(err) {
 					break
 				}
@@ -226,12 +293,12 @@ func (f *fanOutClient) Push(ctx context.Context, req *connect.Request[pushv1.Pus
 				if !backoff.Ongoing() {
 					break
 				}
-				f.metrics.retries.WithLabelValues(f.config.Endpoints[i].URL).Inc()
+				f.metrics.retries.WithLabelValues(f.endpoints[i].URL).Inc()
 			}
 			if err != nil {
-				f.metrics.droppedBytes.WithLabelValues(f.config.Endpoints[i].URL).Add(float64(reqSize))
-				f.metrics.droppedProfiles.WithLabelValues(f.config.Endpoints[i].URL).Add(float64(profileCount))
-				level.Warn(f.opts.Logger).Log("msg", "final error sending to profiles to endpoint", "endpoint", f.config.Endpoints[i].URL, "err", err)
+				f.metrics.droppedBytes.WithLabelValues(f.endpoints[i].URL).Add(float64(reqSize))
+				f.metrics.droppedProfiles.WithLabelValues(f.endpoints[i].URL).Add(float64(profileCount))
+				level.Warn(f.opts.Logger).Log("msg", "final error sending to profiles to endpoint", "endpoint", f.endpoints[i].URL, "err", err)
 				errs = multierr.Append(errs, err)
 			}
 			return err
@@ -308,13 +375,114 @@ func (f *fanOutClient) Append(ctx context.Context, lbs labels.Labels, samples []
 			RawProfile: sample.RawProfile,
 		})
 	}
-	// push to all clients
-	_, err := f.Push(ctx, connect.NewRequest(&pushv1.PushRequest{
+	req := &pushv1.PushRequest{
 		Series: []*pushv1.RawProfileSeries{
 			{Labels: protoLabels, Samples: protoSamples},
 		},
-	}))
-	return err
+	}
+	var errs error
+	if f.diskQueues != nil {
+		errs = f.diskQueues.enqueue(req)
+	}
+	// push to all clients
+	_, err := f.Push(ctx, connect.NewRequest(req))
+	return multierr.Append(errs, err)
+}
+
+// AppendIngest implements the Appender interface. The profile is sent as it
+// was received to the /ingest endpoint of every endpoint, with its labels and
+// the external labels in the name parameter.
+func (f *fanOutClient) AppendIngest(ctx context.Context, profile *pyroscope.IncomingProfile) error {
+	lbsBuilder := labels.NewBuilder(profile.Labels)
+	for name, value := range f.config.ExternalLabels {
+		lbsBuilder.Set(name, value)
+	}
+	query := profile.URL.Query()
+	query.Set("name", pyroscope.IngestName(lbsBuilder.Labels(), query.Get("name")))
+
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(f.ingestClients)+1)
+		size = float64(len(profile.Body))
+	)
+	if f.diskQueues != nil {
+		errs[len(f.ingestClients)] = f.diskQueues.enqueueIngest(query, profile)
+	}
+	for i, client := range f.ingestClients {
+		wg.Add(1)
+		go func(i int, client *http.Client, endpoint *EndpointOptions) {
+			defer wg.Done()
+
+			bo := backoff.New(ctx, backoff.Config{
+				MinBackoff: endpoint.MinBackoff,
+				MaxBackoff: endpoint.MaxBackoff,
+				MaxRetries: endpoint.MaxBackoffRetries,
+			})
+			var err error
+			for {
+				var retry bool
+				retry, err = sendIngest(ctx, client, endpoint, query, profile)
+				if err == nil {
+					f.metrics.sentBytes.WithLabelValues(endpoint.URL).Add(size)
+					f.metrics.sentProfiles.WithLabelValues(endpoint.URL).Inc()
+					return
+				}
+				level.Warn(f.opts.Logger).Log("msg", "failed to ingest to endpoint", "endpoint", endpoint.URL, "err", err)
+				if !retry {
+					break
+				}
+				bo.Wait()
+				if !bo.Ongoing() {
+					break
+				}
+				f.metrics.retries.WithLabelValues(endpoint.URL).Inc()
+			}
+			f.metrics.droppedBytes.WithLabelValues(endpoint.URL).Add(size)
+			f.metrics.droppedProfiles.WithLabelValues(endpoint.URL).Inc()
+			level.Warn(f.opts.Logger).Log("msg", "final error sending profile to endpoint", "endpoint", endpoint.URL, "err", err)
+			errs[i] = err
+		}(i, client, f.endpoints[i])
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// sendIngest sends profile to the /ingest endpoint of endpoint with the given
+// query parameters. It returns whether a failed request can be retried.
+func sendIngest(ctx context.Context, client *http.Client, endpoint *EndpointOptions, query url.Values, profile *pyroscope.IncomingProfile) (bool, error) {
+	u, err := url.JoinPath(endpoint.URL, "ingest")
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, endpoint.RemoteTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u+"?"+query.Encode(), bytes.NewReader(profile.Body))
+	if err != nil {
+		return false, err
+	}
+	if profile.ContentType != "" {
+		req.Header.Set("Content-Type", profile.ContentType)
+	}
+	for k, v := range endpoint.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err = fmt.Errorf("server returned HTTP status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5, err
 }
 
 // WithUserAgent returns a `connect.ClientOption` that sets the User-Agent header on.
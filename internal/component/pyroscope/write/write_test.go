@@ -3,14 +3,22 @@ package write
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
 
 	"connectrpc.com/connect"
+	"github.com/alecthomas/units"
+	"github.com/grafana/agent/internal/agentseed"
 	"github.com/grafana/agent/internal/component"
+	"github.com/grafana/agent/internal/component/common/diskqueue"
 	"github.com/grafana/agent/internal/component/pyroscope"
 	"github.com/grafana/agent/internal/util"
 	pushv1 "github.com/grafana/pyroscope/api/gen/proto/go/push/v1"
@@ -21,6 +29,7 @@ import (
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/atomic"
+	"go.uber.org/goleak"
 )
 
 type PushFunc func(context.Context, *connect.Request[pushv1.PushRequest]) (*connect.Response[pushv1.PushResponse], error)
@@ -208,6 +217,86 @@ func Test_Write_Update(t *testing.T) {
 	require.Equal(t, int32(1), pushTotal.Load())
 }
 
+func Test_Write_AppendIngest(t *testing.T) {
+	for _, diskQueue := range []bool{false, true} {
+		t.Run(fmt.Sprintf("disk_queue=%t", diskQueue), func(t *testing.T) {
+			testAppendIngest(t, diskQueue)
+		})
+	}
+}
+
+func testAppendIngest(t *testing.T, diskQueue bool) {
+	type request struct {
+		query       url.Values
+		contentType string
+		body        string
+	}
+	var (
+		export   Exports
+		received = make(chan request, 10)
+		attempts = atomic.NewInt32(0)
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/ingest", r.URL.Path)
+		// The first attempt fails and is retried.
+		if attempts.Inc() == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		received <- request{query: r.URL.Query(), contentType: r.Header.Get("Content-Type"), body: string(body)}
+	}))
+	defer server.Close()
+
+	argument := DefaultArguments()
+	argument.ExternalLabels = map[string]string{"cluster": "eu-1"}
+	argument.Endpoints = []*EndpointOptions{{
+		URL:           server.URL,
+		RemoteTimeout: GetDefaultEndpointOptions().RemoteTimeout,
+		MinBackoff:    10 * time.Millisecond,
+		MaxBackoff:    50 * time.Millisecond,
+	}}
+	if diskQueue {
+		argument.Endpoints[0].DiskQueue = &diskqueue.DefaultArguments
+	}
+	c, err := New(component.Options{
+		ID:         "1",
+		Logger:     util.TestFlowLogger(t),
+		Registerer: prometheus.NewRegistry(),
+		DataPath:   t.TempDir(),
+		OnStateChange: func(e component.Exports) {
+			export = e.(Exports)
+		},
+	}, argument)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Run(ctx)
+
+	u, err := url.Parse("http://localhost/ingest?name=app.cpu%7Benv%3Ddev%7D&format=jfr&sampleRate=100")
+	require.NoError(t, err)
+	err = export.Receiver.Appender().AppendIngest(context.Background(), &pyroscope.IncomingProfile{
+		Body:        []byte("jfr profile"),
+		ContentType: "application/octet-stream",
+		URL:         u,
+		Labels:      labels.FromStrings("__name__", "process_cpu", "env", "prod", "service_name", "app"),
+	})
+	require.NoError(t, err)
+
+	var req request
+	select {
+	case req = <-received:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "failed waiting for ingested profile")
+	}
+	require.Equal(t, "app.cpu{cluster=eu-1,env=prod}", req.query.Get("name"))
+	require.Equal(t, "jfr", req.query.Get("format"))
+	require.Equal(t, "100", req.query.Get("sampleRate"))
+	require.Equal(t, "application/octet-stream", req.contentType)
+	require.Equal(t, "jfr profile", req.body)
+}
+
 func Test_Unmarshal_Config(t *testing.T) {
 	var arg Arguments
 	river.Unmarshal([]byte(`
@@ -253,3 +342,158 @@ func TestBadRiverConfig(t *testing.T) {
 	err := river.Unmarshal([]byte(exampleRiverConfig), &args)
 	require.ErrorContains(t, err, "at most one of basic_auth, authorization, oauth2, bearer_token & bearer_token_file must be configured")
 }
+
+func Test_Write_DiskQueue(t *testing.T) {
+	var (
+		available = atomic.NewBool(false)
+		received  = make(chan *pushv1.PushRequest, 10)
+	)
+	_, handler := pushv1connect.NewPusherServiceHandler(PushFunc(
+		func(_ context.Context, req *connect.Request[pushv1.PushRequest]) (*connect.Response[pushv1.PushResponse], error) {
+			if !available.Load() {
+				return nil, connect.NewError(connect.CodeUnavailable, errors.New("unavailable"))
+			}
+			if req.Header().Get(agentseed.HeaderName) != agentseed.Get().UID {
+				return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("missing agent seed header"))
+			}
+			received <- req.Msg
+			return &connect.Response[pushv1.PushResponse]{}, nil
+		},
+	))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	dataPath := t.TempDir()
+
+	runComponent := func() (pyroscope.Appendable, *Component, func()) {
+		argument := DefaultArguments()
+		argument.Endpoints = []*EndpointOptions{{
+			URL:           server.URL,
+			RemoteTimeout: GetDefaultEndpointOptions().RemoteTimeout,
+			MinBackoff:    10 * time.Millisecond,
+			MaxBackoff:    50 * time.Millisecond,
+			DiskQueue:     &diskqueue.Arguments{MaxSize: diskqueue.DefaultArguments.MaxSize},
+		}}
+
+		var export Exports
+		c, err := New(component.Options{
+			ID:         "1",
+			Logger:     util.TestFlowLogger(t),
+			Registerer: prometheus.NewRegistry(),
+			DataPath:   dataPath,
+			OnStateChange: func(e component.Exports) {
+				export = e.(Exports)
+			},
+		}, argument)
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			c.Run(ctx)
+		}()
+		return export.Receiver, c, func() {
+			cancel()
+			<-done
+		}
+	}
+
+	// Profiles are queued while the endpoint is unavailable.
+	receiver, c, stop := runComponent()
+	err := receiver.Appender().Append(context.Background(), labels.FromStrings("__name__", "test"), []*pyroscope.RawSample{
+		{RawProfile: []byte("pprofraw")},
+	})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		info := c.DebugInfo().(debugInfo).DiskQueues
+		return len(info) == 1 && info[0].Entries == 1 && info[0].LastSendFailure != ""
+	}, 5*time.Second, 10*time.Millisecond)
+	stop()
+
+	// Queued profiles are replayed after a restart.
+	available.Store(true)
+	_, c, stop = runComponent()
+	defer stop()
+	select {
+	case req := <-received:
+		require.Equal(t, []*typesv1.LabelPair{{Name: "__name__", Value: "test"}}, req.Series[0].Labels)
+		require.Equal(t, []byte("pprofraw"), req.Series[0].Samples[0].RawProfile)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "failed waiting for queued profile")
+	}
+	require.Eventually(t, func() bool {
+		return c.DebugInfo().(debugInfo).DiskQueues[0].Entries == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func Test_DiskQueueStorage_PrepareError(t *testing.T) {
+	ignoreCurrent := goleak.IgnoreCurrent()
+
+	dataPath := t.TempDir()
+	// The queue of the second endpoint can't be created, since its directory
+	// is a file.
+	require.NoError(t, os.WriteFile(filepath.Join(dataPath, "second"), nil, 0o644))
+
+	newEndpoint := func(name string) *EndpointOptions {
+		return &EndpointOptions{
+			Name:          name,
+			URL:           "http://localhost:4040",
+			RemoteTimeout: GetDefaultEndpointOptions().RemoteTimeout,
+			DiskQueue:     &diskqueue.DefaultArguments,
+		}
+	}
+
+	argument := DefaultArguments()
+	argument.Endpoints = []*EndpointOptions{newEndpoint("first")}
+
+	s := newDiskQueueStorage(util.TestFlowLogger(t), dataPath, newMetrics(prometheus.NewRegistry()))
+	u, err := s.prepare(argument)
+	require.NoError(t, err)
+	require.NoError(t, u.Commit())
+	running := s.debugInfo()
+
+	// Change the first endpoint and add the second one. Since the second one
+	// fails, the first one is left as it is.
+	changed := newEndpoint("first")
+	changed.RemoteTimeout = time.Minute
+	argument.Endpoints = []*EndpointOptions{changed, newEndpoint("second")}
+	_, err = s.prepare(argument)
+	require.Error(t, err)
+
+	var opts []EndpointOptions
+	s.endpoints.Range(func(ep *diskqueue.Endpoint[EndpointOptions, *diskQueueEndpoint]) {
+		opts = append(opts, ep.Sender.opts)
+	})
+	require.Equal(t, []EndpointOptions{*newEndpoint("first")}, opts)
+	require.Equal(t, running, s.debugInfo())
+
+	require.NoError(t, s.Close())
+	goleak.VerifyNone(t, ignoreCurrent)
+}
+
+func Test_Unmarshal_DiskQueue(t *testing.T) {
+	var arg Arguments
+	require.NoError(t, river.Unmarshal([]byte(`
+	endpoint {
+		url = "http://localhost:4100"
+		disk_queue { }
+	}
+	endpoint {
+		url = "http://localhost:4200"
+		disk_queue {
+			max_size = "100MiB"
+			max_age  = "1h"
+		}
+	}`), &arg))
+	require.Equal(t, &diskqueue.DefaultArguments, arg.Endpoints[0].DiskQueue)
+	require.Equal(t, &diskqueue.Arguments{MaxSize: 100 * units.MiB, MaxAge: time.Hour}, arg.Endpoints[1].DiskQueue)
+
+	err := river.Unmarshal([]byte(`
+	endpoint {
+		url = "http://localhost:4100"
+		disk_queue {
+			max_age = "-1h"
+		}
+	}`), &arg)
+	require.ErrorContains(t, err, "max_age must not be negative")
+}
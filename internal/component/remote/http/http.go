@@ -46,6 +46,11 @@ type Arguments struct {
 	Body    string            `river:"body,attr,optional"`
 
 	Client common_config.HTTPClientConfig `river:"client,block,optional"`
+
+	// KeepWhitespace exports the response body as is instead of trimming
+	// whitespace around it. It can only be set from Go code, and is used by
+	// import.http to verify signatures against the exact response body.
+	KeepWhitespace bool
 }
 
 // DefaultArguments holds default settings for Arguments.
@@ -228,7 +233,10 @@ func (c *Component) pollError() error {
 		return fmt.Errorf("unexpected status code %s", resp.Status)
 	}
 
-	stringContent := strings.TrimSpace(string(bb))
+	stringContent := string(bb)
+	if !c.args.KeepWhitespace {
+		stringContent = strings.TrimSpace(stringContent)
+	}
 
 	newExports := Exports{
 		Content: rivertypes.OptionalSecret{
@@ -42,6 +42,7 @@ func toLokiWriteArguments(config *client.Config, diags *diag.Diagnostics) *lokiw
 			{
 				Name:              config.Name,
 				URL:               config.URL.String(),
+				Format:            lokiwrite.GetDefaultEndpointOptions().Format,
 				BatchWait:         config.BatchWait,
 				BatchSize:         batchSize,
 				HTTPClientConfig:  common.ToHttpClientConfig(&config.Client),
@@ -465,9 +465,9 @@ func convertMetrics(cfg interface{}, diags *diag.Diagnostics) (stages.StageConfi
 		}
 		fMetrics = append(fMetrics, fMetric)
 	}
-	return stages.StageConfig{MetricsConfig: &stages.MetricsConfig{
-		Metrics: fMetrics,
-	}}, true
+	fCfg := stages.DefaultMetricsConfig
+	fCfg.Metrics = fMetrics
+	return stages.StageConfig{MetricsConfig: &fCfg}, true
 }
 
 func toFlowMetricProcessStage(name string, pMetric promtailstages.MetricConfig, diags *diag.Diagnostics) (stages.MetricConfig, bool) {
@@ -119,6 +119,9 @@ type Flow struct {
 	loader      *controller.Loader
 	modules     *moduleRegistry
 
+	serviceCtrlsMut sync.RWMutex
+	serviceCtrls    map[string]*Flow // Isolated controllers created by services, keyed by ID.
+
 	loadFinished chan struct{}
 
 	loadMut    sync.RWMutex
@@ -135,6 +138,19 @@ func New(o Options) *Flow {
 	})
 }
 
+// NewWithComponentRegistry creates a new, unstarted Flow controller which
+// looks up component definitions in reg rather than in the global component
+// registry. Modules created by the controller use reg as well.
+func NewWithComponentRegistry(o Options, reg controller.ComponentRegistry) *Flow {
+	return newController(controllerOptions{
+		Options:           o,
+		ComponentRegistry: reg,
+		ModuleRegistry:    newModuleRegistry(),
+		IsModule:          false, // We are creating a new root controller.
+		WorkerPool:        worker.NewDefaultWorkerPool(),
+	})
+}
+
 // controllerOptions are internal options used to create both root Flow
 // controller and controllers for modules.
 type controllerOptions struct {
@@ -179,7 +195,8 @@ func newController(o controllerOptions) *Flow {
 		updateQueue: controller.NewQueue(),
 		sched:       controller.NewScheduler(),
 
-		modules: o.ModuleRegistry,
+		modules:      o.ModuleRegistry,
+		serviceCtrls: make(map[string]*Flow),
 
 		loadFinished: make(chan struct{}, 1),
 	}
@@ -231,6 +248,14 @@ func newController(o controllerOptions) *Flow {
 	return f
 }
 
+// Close shuts down a Flow controller which was never run, cleaning up the
+// components and services built by LoadSource without running them. Close
+// must not be called if Run was called.
+func (f *Flow) Close() error {
+	f.loader.Cleanup(!f.opts.IsModule)
+	return f.sched.Close()
+}
+
 // Run starts the Flow controller, blocking until the provided context is
 // canceled. Run must only be called once.
 func (f *Flow) Run(ctx context.Context) {
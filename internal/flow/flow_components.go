@@ -14,12 +14,12 @@ func (f *Flow) GetComponent(id component.ID, opts component.InfoOptions) (*compo
 	defer f.loadMut.RUnlock()
 
 	if id.ModuleID != "" {
-		mod, ok := f.modules.Get(id.ModuleID)
+		ctrl, ok := f.getModuleController(id.ModuleID)
 		if !ok {
 			return nil, component.ErrComponentNotFound
 		}
 
-		return mod.f.GetComponent(component.ID{LocalID: id.LocalID}, opts)
+		return ctrl.GetComponent(component.ID{LocalID: id.LocalID}, opts)
 	}
 
 	graph := f.loader.OriginalGraph()
@@ -43,12 +43,12 @@ func (f *Flow) ListComponents(moduleID string, opts component.InfoOptions) ([]*c
 	defer f.loadMut.RUnlock()
 
 	if moduleID != "" {
-		mod, ok := f.modules.Get(moduleID)
+		ctrl, ok := f.getModuleController(moduleID)
 		if !ok {
 			return nil, component.ErrModuleNotFound
 		}
 
-		return mod.f.ListComponents("", opts)
+		return ctrl.ListComponents("", opts)
 	}
 
 	var (
@@ -127,5 +127,8 @@ func (f *Flow) getComponentDetail(cn controller.ComponentNode, graph *dag.Graph,
 			componentInfo.DebugInfo = builtinComponent.DebugInfo()
 		}
 	}
+	if forEachComponent, ok := cn.(*controller.ForEachNode); ok && opts.GetDebugInfo {
+		componentInfo.DebugInfo = forEachComponent.DebugInfo()
+	}
 	return componentInfo
 }
@@ -70,23 +70,42 @@ func serviceConsumersForGraph(graph *dag.Graph, serviceName string, includePeerS
 // NewController returns a new, unstarted, isolated Flow controller so that
 // services can instantiate their own components.
 func (f *Flow) NewController(id string) service.Controller {
-	return serviceController{
-		f: newController(controllerOptions{
-			Options: Options{
-				ControllerID:    id,
-				Logger:          f.opts.Logger,
-				Tracer:          f.opts.Tracer,
-				DataPath:        f.opts.DataPath,
-				MinStability:    f.opts.MinStability,
-				Reg:             f.opts.Reg,
-				Services:        f.opts.Services,
-				OnExportsChange: nil, // NOTE(@tpaschalis, @wildum) The isolated controller shouldn't be able to export any values.
-			},
-			IsModule:       true,
-			ModuleRegistry: newModuleRegistry(),
-			WorkerPool:     worker.NewDefaultWorkerPool(),
-		}),
+	ctrl := newController(controllerOptions{
+		Options: Options{
+			ControllerID:    id,
+			Logger:          f.opts.Logger,
+			Tracer:          f.opts.Tracer,
+			DataPath:        f.opts.DataPath,
+			MinStability:    f.opts.MinStability,
+			Reg:             f.opts.Reg,
+			Services:        f.opts.Services,
+			OnExportsChange: nil, // NOTE(@tpaschalis, @wildum) The isolated controller shouldn't be able to export any values.
+		},
+		IsModule:       true,
+		ModuleRegistry: newModuleRegistry(),
+		WorkerPool:     worker.NewDefaultWorkerPool(),
+	})
+
+	// Track the isolated controller so that its components can be looked up
+	// through the [service.Host] using id as the module ID.
+	f.serviceCtrlsMut.Lock()
+	f.serviceCtrls[id] = ctrl
+	f.serviceCtrlsMut.Unlock()
+
+	return serviceController{f: ctrl}
+}
+
+// getModuleController returns the controller of the module or isolated
+// service controller with the given ID.
+func (f *Flow) getModuleController(id string) (*Flow, bool) {
+	if mod, ok := f.modules.Get(id); ok {
+		return mod.f, true
 	}
+
+	f.serviceCtrlsMut.RLock()
+	defer f.serviceCtrlsMut.RUnlock()
+	ctrl, ok := f.serviceCtrls[id]
+	return ctrl, ok
 }
 
 type serviceController struct {
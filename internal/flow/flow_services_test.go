@@ -181,6 +181,33 @@ func TestFlow_GetServiceConsumers(t *testing.T) {
 	require.Equal(t, expectConsumers, ctrl.GetServiceConsumers("svc_a"))
 }
 
+func TestFlow_NewController_Components(t *testing.T) {
+	defer verifyNoGoroutineLeaks(t)
+
+	ctrl := New(testOptions(t))
+	defer cleanUpController(ctrl)
+	require.NoError(t, ctrl.LoadSource(makeEmptyFile(t), nil))
+
+	svcCtrl := ctrl.NewController("svc")
+	defer svcCtrl.(serviceController).f.opts.WorkerPool.Stop()
+	defer cleanUpController(svcCtrl.(serviceController).f)
+	require.NoError(t, svcCtrl.LoadSource([]byte(`testcomponents.tick "ticker" { frequency = "1s" }`), nil))
+
+	// Components of the isolated controller can be looked up using the ID of
+	// the controller as the module ID.
+	infos, err := ctrl.ListComponents("svc", component.InfoOptions{})
+	require.NoError(t, err)
+	require.Len(t, infos, 1)
+	require.Equal(t, "testcomponents.tick.ticker", infos[0].ID.LocalID)
+
+	info, err := ctrl.GetComponent(component.ID{ModuleID: "svc", LocalID: "testcomponents.tick.ticker"}, component.InfoOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "testcomponents.tick", info.ComponentName)
+
+	_, err = ctrl.ListComponents("other", component.InfoOptions{})
+	require.ErrorIs(t, err, component.ErrModuleNotFound)
+}
+
 func TestComponents_Using_Services(t *testing.T) {
 	defer verifyNoGoroutineLeaks(t)
 	ctx, cancel := context.WithCancel(context.Background())
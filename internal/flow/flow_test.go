@@ -54,6 +54,20 @@ func TestController_LoadSource_Evaluation(t *testing.T) {
 	require.Equal(t, "hello, world!", out.(testcomponents.PassthroughExports).Output)
 }
 
+func TestController_Close(t *testing.T) {
+	defer verifyNoGoroutineLeaks(t)
+	ctrl := New(testOptions(t))
+
+	f, err := ParseSource(t.Name(), []byte(testFile))
+	require.NoError(t, err)
+	require.NoError(t, ctrl.LoadSource(f, nil))
+	require.NoError(t, ctrl.Close())
+
+	// The ticker was never run, so it never exported a tick time.
+	_, out := getFields(t, ctrl.loader.Graph(), "testcomponents.tick.ticker")
+	require.Zero(t, out.(testcomponents.TickExports).Time)
+}
+
 func getFields(t *testing.T, g *dag.Graph, nodeID string) (component.Arguments, component.Exports) {
 	t.Helper()
 
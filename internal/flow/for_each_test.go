@@ -0,0 +1,235 @@
+package flow_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/internal/flow"
+	"github.com/grafana/agent/internal/flow/internal/testcomponents"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForEach(t *testing.T) {
+	tt := []testCaseUpdateConfig{
+		{
+			name: "ListOfStrings",
+			config: `
+			testcomponents.count "inc" {
+				frequency = "10ms"
+				max = 10
+			}
+
+			testcomponents.passthrough "pt" {
+				for_each = ["a", "b"]
+				input = {"a" = 0, "b" = testcomponents.count.inc.count}[each.key]
+				lag = "1ms"
+			}
+
+			testcomponents.summation "sum" {
+				input = testcomponents.passthrough.pt["b"].output
+			}
+			`,
+			newConfig: `
+			testcomponents.passthrough "pt" {
+				for_each = ["a", "c"]
+				input = {"a" = 0, "c" = -10}[each.key]
+			}
+
+			testcomponents.summation "sum" {
+				input = testcomponents.passthrough.pt["c"].output
+			}
+			`,
+			expected:    10,
+			newExpected: -10,
+		},
+		{
+			name: "Object",
+			config: `
+			testcomponents.passthrough "pt" {
+				for_each = { "first" = 5, "second" = 7 }
+				input = each.value
+			}
+
+			testcomponents.summation "sum" {
+				input = testcomponents.passthrough.pt["second"].output
+			}
+			`,
+			newConfig: `
+			testcomponents.passthrough "pt" {
+				for_each = { "second" = 9 }
+				input = each.value
+			}
+
+			testcomponents.summation "sum" {
+				input = testcomponents.passthrough.pt["second"].output
+			}
+			`,
+			expected:    7,
+			newExpected: 9,
+		},
+		{
+			name: "SiblingWithInstanceLabel",
+			config: `
+			testcomponents.passthrough "pt" {
+				for_each = ["a"]
+				input = 3
+			}
+
+			testcomponents.passthrough "pt_a" {
+				input = 4
+			}
+
+			testcomponents.summation "sum" {
+				input = testcomponents.passthrough.pt["a"].output
+			}
+			`,
+			newConfig: `
+			testcomponents.passthrough "pt" {
+				for_each = ["a"]
+				input = 3
+			}
+
+			testcomponents.passthrough "pt_a" {
+				input = 4
+			}
+
+			testcomponents.summation "sum" {
+				input = testcomponents.passthrough.pt_a.output
+			}
+			`,
+			expected:    3,
+			newExpected: 4,
+		},
+		{
+			name: "CustomComponent",
+			config: `
+			declare "test" {
+				argument "input" {
+					optional = false
+				}
+
+				export "output" {
+					value = argument.input.value
+				}
+			}
+
+			test "mod" {
+				for_each = [3, 4]
+				input = each.value * 2
+			}
+
+			testcomponents.summation "sum" {
+				input = test.mod["1"].output
+			}
+			`,
+			newConfig: `
+			declare "test" {
+				argument "input" {
+					optional = false
+				}
+
+				export "output" {
+					value = argument.input.value
+				}
+			}
+
+			test "mod" {
+				for_each = [3, 4, 5]
+				input = each.value * 3
+			}
+
+			testcomponents.summation "sum" {
+				input = test.mod["2"].output
+			}
+			`,
+			expected:    8,
+			newExpected: 15,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := flow.New(testOptions(t))
+			f, err := flow.ParseSource(t.Name(), []byte(tc.config))
+			require.NoError(t, err)
+			require.NotNil(t, f)
+
+			err = ctrl.LoadSource(f, nil)
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				ctrl.Run(ctx)
+				close(done)
+			}()
+			defer func() {
+				cancel()
+				<-done
+			}()
+
+			require.Eventually(t, func() bool {
+				export := getExport[testcomponents.SummationExports](t, ctrl, "", "testcomponents.summation.sum")
+				return export.LastAdded == tc.expected
+			}, 3*time.Second, 10*time.Millisecond)
+
+			f, err = flow.ParseSource(t.Name(), []byte(tc.newConfig))
+			require.NoError(t, err)
+			require.NotNil(t, f)
+
+			// Reload the controller with the new config.
+			err = ctrl.LoadSource(f, nil)
+			require.NoError(t, err)
+
+			require.Eventually(t, func() bool {
+				export := getExport[testcomponents.SummationExports](t, ctrl, "", "testcomponents.summation.sum")
+				return export.LastAdded == tc.newExpected
+			}, 3*time.Second, 10*time.Millisecond)
+		})
+	}
+}
+
+func TestForEachError(t *testing.T) {
+	tt := []struct {
+		name        string
+		config      string
+		expectedErr string
+	}{
+		{
+			name: "InvalidCollection",
+			config: `
+			testcomponents.passthrough "pt" {
+				for_each = "a"
+				input = each.value
+			}
+			`,
+			expectedErr: `for_each must be an array or an object`,
+		},
+		{
+			name: "DuplicateElements",
+			config: `
+			testcomponents.passthrough "pt" {
+				for_each = ["a", "a"]
+				input = each.value
+			}
+			`,
+			expectedErr: `for_each contains duplicate element "a"`,
+		},
+		{
+			name: "UnknownComponent",
+			config: `
+			testcomponents.doesnotexist "pt" {
+				for_each = ["a"]
+			}
+			`,
+			expectedErr: `cannot find the definition of component name "testcomponents.doesnotexist"`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			testConfigError(t, tc.config, tc.expectedErr)
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package flow_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/internal/featuregate"
+	"github.com/grafana/agent/internal/flow"
+	"github.com/grafana/agent/internal/flow/logging"
+	"github.com/grafana/agent/internal/oci/ocitest"
+	"github.com/grafana/agent/internal/service"
+	"github.com/stretchr/testify/require"
+)
+
+const ociModuleAdd = `declare "add" {
+    argument "a" {}
+    argument "b" {}
+
+    export "sum" {
+        value = argument.a.value + argument.b.value
+    }
+}`
+
+const ociModuleAddMore = `declare "add" {
+    argument "a" {}
+    argument "b" {}
+
+    export "sum" {
+        value = argument.a.value + argument.b.value + 1
+    }
+}`
+
+func ociMain(registry, reference string) string {
+	return `
+import.oci "testImport" {
+	repository     = "` + registry + `/modules/math"
+	reference      = "` + reference + `"
+	plain_http     = true
+	pull_frequency = "100ms"
+}
+
+testImport.add "cc" {
+	a = 1
+	b = 1
+}
+`
+}
+
+func TestImportOCI(t *testing.T) {
+	defer verifyNoGoroutineLeaks(t)
+	reg := ocitest.NewRegistry(t)
+	defer reg.Close()
+	reg.Push("modules/math", "v1", map[string]string{"math.river": ociModuleAdd})
+
+	ctrl, f := setup(t, ociMain(reg.Host(), "v1"))
+	require.NoError(t, ctrl.LoadSource(f, nil))
+	stop := runController(ctrl)
+	defer stop()
+
+	require.Eventually(t, func() bool {
+		export := getExport[map[string]interface{}](t, ctrl, "", "testImport.add.cc")
+		return export["sum"] == 2
+	}, 5*time.Second, 100*time.Millisecond)
+
+	// Moving the tag to a new artifact must update the module.
+	reg.Push("modules/math", "v1", map[string]string{"math.river": ociModuleAddMore})
+
+	require.Eventually(t, func() bool {
+		export := getExport[map[string]interface{}](t, ctrl, "", "testImport.add.cc")
+		return export["sum"] == 3
+	}, 5*time.Second, 100*time.Millisecond)
+}
+
+func TestImportOCI_Digest(t *testing.T) {
+	defer verifyNoGoroutineLeaks(t)
+	reg := ocitest.NewRegistry(t)
+	defer reg.Close()
+	dgst := reg.Push("modules/math", "", map[string]string{"math.river": ociModuleAdd})
+
+	ctrl, f := setup(t, ociMain(reg.Host(), dgst))
+	require.NoError(t, ctrl.LoadSource(f, nil))
+	stop := runController(ctrl)
+	defer stop()
+
+	require.Eventually(t, func() bool {
+		export := getExport[map[string]interface{}](t, ctrl, "", "testImport.add.cc")
+		return export["sum"] == 2
+	}, 5*time.Second, 100*time.Millisecond)
+
+	// A module pulled by digest is immutable and must not be downloaded again.
+	requests := reg.Requests()
+	time.Sleep(500 * time.Millisecond)
+	require.Equal(t, requests, reg.Requests())
+}
+
+func TestImportOCI_OfflineCache(t *testing.T) {
+	reg := ocitest.NewRegistry(t)
+	reg.Push("modules/math", "v1", map[string]string{"math.river": ociModuleAdd})
+
+	dataPath := t.TempDir()
+	newController := func(registry string) *flow.Flow {
+		s, err := logging.New(os.Stderr, logging.DefaultOptions)
+		require.NoError(t, err)
+		ctrl := flow.New(flow.Options{
+			Logger:       s,
+			DataPath:     dataPath,
+			MinStability: featuregate.StabilityBeta,
+			Services:     []service.Service{},
+		})
+		f, err := flow.ParseSource(t.Name(), []byte(ociMain(registry, "v1")))
+		require.NoError(t, err)
+		require.NoError(t, ctrl.LoadSource(f, nil))
+		return ctrl
+	}
+
+	// Populate the cache by loading the module from the registry.
+	ctrl := newController(reg.Host())
+	stop := runController(ctrl)
+	require.Eventually(t, func() bool {
+		export := getExport[map[string]interface{}](t, ctrl, "", "testImport.add.cc")
+		return export["sum"] == 2
+	}, 5*time.Second, 100*time.Millisecond)
+	stop()
+
+	// A restarted controller must load the cached module while the registry is
+	// unreachable.
+	reg.Close()
+
+	defer verifyNoGoroutineLeaks(t)
+	ctrl = newController(reg.Host())
+	stop = runController(ctrl)
+	defer stop()
+
+	require.Eventually(t, func() bool {
+		export := getExport[map[string]interface{}](t, ctrl, "", "testImport.add.cc")
+		return export["sum"] == 2
+	}, 5*time.Second, 100*time.Millisecond)
+}
+
+func TestImportOCI_TamperedCache(t *testing.T) {
+	reg := ocitest.NewRegistry(t)
+	reg.Push("modules/math", "v1", map[string]string{"math.river": ociModuleAdd})
+
+	dataPath := t.TempDir()
+	newController := func(registry string) (*flow.Flow, error) {
+		s, err := logging.New(os.Stderr, logging.DefaultOptions)
+		require.NoError(t, err)
+		ctrl := flow.New(flow.Options{
+			Logger:       s,
+			DataPath:     dataPath,
+			MinStability: featuregate.StabilityBeta,
+			Services:     []service.Service{},
+		})
+		f, err := flow.ParseSource(t.Name(), []byte(ociMain(registry, "v1")))
+		require.NoError(t, err)
+		return ctrl, ctrl.LoadSource(f, nil)
+	}
+
+	// Populate the cache by loading the module from the registry.
+	ctrl, err := newController(reg.Host())
+	require.NoError(t, err)
+	stop := runController(ctrl)
+	require.Eventually(t, func() bool {
+		export := getExport[map[string]interface{}](t, ctrl, "", "testImport.add.cc")
+		return export["sum"] == 2
+	}, 5*time.Second, 100*time.Millisecond)
+	stop()
+	reg.Close()
+
+	// Replace the cached layers with different content.
+	var cachePath string
+	require.NoError(t, filepath.WalkDir(dataPath, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.Name() == "cache.json" {
+			cachePath = path
+		}
+		return err
+	}))
+	bb, err := os.ReadFile(cachePath)
+	require.NoError(t, err)
+	var cache map[string]any
+	require.NoError(t, json.Unmarshal(bb, &cache))
+	for dgst := range cache["blobs"].(map[string]any) {
+		cache["blobs"].(map[string]any)[dgst] = []byte(ociModuleAddMore)
+	}
+	bb, err = json.Marshal(cache)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(cachePath, bb, 0o640))
+
+	// The tampered cache must not be loaded while the registry is unreachable.
+	defer verifyNoGoroutineLeaks(t)
+	ctrl, err = newController(reg.Host())
+	require.Error(t, err)
+	runController(ctrl)()
+}
+
+func runController(ctrl *flow.Flow) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ctrl.Run(ctx)
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
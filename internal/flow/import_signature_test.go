@@ -0,0 +1,149 @@
+package flow_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/internal/oci/ocitest"
+	"github.com/grafana/agent/internal/signature/signaturetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportHTTP_Signature(t *testing.T) {
+	key := signaturetest.NewKey(t)
+
+	// Modules are verified exactly as served, including trailing newlines.
+	var (
+		mut       sync.Mutex
+		module    = ociModuleAdd + "\n"
+		moduleSig = key.Sign(ociModuleAdd + "\n")
+	)
+	setModule := func(content, sig string) {
+		mut.Lock()
+		defer mut.Unlock()
+		module, moduleSig = content, sig
+	}
+
+	defer verifyNoGoroutineLeaks(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mut.Lock()
+		defer mut.Unlock()
+		switch r.URL.Path {
+		case "/math.river":
+			_, _ = w.Write([]byte(module))
+		case "/math.river.sig":
+			_, _ = w.Write([]byte(moduleSig))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	main := `
+import.http "testImport" {
+	url            = "` + srv.URL + `/math.river"
+	poll_frequency = "100ms"
+
+	verify {
+		public_keys = [` + strconv.Quote(key.PublicKey()) + `]
+	}
+}
+
+testImport.add "cc" {
+	a = 1
+	b = 1
+}
+`
+	ctrl, f := setup(t, main)
+	require.NoError(t, ctrl.LoadSource(f, nil))
+	stop := runController(ctrl)
+	defer stop()
+
+	require.Eventually(t, func() bool {
+		export := getExport[map[string]interface{}](t, ctrl, "", "testImport.add.cc")
+		return export["sum"] == 2
+	}, 5*time.Second, 100*time.Millisecond)
+
+	// A module whose signature doesn't match must not be loaded.
+	setModule(ociModuleAddMore, moduleSig)
+	time.Sleep(500 * time.Millisecond)
+	export := getExport[map[string]interface{}](t, ctrl, "", "testImport.add.cc")
+	require.Equal(t, 2, export["sum"])
+
+	// A module must not be loaded if its signature only matches the module
+	// followed by a newline.
+	setModule(ociModuleAddMore, key.Sign(ociModuleAddMore+"\n"))
+	time.Sleep(500 * time.Millisecond)
+	export = getExport[map[string]interface{}](t, ctrl, "", "testImport.add.cc")
+	require.Equal(t, 2, export["sum"])
+
+	// The module is loaded once its signature is published.
+	setModule(ociModuleAddMore, key.Sign(ociModuleAddMore))
+	require.Eventually(t, func() bool {
+		export := getExport[map[string]interface{}](t, ctrl, "", "testImport.add.cc")
+		return export["sum"] == 3
+	}, 5*time.Second, 100*time.Millisecond)
+}
+
+func TestImportOCI_Signature(t *testing.T) {
+	key := signaturetest.NewKey(t)
+	otherKey := signaturetest.NewKey(t)
+
+	defer verifyNoGoroutineLeaks(t)
+	reg := ocitest.NewRegistry(t)
+	defer reg.Close()
+
+	main := func(reference string) string {
+		return `
+import.oci "testImport" {
+	repository = "` + reg.Host() + `/modules/math"
+	reference  = "` + reference + `"
+	plain_http = true
+
+	verify {
+		public_keys = [` + strconv.Quote(key.PublicKey()) + `]
+	}
+}
+
+testImport.add "cc" {
+	a = 1
+	b = 1
+}
+`
+	}
+
+	// A module signed by an unknown key must be rejected.
+	reg.Push("modules/math", "tampered", map[string]string{
+		"math.river":     ociModuleAdd,
+		"math.river.sig": otherKey.Sign(ociModuleAdd),
+	})
+	ctrl, f := setup(t, main("tampered"))
+	err := ctrl.LoadSource(f, nil)
+	require.ErrorContains(t, err, "signature does not match any of the configured public keys")
+	runController(ctrl)()
+
+	// A module without signatures must be rejected.
+	reg.Push("modules/math", "unsigned", map[string]string{"math.river": ociModuleAdd})
+	ctrl, f = setup(t, main("unsigned"))
+	err = ctrl.LoadSource(f, nil)
+	require.ErrorContains(t, err, "missing signature math.river.sig for math.river")
+	runController(ctrl)()
+
+	reg.Push("modules/math", "signed", map[string]string{
+		"math.river":     ociModuleAdd,
+		"math.river.sig": key.Sign(ociModuleAdd),
+	})
+	ctrl, f = setup(t, main("signed"))
+	require.NoError(t, ctrl.LoadSource(f, nil))
+	stop := runController(ctrl)
+	defer stop()
+
+	require.Eventually(t, func() bool {
+		export := getExport[map[string]interface{}](t, ctrl, "", "testImport.add.cc")
+		return export["sum"] == 2
+	}, 5*time.Second, 100*time.Millisecond)
+}
@@ -28,9 +28,28 @@ func NewComponentNodeManager(globals ComponentGlobals, componentReg ComponentReg
 }
 
 // CreateComponentNode creates a new builtin component or a new custom component.
+// Blocks which set the for_each meta-argument create a ForEachNode which
+// manages one builtin or custom component per element.
 func (m *ComponentNodeManager) createComponentNode(componentName string, block *ast.BlockStmt) (ComponentNode, error) {
+	if hasForEach(block) {
+		if block.Label == "" {
+			return nil, fmt.Errorf("component %q must have a label to use %s", componentName, forEachAttr)
+		}
+		if !isCustomComponent(m.customComponentReg, block.Name[0]) {
+			if _, err := m.builtinComponentReg.Get(componentName); err != nil {
+				return nil, err
+			}
+		}
+		return NewForEachNode(m.globals, block, m.newComponentNode), nil
+	}
+	return m.newComponentNode(m.globals, componentName, block)
+}
+
+// newComponentNode creates a new builtin component or a new custom component
+// using the provided globals.
+func (m *ComponentNodeManager) newComponentNode(globals ComponentGlobals, componentName string, block *ast.BlockStmt) (ComponentNode, error) {
 	if isCustomComponent(m.customComponentReg, block.Name[0]) {
-		return NewCustomComponentNode(m.globals, block, m.getCustomComponentConfig), nil
+		return NewCustomComponentNode(globals, block, m.getCustomComponentConfig), nil
 	}
 	registration, err := m.builtinComponentReg.Get(componentName)
 	if err != nil {
@@ -39,7 +58,7 @@ func (m *ComponentNodeManager) createComponentNode(componentName string, block *
 	if block.Label == "" {
 		return nil, fmt.Errorf("component %q must have a label", componentName)
 	}
-	return NewBuiltinComponentNode(m.globals, registration, block), nil
+	return NewBuiltinComponentNode(globals, registration, block), nil
 }
 
 // getCustomComponentConfig is used by the custom component to retrieve its template and the customComponentRegistry associated with it.
@@ -40,8 +40,15 @@ func ComponentReferences(cn dag.Node, g *dag.Graph) ([]Reference, diag.Diagnosti
 		}
 	}
 
+	_, isForEach := cn.(*ForEachNode)
+
 	refs := make([]Reference, 0, len(traversals))
 	for _, t := range traversals {
+		// The each variable is provided by the ForEachNode to its instances.
+		if isForEach && t[0].Name == forEachVar {
+			continue
+		}
+
 		ref, resolveDiags := resolveTraversal(t, g)
 		if resolveDiags.HasErrors() {
 			// We use an empty scope to determine if a reference refers to something in
@@ -556,6 +556,17 @@ func (l *Loader) populateComponentNodes(g *dag.Graph, componentBlocks []*ast.Blo
 		// Check the graph from the previous call to Load to see if we can copy an
 		// existing instance of ComponentNode.
 		if exist := l.graph.GetByID(id); exist != nil {
+			// The running node can't be swapped for a node of a different kind
+			// under the same ID.
+			if _, isForEach := exist.(*ForEachNode); isForEach != hasForEach(block) {
+				diags.Add(diag.Diagnostic{
+					Severity: diag.SeverityLevelError,
+					Message:  fmt.Sprintf("%s cannot be added to or removed from the existing component %q; use a new label instead", forEachAttr, id),
+					StartPos: ast.StartPos(block).Position(),
+					EndPos:   ast.EndPos(block).Position(),
+				})
+				continue
+			}
 			c := exist.(ComponentNode)
 			c.UpdateBlock(block)
 			g.Add(c)
@@ -612,7 +623,12 @@ func (l *Loader) wireGraphEdges(g *dag.Graph) diag.Diagnostics {
 			// skip here because for now Declare nodes can't reference component nodes.
 			continue
 		case *CustomComponentNode:
-			l.wireCustomComponentNode(g, n)
+			l.wireCustomComponentNode(g, n, n.importNamespace, n.customComponentName)
+		case *ForEachNode:
+			// Instances of custom components depend on the same import/declare
+			// nodes as a single custom component would.
+			importNamespace, customComponentName := ExtractImportAndDeclare(n.ComponentName())
+			l.wireCustomComponentNode(g, n, importNamespace, customComponentName)
 		}
 
 		// Finally, wire component references.
@@ -627,13 +643,13 @@ func (l *Loader) wireGraphEdges(g *dag.Graph) diag.Diagnostics {
 }
 
 // wireCustomComponentNode wires a custom component to the import/declare nodes that it depends on.
-func (l *Loader) wireCustomComponentNode(g *dag.Graph, cc *CustomComponentNode) {
+func (l *Loader) wireCustomComponentNode(g *dag.Graph, cc dag.Node, importNamespace, customComponentName string) {
 	// It's important to check first if the importNamespace matches an import node because there might be a
 	// local node that has the same label as an imported declare.
-	if importNode, ok := l.importConfigNodes[cc.importNamespace]; ok {
+	if importNode, ok := l.importConfigNodes[importNamespace]; ok {
 		// add an edge between the custom component and the corresponding import node.
 		g.AddEdge(dag.Edge{From: cc, To: importNode})
-	} else if declare, ok := l.declareNodes[cc.customComponentName]; ok {
+	} else if declare, ok := l.declareNodes[customComponentName]; ok {
 		refs := l.findCustomComponentReferences(declare.Block())
 		for ref := range refs {
 			// add edges between the custom component and declare/import nodes.
@@ -862,14 +878,23 @@ func (l *Loader) postEvaluate(logger log.Logger, bn BlockNode, err error) error
 	return nil
 }
 
-func multierrToDiags(errors error) diag.Diagnostics {
+func multierrToDiags(merr error) diag.Diagnostics {
 	var diags diag.Diagnostics
-	for _, err := range errors.(*multierror.Error).Errors {
-		// TODO(rfratto): should this include position information?
-		diags.Add(diag.Diagnostic{
+	for _, err := range merr.(*multierror.Error).Errors {
+		d := diag.Diagnostic{
 			Severity: diag.SeverityLevelError,
 			Message:  err.Error(),
-		})
+		}
+
+		// Point cycles at the first block which is part of the cycle.
+		var cycleErr dag.CycleError
+		if errors.As(err, &cycleErr) && len(cycleErr.Nodes) > 0 {
+			if bn, ok := cycleErr.Nodes[0].(BlockNode); ok && bn.Block() != nil {
+				d.StartPos = ast.StartPos(bn.Block()).Position()
+				d.EndPos = ast.EndPos(bn.Block()).Position()
+			}
+		}
+		diags.Add(d)
 	}
 	return diags
 }
@@ -121,6 +121,9 @@ func (cc *controllerCollector) Collect(ch chan<- prometheus.Metric) {
 		if builtinComponent, ok := component.(*BuiltinComponentNode); ok {
 			builtinComponent.registry.Collect(ch)
 		}
+		if forEachComponent, ok := component.(*ForEachNode); ok {
+			forEachComponent.collectMetrics(ch)
+		}
 	}
 
 	for _, im := range cc.l.Imports() {
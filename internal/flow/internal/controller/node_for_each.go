@@ -0,0 +1,539 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/internal/component"
+	"github.com/grafana/agent/internal/flow/logging/level"
+	"github.com/grafana/river/ast"
+	"github.com/grafana/river/vm"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// forEachAttr is the name of the controller-owned attribute which fans out
+	// a component block into multiple instances.
+	forEachAttr = "for_each"
+
+	// forEachVar is the name of the variable exposed to the body of a block
+	// using for_each.
+	forEachVar = "each"
+
+	// forEachLabelSeparator separates the label of a block from the key of an
+	// instance in instance labels.
+	forEachLabelSeparator = '-'
+)
+
+// newInstanceFunc creates a new ComponentNode for a single for_each instance.
+type newInstanceFunc func(globals ComponentGlobals, componentName string, block *ast.BlockStmt) (ComponentNode, error)
+
+// ForEachNode is a controller node which manages a component block using the
+// for_each meta-argument.
+//
+// ForEachNode evaluates the for_each expression and manages one ComponentNode
+// per element of the resulting list or object. Each instance is evaluated with
+// an additional "each" variable in scope, holding the key and the value of its
+// element. Instances are added and removed as the collection changes.
+//
+// The exports of a ForEachNode are an object mapping each instance key to the
+// exports of the instance.
+type ForEachNode struct {
+	id                ComponentID
+	globalID          string
+	label             string
+	componentName     string
+	nodeID            string // Cached from id.String() to avoid allocating new strings every time NodeID is called.
+	globals           ComponentGlobals
+	newInstance       newInstanceFunc
+	OnBlockNodeUpdate func(cn BlockNode) // Informs controller that we need to reevaluate
+	logger            log.Logger
+
+	mut           sync.RWMutex
+	block         *ast.BlockStmt // Current River block to derive instances from
+	forEachEval   *vm.Evaluator  // Evaluator for the for_each expression
+	instanceBlock *ast.BlockStmt // Current River block without the for_each attribute
+	keys          []string       // Instance keys in for_each order
+	instances     map[string]*forEachInstance
+	runIndex      int // Incremented for every new instance
+
+	updated chan struct{} // Signals Run that the set of instances changed
+
+	healthMut  sync.RWMutex
+	evalHealth component.Health // Health of the last evaluate
+	runHealth  component.Health // Health of running the instances
+}
+
+var _ ComponentNode = (*ForEachNode)(nil)
+
+// forEachInstance is a single component instance managed by a ForEachNode.
+type forEachInstance struct {
+	ComponentNode
+
+	// runID uniquely identifies the instance for the lifetime of the
+	// ForEachNode, so that an instance which is removed and then re-added
+	// is always restarted by the scheduler.
+	runID string
+}
+
+// NodeID implements dag.Node and returns the scheduling ID of the instance.
+func (fi *forEachInstance) NodeID() string { return fi.runID }
+
+// forEachItem is a single element of an evaluated for_each collection.
+type forEachItem struct {
+	key   string
+	value any
+}
+
+// hasForEach returns true if the block sets the for_each meta-argument.
+func hasForEach(b *ast.BlockStmt) bool {
+	return findForEach(b) != nil
+}
+
+// findForEach returns the for_each attribute of the block, if any.
+func findForEach(b *ast.BlockStmt) *ast.AttributeStmt {
+	for _, stmt := range b.Body {
+		if attr, ok := stmt.(*ast.AttributeStmt); ok && attr.Name.Name == forEachAttr {
+			return attr
+		}
+	}
+	return nil
+}
+
+// NewForEachNode creates a new ForEachNode from an initial ast.BlockStmt. The
+// instances aren't created until Evaluate is called.
+func NewForEachNode(globals ComponentGlobals, b *ast.BlockStmt, newInstance newInstanceFunc) *ForEachNode {
+	var (
+		id     = BlockComponentID(b)
+		nodeID = id.String()
+	)
+
+	initHealth := component.Health{
+		Health:     component.HealthTypeUnknown,
+		Message:    "for_each component created",
+		UpdateTime: time.Now(),
+	}
+
+	globalID := nodeID
+	if globals.ControllerID != "" {
+		globalID = path.Join(globals.ControllerID, nodeID)
+	}
+	parent, node := splitPath(globalID)
+
+	fn := &ForEachNode{
+		id:                id,
+		globalID:          globalID,
+		label:             b.Label,
+		componentName:     b.GetBlockName(),
+		nodeID:            nodeID,
+		globals:           globals,
+		newInstance:       newInstance,
+		OnBlockNodeUpdate: globals.OnBlockNodeUpdate,
+		logger:            log.With(globals.Logger, "component_path", parent, "component_id", node),
+
+		instances: make(map[string]*forEachInstance),
+		updated:   make(chan struct{}, 1),
+
+		evalHealth: initHealth,
+		runHealth:  initHealth,
+	}
+	fn.setBlock(b)
+
+	return fn
+}
+
+// setBlock updates the block and the derived evaluators. mut must be held
+// when calling setBlock.
+func (fn *ForEachNode) setBlock(b *ast.BlockStmt) {
+	instanceBlock := *b
+	instanceBlock.Body = make(ast.Body, 0, len(b.Body))
+
+	var forEachExpr ast.Expr
+	for _, stmt := range b.Body {
+		if attr, ok := stmt.(*ast.AttributeStmt); ok && attr.Name.Name == forEachAttr {
+			forEachExpr = attr.Value
+			continue
+		}
+		instanceBlock.Body = append(instanceBlock.Body, stmt)
+	}
+
+	fn.block = b
+	fn.instanceBlock = &instanceBlock
+	fn.forEachEval = nil
+	if forEachExpr != nil {
+		fn.forEachEval = vm.New(forEachExpr)
+	}
+}
+
+// ID returns the component ID of the node from its River block.
+func (fn *ForEachNode) ID() ComponentID { return fn.id }
+
+// Label returns the label for the block.
+func (fn *ForEachNode) Label() string { return fn.label }
+
+// ComponentName returns the name of the component being instantiated.
+func (fn *ForEachNode) ComponentName() string { return fn.componentName }
+
+// NodeID implements dag.Node and returns the unique ID for this node.
+func (fn *ForEachNode) NodeID() string { return fn.nodeID }
+
+// UpdateBlock updates the River block used to construct instances. The new
+// block isn't used until the next time Evaluate is invoked.
+//
+// UpdateBlock will panic if the block does not match the component ID of the
+// ForEachNode.
+func (fn *ForEachNode) UpdateBlock(b *ast.BlockStmt) {
+	if !BlockComponentID(b).Equals(fn.id) {
+		panic("UpdateBlock called with an River block with a different component ID")
+	}
+
+	fn.mut.Lock()
+	defer fn.mut.Unlock()
+	fn.setBlock(b)
+}
+
+// Block implements BlockNode and returns the current block of the node.
+func (fn *ForEachNode) Block() *ast.BlockStmt {
+	fn.mut.RLock()
+	defer fn.mut.RUnlock()
+	return fn.block
+}
+
+// Evaluate implements BlockNode and evaluates the for_each expression with
+// the provided scope. New instances are created for new elements, instances
+// for removed elements are dropped, and every remaining instance is
+// re-evaluated with "each" in scope.
+//
+// Evaluate will return an error if the for_each expression cannot be
+// evaluated or if any of the instances fails to evaluate.
+func (fn *ForEachNode) Evaluate(scope *vm.Scope) error {
+	err := fn.evaluate(scope)
+
+	switch err {
+	case nil:
+		fn.setEvalHealth(component.HealthTypeHealthy, "component evaluated")
+	default:
+		msg := fmt.Sprintf("component evaluation failed: %s", err)
+		fn.setEvalHealth(component.HealthTypeUnhealthy, msg)
+	}
+	return err
+}
+
+func (fn *ForEachNode) evaluate(scope *vm.Scope) error {
+	fn.mut.Lock()
+	defer fn.mut.Unlock()
+
+	if fn.forEachEval == nil {
+		return fmt.Errorf("missing %s attribute", forEachAttr)
+	}
+
+	var collection any
+	if err := fn.forEachEval.Evaluate(scope, &collection); err != nil {
+		return fmt.Errorf("evaluating %s: %w", forEachAttr, err)
+	}
+	items, err := forEachItems(collection)
+	if err != nil {
+		return err
+	}
+
+	var (
+		errs      []error
+		keys      = make([]string, 0, len(items))
+		instances = make(map[string]*forEachInstance, len(items))
+		labels    = make(map[string]string, len(items))
+	)
+
+	for _, item := range items {
+		block := *fn.instanceBlock
+		block.Label = forEachInstanceLabel(fn.label, item.key)
+
+		if other, exist := labels[block.Label]; exist {
+			return fmt.Errorf("%s keys %q and %q map to the same instance label %q", forEachAttr, other, item.key, block.Label)
+		}
+		labels[block.Label] = item.key
+
+		inst, exist := fn.instances[item.key]
+		if exist {
+			inst.UpdateBlock(&block)
+		} else {
+			node, err := fn.newInstance(fn.instanceGlobals(), fn.componentName, &block)
+			if err != nil {
+				return fmt.Errorf("creating instance %q: %w", item.key, err)
+			}
+			fn.runIndex++
+			inst = &forEachInstance{
+				ComponentNode: node,
+				runID:         fmt.Sprintf("%s#%d", node.NodeID(), fn.runIndex),
+			}
+		}
+
+		instanceScope := &vm.Scope{
+			Parent: scope,
+			Variables: map[string]any{
+				forEachVar: map[string]any{
+					"key":   item.key,
+					"value": item.value,
+				},
+			},
+		}
+		if err := inst.Evaluate(instanceScope); err != nil {
+			errs = append(errs, fmt.Errorf("instance %q: %w", item.key, err))
+		}
+
+		keys = append(keys, item.key)
+		instances[item.key] = inst
+	}
+
+	fn.keys = keys
+	fn.instances = instances
+
+	// Inform Run that the set of instances may have changed.
+	select {
+	case fn.updated <- struct{}{}:
+	default:
+	}
+
+	return errors.Join(errs...)
+}
+
+// instanceGlobals returns the ComponentGlobals to use for new instances.
+// Updates from instances are reported as updates of the ForEachNode.
+func (fn *ForEachNode) instanceGlobals() ComponentGlobals {
+	globals := fn.globals
+	globals.OnBlockNodeUpdate = func(_ BlockNode) { fn.OnBlockNodeUpdate(fn) }
+	return globals
+}
+
+// forEachItems converts an evaluated for_each collection into a list of
+// items. Objects are keyed by their keys. Lists of strings are keyed by
+// their elements, and any other list is keyed by element index.
+func forEachItems(collection any) ([]forEachItem, error) {
+	switch c := collection.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(c))
+		for k := range c {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		items := make([]forEachItem, 0, len(c))
+		for _, k := range keys {
+			items = append(items, forEachItem{key: k, value: c[k]})
+		}
+		return items, nil
+
+	case []any:
+		items := make([]forEachItem, 0, len(c))
+		if allStrings(c) {
+			seen := make(map[string]struct{}, len(c))
+			for _, v := range c {
+				s := v.(string)
+				if _, dup := seen[s]; dup {
+					return nil, fmt.Errorf("%s contains duplicate element %q", forEachAttr, s)
+				}
+				seen[s] = struct{}{}
+				items = append(items, forEachItem{key: s, value: s})
+			}
+			return items, nil
+		}
+		for i, v := range c {
+			items = append(items, forEachItem{key: strconv.Itoa(i), value: v})
+		}
+		return items, nil
+
+	case nil:
+		return nil, nil
+
+	default:
+		return nil, fmt.Errorf("%s must be an array or an object, got %T", forEachAttr, collection)
+	}
+}
+
+func allStrings(vv []any) bool {
+	for _, v := range vv {
+		if _, ok := v.(string); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// forEachInstanceLabel returns the label of the instance for key. Characters
+// which are not valid in identifiers are replaced with underscores so that
+// the instance IDs are safe to use in paths and metric labels.
+//
+// The label and the key are joined with forEachLabelSeparator, which can't
+// appear in the label of a block, so that instance IDs never collide with
+// the IDs of other components.
+func forEachInstanceLabel(label, key string) string {
+	var sb strings.Builder
+	sb.WriteString(label)
+	sb.WriteByte(forEachLabelSeparator)
+	for _, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			sb.WriteRune(r)
+		default:
+			sb.WriteByte('_')
+		}
+	}
+	return sb.String()
+}
+
+// Run runs the instances of the ForEachNode until ctx is canceled. Instances
+// are started and stopped as the collection changes.
+func (fn *ForEachNode) Run(ctx context.Context) error {
+	sched := NewScheduler()
+	defer func() { _ = sched.Close() }()
+
+	fn.setRunHealth(component.HealthTypeHealthy, "started for_each instances")
+	for {
+		if err := sched.Synchronize(fn.runnables()); err != nil {
+			level.Error(fn.logger).Log("msg", "failed to synchronize for_each instances", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			level.Info(fn.logger).Log("msg", "for_each instances exited")
+			fn.setRunHealth(component.HealthTypeExited, "for_each instances shut down")
+			return nil
+		case <-fn.updated:
+		}
+	}
+}
+
+func (fn *ForEachNode) runnables() []RunnableNode {
+	fn.mut.RLock()
+	defer fn.mut.RUnlock()
+
+	rr := make([]RunnableNode, 0, len(fn.instances))
+	for _, inst := range fn.instances {
+		rr = append(rr, inst)
+	}
+	return rr
+}
+
+// Arguments returns the current arguments of each instance, keyed by
+// instance key.
+func (fn *ForEachNode) Arguments() component.Arguments {
+	fn.mut.RLock()
+	defer fn.mut.RUnlock()
+
+	args := make(map[string]any, len(fn.instances))
+	for key, inst := range fn.instances {
+		args[key] = inst.Arguments()
+	}
+	return args
+}
+
+// Exports returns the current exports of each instance, keyed by instance
+// key.
+func (fn *ForEachNode) Exports() component.Exports {
+	fn.mut.RLock()
+	defer fn.mut.RUnlock()
+
+	exports := make(map[string]any, len(fn.instances))
+	for key, inst := range fn.instances {
+		exports[key] = inst.Exports()
+	}
+	return exports
+}
+
+// DebugInfo returns debugging information from each builtin instance which
+// provides it, keyed by instance key.
+func (fn *ForEachNode) DebugInfo() interface{} {
+	fn.mut.RLock()
+	defer fn.mut.RUnlock()
+
+	info := make(map[string]any)
+	for key, inst := range fn.instances {
+		if bc, ok := inst.ComponentNode.(*BuiltinComponentNode); ok {
+			if di := bc.DebugInfo(); di != nil {
+				info[key] = di
+			}
+		}
+	}
+	if len(info) == 0 {
+		return nil
+	}
+	return info
+}
+
+// collectMetrics collects the metrics of all builtin instances.
+func (fn *ForEachNode) collectMetrics(ch chan<- prometheus.Metric) {
+	fn.mut.RLock()
+	defer fn.mut.RUnlock()
+
+	for _, inst := range fn.instances {
+		if bc, ok := inst.ComponentNode.(*BuiltinComponentNode); ok {
+			bc.registry.Collect(ch)
+		}
+	}
+}
+
+// CurrentHealth returns the current health of the ForEachNode.
+//
+// The health of a ForEachNode is determined by combining:
+//
+//  1. Health from the call to Run().
+//  2. Health from the last call to Evaluate().
+//  3. Health of every instance.
+func (fn *ForEachNode) CurrentHealth() component.Health {
+	fn.mut.RLock()
+	healths := make([]component.Health, 0, len(fn.instances)+2)
+	for _, key := range fn.keys {
+		healths = append(healths, fn.instances[key].CurrentHealth())
+	}
+	fn.mut.RUnlock()
+
+	fn.healthMut.RLock()
+	defer fn.healthMut.RUnlock()
+	healths = append(healths, fn.runHealth, fn.evalHealth)
+	return component.LeastHealthy(healths[0], healths[1:]...)
+}
+
+// setEvalHealth sets the internal health from a call to Evaluate. See Health
+// for information on how overall health is calculated.
+func (fn *ForEachNode) setEvalHealth(t component.HealthType, msg string) {
+	fn.healthMut.Lock()
+	defer fn.healthMut.Unlock()
+
+	fn.evalHealth = component.Health{
+		Health:     t,
+		Message:    msg,
+		UpdateTime: time.Now(),
+	}
+}
+
+// setRunHealth sets the internal health from a call to Run. See Health for
+// information on how overall health is calculated.
+func (fn *ForEachNode) setRunHealth(t component.HealthType, msg string) {
+	fn.healthMut.Lock()
+	defer fn.healthMut.Unlock()
+
+	fn.runHealth = component.Health{
+		Health:     t,
+		Message:    msg,
+		UpdateTime: time.Now(),
+	}
+}
+
+// ModuleIDs returns the modules managed by all instances.
+func (fn *ForEachNode) ModuleIDs() []string {
+	fn.mut.RLock()
+	defer fn.mut.RUnlock()
+
+	var ids []string
+	for _, key := range fn.keys {
+		ids = append(ids, fn.instances[key].ModuleIDs()...)
+	}
+	return ids
+}
@@ -31,25 +31,41 @@ func Reduce(g *Graph) {
 	}
 }
 
-// Validate checks that the graph doesn't contain cycles
+// CycleError is returned by Validate for every cycle in a graph. A node which
+// references itself is a cycle of one node.
+type CycleError struct {
+	Nodes []Node
+}
+
+// Error implements error.
+func (err CycleError) Error() string {
+	if len(err.Nodes) == 1 {
+		return fmt.Sprintf("self reference: %s", err.Nodes[0].NodeID())
+	}
+
+	cycleStr := make([]string, len(err.Nodes))
+	for i, node := range err.Nodes {
+		cycleStr[i] = node.NodeID()
+	}
+	return fmt.Sprintf("cycle: %s", strings.Join(cycleStr, ", "))
+}
+
+// Validate checks that the graph doesn't contain cycles. The returned error
+// holds a CycleError for every cycle found.
 func Validate(g *Graph) error {
 	var err error
 
 	// Check cycles using strongly connected components algorithm
 	for _, cycle := range StronglyConnectedComponents(g) {
 		if len(cycle) > 1 {
-			cycleStr := make([]string, len(cycle))
-			for i, node := range cycle {
-				cycleStr[i] = node.NodeID()
-			}
-			err = multierror.Append(err, fmt.Errorf("cycle: %s", strings.Join(cycleStr, ", ")))
+			err = multierror.Append(err, CycleError{Nodes: cycle})
 		}
 	}
 
 	// Check self references
 	for _, e := range g.Edges() {
 		if e.From == e.To {
-			err = multierror.Append(err, fmt.Errorf("self reference: %s", e.From.NodeID()))
+			err = multierror.Append(err, CycleError{Nodes: []Node{e.From}})
 		}
 	}
 
@@ -14,6 +14,7 @@ import (
 
 	"github.com/grafana/agent/internal/component"
 	"github.com/grafana/agent/internal/flow/logging/level"
+	"github.com/grafana/agent/internal/signature"
 	"github.com/grafana/agent/internal/vcs"
 	"github.com/grafana/river/vm"
 )
@@ -28,6 +29,7 @@ type ImportGit struct {
 	repo            *vcs.GitRepo
 	repoOpts        vcs.GitRepoOptions
 	args            GitArguments
+	verifier        *signature.Verifier
 	onContentChange func(map[string]string)
 
 	argsChanged chan struct{}
@@ -43,11 +45,12 @@ var (
 )
 
 type GitArguments struct {
-	Repository    string            `river:"repository,attr"`
-	Revision      string            `river:"revision,attr,optional"`
-	Path          string            `river:"path,attr"`
-	PullFrequency time.Duration     `river:"pull_frequency,attr,optional"`
-	GitAuthConfig vcs.GitAuthConfig `river:",squash"`
+	Repository    string               `river:"repository,attr"`
+	Revision      string               `river:"revision,attr,optional"`
+	Path          string               `river:"path,attr"`
+	PullFrequency time.Duration        `river:"pull_frequency,attr,optional"`
+	GitAuthConfig vcs.GitAuthConfig    `river:",squash"`
+	Verify        *signature.Arguments `river:"verify,block,optional"`
 }
 
 var DefaultGitArguments = GitArguments{
@@ -178,6 +181,12 @@ func (im *ImportGit) Update(args component.Arguments) (err error) {
 
 	newArgs := args.(GitArguments)
 
+	verifier, err := signature.FromArguments(newArgs.Verify)
+	if err != nil {
+		return err
+	}
+	im.verifier = verifier
+
 	// TODO(rfratto): store in a repo-specific directory so changing repositories
 	// doesn't risk break the module loader if there's a SHA collision between
 	// the two different repositories.
@@ -252,16 +261,36 @@ func (im *ImportGit) handleDirectory(path string) error {
 		return err
 	}
 
-	content := make(map[string]string)
+	var (
+		content    = make(map[string]string)
+		signatures = make(map[string]string)
+	)
 	for _, fi := range filesInfo {
-		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".river") {
+		if fi.IsDir() {
 			continue
 		}
+
+		var target map[string]string
+		switch {
+		case strings.HasSuffix(fi.Name(), ".river"):
+			target = content
+		case strings.HasSuffix(fi.Name(), ".river"+signature.Suffix) && im.verifier != nil:
+			target = signatures
+		default:
+			continue
+		}
+
 		bb, err := im.repo.ReadFile(filepath.Join(path, fi.Name()))
 		if err != nil {
 			return err
 		}
-		content[fi.Name()] = string(bb)
+		target[fi.Name()] = string(bb)
+	}
+
+	if im.verifier != nil {
+		if err := im.verifier.VerifyFiles(content, signatures); err != nil {
+			return err
+		}
 	}
 	im.onContentChange(content)
 	return nil
@@ -272,6 +301,16 @@ func (im *ImportGit) handleFile(path string) error {
 	if err != nil {
 		return err
 	}
+
+	if im.verifier != nil {
+		sig, err := im.repo.ReadFile(path + signature.Suffix)
+		if err != nil {
+			return fmt.Errorf("reading signature: %w", err)
+		}
+		if err := im.verifier.Verify(bb, sig); err != nil {
+			return fmt.Errorf("verifying %s: %w", path, err)
+		}
+	}
 	im.onContentChange(map[string]string{path: string(bb)})
 	return nil
 }
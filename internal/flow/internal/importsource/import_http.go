@@ -3,14 +3,21 @@ package importsource
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"reflect"
+	"sync"
 	"time"
 
+	"github.com/go-kit/log"
 	"github.com/grafana/agent/internal/component"
 	common_config "github.com/grafana/agent/internal/component/common/config"
 	remote_http "github.com/grafana/agent/internal/component/remote/http"
+	"github.com/grafana/agent/internal/flow/logging/level"
+	"github.com/grafana/agent/internal/signature"
 	"github.com/grafana/river/vm"
+	prom_config "github.com/prometheus/common/config"
 )
 
 // ImportHTTP imports a module from a HTTP server via the remote.http component.
@@ -19,19 +26,35 @@ type ImportHTTP struct {
 	arguments         component.Arguments
 	managedOpts       component.Options
 	eval              *vm.Evaluator
+	log               log.Logger
+	onContentChange   func(map[string]string)
+
+	// Signature verification state.
+	verifyMut sync.Mutex
+	verifier  *signature.Verifier
+	sigClient *http.Client
+	sigArgs   HTTPArguments
+	pending   *string // Content which failed verification, retried on every poll.
+
+	healthMut    sync.RWMutex
+	verifyHealth *component.Health // Set when the last content failed verification.
 }
 
 var _ ImportSource = (*ImportHTTP)(nil)
 
 func NewImportHTTP(managedOpts component.Options, eval *vm.Evaluator, onContentChange func(map[string]string)) *ImportHTTP {
+	im := &ImportHTTP{
+		eval:            eval,
+		log:             managedOpts.Logger,
+		onContentChange: onContentChange,
+	}
+
 	opts := managedOpts
 	opts.OnStateChange = func(e component.Exports) {
-		onContentChange(map[string]string{opts.ID: e.(remote_http.Exports).Content.Value})
-	}
-	return &ImportHTTP{
-		managedOpts: opts,
-		eval:        eval,
+		im.handleContent(e.(remote_http.Exports).Content.Value)
 	}
+	im.managedOpts = opts
+	return im
 }
 
 // HTTPArguments holds values which are used to configure the remote.http component.
@@ -45,6 +68,7 @@ type HTTPArguments struct {
 	Body    string            `river:"body,attr,optional"`
 
 	Client common_config.HTTPClientConfig `river:"client,block,optional"`
+	Verify *signature.Arguments           `river:"verify,block,optional"`
 }
 
 // DefaultHTTPArguments holds default settings for HTTPArguments.
@@ -60,45 +84,209 @@ func (args *HTTPArguments) SetToDefault() {
 	*args = DefaultHTTPArguments
 }
 
+func (args HTTPArguments) remoteHTTPArguments() remote_http.Arguments {
+	return remote_http.Arguments{
+		URL:           args.URL,
+		PollFrequency: args.PollFrequency,
+		PollTimeout:   args.PollTimeout,
+		Method:        args.Method,
+		Headers:       args.Headers,
+		Body:          args.Body,
+		Client:        args.Client,
+
+		// Keep the module as served, so that its signature can be verified.
+		KeepWhitespace: true,
+	}
+}
+
 func (im *ImportHTTP) Evaluate(scope *vm.Scope) error {
 	var arguments HTTPArguments
 	if err := im.eval.Evaluate(scope, &arguments); err != nil {
 		return fmt.Errorf("decoding River: %w", err)
 	}
+
+	if im.managedRemoteHTTP != nil && reflect.DeepEqual(im.arguments, arguments) {
+		return nil
+	}
+
+	// The verifier must be updated before the managed component, which polls
+	// the endpoint when it's created or updated.
+	if err := im.updateVerifier(arguments); err != nil {
+		return err
+	}
+
 	if im.managedRemoteHTTP == nil {
 		var err error
-		im.managedRemoteHTTP, err = remote_http.New(im.managedOpts, remote_http.Arguments{
-			URL:           arguments.URL,
-			PollFrequency: arguments.PollFrequency,
-			PollTimeout:   arguments.PollTimeout,
-			Method:        arguments.Method,
-			Headers:       arguments.Headers,
-			Body:          arguments.Body,
-			Client:        arguments.Client,
-		})
+		im.managedRemoteHTTP, err = remote_http.New(im.managedOpts, arguments.remoteHTTPArguments())
 		if err != nil {
 			return fmt.Errorf("creating http component: %w", err)
 		}
 		im.arguments = arguments
-	}
-
-	if reflect.DeepEqual(im.arguments, arguments) {
 		return nil
 	}
 
 	// Update the existing managed component
-	if err := im.managedRemoteHTTP.Update(arguments); err != nil {
+	if err := im.managedRemoteHTTP.Update(arguments.remoteHTTPArguments()); err != nil {
 		return fmt.Errorf("updating component: %w", err)
 	}
 	im.arguments = arguments
 	return nil
 }
 
+func (im *ImportHTTP) updateVerifier(args HTTPArguments) error {
+	verifier, err := signature.FromArguments(args.Verify)
+	if err != nil {
+		return err
+	}
+
+	var sigClient *http.Client
+	if verifier != nil {
+		sigClient, err = prom_config.NewClientFromConfig(*args.Client.Convert(), im.managedOpts.ID)
+		if err != nil {
+			return fmt.Errorf("creating signature client: %w", err)
+		}
+	}
+
+	im.verifyMut.Lock()
+	defer im.verifyMut.Unlock()
+	im.verifier = verifier
+	im.sigClient = sigClient
+	im.sigArgs = args
+	if verifier == nil {
+		im.pending = nil
+		im.setVerifyHealth(nil)
+	}
+	return nil
+}
+
 func (im *ImportHTTP) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		im.retryVerification(ctx)
+	}()
+
 	return im.managedRemoteHTTP.Run(ctx)
 }
 
+// retryVerification periodically verifies content which previously failed
+// verification, since the managed component only reports content changes and
+// the signature may be published after the content.
+func (im *ImportHTTP) retryVerification(ctx context.Context) {
+	for {
+		im.verifyMut.Lock()
+		frequency := im.sigArgs.PollFrequency
+		im.verifyMut.Unlock()
+		if frequency <= 0 {
+			frequency = DefaultHTTPArguments.PollFrequency
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(frequency):
+		}
+
+		im.verifyMut.Lock()
+		pending := im.pending
+		im.verifyMut.Unlock()
+		if pending != nil {
+			im.handleContent(*pending)
+		}
+	}
+}
+
+// handleContent verifies the signature of content if verification is enabled,
+// and passes it to the controller if it's valid.
+func (im *ImportHTTP) handleContent(content string) {
+	im.verifyMut.Lock()
+	verifier, sigClient, args := im.verifier, im.sigClient, im.sigArgs
+	im.verifyMut.Unlock()
+
+	if verifier != nil {
+		if err := im.verify(verifier, sigClient, args, content); err != nil {
+			level.Error(im.log).Log("msg", "refusing to load module which failed signature verification", "err", err)
+
+			im.verifyMut.Lock()
+			im.pending = &content
+			im.verifyMut.Unlock()
+			im.setVerifyHealth(err)
+			return
+		}
+	}
+
+	im.verifyMut.Lock()
+	im.pending = nil
+	im.verifyMut.Unlock()
+	im.setVerifyHealth(nil)
+
+	im.onContentChange(map[string]string{im.managedOpts.ID: content})
+}
+
+// verify downloads the signature stored next to the module and verifies
+// content against it.
+func (im *ImportHTTP) verify(verifier *signature.Verifier, client *http.Client, args HTTPArguments, content string) error {
+	u, err := url.Parse(args.URL)
+	if err != nil {
+		return err
+	}
+	u.Path += signature.Suffix
+
+	ctx, cancel := context.WithTimeout(context.Background(), args.PollTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	for name, value := range args.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetching signature: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching signature: unexpected status code %s", resp.Status)
+	}
+	sig, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return fmt.Errorf("reading signature: %w", err)
+	}
+
+	return verifier.Verify([]byte(content), sig)
+}
+
+func (im *ImportHTTP) setVerifyHealth(err error) {
+	im.healthMut.Lock()
+	defer im.healthMut.Unlock()
+
+	if err == nil {
+		im.verifyHealth = nil
+		return
+	}
+	im.verifyHealth = &component.Health{
+		Health:     component.HealthTypeUnhealthy,
+		Message:    fmt.Sprintf("signature verification failed: %s", err),
+		UpdateTime: time.Now(),
+	}
+}
+
 func (im *ImportHTTP) CurrentHealth() component.Health {
+	im.healthMut.RLock()
+	verifyHealth := im.verifyHealth
+	im.healthMut.RUnlock()
+
+	if verifyHealth != nil {
+		return *verifyHealth
+	}
 	return im.managedRemoteHTTP.CurrentHealth()
 }
 
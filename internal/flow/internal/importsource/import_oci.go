@@ -0,0 +1,402 @@
+package importsource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+
+	"github.com/grafana/agent/internal/component"
+	"github.com/grafana/agent/internal/flow/logging/level"
+	"github.com/grafana/agent/internal/oci"
+	"github.com/grafana/agent/internal/signature"
+	"github.com/grafana/river/vm"
+)
+
+// ImportOCI imports a module bundle from an OCI registry. Pulled modules are
+// cached on disk so that they can be loaded while the registry is
+// unreachable.
+type ImportOCI struct {
+	opts            component.Options
+	log             log.Logger
+	eval            *vm.Evaluator
+	mut             sync.RWMutex
+	args            OCIArguments
+	client          *oci.Client
+	httpClient      *http.Client
+	ref             oci.Reference
+	digest          string // Digest of the currently loaded module.
+	verifier        *signature.Verifier
+	onContentChange func(map[string]string)
+
+	argsChanged chan struct{}
+
+	healthMut sync.RWMutex
+	health    component.Health
+}
+
+var (
+	_ ImportSource              = (*ImportOCI)(nil)
+	_ component.Component       = (*ImportOCI)(nil)
+	_ component.HealthComponent = (*ImportOCI)(nil)
+)
+
+// OCIArguments holds values which are used to configure the import.oci block.
+type OCIArguments struct {
+	Repository    string               `river:"repository,attr"`
+	Reference     string               `river:"reference,attr,optional"`
+	PullFrequency time.Duration        `river:"pull_frequency,attr,optional"`
+	PullTimeout   time.Duration        `river:"pull_timeout,attr,optional"`
+	PlainHTTP     bool                 `river:"plain_http,attr,optional"`
+	BasicAuth     *oci.BasicAuth       `river:"basic_auth,block,optional"`
+	Verify        *signature.Arguments `river:"verify,block,optional"`
+}
+
+// DefaultOCIArguments holds the default arguments for import.oci.
+var DefaultOCIArguments = OCIArguments{
+	Reference:     "latest",
+	PullFrequency: time.Minute,
+	PullTimeout:   30 * time.Second,
+}
+
+// SetToDefault implements river.Defaulter.
+func (args *OCIArguments) SetToDefault() {
+	*args = DefaultOCIArguments
+}
+
+// Validate implements river.Validator.
+func (args *OCIArguments) Validate() error {
+	if args.PullFrequency < 0 {
+		return fmt.Errorf("pull_frequency must not be negative")
+	}
+	if args.PullTimeout <= 0 {
+		return fmt.Errorf("pull_timeout must be greater than 0")
+	}
+	_, err := oci.ParseReference(args.Repository, args.Reference)
+	return err
+}
+
+// ociCache is the content of the on-disk cache of the last pulled module. The
+// raw manifest and layers are cached so that their digests can be verified
+// again when the cache is loaded.
+type ociCache struct {
+	Reference string            `json:"reference"`
+	Digest    string            `json:"digest"`
+	Manifest  []byte            `json:"manifest"`
+	Blobs     map[string][]byte `json:"blobs"`
+}
+
+func NewImportOCI(managedOpts component.Options, eval *vm.Evaluator, onContentChange func(map[string]string)) *ImportOCI {
+	return &ImportOCI{
+		opts:            managedOpts,
+		log:             managedOpts.Logger,
+		eval:            eval,
+		argsChanged:     make(chan struct{}, 1),
+		onContentChange: onContentChange,
+		httpClient: &http.Client{
+			Transport: http.DefaultTransport.(*http.Transport).Clone(),
+		},
+	}
+}
+
+func (im *ImportOCI) Evaluate(scope *vm.Scope) error {
+	var arguments OCIArguments
+	if err := im.eval.Evaluate(scope, &arguments); err != nil {
+		return fmt.Errorf("decoding River: %w", err)
+	}
+
+	if reflect.DeepEqual(im.args, arguments) {
+		return nil
+	}
+
+	if err := im.Update(arguments); err != nil {
+		return fmt.Errorf("updating component: %w", err)
+	}
+	return nil
+}
+
+func (im *ImportOCI) Run(ctx context.Context) error {
+	var (
+		ticker  *time.Ticker
+		tickerC <-chan time.Time
+	)
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+		im.httpClient.CloseIdleConnections()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-im.argsChanged:
+			im.mut.RLock()
+			pullFrequency := im.args.PullFrequency
+			im.mut.RUnlock()
+			ticker, tickerC = im.updateTicker(pullFrequency, ticker)
+
+		case <-tickerC:
+			im.tickPull(ctx)
+		}
+	}
+}
+
+func (im *ImportOCI) updateTicker(pullFrequency time.Duration, ticker *time.Ticker) (*time.Ticker, <-chan time.Time) {
+	if pullFrequency > 0 {
+		if ticker == nil {
+			ticker = time.NewTicker(pullFrequency)
+		} else {
+			ticker.Reset(pullFrequency)
+		}
+		return ticker, ticker.C
+	}
+
+	if ticker != nil {
+		ticker.Stop()
+	}
+	return nil, nil
+}
+
+func (im *ImportOCI) tickPull(ctx context.Context) {
+	im.mut.Lock()
+	ctx, cancel := context.WithTimeout(ctx, im.args.PullTimeout)
+	err := im.pull(ctx)
+	cancel()
+	im.mut.Unlock()
+
+	im.updateHealth(err)
+	if err != nil {
+		level.Error(im.log).Log("msg", "failed to pull module from registry", "err", err)
+	}
+}
+
+// Update implements component.Component.
+// Failing to reach the registry isn't returned as an error if the module could
+// be loaded from the on-disk cache instead; the source is reported as
+// unhealthy until the next successful pull.
+func (im *ImportOCI) Update(args component.Arguments) (err error) {
+	im.mut.Lock()
+	defer im.mut.Unlock()
+
+	newArgs := args.(OCIArguments)
+
+	ref, err := oci.ParseReference(newArgs.Repository, newArgs.Reference)
+	if err != nil {
+		return err
+	}
+
+	verifier, err := signature.FromArguments(newArgs.Verify)
+	if err != nil {
+		return err
+	}
+
+	im.ref = ref
+	im.verifier = verifier
+	// The timeout bounds every request, in case the registry stops responding
+	// in the middle of a response.
+	im.httpClient.Timeout = newArgs.PullTimeout
+	im.client = oci.NewClient(oci.Options{
+		HTTPClient: im.httpClient,
+		PlainHTTP:  newArgs.PlainHTTP,
+		BasicAuth:  newArgs.BasicAuth,
+	})
+	im.digest = ""
+
+	ctx, cancel := context.WithTimeout(context.Background(), newArgs.PullTimeout)
+	pullErr := im.pull(ctx)
+	cancel()
+	if pullErr != nil {
+		if im.digest == "" {
+			im.updateHealth(pullErr)
+			return pullErr
+		}
+		level.Error(im.log).Log("msg", "failed to pull module from registry, using cached module", "err", pullErr)
+	}
+	im.updateHealth(pullErr)
+
+	im.args = newArgs
+
+	// Schedule an update for handling the changed arguments.
+	select {
+	case im.argsChanged <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// pull resolves the configured reference, and downloads the module if its
+// digest changed since the last pull. If the registry can't be reached and no
+// module is loaded yet, the cached module is loaded instead.
+// pull must only be called with im.mut held.
+func (im *ImportOCI) pull(ctx context.Context) error {
+	cache := im.readCache()
+
+	dgst, err := im.client.Resolve(ctx, im.ref)
+	if err != nil {
+		im.fallbackToCache(cache)
+		return err
+	}
+
+	switch {
+	case dgst == im.digest:
+		return nil
+	case cache != nil && cache.Digest == dgst:
+		if err := im.loadCache(cache); err == nil {
+			return nil
+		}
+		// Pull the module again if the cache can't be loaded.
+	}
+
+	artifact, err := im.client.Pull(ctx, im.ref, "")
+	if err != nil {
+		im.fallbackToCache(cache)
+		return err
+	}
+
+	if err := im.load(artifact); err != nil {
+		return err
+	}
+	level.Info(im.log).Log("msg", "pulled module from registry", "reference", im.ref, "digest", artifact.Digest)
+
+	cache = &ociCache{
+		Reference: im.ref.String(),
+		Digest:    artifact.Digest,
+		Manifest:  artifact.Manifest,
+		Blobs:     artifact.Blobs,
+	}
+	if err := im.writeCache(*cache); err != nil {
+		level.Warn(im.log).Log("msg", "failed to cache module on disk", "err", err)
+	}
+	return nil
+}
+
+// fallbackToCache loads the cached module if no module is loaded yet.
+func (im *ImportOCI) fallbackToCache(cache *ociCache) {
+	if im.digest != "" || cache == nil {
+		return
+	}
+	if err := im.loadCache(cache); err != nil {
+		level.Warn(im.log).Log("msg", "failed to load cached module", "err", err)
+	}
+}
+
+// loadCache verifies the digests of the cached module and loads it.
+func (im *ImportOCI) loadCache(cache *ociCache) error {
+	artifact, err := oci.Load(cache.Digest, cache.Manifest, cache.Blobs, "")
+	if err != nil {
+		return fmt.Errorf("verifying cached module: %w", err)
+	}
+	return im.load(artifact)
+}
+
+// load verifies the signatures of the module files in artifact if
+// verification is enabled, and passes them to the controller.
+func (im *ImportOCI) load(artifact *oci.Artifact) error {
+	var (
+		files      = make(map[string]string)
+		signatures = make(map[string]string)
+	)
+	for name, bb := range artifact.Files {
+		switch {
+		case strings.HasSuffix(name, ".river"):
+			files[name] = string(bb)
+		case strings.HasSuffix(name, ".river"+signature.Suffix):
+			signatures[name] = string(bb)
+		}
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("%s does not contain any .river files", im.ref)
+	}
+
+	if im.verifier != nil {
+		if err := im.verifier.VerifyFiles(files, signatures); err != nil {
+			return err
+		}
+	}
+
+	im.digest = artifact.Digest
+	im.onContentChange(files)
+	return nil
+}
+
+func (im *ImportOCI) cachePath() string {
+	return filepath.Join(im.opts.DataPath, "oci", "cache.json")
+}
+
+// readCache returns the cached module for the configured reference, or nil if
+// there is none.
+func (im *ImportOCI) readCache() *ociCache {
+	bb, err := os.ReadFile(im.cachePath())
+	if err != nil {
+		return nil
+	}
+
+	var cache ociCache
+	if err := json.Unmarshal(bb, &cache); err != nil {
+		level.Warn(im.log).Log("msg", "ignoring invalid module cache", "err", err)
+		return nil
+	}
+	if cache.Reference != im.ref.String() || cache.Digest == "" {
+		return nil
+	}
+	return &cache
+}
+
+func (im *ImportOCI) writeCache(cache ociCache) error {
+	bb, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+
+	path := im.cachePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, bb, 0640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (im *ImportOCI) updateHealth(err error) {
+	im.healthMut.Lock()
+	defer im.healthMut.Unlock()
+
+	if err != nil {
+		im.health = component.Health{
+			Health:     component.HealthTypeUnhealthy,
+			Message:    err.Error(),
+			UpdateTime: time.Now(),
+		}
+	} else {
+		im.health = component.Health{
+			Health:     component.HealthTypeHealthy,
+			Message:    "module updated",
+			UpdateTime: time.Now(),
+		}
+	}
+}
+
+// CurrentHealth implements component.HealthComponent.
+func (im *ImportOCI) CurrentHealth() component.Health {
+	im.healthMut.RLock()
+	defer im.healthMut.RUnlock()
+	return im.health
+}
+
+// Update the evaluator.
+func (im *ImportOCI) SetEval(eval *vm.Evaluator) {
+	im.eval = eval
+}
@@ -15,6 +15,7 @@ const (
 	String
 	Git
 	HTTP
+	OCI
 )
 
 const (
@@ -22,6 +23,7 @@ const (
 	BlockImportString = "import.string"
 	BlockImportHTTP   = "import.http"
 	BlockImportGit    = "import.git"
+	BlockImportOCI    = "import.oci"
 )
 
 // ImportSource retrieves a module from a source.
@@ -48,6 +50,8 @@ func NewImportSource(sourceType SourceType, managedOpts component.Options, eval
 		return NewImportHTTP(managedOpts, eval, onContentChange)
 	case Git:
 		return NewImportGit(managedOpts, eval, onContentChange)
+	case OCI:
+		return NewImportOCI(managedOpts, eval, onContentChange)
 	}
 	panic(fmt.Errorf("unsupported source type: %v", sourceType))
 }
@@ -63,6 +67,8 @@ func GetSourceType(fullName string) SourceType {
 		return HTTP
 	case BlockImportGit:
 		return Git
+	case BlockImportOCI:
+		return OCI
 	}
 	panic(fmt.Errorf("name does not map to a known source type: %v", fullName))
 }
@@ -0,0 +1,153 @@
+// Package pipelinetest runs tests against River pipelines.
+//
+// A test file declares one or more tests. Each test loads a configuration,
+// replaces the components which send data out of the process with stubs,
+// sends input fixtures to the exports of components in the pipeline, and
+// compares what reaches the stubs against golden files.
+package pipelinetest
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/grafana/river"
+)
+
+// FileSuffix is the suffix of test files.
+const FileSuffix = ".test.river"
+
+// DefaultStubs are the components which are replaced with stubs when a test
+// doesn't set the stubs attribute.
+var DefaultStubs = []string{
+	"loki.write",
+	"prometheus.remote_write",
+	"otelcol.exporter.loadbalancing",
+	"otelcol.exporter.otlp",
+	"otelcol.exporter.otlphttp",
+}
+
+// DefaultTimeout is how long a test waits for expected output by default.
+const DefaultTimeout = 5 * time.Second
+
+// File is the content of a test file.
+type File struct {
+	Tests []Test `river:"test,block"`
+}
+
+// Test is a single test of a pipeline.
+type Test struct {
+	Name string `river:",label"`
+
+	// Config is the path to the configuration file or directory under test,
+	// relative to the test file.
+	Config  string        `river:"config,attr"`
+	Stubs   []string      `river:"stubs,attr,optional"`
+	Timeout time.Duration `river:"timeout,attr,optional"`
+
+	Logs    []LogsInput    `river:"logs,block,optional"`
+	Metrics []MetricsInput `river:"metrics,block,optional"`
+	OTLP    []OTLPInput    `river:"otlp,block,optional"`
+
+	Expect []Expect `river:"expect,block"`
+}
+
+// SetToDefault implements river.Defaulter.
+func (t *Test) SetToDefault() {
+	*t = Test{
+		Stubs:   DefaultStubs,
+		Timeout: DefaultTimeout,
+	}
+}
+
+// Validate implements river.Validator.
+func (t *Test) Validate() error {
+	if t.Config == "" {
+		return fmt.Errorf("config must not be empty")
+	}
+	if t.Timeout <= 0 {
+		return fmt.Errorf("timeout must be greater than 0")
+	}
+	if len(t.Expect) == 0 {
+		return fmt.Errorf("at least one expect block must be provided")
+	}
+	for _, in := range t.Logs {
+		if _, _, err := splitTarget(in.Target); err != nil {
+			return err
+		}
+	}
+	for _, in := range t.Metrics {
+		if _, _, err := splitTarget(in.Target); err != nil {
+			return err
+		}
+	}
+	for _, in := range t.OTLP {
+		if _, _, err := splitTarget(in.Target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LogsInput sends log lines to a loki.LogsReceiver.
+type LogsInput struct {
+	Target    string            `river:"target,attr"`
+	Labels    map[string]string `river:"labels,attr,optional"`
+	Timestamp time.Time         `river:"timestamp,attr,optional"`
+	Lines     []string          `river:"lines,attr"`
+}
+
+// MetricsInput sends samples in the Prometheus text exposition format to a
+// storage.Appendable.
+type MetricsInput struct {
+	Target string `river:"target,attr"`
+	Text   string `river:"text,attr"`
+}
+
+// OTLPInput sends OTLP payloads, encoded as JSON, to an otelcol.Consumer.
+type OTLPInput struct {
+	Target  string `river:"target,attr"`
+	Logs    string `river:"logs,attr,optional"`
+	Metrics string `river:"metrics,attr,optional"`
+	Traces  string `river:"traces,attr,optional"`
+}
+
+// Validate implements river.Validator.
+func (in *OTLPInput) Validate() error {
+	if in.Logs == "" && in.Metrics == "" && in.Traces == "" {
+		return fmt.Errorf("at least one of logs, metrics or traces must be set")
+	}
+	return nil
+}
+
+// Expect compares the output received by a stub with a golden file.
+type Expect struct {
+	Component string `river:"component,attr"`
+	// Golden is the path to the golden file, relative to the test file.
+	Golden string `river:"golden,attr"`
+}
+
+// ParseFile reads and decodes the test file at path.
+func ParseFile(path string) (*File, error) {
+	bb, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var f File
+	if err := river.Unmarshal(bb, &f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// splitTarget splits a target such as "loki.process.default.receiver" into
+// the ID of the component and the name of the export.
+func splitTarget(target string) (id string, export string, err error) {
+	idx := strings.LastIndex(target, ".")
+	if idx <= 0 || idx == len(target)-1 {
+		return "", "", fmt.Errorf("invalid target %q: expected a component ID followed by the name of an export", target)
+	}
+	return target[:idx], target[idx+1:], nil
+}
@@ -0,0 +1,94 @@
+package pipelinetest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes results to w as a JUnit XML report. Each test file is
+// reported as a test suite.
+func WriteJUnit(w io.Writer, results []Result) error {
+	var (
+		report     junitTestSuites
+		suiteIndex = make(map[string]int)
+		suiteTimes []time.Duration
+		total      time.Duration
+	)
+
+	for _, res := range results {
+		idx, ok := suiteIndex[res.File]
+		if !ok {
+			idx = len(report.Suites)
+			suiteIndex[res.File] = idx
+			report.Suites = append(report.Suites, junitTestSuite{Name: res.File})
+			suiteTimes = append(suiteTimes, 0)
+		}
+		suite := &report.Suites[idx]
+
+		tc := junitTestCase{
+			Name:      res.Name,
+			Classname: res.File,
+			Time:      formatSeconds(res.Duration),
+		}
+		if !res.Passed() {
+			tc.Failure = &junitFailure{Message: "test failed", Text: res.Failure}
+			suite.Failures++
+			report.Failures++
+		}
+		suite.Cases = append(suite.Cases, tc)
+		suite.Tests++
+		report.Tests++
+		suiteTimes[idx] += res.Duration
+		total += res.Duration
+	}
+
+	for i := range report.Suites {
+		report.Suites[i].Time = formatSeconds(suiteTimes[i])
+	}
+	report.Time = formatSeconds(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func formatSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
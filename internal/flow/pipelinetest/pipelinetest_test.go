@@ -0,0 +1,220 @@
+package pipelinetest_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	_ "github.com/grafana/agent/internal/component/loki/process"
+	_ "github.com/grafana/agent/internal/component/loki/write"
+	_ "github.com/grafana/agent/internal/component/otelcol/exporter/otlp"
+	_ "github.com/grafana/agent/internal/component/otelcol/processor/attributes"
+	_ "github.com/grafana/agent/internal/component/prometheus/relabel"
+	_ "github.com/grafana/agent/internal/component/prometheus/remotewrite"
+	"github.com/grafana/agent/internal/featuregate"
+	"github.com/grafana/agent/internal/flow/pipelinetest"
+	"github.com/grafana/agent/internal/service"
+	"github.com/grafana/agent/internal/service/labelstore"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func testOptions() pipelinetest.Options {
+	return pipelinetest.Options{
+		MinStability: featuregate.StabilityExperimental,
+		Services: func(l log.Logger, _ string) ([]service.Service, error) {
+			return []service.Service{labelstore.New(l, prometheus.NewRegistry())}, nil
+		},
+	}
+}
+
+func TestRunFile(t *testing.T) {
+	results, err := pipelinetest.RunFile(context.Background(), testOptions(), "testdata/pipeline.test.river")
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+
+	for _, res := range results {
+		require.True(t, res.Passed(), "test %q failed: %s", res.Name, res.Failure)
+	}
+}
+
+func TestRunFile_Mismatch(t *testing.T) {
+	dir := t.TempDir()
+	copyFile(t, "testdata/config.river", filepath.Join(dir, "config.river"))
+	writeFile(t, filepath.Join(dir, "golden.txt"), "1970-01-01T00:00:00Z {env=\"test\", job=\"app\"} wrong\n")
+	writeFile(t, filepath.Join(dir, "logs.test.river"), `
+		test "logs" {
+			config  = "config.river"
+			timeout = "500ms"
+
+			logs {
+				target = "loki.process.default.receiver"
+				labels = {job = "app"}
+				lines  = ["right"]
+			}
+
+			expect {
+				component = "loki.write.default"
+				golden    = "golden.txt"
+			}
+		}
+	`)
+
+	results, err := pipelinetest.RunFile(context.Background(), testOptions(), filepath.Join(dir, "logs.test.river"))
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.False(t, results[0].Passed())
+	require.Contains(t, results[0].Failure, "output of loki.write.default does not match")
+	require.Contains(t, results[0].Failure, `-1970-01-01T00:00:00Z {env="test", job="app"} wrong`)
+	require.Contains(t, results[0].Failure, `+1970-01-01T00:00:00Z {env="test", job="app"} right`)
+}
+
+func TestRunFile_Update(t *testing.T) {
+	dir := t.TempDir()
+	copyFile(t, "testdata/config.river", filepath.Join(dir, "config.river"))
+	writeFile(t, filepath.Join(dir, "logs.test.river"), `
+		test "logs" {
+			config = "config.river"
+
+			logs {
+				target = "loki.process.default.receiver"
+				labels = {job = "app"}
+				lines  = ["first", "level=debug second", "third"]
+			}
+
+			expect {
+				component = "loki.write.default"
+				golden    = "golden/logs.txt"
+			}
+		}
+	`)
+
+	opts := testOptions()
+	opts.Update = true
+	results, err := pipelinetest.RunFile(context.Background(), opts, filepath.Join(dir, "logs.test.river"))
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.True(t, results[0].Passed(), results[0].Failure)
+
+	bb, err := os.ReadFile(filepath.Join(dir, "golden", "logs.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "1970-01-01T00:00:00Z {env=\"test\", job=\"app\"} first\n1970-01-01T00:00:00Z {env=\"test\", job=\"app\"} third\n", string(bb))
+
+	// Running the test again compares against the written golden file.
+	results, err = pipelinetest.RunFile(context.Background(), testOptions(), filepath.Join(dir, "logs.test.river"))
+	require.NoError(t, err)
+	require.True(t, results[0].Passed(), results[0].Failure)
+}
+
+func TestRunFile_Errors(t *testing.T) {
+	tt := []struct {
+		name      string
+		test      string
+		expectErr string
+	}{
+		{
+			name: "unknown target",
+			test: `
+				test "t" {
+					config = "config.river"
+					logs {
+						target = "loki.process.missing.receiver"
+						lines  = ["a"]
+					}
+					expect {
+						component = "loki.write.default"
+						golden    = "golden.txt"
+					}
+				}
+			`,
+			expectErr: `target loki.process.missing.receiver: component "loki.process.missing": component not found`,
+		},
+		{
+			name: "wrong receiver type",
+			test: `
+				test "t" {
+					config = "config.river"
+					metrics {
+						target = "loki.process.default.receiver"
+						text   = "up 1"
+					}
+					expect {
+						component = "loki.write.default"
+						golden    = "golden.txt"
+					}
+				}
+			`,
+			expectErr: "target loki.process.default.receiver: expected a storage.Appendable",
+		},
+		{
+			name: "not stubbed",
+			test: `
+				test "t" {
+					config = "config.river"
+					stubs  = ["prometheus.remote_write"]
+					expect {
+						component = "loki.write.default"
+						golden    = "golden.txt"
+					}
+				}
+			`,
+			expectErr: "loki.write.default is not a stubbed component",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			copyFile(t, "testdata/config.river", filepath.Join(dir, "config.river"))
+			writeFile(t, filepath.Join(dir, "golden.txt"), "")
+			writeFile(t, filepath.Join(dir, "t.test.river"), tc.test)
+
+			results, err := pipelinetest.RunFile(context.Background(), testOptions(), filepath.Join(dir, "t.test.river"))
+			require.NoError(t, err)
+			require.Len(t, results, 1)
+			require.Contains(t, results[0].Failure, tc.expectErr)
+		})
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	results := []pipelinetest.Result{
+		{File: "a.test.river", Name: "passes", Duration: 1500 * time.Millisecond},
+		{File: "a.test.river", Name: "fails", Duration: 500 * time.Millisecond, Failure: "output does not match"},
+		{File: "b.test.river", Name: "passes", Duration: time.Second},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, pipelinetest.WriteJUnit(&buf, results))
+
+	expect := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites tests="3" failures="1" time="3.000">
+  <testsuite name="a.test.river" tests="2" failures="1" time="2.000">
+    <testcase name="passes" classname="a.test.river" time="1.500"></testcase>
+    <testcase name="fails" classname="a.test.river" time="0.500">
+      <failure message="test failed">output does not match</failure>
+    </testcase>
+  </testsuite>
+  <testsuite name="b.test.river" tests="1" failures="0" time="1.000">
+    <testcase name="passes" classname="b.test.river" time="1.000"></testcase>
+  </testsuite>
+</testsuites>
+`
+	require.Equal(t, expect, buf.String())
+}
+
+func copyFile(t *testing.T, from, to string) {
+	t.Helper()
+	bb, err := os.ReadFile(from)
+	require.NoError(t, err)
+	writeFile(t, to, string(bb))
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
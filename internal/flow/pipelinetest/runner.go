@@ -0,0 +1,468 @@
+package pipelinetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/internal/component"
+	"github.com/grafana/agent/internal/component/common/loki"
+	"github.com/grafana/agent/internal/component/otelcol"
+	"github.com/grafana/agent/internal/featuregate"
+	"github.com/grafana/agent/internal/flow"
+	"github.com/grafana/agent/internal/flow/logging"
+	"github.com/grafana/agent/internal/service"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/storage"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+// pollInterval is how often the output of stubs is compared with golden
+// files.
+const pollInterval = 50 * time.Millisecond
+
+// settleTime is how long the output of a stub must stay the same before it's
+// written to a golden file in update mode.
+const settleTime = 500 * time.Millisecond
+
+// Options configures how tests are run.
+type Options struct {
+	// Logger receives the logs of components under test. Logs are discarded
+	// if Logger is nil.
+	Logger *logging.Logger
+
+	// MinStability is the minimum stability level of components which can be
+	// used in the configuration under test.
+	MinStability featuregate.Stability
+
+	// Services builds the services available to components under test. A new
+	// set of services is built for every test.
+	Services func(l log.Logger, dataPath string) ([]service.Service, error)
+
+	// Update writes the output of stubs to golden files instead of comparing
+	// it.
+	Update bool
+}
+
+// Result is the result of a single test.
+type Result struct {
+	File     string        // Path to the test file.
+	Name     string        // Name of the test.
+	Duration time.Duration // How long the test took to run.
+	Failure  string        // Why the test failed. Empty if the test passed.
+}
+
+// Passed returns whether the test passed.
+func (r Result) Passed() bool { return r.Failure == "" }
+
+// RunFile runs all tests in the test file at path. An error is only returned
+// if the test file can't be read; failing tests are reported in the results.
+func RunFile(ctx context.Context, opts Options, path string) ([]Result, error) {
+	f, err := ParseFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading test file %s: %w", path, err)
+	}
+
+	results := make([]Result, 0, len(f.Tests))
+	for _, test := range f.Tests {
+		start := time.Now()
+		err := runTest(ctx, opts, filepath.Dir(path), test)
+
+		res := Result{
+			File:     path,
+			Name:     test.Name,
+			Duration: time.Since(start),
+		}
+		if err != nil {
+			res.Failure = err.Error()
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+func runTest(ctx context.Context, opts Options, dir string, test Test) error {
+	source, err := readConfig(resolvePath(dir, test.Config))
+	if err != nil {
+		return fmt.Errorf("reading config: %w", err)
+	}
+
+	dataPath, err := os.MkdirTemp("", "agent-test-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dataPath)
+
+	l := opts.Logger
+	if l == nil {
+		l, err = logging.New(io.Discard, logging.DefaultOptions)
+		if err != nil {
+			return fmt.Errorf("building logger: %w", err)
+		}
+	}
+
+	var services []service.Service
+	if opts.Services != nil {
+		services, err = opts.Services(l, dataPath)
+		if err != nil {
+			return fmt.Errorf("building services: %w", err)
+		}
+	}
+
+	outputs := newOutputs()
+	f := flow.NewWithComponentRegistry(flow.Options{
+		Logger:       l,
+		DataPath:     dataPath,
+		Reg:          prometheus.NewRegistry(),
+		MinStability: opts.MinStability,
+		Services:     services,
+	}, newStubRegistry(opts.MinStability, test.Stubs, outputs))
+	if err := f.LoadSource(source, nil); err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		f.Run(ctx)
+	}()
+
+	sendCtx, sendCancel := context.WithTimeout(ctx, test.Timeout)
+	defer sendCancel()
+	if err := sendInputs(sendCtx, f, test); err != nil {
+		return err
+	}
+
+	var failures []string
+	for _, expect := range test.Expect {
+		var err error
+		if opts.Update {
+			err = updateGolden(ctx, outputs, dir, expect, test.Timeout)
+		} else {
+			err = compareGolden(ctx, outputs, dir, expect, test.Timeout)
+		}
+		if err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "\n"))
+	}
+	return nil
+}
+
+func resolvePath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// readConfig reads the configuration at path. If path is a directory, all
+// *.river files in it are combined into a single configuration.
+func readConfig(path string) (*flow.Source, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !fi.IsDir() {
+		bb, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return flow.ParseSource(path, bb)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(path, "*.river"))
+	if err != nil {
+		return nil, err
+	}
+	sources := make(map[string][]byte, len(matches))
+	for _, match := range matches {
+		if strings.HasSuffix(match, FileSuffix) {
+			continue
+		}
+		bb, err := os.ReadFile(match)
+		if err != nil {
+			return nil, err
+		}
+		sources[match] = bb
+	}
+	return flow.ParseSources(sources)
+}
+
+// sendInputs sends the input fixtures of test to their targets. Logs are sent
+// first, then metrics, then OTLP payloads.
+func sendInputs(ctx context.Context, f *flow.Flow, test Test) error {
+	for _, in := range test.Logs {
+		receiver, err := lookupTarget[loki.LogsReceiver](f, in.Target)
+		if err != nil {
+			return err
+		}
+		if err := sendLogs(ctx, receiver, in); err != nil {
+			return fmt.Errorf("sending logs to %s: %w", in.Target, err)
+		}
+	}
+
+	for _, in := range test.Metrics {
+		appendable, err := lookupTarget[storage.Appendable](f, in.Target)
+		if err != nil {
+			return err
+		}
+		if err := sendMetrics(ctx, appendable, in); err != nil {
+			return fmt.Errorf("sending metrics to %s: %w", in.Target, err)
+		}
+	}
+
+	for _, in := range test.OTLP {
+		consumer, err := lookupTarget[otelcol.Consumer](f, in.Target)
+		if err != nil {
+			return err
+		}
+		if err := sendOTLP(ctx, consumer, in); err != nil {
+			return fmt.Errorf("sending OTLP to %s: %w", in.Target, err)
+		}
+	}
+	return nil
+}
+
+// lookupTarget returns the export of a component referenced by target.
+func lookupTarget[T any](f *flow.Flow, target string) (T, error) {
+	var zero T
+
+	id, export, err := splitTarget(target)
+	if err != nil {
+		return zero, err
+	}
+
+	info, err := f.GetComponent(component.ID{LocalID: id}, component.InfoOptions{GetExports: true})
+	if err != nil {
+		return zero, fmt.Errorf("target %s: component %q: %w", target, id, err)
+	}
+
+	value, ok := exportField(info.Exports, export)
+	if !ok {
+		return zero, fmt.Errorf("target %s: component %q has no export named %q", target, id, export)
+	}
+	v, ok := value.(T)
+	if !ok || value == nil {
+		return zero, fmt.Errorf("target %s: expected a %s, got %T", target, reflect.TypeOf((*T)(nil)).Elem(), value)
+	}
+	return v, nil
+}
+
+// exportField returns the export with the given name from a component's
+// exports.
+func exportField(exports component.Exports, name string) (any, bool) {
+	if m, ok := exports.(map[string]any); ok {
+		v, ok := m[name]
+		return v, ok
+	}
+
+	rv := reflect.ValueOf(exports)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, false
+	}
+
+	for i := 0; i < rv.NumField(); i++ {
+		tag := rv.Type().Field(i).Tag.Get("river")
+		if fieldName, _, _ := strings.Cut(tag, ","); fieldName == name {
+			return rv.Field(i).Interface(), true
+		}
+	}
+	return nil, false
+}
+
+func sendLogs(ctx context.Context, receiver loki.LogsReceiver, in LogsInput) error {
+	lbls := make(model.LabelSet, len(in.Labels))
+	for k, v := range in.Labels {
+		lbls[model.LabelName(k)] = model.LabelValue(v)
+	}
+
+	ts := in.Timestamp
+	if ts.IsZero() {
+		ts = time.Unix(0, 0)
+	}
+
+	for _, line := range in.Lines {
+		entry := loki.Entry{
+			Labels: lbls.Clone(),
+			Entry:  logproto.Entry{Timestamp: ts, Line: line},
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for the receiver to accept log lines")
+		case receiver.Chan() <- entry:
+		}
+	}
+	return nil
+}
+
+func sendMetrics(ctx context.Context, appendable storage.Appendable, in MetricsInput) error {
+	app := appendable.Appender(ctx)
+
+	p := textparse.NewPromParser([]byte(in.Text))
+	for {
+		entry, err := p.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			_ = app.Rollback()
+			return fmt.Errorf("parsing metrics: %w", err)
+		}
+		if entry != textparse.EntrySeries {
+			continue
+		}
+
+		_, ts, v := p.Series()
+		var t int64
+		if ts != nil {
+			t = *ts
+		}
+
+		var lbls labels.Labels
+		p.Metric(&lbls)
+		if _, err := app.Append(0, lbls, t, v); err != nil {
+			_ = app.Rollback()
+			return err
+		}
+	}
+	return app.Commit()
+}
+
+func sendOTLP(ctx context.Context, consumer otelcol.Consumer, in OTLPInput) error {
+	if in.Logs != "" {
+		ld, err := (&plog.JSONUnmarshaler{}).UnmarshalLogs([]byte(in.Logs))
+		if err != nil {
+			return fmt.Errorf("parsing logs: %w", err)
+		}
+		if err := consumer.ConsumeLogs(ctx, ld); err != nil {
+			return err
+		}
+	}
+	if in.Metrics != "" {
+		md, err := (&pmetric.JSONUnmarshaler{}).UnmarshalMetrics([]byte(in.Metrics))
+		if err != nil {
+			return fmt.Errorf("parsing metrics: %w", err)
+		}
+		if err := consumer.ConsumeMetrics(ctx, md); err != nil {
+			return err
+		}
+	}
+	if in.Traces != "" {
+		td, err := (&ptrace.JSONUnmarshaler{}).UnmarshalTraces([]byte(in.Traces))
+		if err != nil {
+			return fmt.Errorf("parsing traces: %w", err)
+		}
+		if err := consumer.ConsumeTraces(ctx, td); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compareGolden waits until the output of the stub matches its golden file,
+// and returns an error with a diff if it doesn't before timeout.
+func compareGolden(ctx context.Context, outputs *outputs, dir string, expect Expect, timeout time.Duration) error {
+	out := outputs.get(expect.Component)
+	if out == nil {
+		return fmt.Errorf("%s is not a stubbed component", expect.Component)
+	}
+
+	goldenPath := resolvePath(dir, expect.Golden)
+	bb, err := os.ReadFile(goldenPath)
+	if err != nil {
+		return fmt.Errorf("reading golden file: %w", err)
+	}
+	expected := string(bb)
+
+	actual := pollOutput(ctx, out, timeout, func(actual string, _ time.Duration) bool {
+		return actual == expected
+	})
+	if actual == expected {
+		return nil
+	}
+
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(expected),
+		B:        difflib.SplitLines(actual),
+		FromFile: goldenPath,
+		ToFile:   expect.Component,
+		Context:  3,
+	})
+	return fmt.Errorf("output of %s does not match %s:\n%s", expect.Component, goldenPath, diff)
+}
+
+// updateGolden waits until the output of the stub stops changing, and writes
+// it to its golden file.
+func updateGolden(ctx context.Context, outputs *outputs, dir string, expect Expect, timeout time.Duration) error {
+	out := outputs.get(expect.Component)
+	if out == nil {
+		return fmt.Errorf("%s is not a stubbed component", expect.Component)
+	}
+
+	actual := pollOutput(ctx, out, timeout, func(_ string, unchangedFor time.Duration) bool {
+		return unchangedFor >= settleTime
+	})
+
+	goldenPath := resolvePath(dir, expect.Golden)
+	if err := os.MkdirAll(filepath.Dir(goldenPath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(goldenPath, []byte(actual), 0644)
+}
+
+// pollOutput polls the output of a stub until done returns true or timeout
+// passes, and returns the last output.
+func pollOutput(ctx context.Context, out *output, timeout time.Duration, done func(actual string, unchangedFor time.Duration) bool) string {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	var (
+		last        = out.String()
+		lastChanged = time.Now()
+	)
+	for {
+		if done(last, time.Since(lastChanged)) {
+			return last
+		}
+
+		select {
+		case <-ctx.Done():
+			return out.String()
+		case <-ticker.C:
+		}
+
+		if actual := out.String(); actual != last {
+			last = actual
+			lastChanged = time.Now()
+		}
+	}
+}
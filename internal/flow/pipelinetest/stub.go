@@ -0,0 +1,258 @@
+package pipelinetest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/grafana/agent/internal/component"
+	"github.com/grafana/agent/internal/component/common/loki"
+	"github.com/grafana/agent/internal/component/otelcol"
+	"github.com/grafana/agent/internal/component/prometheus"
+	"github.com/grafana/agent/internal/featuregate"
+	"github.com/grafana/agent/internal/service/labelstore"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	otelconsumer "go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+var (
+	logsReceiverType = reflect.TypeOf((*loki.LogsReceiver)(nil)).Elem()
+	appendableType   = reflect.TypeOf((*storage.Appendable)(nil)).Elem()
+	consumerType     = reflect.TypeOf((*otelcol.Consumer)(nil)).Elem()
+)
+
+// stubRegistry looks up components in the global component registry, and
+// replaces the components with the given names with stubs.
+type stubRegistry struct {
+	minStability featuregate.Stability
+	stubs        map[string]struct{}
+	outputs      *outputs
+}
+
+func newStubRegistry(minStability featuregate.Stability, stubs []string, outputs *outputs) *stubRegistry {
+	reg := &stubRegistry{
+		minStability: minStability,
+		stubs:        make(map[string]struct{}, len(stubs)),
+		outputs:      outputs,
+	}
+	for _, name := range stubs {
+		reg.stubs[name] = struct{}{}
+	}
+	return reg
+}
+
+// Get implements controller.ComponentRegistry.
+func (reg *stubRegistry) Get(name string) (component.Registration, error) {
+	cr, exists := component.Get(name)
+	if !exists {
+		return component.Registration{}, fmt.Errorf("cannot find the definition of component name %q", name)
+	}
+	if err := featuregate.CheckAllowed(cr.Stability, reg.minStability, fmt.Sprintf("component %q", name)); err != nil {
+		return component.Registration{}, err
+	}
+
+	if _, stubbed := reg.stubs[name]; stubbed {
+		// The stub keeps the arguments and exports of the real component, so
+		// that the configuration under test is decoded and validated as usual.
+		exports := cr.Exports
+		cr.Build = func(opts component.Options, _ component.Arguments) (component.Component, error) {
+			return newStub(opts, exports, reg.outputs.forComponent(opts.ID))
+		}
+	}
+	return cr, nil
+}
+
+// stub is a component which records everything sent to its exported
+// receivers.
+type stub struct {
+	logs []loki.LogsReceiver
+	out  *output
+}
+
+var _ component.Component = (*stub)(nil)
+
+// newStub builds a stub whose exports are a value of the same type as
+// exports. Every receiver field of the exports is set to a receiver which
+// records the data it receives to out.
+func newStub(opts component.Options, exports component.Exports, out *output) (*stub, error) {
+	s := &stub{out: out}
+	if exports == nil || reflect.TypeOf(exports).Kind() != reflect.Struct {
+		return s, nil
+	}
+
+	var ls labelstore.LabelStore
+	exportsValue := reflect.New(reflect.TypeOf(exports)).Elem()
+	for i := 0; i < exportsValue.NumField(); i++ {
+		field := exportsValue.Field(i)
+
+		switch field.Type() {
+		case logsReceiverType:
+			receiver := loki.NewLogsReceiver()
+			s.logs = append(s.logs, receiver)
+			field.Set(reflect.ValueOf(receiver))
+
+		case appendableType:
+			if ls == nil {
+				data, err := opts.GetServiceData(labelstore.ServiceName)
+				if err != nil {
+					return nil, err
+				}
+				ls = data.(labelstore.LabelStore)
+			}
+			field.Set(reflect.ValueOf(s.appendable(ls)))
+
+		case consumerType:
+			field.Set(reflect.ValueOf(otelcol.Consumer(&stubConsumer{out: out})))
+		}
+	}
+
+	opts.OnStateChange(exportsValue.Interface())
+	return s, nil
+}
+
+func (s *stub) appendable(ls labelstore.LabelStore) storage.Appendable {
+	return prometheus.NewInterceptor(nil, ls,
+		prometheus.WithAppendHook(func(ref storage.SeriesRef, l labels.Labels, t int64, v float64, _ storage.Appender) (storage.SeriesRef, error) {
+			s.out.add(fmt.Sprintf("%s %s %d", l.String(), strconv.FormatFloat(v, 'g', -1, 64), t))
+			return ref, nil
+		}),
+	)
+}
+
+// Run implements component.Component.
+func (s *stub) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for _, receiver := range s.logs {
+		wg.Add(1)
+		go func(receiver loki.LogsReceiver) {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case entry := <-receiver.Chan():
+					s.out.add(formatEntry(entry))
+				}
+			}
+		}(receiver)
+	}
+
+	<-ctx.Done()
+	return nil
+}
+
+// Update implements component.Component.
+func (s *stub) Update(component.Arguments) error {
+	return nil
+}
+
+func formatEntry(entry loki.Entry) string {
+	return fmt.Sprintf("%s %s %s", entry.Timestamp.UTC().Format(time.RFC3339Nano), entry.Labels.String(), entry.Line)
+}
+
+// stubConsumer records OTLP payloads as indented JSON.
+type stubConsumer struct {
+	out *output
+}
+
+var _ otelcol.Consumer = (*stubConsumer)(nil)
+
+func (c *stubConsumer) Capabilities() otelconsumer.Capabilities {
+	return otelconsumer.Capabilities{MutatesData: false}
+}
+
+func (c *stubConsumer) ConsumeTraces(_ context.Context, td ptrace.Traces) error {
+	bb, err := (&ptrace.JSONMarshaler{}).MarshalTraces(td)
+	return c.add(bb, err)
+}
+
+func (c *stubConsumer) ConsumeMetrics(_ context.Context, md pmetric.Metrics) error {
+	bb, err := (&pmetric.JSONMarshaler{}).MarshalMetrics(md)
+	return c.add(bb, err)
+}
+
+func (c *stubConsumer) ConsumeLogs(_ context.Context, ld plog.Logs) error {
+	bb, err := (&plog.JSONMarshaler{}).MarshalLogs(ld)
+	return c.add(bb, err)
+}
+
+func (c *stubConsumer) add(bb []byte, err error) error {
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, bb, "", "  "); err != nil {
+		return err
+	}
+	c.out.add(buf.String())
+	return nil
+}
+
+// outputs holds the output of all stubs, keyed by component ID.
+type outputs struct {
+	mut  sync.Mutex
+	byID map[string]*output
+}
+
+func newOutputs() *outputs {
+	return &outputs{byID: make(map[string]*output)}
+}
+
+// forComponent returns the output of the stub with the given ID, creating it
+// if it doesn't exist yet.
+func (o *outputs) forComponent(id string) *output {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+
+	out, ok := o.byID[id]
+	if !ok {
+		out = &output{}
+		o.byID[id] = out
+	}
+	return out
+}
+
+// get returns the output of the stub with the given ID, or nil if no stub was
+// built with that ID.
+func (o *outputs) get(id string) *output {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+	return o.byID[id]
+}
+
+// output is the data received by a stub, in the order it was received.
+type output struct {
+	mut   sync.Mutex
+	items []string
+}
+
+func (o *output) add(item string) {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+	o.items = append(o.items, item)
+}
+
+// String returns the output as it's written to golden files: one item per
+// line.
+func (o *output) String() string {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+
+	var buf bytes.Buffer
+	for _, item := range o.items {
+		buf.WriteString(item)
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
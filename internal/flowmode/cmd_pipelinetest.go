@@ -0,0 +1,165 @@
+package flowmode
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/grafana/agent/internal/featuregate"
+	"github.com/grafana/agent/internal/flow/pipelinetest"
+	"github.com/spf13/cobra"
+)
+
+func testCommand() *cobra.Command {
+	t := &flowTest{
+		minStability: featuregate.StabilityExperimental,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "test [flags] path...",
+		Short: "Run tests against River pipelines",
+		Long: `The test subcommand runs the tests declared in test files against the
+configurations they reference.
+
+Each path argument is either a test file or a directory. Directories are
+searched recursively for files ending in ` + pipelinetest.FileSuffix + `.
+
+Components which send data out of the process, such as loki.write and
+prometheus.remote_write, are replaced with stubs which record the data they
+receive. Every other component runs as it would with the run subcommand. Input
+fixtures are sent to the exports of components in the pipeline, and the output
+of each stub is compared with a golden file.
+
+If --update is provided, golden files are written with the output of the stubs
+instead of being compared.
+
+test exits with a non-zero exit code if any test fails.`,
+		Args:         cobra.MinimumNArgs(1),
+		SilenceUsage: true,
+
+		RunE: func(_ *cobra.Command, args []string) error {
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+			return t.Run(ctx, os.Stdout, args)
+		},
+	}
+
+	cmd.Flags().BoolVar(&t.update, "update", t.update, "Write the output of stubs to golden files instead of comparing it")
+	cmd.Flags().StringVar(&t.junitOutput, "junit.output", t.junitOutput, "Path to write a JUnit XML report to")
+	return cmd
+}
+
+type flowTest struct {
+	minStability featuregate.Stability
+	update       bool
+	junitOutput  string
+}
+
+func (ft *flowTest) Run(ctx context.Context, w io.Writer, paths []string) error {
+	files, err := findTestFiles(paths)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no test files found")
+	}
+
+	opts := pipelinetest.Options{
+		MinStability: ft.minStability,
+		Services:     buildLocalServices,
+		Update:       ft.update,
+	}
+
+	var (
+		results []pipelinetest.Result
+		failed  int
+	)
+	for _, file := range files {
+		fileResults, err := pipelinetest.RunFile(ctx, opts, file)
+		if err != nil {
+			return err
+		}
+
+		for _, res := range fileResults {
+			status := "PASS"
+			if !res.Passed() {
+				status = "FAIL"
+				failed++
+			}
+			fmt.Fprintf(w, "--- %s: %s/%s (%.2fs)\n", status, res.File, res.Name, res.Duration.Seconds())
+			if !res.Passed() {
+				fmt.Fprintln(w, indent(res.Failure, "    "))
+			}
+		}
+		results = append(results, fileResults...)
+	}
+
+	if ft.junitOutput != "" {
+		if err := writeJUnitFile(ft.junitOutput, results); err != nil {
+			return fmt.Errorf("writing JUnit report: %w", err)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d test(s) failed", failed, len(results))
+	}
+	fmt.Fprintf(w, "ok: %d test(s) passed\n", len(results))
+	return nil
+}
+
+// findTestFiles returns the test files in paths. Directories are searched
+// recursively.
+func findTestFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(path, pipelinetest.FileSuffix) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func writeJUnitFile(path string, results []pipelinetest.Result) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := pipelinetest.WriteJUnit(f, results); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func indent(s, prefix string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = prefix + line
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,84 @@
+package flowmode
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/grafana/agent/internal/featuregate"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTest_Run(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "config.river"), `
+		loki.process "default" {
+			forward_to = [loki.write.default.receiver]
+
+			stage.drop {
+				expression = ".*level=debug.*"
+			}
+		}
+
+		loki.write "default" {
+			endpoint {
+				url = "http://localhost:3100/loki/api/v1/push"
+			}
+		}
+	`)
+	writeTestFile(t, filepath.Join(dir, "tests", "logs.test.river"), `
+		test "drops_debug_logs" {
+			config = "../config.river"
+
+			logs {
+				target = "loki.process.default.receiver"
+				labels = {job = "app"}
+				lines  = ["level=info a", "level=debug b"]
+			}
+
+			expect {
+				component = "loki.write.default"
+				golden    = "golden/logs.txt"
+			}
+		}
+	`)
+	junitPath := filepath.Join(dir, "report.xml")
+
+	ft := &flowTest{minStability: featuregate.StabilityExperimental, update: true}
+	var out bytes.Buffer
+	require.NoError(t, ft.Run(context.Background(), &out, []string{dir}))
+	require.Contains(t, out.String(), "--- PASS: "+filepath.Join(dir, "tests", "logs.test.river")+"/drops_debug_logs")
+
+	golden, err := os.ReadFile(filepath.Join(dir, "tests", "golden", "logs.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "1970-01-01T00:00:00Z {job=\"app\"} level=info a\n", string(golden))
+
+	// Change the golden file so that the test fails.
+	writeTestFile(t, filepath.Join(dir, "tests", "golden", "logs.txt"), "something else\n")
+
+	ft = &flowTest{minStability: featuregate.StabilityExperimental, junitOutput: junitPath}
+	out.Reset()
+	err = ft.Run(context.Background(), &out, []string{dir})
+	require.EqualError(t, err, "1 of 1 test(s) failed")
+	require.Contains(t, out.String(), "--- FAIL: ")
+	require.Contains(t, out.String(), "    -something else")
+
+	report, err := os.ReadFile(junitPath)
+	require.NoError(t, err)
+	require.Contains(t, string(report), `<testsuites tests="1" failures="1"`)
+	require.Contains(t, string(report), `<testcase name="drops_debug_logs"`)
+}
+
+func TestTest_NoFiles(t *testing.T) {
+	ft := &flowTest{minStability: featuregate.StabilityExperimental}
+	err := ft.Run(context.Background(), &bytes.Buffer{}, []string{t.TempDir()})
+	require.EqualError(t, err, "no test files found")
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
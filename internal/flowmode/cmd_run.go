@@ -30,6 +30,7 @@ import (
 	"github.com/grafana/agent/internal/service"
 	httpservice "github.com/grafana/agent/internal/service/http"
 	"github.com/grafana/agent/internal/service/labelstore"
+	"github.com/grafana/agent/internal/service/livedebugging"
 	otel_service "github.com/grafana/agent/internal/service/otel"
 	remotecfgservice "github.com/grafana/agent/internal/service/remotecfg"
 	uiservice "github.com/grafana/agent/internal/service/ui"
@@ -257,6 +258,7 @@ func (fr *flowRun) Run(configPath string) error {
 	remoteCfgService, err := remotecfgservice.New(remotecfgservice.Options{
 		Logger:      log.With(l, "service", "remotecfg"),
 		StoragePath: fr.storagePath,
+		Metrics:     reg,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create the remotecfg service: %w", err)
@@ -272,6 +274,7 @@ func (fr *flowRun) Run(configPath string) error {
 	}
 
 	labelService := labelstore.New(l, reg)
+	liveDebuggingService := livedebugging.New()
 	agentseed.Init(fr.storagePath, l)
 
 	f := flow.New(flow.Options{
@@ -286,6 +289,7 @@ func (fr *flowRun) Run(configPath string) error {
 			clusterService,
 			otelService,
 			labelService,
+			liveDebuggingService,
 			remoteCfgService,
 		},
 	})
@@ -0,0 +1,195 @@
+package flowmode
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/internal/featuregate"
+	"github.com/grafana/agent/internal/flow"
+	"github.com/grafana/agent/internal/flow/logging"
+	"github.com/grafana/agent/internal/service"
+	httpservice "github.com/grafana/agent/internal/service/http"
+	"github.com/grafana/agent/internal/service/labelstore"
+	"github.com/grafana/agent/internal/service/livedebugging"
+	otel_service "github.com/grafana/agent/internal/service/otel"
+	remotecfgservice "github.com/grafana/agent/internal/service/remotecfg"
+	uiservice "github.com/grafana/agent/internal/service/ui"
+	"github.com/grafana/river/diag"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/cobra"
+)
+
+func validateCommand() *cobra.Command {
+	v := &flowValidate{
+		minStability: featuregate.StabilityExperimental,
+		configFormat: "flow",
+	}
+
+	cmd := &cobra.Command{
+		Use:   "validate [flags] path",
+		Short: "Validate a configuration without running it",
+		Long: `The validate subcommand checks that a configuration can be loaded, without
+running any components.
+
+validate must be provided an argument pointing at the River dir/file-path to
+validate. If path is a directory, all *.river files in that directory are
+combined into a single unit, the same way the run subcommand does.
+
+The configuration is parsed and its component graph is built: references are
+resolved, cycles are detected, every component is constructed and its arguments
+are validated. Components are never run, so no data is collected or sent.
+Imported modules are still retrieved from their sources.
+
+Every problem found is reported along with its position in the configuration,
+and validate exits with a non-zero exit code if there are any errors.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+
+		RunE: func(_ *cobra.Command, args []string) error {
+			return v.Run(args[0])
+		},
+	}
+
+	cmd.Flags().StringVar(&v.configFormat, "config.format", v.configFormat, fmt.Sprintf("The format of the source file. Supported formats: %s.", supportedFormatsList()))
+	cmd.Flags().BoolVar(&v.configBypassConversionErrors, "config.bypass-conversion-errors", v.configBypassConversionErrors, "Enable bypassing errors when converting")
+	cmd.Flags().StringVar(&v.configExtraArgs, "config.extra-args", v.configExtraArgs, "Extra arguments from the original format used by the converter. Multiple arguments can be passed by separating them with a space.")
+	return cmd
+}
+
+type flowValidate struct {
+	minStability                 featuregate.Stability
+	configFormat                 string
+	configBypassConversionErrors bool
+	configExtraArgs              string
+}
+
+func (fv *flowValidate) Run(configPath string) error {
+	source, err := loadFlowSource(configPath, fv.configFormat, fv.configBypassConversionErrors, fv.configExtraArgs)
+	if err == nil {
+		err = fv.validate(source)
+	}
+	if err == nil {
+		return nil
+	}
+
+	var diags diag.Diagnostics
+	if !errors.As(err, &diags) {
+		return fmt.Errorf("reading config path %q: %w", configPath, err)
+	}
+
+	if source == nil {
+		// The configuration couldn't be parsed, so there is no source to
+		// print context from.
+		for _, d := range diags {
+			fmt.Fprintln(os.Stderr, d)
+		}
+	} else {
+		p := diag.NewPrinter(diag.PrinterConfig{
+			Color:              !color.NoColor,
+			ContextLinesBefore: 1,
+			ContextLinesAfter:  1,
+		})
+		_ = p.Fprint(os.Stderr, source.RawConfigs(), diags)
+	}
+	return fmt.Errorf("found %d error(s) in %s", countErrors(diags), configPath)
+}
+
+// validate builds the component graph of source without running it. Components
+// write to a temporary data directory which is removed afterwards.
+func (fv *flowValidate) validate(source *flow.Source) error {
+	dataPath, err := os.MkdirTemp("", "agent-validate-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dataPath)
+
+	// Logs from building components are discarded, since any problem is
+	// reported as a diagnostic.
+	l, err := logging.New(io.Discard, logging.DefaultOptions)
+	if err != nil {
+		return fmt.Errorf("building logger: %w", err)
+	}
+
+	services, err := buildLocalServices(l, dataPath)
+	if err != nil {
+		return err
+	}
+
+	f := flow.New(flow.Options{
+		Logger:       l,
+		DataPath:     dataPath,
+		Reg:          prometheus.NewRegistry(),
+		MinStability: fv.minStability,
+		Services:     services,
+	})
+
+	// Building components may start background work, so the controller is
+	// closed before returning. It's never run, so no component or service is
+	// scheduled.
+	defer f.Close()
+
+	return f.LoadSource(source, nil)
+}
+
+// buildLocalServices builds the services which components may depend on.
+// Clustering is disabled and the HTTP server only listens on a random
+// loopback port, so running the services doesn't expose anything outside of
+// the host.
+func buildLocalServices(l log.Logger, dataPath string) ([]service.Service, error) {
+	reg := prometheus.NewRegistry()
+
+	clusterService, err := buildClusterService(clusterOptions{
+		Log:     l,
+		Metrics: reg,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	remoteCfgService, err := remotecfgservice.New(remotecfgservice.Options{
+		Logger:      l,
+		StoragePath: dataPath,
+		Metrics:     reg,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the remotecfg service: %w", err)
+	}
+
+	otelService := otel_service.New(l)
+	if otelService == nil {
+		return nil, fmt.Errorf("failed to create otel service")
+	}
+
+	return []service.Service{
+		httpservice.New(httpservice.Options{
+			Logger:   l,
+			Gatherer: reg,
+
+			HTTPListenAddr:   "127.0.0.1:0",
+			MemoryListenAddr: "agent.internal:12345",
+
+			ReadyFunc:  func() bool { return false },
+			ReloadFunc: func() (*flow.Source, error) { return nil, fmt.Errorf("reloading is not supported") },
+		}),
+		uiservice.New(uiservice.Options{UIPrefix: "/"}),
+		clusterService,
+		otelService,
+		labelstore.New(l, reg),
+		livedebugging.New(),
+		remoteCfgService,
+	}, nil
+}
+
+func countErrors(diags diag.Diagnostics) int {
+	var n int
+	for _, d := range diags {
+		if d.Severity == diag.SeverityLevelError {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,131 @@
+package flowmode
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/grafana/agent/internal/featuregate"
+	"github.com/grafana/agent/internal/flow"
+	"github.com/grafana/river/diag"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slices"
+)
+
+func TestValidate(t *testing.T) {
+	tt := []struct {
+		name       string
+		config     string
+		expectErrs []string // Expected diagnostic messages, each with a position.
+	}{
+		{
+			name: "valid",
+			config: `
+				discovery.relabel "a" {
+					targets = []
+				}
+
+				prometheus.relabel "b" {
+					forward_to = []
+				}
+			`,
+		},
+		{
+			name: "unknown reference",
+			config: `
+				prometheus.relabel "b" {
+					forward_to = [prometheus.remote_write.missing.receiver]
+				}
+			`,
+			expectErrs: []string{`component "prometheus.remote_write.missing.receiver" does not exist or is out of scope`},
+		},
+		{
+			name: "type mismatch",
+			config: `
+				discovery.relabel "a" {
+					targets = "foo"
+				}
+			`,
+			expectErrs: []string{`"foo" should be array, got string`},
+		},
+		{
+			name: "cycle",
+			config: `
+				discovery.relabel "a" {
+					targets = discovery.relabel.b.output
+				}
+
+				discovery.relabel "b" {
+					targets = discovery.relabel.a.output
+				}
+			`,
+			expectErrs: []string{`cycle: discovery.relabel.`},
+		},
+		{
+			name: "invalid arguments at construction",
+			config: `
+				loki.process "a" {
+					forward_to = []
+
+					stage.regex {
+						expression = "("
+					}
+				}
+
+				discovery.relabel "b" {
+					targets = 1
+				}
+			`,
+			expectErrs: []string{
+				`missing closing )`,
+				`1 should be array, got number`,
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			source, err := flow.ParseSource(t.Name(), []byte(tc.config))
+			require.NoError(t, err)
+
+			fv := &flowValidate{minStability: featuregate.StabilityExperimental}
+			err = fv.validate(source)
+			if len(tc.expectErrs) == 0 {
+				require.NoError(t, err)
+				return
+			}
+
+			var diags diag.Diagnostics
+			require.True(t, errors.As(err, &diags), "expected diagnostics, got %v", err)
+			require.Len(t, diags, len(tc.expectErrs))
+
+			// Components are evaluated concurrently, so diagnostics aren't
+			// reported in a stable order.
+			for _, expect := range tc.expectErrs {
+				idx := slices.IndexFunc(diags, func(d diag.Diagnostic) bool {
+					return strings.Contains(d.Message, expect)
+				})
+				require.NotEqual(t, -1, idx, "no diagnostic contains %q: %v", expect, diags)
+				require.Equal(t, t.Name(), diags[idx].StartPos.Filename)
+				require.NotZero(t, diags[idx].StartPos.Line)
+			}
+		})
+	}
+}
+
+func TestValidate_Run(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.river")
+	require.NoError(t, os.WriteFile(valid, []byte(`prometheus.relabel "a" { forward_to = [] }`), 0644))
+	invalid := filepath.Join(dir, "invalid.river")
+	require.NoError(t, os.WriteFile(invalid, []byte(`prometheus.relabel "a" { forward_to = 1 }`), 0644))
+	unparsable := filepath.Join(dir, "unparsable.river")
+	require.NoError(t, os.WriteFile(unparsable, []byte(`prometheus.relabel "a" {`), 0644))
+
+	fv := &flowValidate{minStability: featuregate.StabilityExperimental, configFormat: "flow"}
+	require.NoError(t, fv.Run(valid))
+	require.EqualError(t, fv.Run(invalid), "found 1 error(s) in "+invalid)
+	require.EqualError(t, fv.Run(unparsable), "found 1 error(s) in "+unparsable)
+}
@@ -0,0 +1,532 @@
+// Package oci implements a minimal client for pulling artifacts from
+// registries implementing the OCI distribution specification.
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/grafana/river/rivertypes"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	// maxManifestSize is the largest manifest the client downloads.
+	maxManifestSize = 4 << 20
+	// maxBlobSize is the largest layer the client downloads.
+	maxBlobSize = 32 << 20
+
+	mediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+)
+
+// BasicAuth holds credentials used to authenticate to a registry.
+type BasicAuth struct {
+	Username string            `river:"username,attr"`
+	Password rivertypes.Secret `river:"password,attr"`
+}
+
+// Reference identifies an artifact in a registry.
+type Reference struct {
+	Registry   string // Registry host, optionally including a port.
+	Repository string // Repository name within the registry.
+	Reference  string // Tag or digest of the artifact.
+}
+
+// ParseReference parses a repository in the form REGISTRY/REPOSITORY along
+// with a tag or digest.
+func ParseReference(repository, reference string) (Reference, error) {
+	registry, name, ok := strings.Cut(repository, "/")
+	if !ok || registry == "" || name == "" {
+		return Reference{}, fmt.Errorf("repository %q must be in the form REGISTRY/REPOSITORY", repository)
+	}
+	if strings.ContainsAny(repository, "@") {
+		return Reference{}, fmt.Errorf("repository %q must not contain a tag or digest", repository)
+	}
+	if reference == "" {
+		return Reference{}, fmt.Errorf("reference must not be empty")
+	}
+	if strings.Contains(reference, ":") {
+		if _, err := digest.Parse(reference); err != nil {
+			return Reference{}, fmt.Errorf("invalid digest %q: %w", reference, err)
+		}
+	}
+
+	return Reference{
+		Registry:   registry,
+		Repository: name,
+		Reference:  reference,
+	}, nil
+}
+
+// IsDigest returns true if the reference points to an immutable digest rather
+// than a tag.
+func (r Reference) IsDigest() bool {
+	return strings.Contains(r.Reference, ":")
+}
+
+// String returns the reference in the form REGISTRY/REPOSITORY:TAG or
+// REGISTRY/REPOSITORY@DIGEST.
+func (r Reference) String() string {
+	if r.IsDigest() {
+		return r.Registry + "/" + r.Repository + "@" + r.Reference
+	}
+	return r.Registry + "/" + r.Repository + ":" + r.Reference
+}
+
+// Artifact is a set of files pulled from a registry.
+type Artifact struct {
+	// Digest is the digest of the artifact's manifest.
+	Digest string
+	// Files maps file paths, relative to the root of the artifact, to their
+	// contents.
+	Files map[string][]byte
+
+	// Manifest and Blobs hold the raw manifest and the layers which files
+	// were read from, keyed by digest, so that the artifact can be cached and
+	// verified again with Load.
+	Manifest []byte
+	Blobs    map[string][]byte
+}
+
+// Options configures a Client.
+type Options struct {
+	// HTTPClient is used to send requests. http.DefaultClient is used when nil.
+	HTTPClient *http.Client
+	// PlainHTTP connects to the registry over HTTP instead of HTTPS.
+	PlainHTTP bool
+	// BasicAuth holds optional credentials for the registry.
+	BasicAuth *BasicAuth
+}
+
+// Client pulls artifacts from an OCI registry.
+type Client struct {
+	opts Options
+
+	mut   sync.Mutex
+	token string // Bearer token retrieved from the registry's token service.
+}
+
+// NewClient creates a new Client.
+func NewClient(opts Options) *Client {
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	return &Client{opts: opts}
+}
+
+// Resolve returns the digest of the manifest ref points to. If ref is already
+// a digest, it is returned without contacting the registry.
+func (c *Client) Resolve(ctx context.Context, ref Reference) (string, error) {
+	if ref.IsDigest() {
+		return ref.Reference, nil
+	}
+
+	_, dgst, err := c.fetchManifest(ctx, ref)
+	return dgst, err
+}
+
+// Pull downloads the artifact ref points to. The digests of the manifest and
+// of every layer are verified. Only files whose name has the given suffix are
+// returned; pass an empty suffix to keep all files.
+func (c *Client) Pull(ctx context.Context, ref Reference, suffix string) (*Artifact, error) {
+	raw, dgst, err := c.fetchManifest(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := parseManifest(ref.String(), raw)
+	if err != nil {
+		return nil, err
+	}
+
+	blobs := make(map[string][]byte)
+	for _, layer := range manifest.Layers {
+		if !isFileLayer(layer) {
+			continue
+		}
+		data, err := c.fetchBlob(ctx, ref, layer)
+		if err != nil {
+			return nil, err
+		}
+		blobs[layer.Digest.String()] = data
+	}
+
+	return newArtifact(dgst, raw, manifest, blobs, suffix)
+}
+
+// Load rebuilds an artifact from the manifest and blobs of an artifact
+// returned by Pull, such as from an on-disk cache. The manifest is verified
+// against dgst, and every layer against the digest from the manifest. Only
+// files whose name has the given suffix are returned.
+func Load(dgst string, manifest []byte, blobs map[string][]byte, suffix string) (*Artifact, error) {
+	expect, err := digest.Parse(dgst)
+	if err != nil {
+		return nil, fmt.Errorf("invalid digest %q: %w", dgst, err)
+	}
+	if !verify(expect, manifest) {
+		return nil, fmt.Errorf("manifest does not match its digest %s", dgst)
+	}
+	m, err := parseManifest(dgst, manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, layer := range m.Layers {
+		if !isFileLayer(layer) {
+			continue
+		}
+		if !verify(layer.Digest, blobs[layer.Digest.String()]) {
+			return nil, fmt.Errorf("layer %s is missing or does not match its digest", layer.Digest)
+		}
+	}
+	return newArtifact(dgst, manifest, m, blobs, suffix)
+}
+
+// newArtifact extracts the files from the layers of manifest. blobs must hold
+// the verified content of every layer for which isFileLayer returns true.
+func newArtifact(dgst string, raw []byte, manifest *ocispec.Manifest, blobs map[string][]byte, suffix string) (*Artifact, error) {
+	files := make(map[string][]byte)
+	addFile := func(name string, data []byte) error {
+		// Keep the path relative to the root of the artifact, so that files
+		// with the same name in different directories don't collide.
+		name = strings.TrimPrefix(path.Clean("/"+name), "/")
+		if name == "" || !strings.HasSuffix(name, suffix) {
+			return nil
+		}
+		if _, ok := files[name]; ok {
+			return fmt.Errorf("artifact contains file %q more than once", name)
+		}
+		files[name] = data
+		return nil
+	}
+
+	used := make(map[string][]byte)
+	for _, layer := range manifest.Layers {
+		if !isFileLayer(layer) {
+			continue
+		}
+		data := blobs[layer.Digest.String()]
+		used[layer.Digest.String()] = data
+
+		if title := layer.Annotations[ocispec.AnnotationTitle]; title != "" {
+			if err := addFile(title, data); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := extractTar(data, isGzipLayer(layer.MediaType), addFile); err != nil {
+			return nil, fmt.Errorf("extracting layer %s: %w", layer.Digest, err)
+		}
+	}
+
+	return &Artifact{Digest: dgst, Files: files, Manifest: raw, Blobs: used}, nil
+}
+
+// isFileLayer returns true if files are read from layer.
+func isFileLayer(layer ocispec.Descriptor) bool {
+	return layer.Annotations[ocispec.AnnotationTitle] != "" || isTarLayer(layer.MediaType)
+}
+
+func isTarLayer(mediaType string) bool {
+	return mediaType == ocispec.MediaTypeImageLayer || isGzipLayer(mediaType) ||
+		mediaType == "application/vnd.docker.image.rootfs.diff.tar.gzip"
+}
+
+func isGzipLayer(mediaType string) bool {
+	return strings.HasSuffix(mediaType, "+gzip") || strings.HasSuffix(mediaType, ".tar.gzip")
+}
+
+// extractTar calls fn for every regular file in the tar archive data.
+func extractTar(data []byte, gzipped bool, fn func(name string, data []byte) error) error {
+	var r io.Reader = bytes.NewReader(data)
+	if gzipped {
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		bb, err := readLimited(tr, maxBlobSize)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", hdr.Name, err)
+		}
+		if err := fn(hdr.Name, bb); err != nil {
+			return err
+		}
+	}
+}
+
+// fetchManifest downloads and verifies the manifest ref points to, returning
+// its raw content along with its digest.
+func (c *Client) fetchManifest(ctx context.Context, ref Reference) ([]byte, string, error) {
+	accept := strings.Join([]string{ocispec.MediaTypeImageManifest, mediaTypeDockerManifest}, ", ")
+	resp, err := c.do(ctx, ref, "manifests/"+ref.Reference, accept)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	bb, err := readLimited(resp.Body, maxManifestSize)
+	if err != nil {
+		return nil, "", fmt.Errorf("reading manifest for %s: %w", ref, err)
+	}
+
+	dgst := digest.FromBytes(bb)
+	if ref.IsDigest() {
+		expect, err := digest.Parse(ref.Reference)
+		if err != nil {
+			return nil, "", err
+		}
+		if !verify(expect, bb) {
+			return nil, "", fmt.Errorf("manifest for %s does not match its digest", ref)
+		}
+		dgst = expect
+	} else if header := resp.Header.Get("Docker-Content-Digest"); header != "" {
+		expect, err := digest.Parse(header)
+		if err != nil {
+			return nil, "", fmt.Errorf("registry returned invalid digest %q: %w", header, err)
+		}
+		if !verify(expect, bb) {
+			return nil, "", fmt.Errorf("manifest for %s does not match the digest %s reported by the registry", ref, expect)
+		}
+		dgst = expect
+	}
+	return bb, dgst.String(), nil
+}
+
+// parseManifest decodes the manifest of the artifact identified by name.
+func parseManifest(name string, bb []byte) (*ocispec.Manifest, error) {
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(bb, &manifest); err != nil {
+		return nil, fmt.Errorf("decoding manifest for %s: %w", name, err)
+	}
+	if manifest.MediaType == ocispec.MediaTypeImageIndex {
+		return nil, fmt.Errorf("%s refers to an image index, which is not supported", name)
+	}
+	return &manifest, nil
+}
+
+// fetchBlob downloads and verifies the blob desc refers to.
+func (c *Client) fetchBlob(ctx context.Context, ref Reference, desc ocispec.Descriptor) ([]byte, error) {
+	if err := desc.Digest.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid layer digest %q: %w", desc.Digest, err)
+	}
+	if desc.Size > maxBlobSize {
+		return nil, fmt.Errorf("layer %s is larger than the maximum of %d bytes", desc.Digest, maxBlobSize)
+	}
+
+	resp, err := c.do(ctx, ref, "blobs/"+desc.Digest.String(), "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	bb, err := readLimited(resp.Body, maxBlobSize)
+	if err != nil {
+		return nil, fmt.Errorf("reading layer %s: %w", desc.Digest, err)
+	}
+	if !verify(desc.Digest, bb) {
+		return nil, fmt.Errorf("layer %s does not match its digest", desc.Digest)
+	}
+	return bb, nil
+}
+
+func verify(dgst digest.Digest, bb []byte) bool {
+	if err := dgst.Validate(); err != nil {
+		return false
+	}
+	v := dgst.Verifier()
+	_, _ = v.Write(bb)
+	return v.Verified()
+}
+
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	bb, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(bb)) > limit {
+		return nil, fmt.Errorf("content exceeds the maximum size of %d bytes", limit)
+	}
+	return bb, nil
+}
+
+// do sends a GET request for the given path under the repository, handling
+// authentication challenges from the registry.
+func (c *Client) do(ctx context.Context, ref Reference, subpath string, accept string) (*http.Response, error) {
+	scheme := "https"
+	if c.opts.PlainHTTP {
+		scheme = "http"
+	}
+	u := fmt.Sprintf("%s://%s/v2/%s/%s", scheme, ref.Registry, ref.Repository, subpath)
+
+	resp, err := c.send(ctx, u, accept)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+
+		if err := c.authenticate(ctx, challenge, ref); err != nil {
+			return nil, fmt.Errorf("authenticating to %s: %w", ref.Registry, err)
+		}
+		if resp, err = c.send(ctx, u, accept); err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fetching %s from %s: unexpected status code %s", subpath, ref, resp.Status)
+	}
+	return resp, nil
+}
+
+func (c *Client) send(ctx context.Context, u string, accept string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	c.mut.Lock()
+	token := c.token
+	c.mut.Unlock()
+
+	switch {
+	case token != "":
+		req.Header.Set("Authorization", "Bearer "+token)
+	case c.opts.BasicAuth != nil:
+		req.SetBasicAuth(c.opts.BasicAuth.Username, string(c.opts.BasicAuth.Password))
+	}
+	return c.opts.HTTPClient.Do(req)
+}
+
+// authenticate handles a WWW-Authenticate challenge. Bearer challenges
+// retrieve a token from the registry's token service. Basic challenges can't
+// be satisfied, since the configured credentials were already sent.
+func (c *Client) authenticate(ctx context.Context, challenge string, ref Reference) error {
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if c.opts.BasicAuth == nil {
+			return fmt.Errorf("registry requires credentials")
+		}
+		return fmt.Errorf("registry rejected the configured credentials")
+	case "bearer":
+		return c.fetchToken(ctx, params, ref)
+	default:
+		return fmt.Errorf("unsupported authentication challenge %q", challenge)
+	}
+}
+
+func (c *Client) fetchToken(ctx context.Context, params map[string]string, ref Reference) error {
+	realm := params["realm"]
+	if realm == "" {
+		return fmt.Errorf("bearer challenge is missing a realm")
+	}
+	u, err := url.Parse(realm)
+	if err != nil {
+		return fmt.Errorf("invalid realm %q: %w", realm, err)
+	}
+
+	q := u.Query()
+	if service := params["service"]; service != "" {
+		q.Set("service", service)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + ref.Repository + ":pull"
+	}
+	q.Set("scope", scope)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	if c.opts.BasicAuth != nil {
+		req.SetBasicAuth(c.opts.BasicAuth.Username, string(c.opts.BasicAuth.Password))
+	}
+
+	resp, err := c.opts.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("token service returned unexpected status code %s", resp.Status)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(&body); err != nil {
+		return fmt.Errorf("decoding token response: %w", err)
+	}
+
+	token := body.Token
+	if token == "" {
+		token = body.AccessToken
+	}
+	if token == "" {
+		return fmt.Errorf("token service returned an empty token")
+	}
+
+	c.mut.Lock()
+	c.token = token
+	c.mut.Unlock()
+	return nil
+}
+
+// parseChallenge parses a WWW-Authenticate header of the form
+// `Scheme key="value", key2="value2"`.
+func parseChallenge(header string) (scheme string, params map[string]string) {
+	params = make(map[string]string)
+
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	for rest != "" {
+		var key, value string
+		rest = strings.TrimLeft(rest, " ,")
+		key, rest, _ = strings.Cut(rest, "=")
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		if key = strings.TrimSpace(key); key != "" {
+			params[strings.ToLower(key)] = value
+		}
+	}
+	return scheme, params
+}
@@ -0,0 +1,220 @@
+package oci_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grafana/agent/internal/oci"
+	"github.com/grafana/agent/internal/oci/ocitest"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReference(t *testing.T) {
+	ref, err := oci.ParseReference("localhost:5000/modules/math", "v1")
+	require.NoError(t, err)
+	require.Equal(t, oci.Reference{Registry: "localhost:5000", Repository: "modules/math", Reference: "v1"}, ref)
+	require.False(t, ref.IsDigest())
+	require.Equal(t, "localhost:5000/modules/math:v1", ref.String())
+
+	dgst := digest.FromString("test").String()
+	ref, err = oci.ParseReference("localhost:5000/math", dgst)
+	require.NoError(t, err)
+	require.True(t, ref.IsDigest())
+	require.Equal(t, "localhost:5000/math@"+dgst, ref.String())
+
+	_, err = oci.ParseReference("math", "v1")
+	require.ErrorContains(t, err, "must be in the form REGISTRY/REPOSITORY")
+	_, err = oci.ParseReference("localhost/math", "sha256:invalid")
+	require.ErrorContains(t, err, "invalid digest")
+}
+
+func TestClient_Pull(t *testing.T) {
+	reg := ocitest.NewRegistry(t)
+	dgst := reg.Push("modules/math", "v1", map[string]string{
+		"add.river":  "declare \"add\" {}",
+		"README.md":  "not a module",
+		"mult.river": "declare \"mult\" {}",
+	})
+
+	client := oci.NewClient(oci.Options{PlainHTTP: true})
+	ref, err := oci.ParseReference(reg.Host()+"/modules/math", "v1")
+	require.NoError(t, err)
+
+	resolved, err := client.Resolve(context.Background(), ref)
+	require.NoError(t, err)
+	require.Equal(t, dgst, resolved)
+
+	artifact, err := client.Pull(context.Background(), ref, ".river")
+	require.NoError(t, err)
+	require.Equal(t, dgst, artifact.Digest)
+	require.Equal(t, map[string][]byte{
+		"add.river":  []byte("declare \"add\" {}"),
+		"mult.river": []byte("declare \"mult\" {}"),
+	}, artifact.Files)
+
+	// Pulling by digest must yield the same artifact.
+	ref, err = oci.ParseReference(reg.Host()+"/modules/math", dgst)
+	require.NoError(t, err)
+	byDigest, err := client.Pull(context.Background(), ref, ".river")
+	require.NoError(t, err)
+	require.Equal(t, artifact, byDigest)
+}
+
+func TestClient_Pull_BasicAuth(t *testing.T) {
+	reg := ocitest.NewRegistry(t)
+	reg.RequireBasicAuth("user", "pass")
+	reg.Push("math", "latest", map[string]string{"add.river": "add"})
+
+	ref, err := oci.ParseReference(reg.Host()+"/math", "latest")
+	require.NoError(t, err)
+
+	_, err = oci.NewClient(oci.Options{PlainHTTP: true}).Pull(context.Background(), ref, "")
+	require.ErrorContains(t, err, "registry requires credentials")
+
+	client := oci.NewClient(oci.Options{
+		PlainHTTP: true,
+		BasicAuth: &oci.BasicAuth{Username: "user", Password: "pass"},
+	})
+	artifact, err := client.Pull(context.Background(), ref, "")
+	require.NoError(t, err)
+	require.Equal(t, []byte("add"), artifact.Files["add.river"])
+}
+
+func TestClient_Pull_TarLayerAndBearerToken(t *testing.T) {
+	layer := buildTarGzip(t, map[string]string{
+		"modules/add.river": "add",
+		"modules/notes.txt": "notes",
+	})
+	config := []byte("{}")
+	manifest, err := json.Marshal(ocispec.Manifest{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    ocispec.Descriptor{MediaType: ocispec.MediaTypeImageConfig, Digest: digest.FromBytes(config), Size: int64(len(config))},
+		Layers: []ocispec.Descriptor{
+			{MediaType: ocispec.MediaTypeImageLayerGzip, Digest: digest.FromBytes(layer), Size: int64(len(layer))},
+		},
+	})
+	require.NoError(t, err)
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			require.Equal(t, "repository:math:pull", r.URL.Query().Get("scope"))
+			require.Equal(t, "test", r.URL.Query().Get("service"))
+			_, _ = w.Write([]byte(`{"token": "secret-token"}`))
+		case r.Header.Get("Authorization") != "Bearer secret-token":
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+srv.URL+`/token",service="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/v2/math/manifests/latest":
+			_, _ = w.Write(manifest)
+		case r.URL.Path == "/v2/math/blobs/"+digest.FromBytes(layer).String():
+			_, _ = w.Write(layer)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	ref, err := oci.ParseReference(strings.TrimPrefix(srv.URL, "http://")+"/math", "latest")
+	require.NoError(t, err)
+
+	artifact, err := oci.NewClient(oci.Options{PlainHTTP: true}).Pull(context.Background(), ref, ".river")
+	require.NoError(t, err)
+	require.Equal(t, digest.FromBytes(manifest).String(), artifact.Digest)
+	require.Equal(t, map[string][]byte{"modules/add.river": []byte("add")}, artifact.Files)
+}
+
+func TestLoad(t *testing.T) {
+	reg := ocitest.NewRegistry(t)
+	dgst := reg.Push("modules/math", "v1", map[string]string{
+		"add.river": "declare \"add\" {}",
+	})
+
+	ref, err := oci.ParseReference(reg.Host()+"/modules/math", "v1")
+	require.NoError(t, err)
+	artifact, err := oci.NewClient(oci.Options{PlainHTTP: true}).Pull(context.Background(), ref, ".river")
+	require.NoError(t, err)
+
+	loaded, err := oci.Load(dgst, artifact.Manifest, artifact.Blobs, ".river")
+	require.NoError(t, err)
+	require.Equal(t, artifact, loaded)
+
+	_, err = oci.Load(digest.FromString("other").String(), artifact.Manifest, artifact.Blobs, ".river")
+	require.ErrorContains(t, err, "manifest does not match its digest")
+
+	tampered := make(map[string][]byte)
+	for k := range artifact.Blobs {
+		tampered[k] = []byte("tampered")
+	}
+	_, err = oci.Load(dgst, artifact.Manifest, tampered, ".river")
+	require.ErrorContains(t, err, "does not match its digest")
+}
+
+func TestClient_Pull_VerifiesDigests(t *testing.T) {
+	content := []byte("add")
+	manifest, err := json.Marshal(ocispec.Manifest{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Layers: []ocispec.Descriptor{{
+			MediaType:   "text/plain",
+			Digest:      digest.FromBytes(content),
+			Size:        int64(len(content)),
+			Annotations: map[string]string{ocispec.AnnotationTitle: "add.river"},
+		}},
+	})
+	require.NoError(t, err)
+
+	var tamperManifest bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.Contains(r.URL.Path, "/manifests/"):
+			w.Header().Set("Docker-Content-Digest", digest.FromBytes(manifest).String())
+			if tamperManifest {
+				_, _ = w.Write(append(manifest, ' '))
+				return
+			}
+			_, _ = w.Write(manifest)
+		case strings.Contains(r.URL.Path, "/blobs/"):
+			_, _ = w.Write([]byte("tampered"))
+		}
+	}))
+	defer srv.Close()
+
+	client := oci.NewClient(oci.Options{PlainHTTP: true})
+	ref, err := oci.ParseReference(strings.TrimPrefix(srv.URL, "http://")+"/math", "latest")
+	require.NoError(t, err)
+
+	_, err = client.Pull(context.Background(), ref, "")
+	require.ErrorContains(t, err, "does not match its digest")
+
+	tamperManifest = true
+	_, err = client.Pull(context.Background(), ref, "")
+	require.ErrorContains(t, err, "does not match the digest")
+}
+
+func buildTarGzip(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+	return buf.Bytes()
+}
@@ -0,0 +1,144 @@
+// Package ocitest provides an in-memory OCI registry for use in tests.
+package ocitest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Registry is an in-memory registry serving the pull endpoints of the OCI
+// distribution API.
+type Registry struct {
+	srv *httptest.Server
+
+	mut       sync.Mutex
+	manifests map[string][]byte // repository/reference -> manifest
+	blobs     map[string][]byte // digest -> content
+	requests  int
+	username  string
+	password  string
+}
+
+// NewRegistry starts a new Registry which is closed when the test finishes.
+func NewRegistry(t testing.TB) *Registry {
+	r := &Registry{
+		manifests: make(map[string][]byte),
+		blobs:     make(map[string][]byte),
+	}
+	r.srv = httptest.NewServer(http.HandlerFunc(r.serveHTTP))
+	t.Cleanup(r.srv.Close)
+	return r
+}
+
+// Host returns the host and port the registry is listening on.
+func (r *Registry) Host() string {
+	return strings.TrimPrefix(r.srv.URL, "http://")
+}
+
+// Close shuts down the registry, making it unreachable.
+func (r *Registry) Close() {
+	r.srv.Close()
+}
+
+// RequireBasicAuth makes the registry reject requests which don't use the
+// given credentials.
+func (r *Registry) RequireBasicAuth(username, password string) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.username, r.password = username, password
+}
+
+// Requests returns the number of requests the registry received.
+func (r *Registry) Requests() int {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return r.requests
+}
+
+// Push stores files as an artifact with one layer per file, and tags it with
+// tag. It returns the digest of the artifact's manifest.
+func (r *Registry) Push(repository, tag string, files map[string]string) string {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	config := []byte("{}")
+	manifest := ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    r.addBlob("application/vnd.grafana.agent.module.config.v1+json", config),
+	}
+	for name, content := range files {
+		desc := r.addBlob("text/plain", []byte(content))
+		desc.Annotations = map[string]string{ocispec.AnnotationTitle: name}
+		manifest.Layers = append(manifest.Layers, desc)
+	}
+
+	bb, err := json.Marshal(manifest)
+	if err != nil {
+		panic(err)
+	}
+	dgst := digest.FromBytes(bb)
+	r.manifests[repository+"/"+dgst.String()] = bb
+	if tag != "" {
+		r.manifests[repository+"/"+tag] = bb
+	}
+	return dgst.String()
+}
+
+func (r *Registry) addBlob(mediaType string, content []byte) ocispec.Descriptor {
+	dgst := digest.FromBytes(content)
+	r.blobs[dgst.String()] = content
+	return ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    dgst,
+		Size:      int64(len(content)),
+	}
+}
+
+func (r *Registry) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.requests++
+
+	if r.username != "" {
+		if u, p, ok := req.BasicAuth(); !ok || u != r.username || p != r.password {
+			w.Header().Set("WWW-Authenticate", `Basic realm="ocitest"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	switch {
+	case strings.Contains(path, "/manifests/"):
+		repo, ref, _ := strings.Cut(path, "/manifests/")
+		bb, ok := r.manifests[repo+"/"+ref]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+		w.Header().Set("Docker-Content-Digest", digest.FromBytes(bb).String())
+		_, _ = w.Write(bb)
+
+	case strings.Contains(path, "/blobs/"):
+		_, dgst, _ := strings.Cut(path, "/blobs/")
+		bb, ok := r.blobs[dgst]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		_, _ = w.Write(bb)
+
+	default:
+		http.NotFound(w, req)
+	}
+}
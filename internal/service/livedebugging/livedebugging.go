@@ -0,0 +1,153 @@
+// Package livedebugging implements the live debugging service for Flow.
+// Components publish samples of the data flowing through them to the service,
+// which passes them on to clients watching the component, such as the UI.
+package livedebugging
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/grafana/agent/internal/featuregate"
+	"github.com/grafana/agent/internal/service"
+)
+
+// ServiceName defines the name used for the live debugging service.
+const ServiceName = "livedebugging"
+
+// DebugDataPublisher is used by components to publish the data flowing
+// through them.
+type DebugDataPublisher interface {
+	// IsActive returns whether any client is watching the component with the
+	// given ID. Components should check IsActive before formatting data, so
+	// that live debugging costs nothing when nobody is watching.
+	IsActive(componentID string) bool
+
+	// Publish passes data to every client watching the component with the
+	// given ID. Publish must not be called while holding locks which a client
+	// could wait on, since clients are called synchronously.
+	Publish(componentID string, data string)
+}
+
+// CallbackManager is used by clients to watch components.
+type CallbackManager interface {
+	// AddCallback registers callback to be called with the data published by
+	// the component with the given ID. callback must not block. The returned
+	// function removes the callback.
+	AddCallback(componentID string, callback func(data string)) (remove func())
+}
+
+// Service implements the live debugging service.
+type Service struct {
+	mut       sync.RWMutex
+	nextID    uint64
+	callbacks map[string]map[uint64]func(string) // Component ID -> callback ID -> callback
+}
+
+var (
+	_ service.Service    = (*Service)(nil)
+	_ DebugDataPublisher = (*Service)(nil)
+	_ CallbackManager    = (*Service)(nil)
+)
+
+// New returns a new, unstarted live debugging service.
+func New() *Service {
+	return &Service{
+		callbacks: make(map[string]map[uint64]func(string)),
+	}
+}
+
+// Definition implements service.Service.
+func (*Service) Definition() service.Definition {
+	return service.Definition{
+		Name:       ServiceName,
+		ConfigType: nil, // livedebugging does not accept configuration
+		DependsOn:  []string{},
+		Stability:  featuregate.StabilityStable,
+	}
+}
+
+// Run implements service.Service.
+func (*Service) Run(ctx context.Context, host service.Host) error {
+	<-ctx.Done()
+	return nil
+}
+
+// Update implements service.Service.
+func (*Service) Update(newConfig any) error {
+	return fmt.Errorf("livedebugging service does not support configuration")
+}
+
+// Data implements service.Service. It returns the Service itself, which
+// implements both DebugDataPublisher and CallbackManager.
+func (s *Service) Data() any {
+	return s
+}
+
+// IsActive implements DebugDataPublisher.
+func (s *Service) IsActive(componentID string) bool {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+	return len(s.callbacks[componentID]) > 0
+}
+
+// Publish implements DebugDataPublisher. Callbacks are called after the lock
+// is released, so a slow or reentrant callback doesn't block other callers.
+func (s *Service) Publish(componentID string, data string) {
+	s.mut.RLock()
+	callbacks := make([]func(string), 0, len(s.callbacks[componentID]))
+	for _, callback := range s.callbacks[componentID] {
+		callbacks = append(callbacks, callback)
+	}
+	s.mut.RUnlock()
+
+	for _, callback := range callbacks {
+		callback(data)
+	}
+}
+
+// AddCallback implements CallbackManager.
+func (s *Service) AddCallback(componentID string, callback func(data string)) (remove func()) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	id := s.nextID
+	s.nextID++
+	if s.callbacks[componentID] == nil {
+		s.callbacks[componentID] = make(map[uint64]func(string))
+	}
+	s.callbacks[componentID][id] = callback
+
+	return func() {
+		s.mut.Lock()
+		defer s.mut.Unlock()
+		delete(s.callbacks[componentID], id)
+		if len(s.callbacks[componentID]) == 0 {
+			delete(s.callbacks, componentID)
+		}
+	}
+}
+
+// GetPublisher returns the DebugDataPublisher of the live debugging service
+// from getServiceData, which is usually component.Options.GetServiceData. If
+// the service isn't available, as is the case when components are built in
+// tests, a publisher which discards all data is returned.
+func GetPublisher(getServiceData func(name string) (interface{}, error)) DebugDataPublisher {
+	if getServiceData == nil {
+		return noopPublisher{}
+	}
+	data, err := getServiceData(ServiceName)
+	if err != nil {
+		return noopPublisher{}
+	}
+	publisher, ok := data.(DebugDataPublisher)
+	if !ok {
+		return noopPublisher{}
+	}
+	return publisher
+}
+
+type noopPublisher struct{}
+
+func (noopPublisher) IsActive(string) bool   { return false }
+func (noopPublisher) Publish(string, string) {}
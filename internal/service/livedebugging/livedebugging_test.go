@@ -0,0 +1,74 @@
+package livedebugging
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestService(t *testing.T) {
+	s := New()
+	publisher := s.Data().(DebugDataPublisher)
+	manager := s.Data().(CallbackManager)
+
+	require.False(t, publisher.IsActive("a"))
+	publisher.Publish("a", "nobody is watching")
+
+	var first, second []string
+	removeFirst := manager.AddCallback("a", func(data string) { first = append(first, data) })
+	removeSecond := manager.AddCallback("a", func(data string) { second = append(second, data) })
+	require.True(t, publisher.IsActive("a"))
+	require.False(t, publisher.IsActive("b"))
+
+	publisher.Publish("a", "one")
+	publisher.Publish("b", "other component")
+	removeFirst()
+	publisher.Publish("a", "two")
+
+	require.Equal(t, []string{"one"}, first)
+	require.Equal(t, []string{"one", "two"}, second)
+
+	removeSecond()
+	require.False(t, publisher.IsActive("a"))
+}
+
+func TestService_CallbackRemovesItself(t *testing.T) {
+	s := New()
+
+	// A callback which removes itself would deadlock if it was called while
+	// the lock is held.
+	var (
+		calls  int
+		remove func()
+	)
+	remove = s.AddCallback("a", func(string) {
+		calls++
+		remove()
+	})
+
+	s.Publish("a", "one")
+	s.Publish("a", "two")
+	require.Equal(t, 1, calls)
+	require.False(t, s.IsActive("a"))
+}
+
+func TestGetPublisher(t *testing.T) {
+	s := New()
+
+	publisher := GetPublisher(func(name string) (interface{}, error) {
+		require.Equal(t, ServiceName, name)
+		return s.Data(), nil
+	})
+	require.Equal(t, s, publisher)
+
+	// Components still work when the service isn't available.
+	publisher = GetPublisher(func(string) (interface{}, error) {
+		return nil, errors.New("no such service")
+	})
+	require.False(t, publisher.IsActive("a"))
+	publisher.Publish("a", "discarded")
+
+	publisher = GetPublisher(nil)
+	require.False(t, publisher.IsActive("a"))
+}
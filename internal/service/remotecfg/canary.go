@@ -0,0 +1,210 @@
+package remotecfg
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/grafana/agent/internal/component"
+	"github.com/grafana/agent/internal/flow/logging/level"
+	"github.com/grafana/agent/internal/service"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultCanaryCheckInterval is how often component health is checked while
+// a new configuration is being canaried.
+const defaultCanaryCheckInterval = 5 * time.Second
+
+// CanaryOptions configures automatic rollback of remote configurations which
+// make components unhealthy.
+type CanaryOptions struct {
+	GracePeriod        time.Duration `river:"grace_period,attr,optional"`
+	UnhealthyThreshold float64       `river:"unhealthy_threshold,attr,optional"`
+}
+
+// DefaultCanaryOptions holds the default settings for the canary block.
+var DefaultCanaryOptions = CanaryOptions{
+	GracePeriod:        5 * time.Minute,
+	UnhealthyThreshold: 0.5,
+}
+
+// SetToDefault implements river.Defaulter.
+func (o *CanaryOptions) SetToDefault() {
+	*o = DefaultCanaryOptions
+}
+
+// Validate implements river.Validator.
+func (o *CanaryOptions) Validate() error {
+	if o.GracePeriod <= 0 {
+		return fmt.Errorf("grace_period must be greater than 0")
+	}
+	if o.UnhealthyThreshold <= 0 || o.UnhealthyThreshold > 1 {
+		return fmt.Errorf("unhealthy_threshold must be greater than 0 and at most 1")
+	}
+	return nil
+}
+
+// canaryState tracks a newly loaded configuration until it's either promoted
+// to be the last known-good configuration or rolled back.
+type canaryState struct {
+	config    []byte
+	signature string
+	hash      string
+	deadline  time.Time
+}
+
+type metrics struct {
+	rollbacksTotal   prometheus.Counter
+	canaryInProgress prometheus.Gauge
+}
+
+func newMetrics(reg prometheus.Registerer) *metrics {
+	m := &metrics{
+		rollbacksTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "agent_remotecfg_rollbacks_total",
+			Help: "Total number of remote configurations rolled back because components became unhealthy.",
+		}),
+		canaryInProgress: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "agent_remotecfg_canary_in_progress",
+			Help: "Set to 1 while a new remote configuration is within its canary grace period.",
+		}),
+	}
+
+	if reg != nil {
+		reg.MustRegister(m.rollbacksTotal, m.canaryInProgress)
+	}
+	return m
+}
+
+// startCanary starts canarying a newly loaded configuration. It returns false
+// if canarying is disabled, or if there is no known-good configuration to
+// roll back to.
+//
+// startCanary must be called with loadMut held.
+func (s *Service) startCanary(b []byte, sig, hash string) bool {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if s.args.Canary == nil || s.lastGoodConfig == nil {
+		s.canary = nil
+		s.metrics.canaryInProgress.Set(0)
+		return false
+	}
+
+	s.canary = &canaryState{
+		config:    b,
+		signature: sig,
+		hash:      hash,
+		deadline:  time.Now().Add(s.args.Canary.GracePeriod),
+	}
+	s.metrics.canaryInProgress.Set(1)
+	level.Info(s.opts.Logger).Log("msg", "canarying new remote configuration", "hash", hash, "grace_period", s.args.Canary.GracePeriod)
+	return true
+}
+
+// setLastGood marks b as the last known-good configuration, and caches it on
+// disk along with its signature.
+//
+// setLastGood must be called with loadMut held.
+func (s *Service) setLastGood(b []byte, sig string) {
+	s.mut.Lock()
+	s.lastGoodConfig = b
+	s.mut.Unlock()
+
+	s.setCachedConfig(b, sig)
+}
+
+// runCanary periodically checks the health of components while a
+// configuration is being canaried.
+func (s *Service) runCanary(ctx context.Context, host service.Host) {
+	t := time.NewTicker(s.canaryCheckInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			s.checkCanary(host)
+		}
+	}
+}
+
+// checkCanary rolls back the canaried configuration if too many components
+// are unhealthy, or promotes it once its grace period has passed.
+func (s *Service) checkCanary(host service.Host) {
+	s.loadMut.Lock()
+	defer s.loadMut.Unlock()
+
+	s.mut.RLock()
+	var (
+		canary = s.canary
+		opts   = s.args.Canary
+		prev   = s.lastGoodConfig
+	)
+	s.mut.RUnlock()
+
+	switch {
+	case canary == nil:
+		return
+	case opts == nil:
+		// Canarying was disabled in the meantime.
+		s.promote(canary)
+		return
+	}
+
+	unhealthy, total := s.componentHealth(host)
+	if total > 0 && float64(unhealthy)/float64(total) >= opts.UnhealthyThreshold {
+		s.rollback(canary, prev, unhealthy, total)
+		return
+	}
+
+	if time.Now().After(canary.deadline) {
+		s.promote(canary)
+	}
+}
+
+func (s *Service) promote(canary *canaryState) {
+	level.Info(s.opts.Logger).Log("msg", "remote configuration passed its canary grace period", "hash", canary.hash)
+
+	s.setLastGood(canary.config, canary.signature)
+
+	s.mut.Lock()
+	s.canary = nil
+	s.mut.Unlock()
+	s.metrics.canaryInProgress.Set(0)
+}
+
+func (s *Service) rollback(canary *canaryState, prev []byte, unhealthy, total int) {
+	reason := fmt.Errorf("%d of %d components became unhealthy within the canary grace period", unhealthy, total)
+	level.Warn(s.opts.Logger).Log("msg", "rolling back remote configuration to the last known-good configuration", "hash", canary.hash, "reason", reason)
+
+	s.mut.Lock()
+	s.canary = nil
+	s.rejectedHash = canary.hash
+	s.mut.Unlock()
+	s.metrics.canaryInProgress.Set(0)
+	s.metrics.rollbacksTotal.Inc()
+
+	if err := s.parseAndLoad(prev); err != nil {
+		level.Error(s.opts.Logger).Log("msg", "failed to load the last known-good remote configuration", "err", err)
+	}
+}
+
+// componentHealth returns the number of unhealthy components, and the total
+// number of components, defined by the remote configuration.
+func (s *Service) componentHealth(host service.Host) (unhealthy, total int) {
+	infos, err := host.ListComponents(ServiceName, component.InfoOptions{GetHealth: true})
+	if err != nil {
+		level.Debug(s.opts.Logger).Log("msg", "failed to list components to check their health", "err", err)
+		return 0, 0
+	}
+
+	for _, info := range infos {
+		switch info.Health.Health {
+		case component.HealthTypeUnhealthy, component.HealthTypeExited:
+			unhealthy++
+		}
+	}
+	return unhealthy, len(infos)
+}
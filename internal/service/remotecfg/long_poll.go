@@ -0,0 +1,164 @@
+package remotecfg
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"connectrpc.com/connect"
+	agentv1 "github.com/grafana/agent-remote-config/api/gen/proto/go/agent/v1"
+	"github.com/grafana/agent/internal/flow/logging/level"
+)
+
+const (
+	// longPollGracePeriod is added to the long-poll timeout to give the API time
+	// to respond after holding a request for the full timeout.
+	longPollGracePeriod = 10 * time.Second
+
+	// longPollMinBackoff is the initial delay before retrying a failed
+	// long-poll request.
+	longPollMinBackoff = time.Second
+)
+
+// runLongPoll continuously long-polls the API for configuration changes while
+// long polling is enabled. Failed requests are retried with a jittered
+// exponential backoff, during which the service falls back to polling.
+func (s *Service) runLongPoll(ctx context.Context) {
+	var failures int
+
+	for ctx.Err() == nil {
+		timeout, pollFrequency := s.longPollSettings()
+		if timeout == 0 || !s.isEnabled() {
+			s.longPollHealthy.Store(false)
+			failures = 0
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.updated:
+			}
+			continue
+		}
+
+		start := time.Now()
+		changed, err := s.longPoll(ctx, timeout)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			s.longPollHealthy.Store(false)
+			delay := jitteredBackoff(failures, longPollMinBackoff, pollFrequency)
+			failures++
+
+			level.Warn(s.opts.Logger).Log("msg", "long-poll request to the API failed, falling back to polling", "err", err, "retry_in", delay)
+			s.sleep(ctx, delay)
+			continue
+		}
+
+		s.longPollHealthy.Store(true)
+		failures = 0
+
+		// An API which doesn't support long polling responds immediately. Wait
+		// for the rest of the poll interval to avoid sending requests in a
+		// tight loop.
+		if elapsed := time.Since(start); !changed && elapsed < pollFrequency {
+			s.sleep(ctx, pollFrequency-elapsed)
+		}
+	}
+}
+
+// longPoll sends a single long-poll request to the API, asking it to hold
+// the request until the configuration changes or until timeout elapses. It
+// returns true if a new configuration was loaded. Failures to load the
+// received configuration are logged rather than returned.
+func (s *Service) longPoll(ctx context.Context, timeout time.Duration) (bool, error) {
+	s.mut.RLock()
+	req := connect.NewRequest(&agentv1.GetConfigRequest{
+		Id:       s.args.ID,
+		Metadata: s.args.Metadata,
+	})
+	client := s.asClient
+	currentHash := s.currentConfigHash
+	// Use the hash of the last received configuration, so that the API can
+	// hold the request even if that configuration failed to load.
+	receivedHash := s.receivedHash
+	if receivedHash == "" {
+		receivedHash = currentHash
+	}
+	s.mut.RUnlock()
+
+	etag := strconv.Quote(receivedHash)
+	if receivedHash != "" {
+		req.Header().Set("If-None-Match", etag)
+	}
+	req.Header().Set("Prefer", fmt.Sprintf("wait=%d", int64(timeout.Seconds())))
+
+	ctx, cancel := context.WithTimeout(ctx, timeout+longPollGracePeriod)
+	defer cancel()
+
+	rsp, err := client.GetConfig(ctx, req)
+	if err != nil {
+		return false, err
+	}
+	if receivedHash != "" && rsp.Header().Get("ETag") == etag {
+		return false, nil
+	}
+
+	newHash := getHash([]byte(rsp.Msg.GetContent()))
+	if newHash == currentHash {
+		return false, nil
+	}
+	if err := s.applyAPIConfig([]byte(rsp.Msg.GetContent()), rsp.Header().Get(SignatureHeader)); err != nil {
+		level.Error(s.opts.Logger).Log("msg", "failed to load remote configuration from the API", "err", err)
+	}
+	return s.getCfgHash() == newHash, nil
+}
+
+// longPollActive returns true if long polling is enabled and the last
+// long-poll request succeeded.
+func (s *Service) longPollActive() bool {
+	timeout, _ := s.longPollSettings()
+	return timeout > 0 && s.longPollHealthy.Load()
+}
+
+func (s *Service) longPollSettings() (timeout, pollFrequency time.Duration) {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+	return s.args.LongPollTimeout, s.args.PollFrequency
+}
+
+// sleep waits for d to elapse, ctx to be canceled, or the service to be
+// updated, whichever comes first.
+func (s *Service) sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-s.updated:
+	case <-t.C:
+	}
+}
+
+// jitteredBackoff returns the delay before the next attempt after the given
+// number of consecutive failures. The delay doubles after every failure up to
+// max, and is randomly picked between half and the full delay to avoid many
+// agents reconnecting at once.
+func jitteredBackoff(failures int, min, max time.Duration) time.Duration {
+	if max < min {
+		max = min
+	}
+
+	d := min
+	for i := 0; i < failures && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
@@ -20,8 +20,11 @@ import (
 	"github.com/grafana/agent/internal/featuregate"
 	"github.com/grafana/agent/internal/flow/logging/level"
 	"github.com/grafana/agent/internal/service"
+	"github.com/grafana/agent/internal/signature"
 	"github.com/grafana/river"
+	"github.com/prometheus/client_golang/prometheus"
 	commonconfig "github.com/prometheus/common/config"
+	"go.uber.org/atomic"
 )
 
 func getHash(in []byte) string {
@@ -48,16 +51,35 @@ type Service struct {
 	ticker            *time.Ticker
 	dataPath          string
 	currentConfigHash string
+	verifier          *signature.Verifier
+
+	updated         chan struct{} // Notified when Arguments change.
+	longPollHealthy atomic.Bool
+
+	// loadMut serializes loading configurations, which may happen from
+	// polling, long polling, and canary checks.
+	loadMut             sync.Mutex
+	metrics             *metrics
+	canaryCheckInterval time.Duration
+	lastGoodConfig      []byte       // Last known-good configuration, protected by mut.
+	canary              *canaryState // In-progress canary, protected by mut.
+	rejectedHash        string       // Hash of the last rolled back configuration, protected by mut.
+	receivedHash        string       // Hash of the latest configuration returned by the API, protected by mut.
 }
 
 // ServiceName defines the name used for the remotecfg service.
 const ServiceName = "remotecfg"
 
+// SignatureHeader is the response header holding the base64-encoded detached
+// signature of the configuration served by the API.
+const SignatureHeader = "X-Config-Signature"
+
 // Options are used to configure the remotecfg service. Options are
 // constant for the lifetime of the remotecfg service.
 type Options struct {
-	Logger      log.Logger // Where to send logs.
-	StoragePath string     // Where to cache configuration on-disk.
+	Logger      log.Logger            // Where to send logs.
+	StoragePath string                // Where to cache configuration on-disk.
+	Metrics     prometheus.Registerer // Where to send metrics to.
 }
 
 // Arguments holds runtime settings for the remotecfg service.
@@ -66,6 +88,9 @@ type Arguments struct {
 	ID               string                   `river:"id,attr,optional"`
 	Metadata         map[string]string        `river:"metadata,attr,optional"`
 	PollFrequency    time.Duration            `river:"poll_frequency,attr,optional"`
+	LongPollTimeout  time.Duration            `river:"long_poll_timeout,attr,optional"`
+	Canary           *CanaryOptions           `river:"canary,block,optional"`
+	Verify           *signature.Arguments     `river:"verify,block,optional"`
 	HTTPClientConfig *config.HTTPClientConfig `river:",squash"`
 }
 
@@ -86,6 +111,10 @@ func (a *Arguments) SetToDefault() {
 
 // Validate implements river.Validator.
 func (a *Arguments) Validate() error {
+	if a.LongPollTimeout < 0 {
+		return fmt.Errorf("long_poll_timeout must not be negative")
+	}
+
 	// We must explicitly Validate because HTTPClientConfig is squashed and it
 	// won't run otherwise
 	if a.HTTPClientConfig != nil {
@@ -113,8 +142,12 @@ func New(opts Options) (*Service, error) {
 	}
 
 	return &Service{
-		opts:   opts,
-		ticker: time.NewTicker(math.MaxInt64),
+		opts:    opts,
+		ticker:  time.NewTicker(math.MaxInt64),
+		updated: make(chan struct{}, 1),
+
+		metrics:             newMetrics(opts.Metrics),
+		canaryCheckInterval: defaultCanaryCheckInterval,
 	}, nil
 }
 
@@ -147,12 +180,22 @@ func (s *Service) Run(ctx context.Context, host service.Host) error {
 		s.ctrl.Run(ctx)
 	}()
 
+	// Long poll for updates if enabled. Polling is only used as a fallback
+	// while long polling is failing.
+	go s.runLongPoll(ctx)
+
+	// Roll back new configurations which make components unhealthy if
+	// canarying is enabled.
+	go s.runCanary(ctx, host)
+
 	for {
 		select {
 		case <-s.ch:
-			err := s.fetchRemote()
-			if err != nil {
-				level.Error(s.opts.Logger).Log("msg", "failed to fetch remote configuration from the API", "err", err)
+			if !s.longPollActive() {
+				err := s.fetchRemote()
+				if err != nil {
+					level.Error(s.opts.Logger).Log("msg", "failed to fetch remote configuration from the API", "err", err)
+				}
 			}
 		case <-ctx.Done():
 			s.ticker.Stop()
@@ -172,16 +215,26 @@ func (s *Service) Update(newConfig any) error {
 		s.ch = nil
 		s.ticker.Reset(math.MaxInt64)
 		s.asClient = noopClient{}
+		s.receivedHash = ""
+		s.canary = nil
+		s.verifier = nil
 		s.args.HTTPClientConfig = config.CloneDefaultHTTPClientConfig()
 		s.mut.Unlock()
 
 		s.setCfgHash("")
+		s.notifyUpdated()
 		return nil
 	}
 
+	verifier, err := signature.FromArguments(newArgs.Verify)
+	if err != nil {
+		return err
+	}
+
 	s.mut.Lock()
 	hash, err := newArgs.Hash()
 	if err != nil {
+		s.mut.Unlock()
 		return err
 	}
 	s.dataPath = filepath.Join(s.opts.StoragePath, ServiceName, hash)
@@ -191,6 +244,7 @@ func (s *Service) Update(newConfig any) error {
 	if !reflect.DeepEqual(s.args.HTTPClientConfig, newArgs.HTTPClientConfig) {
 		httpClient, err := commonconfig.NewClientFromConfig(*newArgs.HTTPClientConfig.Convert(), "remoteconfig")
 		if err != nil {
+			s.mut.Unlock()
 			return err
 		}
 		s.asClient = agentv1connect.NewAgentServiceClient(
@@ -198,8 +252,10 @@ func (s *Service) Update(newConfig any) error {
 			newArgs.URL,
 		)
 	}
+	s.verifier = verifier
 	s.args = newArgs // Update the args as the last step to avoid polluting any comparisons
 	s.mut.Unlock()
+	s.notifyUpdated()
 
 	// If we've already called Run, then immediately trigger an API call with
 	// the updated Arguments, and/or fall back to the updated cache location.
@@ -210,6 +266,13 @@ func (s *Service) Update(newConfig any) error {
 	return nil
 }
 
+func (s *Service) notifyUpdated() {
+	select {
+	case s.updated <- struct{}{}:
+	default:
+	}
+}
+
 // fetch attempts to read configuration from the API and the local cache
 // and then parse/load their contents in order of preference.
 func (s *Service) fetch() {
@@ -222,43 +285,109 @@ func (s *Service) fetchRemote() error {
 		return nil
 	}
 
-	b, err := s.getAPIConfig()
+	b, sig, err := s.getAPIConfig()
 	if err != nil {
 		return err
 	}
+	return s.applyAPIConfig(b, sig)
+}
+
+// applyAPIConfig loads configuration returned by the API, unless it's
+// unchanged, and caches it on disk. If signature verification is enabled,
+// configurations without a valid signature are rejected.
+func (s *Service) applyAPIConfig(b []byte, sig string) error {
+	s.loadMut.Lock()
+	defer s.loadMut.Unlock()
 
 	// API return the same configuration, no need to reload.
 	newConfigHash := getHash(b)
 	if s.getCfgHash() == newConfigHash {
 		level.Debug(s.opts.Logger).Log("msg", "skipping over API response since it contained the same hash")
+		s.setReceivedHash(newConfigHash)
 		return nil
 	}
 
-	err = s.parseAndLoad(b)
-	if err != nil {
+	// Don't reload a configuration which was just rolled back until the API
+	// serves a different one.
+	s.mut.Lock()
+	rejected := s.rejectedHash == newConfigHash
+	if !rejected {
+		s.rejectedHash = ""
+	}
+	s.mut.Unlock()
+	if rejected {
+		level.Debug(s.opts.Logger).Log("msg", "skipping over API response since it contained a configuration which was rolled back")
+		return nil
+	}
+
+	s.setReceivedHash(newConfigHash)
+	if err := s.verifySignature(b, sig); err != nil {
 		return err
 	}
 
-	// If successful, flush to disk and keep a copy.
-	s.setCachedConfig(b)
+	err := s.parseAndLoad(b)
+	if err != nil {
+		return err
+	}
 	s.setCfgHash(newConfigHash)
+
+	// If successful, flush to disk and keep a copy. When canarying, this is
+	// delayed until the configuration passes its grace period.
+	if !s.startCanary(b, sig, newConfigHash) {
+		s.setLastGood(b, sig)
+	}
 	return nil
 }
 
 func (s *Service) fetchLocal() {
-	b, err := s.getCachedConfig()
+	s.loadMut.Lock()
+	defer s.loadMut.Unlock()
+
+	b, sig, err := s.getCachedConfig()
 	if err != nil {
 		level.Error(s.opts.Logger).Log("msg", "failed to read from cache", "err", err)
 		return
 	}
 
+	// The cache is verified like an API response, since its contents may have
+	// been modified on disk.
+	if err := s.verifySignature(b, sig); err != nil {
+		level.Error(s.opts.Logger).Log("msg", "failed to load from cache", "err", err)
+		return
+	}
+
 	err = s.parseAndLoad(b)
 	if err != nil {
 		level.Error(s.opts.Logger).Log("msg", "failed to load from cache", "err", err)
+		return
+	}
+
+	s.mut.Lock()
+	s.lastGoodConfig = b
+	s.mut.Unlock()
+}
+
+// verifySignature checks sig against b if signature verification is enabled.
+func (s *Service) verifySignature(b []byte, sig string) error {
+	s.mut.RLock()
+	verifier := s.verifier
+	s.mut.RUnlock()
+
+	if verifier == nil {
+		return nil
+	}
+	if sig == "" {
+		return fmt.Errorf("refusing to load remote configuration: the API response has no %s header", SignatureHeader)
 	}
+	if err := verifier.Verify(b, []byte(sig)); err != nil {
+		return fmt.Errorf("refusing to load remote configuration: %w", err)
+	}
+	return nil
 }
 
-func (s *Service) getAPIConfig() ([]byte, error) {
+// getAPIConfig returns the configuration served by the API along with its
+// signature, if any.
+func (s *Service) getAPIConfig() ([]byte, string, error) {
 	s.mut.RLock()
 	req := connect.NewRequest(&agentv1.GetConfigRequest{
 		Id:       s.args.ID,
@@ -269,21 +398,33 @@ func (s *Service) getAPIConfig() ([]byte, error) {
 
 	gcr, err := client.GetConfig(context.Background(), req)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	return []byte(gcr.Msg.GetContent()), nil
+	return []byte(gcr.Msg.GetContent()), gcr.Header().Get(SignatureHeader), nil
 }
 
-func (s *Service) getCachedConfig() ([]byte, error) {
+// getCachedConfig returns the cached configuration along with its signature,
+// if any.
+func (s *Service) getCachedConfig() ([]byte, string, error) {
 	s.mut.RLock()
 	p := s.dataPath
 	s.mut.RUnlock()
 
-	return os.ReadFile(p)
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, "", err
+	}
+	sig, err := os.ReadFile(p + signature.Suffix)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, "", err
+	}
+	return b, string(sig), nil
 }
 
-func (s *Service) setCachedConfig(b []byte) {
+// setCachedConfig caches b and its signature on disk. The signature is stored
+// next to the configuration, with signature.Suffix appended to its name.
+func (s *Service) setCachedConfig(b []byte, sig string) {
 	s.mut.RLock()
 	p := s.dataPath
 	s.mut.RUnlock()
@@ -291,6 +432,19 @@ func (s *Service) setCachedConfig(b []byte) {
 	err := os.WriteFile(p, b, 0750)
 	if err != nil {
 		level.Error(s.opts.Logger).Log("msg", "failed to flush remote configuration contents the on-disk cache", "err", err)
+		return
+	}
+
+	if sig == "" {
+		err = os.Remove(p + signature.Suffix)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	} else {
+		err = os.WriteFile(p+signature.Suffix, []byte(sig), 0750)
+	}
+	if err != nil {
+		level.Error(s.opts.Logger).Log("msg", "failed to flush remote configuration signature to the on-disk cache", "err", err)
 	}
 }
 
@@ -326,6 +480,13 @@ func (s *Service) setCfgHash(h string) {
 	s.currentConfigHash = h
 }
 
+func (s *Service) setReceivedHash(h string) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	s.receivedHash = h
+}
+
 func (s *Service) isEnabled() bool {
 	s.mut.RLock()
 	defer s.mut.RUnlock()
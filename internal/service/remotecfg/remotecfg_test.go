@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
@@ -18,11 +19,15 @@ import (
 	"github.com/grafana/agent/internal/flow/componenttest"
 	"github.com/grafana/agent/internal/flow/logging"
 	"github.com/grafana/agent/internal/service"
+	"github.com/grafana/agent/internal/signature"
+	"github.com/grafana/agent/internal/signature/signaturetest"
 	"github.com/grafana/agent/internal/util"
 	"github.com/grafana/river"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
 )
 
 func TestOnDiskCache(t *testing.T) {
@@ -103,6 +108,378 @@ func TestAPIResponse(t *testing.T) {
 	}, time.Second, 10*time.Millisecond)
 }
 
+func TestLongPoll(t *testing.T) {
+	url := "https://example.com/"
+	cfg1 := `loki.process "default" { forward_to = [] }`
+	cfg2 := `loki.process "updated" { forward_to = [] }`
+
+	// Create a new service which only polls once an hour.
+	env := newTestEnvironment(t)
+	require.NoError(t, env.ApplyConfig(fmt.Sprintf(`
+		url               = "%s"
+		poll_frequency    = "1h"
+		long_poll_timeout = "1m"
+	`, url)))
+
+	// Mock an API which holds long-poll requests until the configuration
+	// changes.
+	var (
+		changed    = make(chan struct{})
+		current    atomic.String
+		lastPrefer atomic.String
+	)
+	current.Store(cfg1)
+	client := &agentClient{}
+	env.svc.asClient = client
+	client.getConfigFunc = func(ctx context.Context, req *connect.Request[agentv1.GetConfigRequest]) (*connect.Response[agentv1.GetConfigResponse], error) {
+		cfg := current.Load()
+		if req.Header().Get("If-None-Match") == strconv.Quote(getHash([]byte(cfg))) {
+			lastPrefer.Store(req.Header().Get("Prefer"))
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-changed:
+				cfg = current.Load()
+			}
+		}
+		return buildGetConfigHandler(cfg)(ctx, req)
+	}
+
+	runTestEnvironment(t, env)
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Equal(c, getHash([]byte(cfg1)), env.svc.getCfgHash())
+		assert.Equal(c, "wait=60", lastPrefer.Load())
+	}, time.Second, 10*time.Millisecond)
+
+	// Verify that the updated configuration is loaded as soon as the API
+	// responds, without waiting for the poll frequency.
+	current.Store(cfg2)
+	close(changed)
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Equal(c, getHash([]byte(cfg2)), env.svc.getCfgHash())
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestLongPollInvalidConfig(t *testing.T) {
+	url := "https://example.com/"
+	invalidCfg := `loki.process "default" { unknown = true }`
+
+	// Create a new service which only polls once an hour.
+	env := newTestEnvironment(t)
+	require.NoError(t, env.ApplyConfig(fmt.Sprintf(`
+		url               = "%s"
+		poll_frequency    = "1h"
+		long_poll_timeout = "1m"
+	`, url)))
+
+	// Mock an API which serves a configuration which fails to load, and holds
+	// long-poll requests for it until they are canceled.
+	var (
+		requests atomic.Int32
+		held     atomic.Bool
+	)
+	client := &agentClient{}
+	env.svc.asClient = client
+	client.getConfigFunc = func(ctx context.Context, req *connect.Request[agentv1.GetConfigRequest]) (*connect.Response[agentv1.GetConfigResponse], error) {
+		requests.Inc()
+		if req.Header().Get("If-None-Match") == strconv.Quote(getHash([]byte(invalidCfg))) {
+			held.Store(true)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return buildGetConfigHandler(invalidCfg)(ctx, req)
+	}
+
+	runTestEnvironment(t, env)
+
+	// Verify that the service waits for a different configuration rather than
+	// fetching and reloading the invalid one in a loop.
+	require.Eventually(t, held.Load, time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	require.LessOrEqual(t, requests.Load(), int32(3))
+	require.Empty(t, env.svc.getCfgHash())
+}
+
+func TestLongPollFallback(t *testing.T) {
+	ctx := componenttest.TestContext(t)
+	url := "https://example.com/"
+	cfg1 := `loki.process "default" { forward_to = [] }`
+	cfg2 := `loki.process "updated" { forward_to = [] }`
+
+	// Create a new service.
+	env := newTestEnvironment(t)
+	require.NoError(t, env.ApplyConfig(fmt.Sprintf(`
+		url               = "%s"
+		poll_frequency    = "10ms"
+		long_poll_timeout = "1m"
+	`, url)))
+
+	// Mock an API where long-poll requests always fail.
+	var content atomic.String
+	content.Store(cfg1)
+	client := &agentClient{}
+	env.svc.asClient = client
+	client.getConfigFunc = func(ctx context.Context, req *connect.Request[agentv1.GetConfigRequest]) (*connect.Response[agentv1.GetConfigResponse], error) {
+		if req.Header().Get("Prefer") != "" {
+			return nil, connect.NewError(connect.CodeUnavailable, fmt.Errorf("stream broken"))
+		}
+		return buildGetConfigHandler(content.Load())(ctx, req)
+	}
+
+	go func() {
+		require.NoError(t, env.Run(ctx))
+	}()
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Equal(c, getHash([]byte(cfg1)), env.svc.getCfgHash())
+	}, time.Second, 10*time.Millisecond)
+
+	// Verify that the service falls back to polling.
+	content.Store(cfg2)
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Equal(c, getHash([]byte(cfg2)), env.svc.getCfgHash())
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestCanaryRollback(t *testing.T) {
+	ctx := componenttest.TestContext(t)
+	url := "https://example.com/"
+	cfg1 := `loki.process "default" { forward_to = [] }`
+	cfg2 := `loki.process "updated" { forward_to = [] }`
+
+	// Create a new service with a long canary grace period.
+	env := newTestEnvironment(t)
+	require.NoError(t, env.ApplyConfig(fmt.Sprintf(`
+		url            = "%s"
+		poll_frequency = "10ms"
+
+		canary {
+			grace_period = "1h"
+		}
+	`, url)))
+	env.svc.canaryCheckInterval = 10 * time.Millisecond
+
+	client := &agentClient{}
+	env.svc.asClient = client
+
+	client.mut.Lock()
+	client.getConfigFunc = buildGetConfigHandler(cfg1)
+	client.mut.Unlock()
+
+	go func() {
+		require.NoError(t, env.Run(ctx))
+	}()
+
+	// The first configuration has nothing to roll back to, so it's accepted
+	// immediately.
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Equal(c, getHash([]byte(cfg1)), env.svc.getCfgHash())
+		b, err := os.ReadFile(env.svc.dataPath)
+		assert.NoError(c, err)
+		assert.Equal(c, cfg1, string(b))
+	}, time.Second, 10*time.Millisecond)
+
+	client.mut.Lock()
+	client.getConfigFunc = buildGetConfigHandler(cfg2)
+	client.mut.Unlock()
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Equal(c, getHash([]byte(cfg2)), env.svc.getCfgHash())
+	}, time.Second, 10*time.Millisecond)
+
+	// Make all components unhealthy, and verify that the service rolls back
+	// to the previous configuration.
+	env.host.unhealthy.Store(true)
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Equal(c, getHash([]byte(cfg1)), env.svc.getCfgHash())
+		assert.Equal(c, float64(1), testutil.ToFloat64(env.svc.metrics.rollbacksTotal))
+	}, time.Second, 10*time.Millisecond)
+
+	// The rolled back configuration isn't loaded again, and the cache still
+	// holds the last known-good configuration.
+	require.Never(t, func() bool {
+		return env.svc.getCfgHash() != getHash([]byte(cfg1))
+	}, 100*time.Millisecond, 10*time.Millisecond)
+	b, err := os.ReadFile(env.svc.dataPath)
+	require.NoError(t, err)
+	require.Equal(t, cfg1, string(b))
+}
+
+func TestCanaryPromote(t *testing.T) {
+	ctx := componenttest.TestContext(t)
+	url := "https://example.com/"
+	cfg1 := `loki.process "default" { forward_to = [] }`
+	cfg2 := `loki.process "updated" { forward_to = [] }`
+
+	// Create a new service with a short canary grace period.
+	env := newTestEnvironment(t)
+	require.NoError(t, env.ApplyConfig(fmt.Sprintf(`
+		url            = "%s"
+		poll_frequency = "10ms"
+
+		canary {
+			grace_period = "50ms"
+		}
+	`, url)))
+	env.svc.canaryCheckInterval = 10 * time.Millisecond
+
+	client := &agentClient{}
+	env.svc.asClient = client
+
+	client.mut.Lock()
+	client.getConfigFunc = buildGetConfigHandler(cfg1)
+	client.mut.Unlock()
+
+	go func() {
+		require.NoError(t, env.Run(ctx))
+	}()
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Equal(c, getHash([]byte(cfg1)), env.svc.getCfgHash())
+	}, time.Second, 10*time.Millisecond)
+
+	client.mut.Lock()
+	client.getConfigFunc = buildGetConfigHandler(cfg2)
+	client.mut.Unlock()
+
+	// Verify that the new configuration is cached once it passes its grace
+	// period.
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Equal(c, getHash([]byte(cfg2)), env.svc.getCfgHash())
+		assert.Equal(c, float64(0), testutil.ToFloat64(env.svc.metrics.canaryInProgress))
+		b, err := os.ReadFile(env.svc.dataPath)
+		assert.NoError(c, err)
+		assert.Equal(c, cfg2, string(b))
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, float64(0), testutil.ToFloat64(env.svc.metrics.rollbacksTotal))
+}
+
+func TestSignatureVerification(t *testing.T) {
+	ctx := componenttest.TestContext(t)
+	url := "https://example.com/"
+	cfg1 := `loki.process "default" { forward_to = [] }`
+	cfg2 := `loki.process "updated" { forward_to = [] }`
+
+	key := signaturetest.NewKey(t)
+	otherKey := signaturetest.NewKey(t)
+
+	// Create a new service which requires configurations to be signed.
+	env := newTestEnvironment(t)
+	require.NoError(t, env.ApplyConfig(fmt.Sprintf(`
+		url            = "%s"
+		poll_frequency = "10ms"
+
+		verify {
+			public_keys = [%s]
+		}
+	`, url, strconv.Quote(key.PublicKey()))))
+
+	client := &agentClient{}
+	env.svc.asClient = client
+
+	client.mut.Lock()
+	client.getConfigFunc = buildSignedGetConfigHandler(cfg1, key.Sign(cfg1))
+	client.mut.Unlock()
+
+	go func() {
+		require.NoError(t, env.Run(ctx))
+	}()
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Equal(c, getHash([]byte(cfg1)), env.svc.getCfgHash())
+	}, time.Second, 10*time.Millisecond)
+
+	// Verify that configurations signed by an unknown key are rejected.
+	client.mut.Lock()
+	client.getConfigFunc = buildSignedGetConfigHandler(cfg2, otherKey.Sign(cfg2))
+	client.mut.Unlock()
+
+	require.ErrorContains(t, env.svc.fetchRemote(), "signature does not match")
+	require.Equal(t, getHash([]byte(cfg1)), env.svc.getCfgHash())
+
+	// Verify that unsigned configurations are rejected.
+	client.mut.Lock()
+	client.getConfigFunc = buildGetConfigHandler(cfg2)
+	client.mut.Unlock()
+
+	require.ErrorContains(t, env.svc.fetchRemote(), "has no X-Config-Signature header")
+	require.Equal(t, getHash([]byte(cfg1)), env.svc.getCfgHash())
+
+	// Verify that the configuration is loaded once it's correctly signed.
+	client.mut.Lock()
+	client.getConfigFunc = buildSignedGetConfigHandler(cfg2, key.Sign(cfg2))
+	client.mut.Unlock()
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Equal(c, getHash([]byte(cfg2)), env.svc.getCfgHash())
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestOnDiskCacheSignatureVerification(t *testing.T) {
+	url := "https://example.com/"
+	cacheContents := `loki.process "default" { forward_to = [] }`
+	key := signaturetest.NewKey(t)
+	otherKey := signaturetest.NewKey(t)
+
+	tt := []struct {
+		name      string
+		signature string
+		expectCfg bool
+	}{
+		{name: "Unsigned", signature: "", expectCfg: false},
+		{name: "UnknownKey", signature: otherKey.Sign(cacheContents), expectCfg: false},
+		{name: "Valid", signature: key.Sign(cacheContents), expectCfg: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			// Create a new service which requires configurations to be signed.
+			env := newTestEnvironment(t)
+			require.NoError(t, env.ApplyConfig(fmt.Sprintf(`
+				url = "%s"
+
+				verify {
+					public_keys = [%s]
+				}
+			`, url, strconv.Quote(key.PublicKey()))))
+
+			client := &agentClient{}
+			env.svc.asClient = client
+
+			// Mock client to return an unparseable response, so that the
+			// service falls back to the on-disk cache.
+			client.getConfigFunc = buildGetConfigHandler("unparseable river config")
+
+			require.NoError(t, os.WriteFile(env.svc.dataPath, []byte(cacheContents), 0644))
+			if tc.signature != "" {
+				require.NoError(t, os.WriteFile(env.svc.dataPath+signature.Suffix, []byte(tc.signature), 0644))
+			}
+
+			runTestEnvironment(t, env)
+
+			if tc.expectCfg {
+				require.EventuallyWithT(t, func(c *assert.CollectT) {
+					assert.Equal(c, getHash([]byte(cacheContents)), env.svc.getCfgHash())
+				}, time.Second, 10*time.Millisecond)
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+			require.Empty(t, env.svc.getCfgHash())
+		})
+	}
+}
+
+func TestJitteredBackoff(t *testing.T) {
+	for failures, expectMax := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		for i := 0; i < 10; i++ {
+			d := jitteredBackoff(failures, time.Second, 5*time.Second)
+			require.GreaterOrEqual(t, d, expectMax/2)
+			require.LessOrEqual(t, d, expectMax)
+		}
+	}
+}
+
 func buildGetConfigHandler(in string) func(context.Context, *connect.Request[agentv1.GetConfigRequest]) (*connect.Response[agentv1.GetConfigResponse], error) {
 	return func(context.Context, *connect.Request[agentv1.GetConfigRequest]) (*connect.Response[agentv1.GetConfigResponse], error) {
 		rsp := &connect.Response[agentv1.GetConfigResponse]{
@@ -114,9 +491,18 @@ func buildGetConfigHandler(in string) func(context.Context, *connect.Request[age
 	}
 }
 
+func buildSignedGetConfigHandler(in, sig string) func(context.Context, *connect.Request[agentv1.GetConfigRequest]) (*connect.Response[agentv1.GetConfigResponse], error) {
+	return func(ctx context.Context, req *connect.Request[agentv1.GetConfigRequest]) (*connect.Response[agentv1.GetConfigResponse], error) {
+		rsp := connect.NewResponse(&agentv1.GetConfigResponse{Content: in})
+		rsp.Header().Set(SignatureHeader, sig)
+		return rsp, nil
+	}
+}
+
 type testEnvironment struct {
-	t   *testing.T
-	svc *Service
+	t    *testing.T
+	svc  *Service
+	host *fakeHost
 }
 
 func newTestEnvironment(t *testing.T) *testEnvironment {
@@ -128,11 +514,27 @@ func newTestEnvironment(t *testing.T) *testEnvironment {
 	require.NoError(t, err)
 
 	return &testEnvironment{
-		t:   t,
-		svc: svc,
+		t:    t,
+		svc:  svc,
+		host: &fakeHost{},
 	}
 }
 
+// runTestEnvironment runs env until the test finishes. The service is stopped
+// before the test's temporary directories are removed.
+func runTestEnvironment(t *testing.T, env *testEnvironment) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, env.Run(ctx))
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
 func (env *testEnvironment) ApplyConfig(config string) error {
 	var args Arguments
 	if err := river.Unmarshal([]byte(config), &args); err != nil {
@@ -142,28 +544,46 @@ func (env *testEnvironment) ApplyConfig(config string) error {
 }
 
 func (env *testEnvironment) Run(ctx context.Context) error {
-	return env.svc.Run(ctx, fakeHost{})
+	return env.svc.Run(ctx, env.host)
 }
 
-type fakeHost struct{}
+type fakeHost struct {
+	mut  sync.RWMutex
+	ctrl *flow.Flow
 
-var _ service.Host = (fakeHost{})
+	// unhealthy marks all components as unhealthy when set.
+	unhealthy atomic.Bool
+}
+
+var _ service.Host = (*fakeHost)(nil)
 
-func (fakeHost) GetComponent(id component.ID, opts component.InfoOptions) (*component.Info, error) {
+func (*fakeHost) GetComponent(id component.ID, opts component.InfoOptions) (*component.Info, error) {
 	return nil, fmt.Errorf("no such component %s", id)
 }
 
-func (fakeHost) ListComponents(moduleID string, opts component.InfoOptions) ([]*component.Info, error) {
+func (f *fakeHost) ListComponents(moduleID string, opts component.InfoOptions) ([]*component.Info, error) {
 	if moduleID == "" {
 		return nil, nil
 	}
+
+	f.mut.RLock()
+	defer f.mut.RUnlock()
+	if moduleID == ServiceName && f.ctrl != nil {
+		infos, err := f.ctrl.ListComponents("", opts)
+		if f.unhealthy.Load() {
+			for _, info := range infos {
+				info.Health.Health = component.HealthTypeUnhealthy
+			}
+		}
+		return infos, err
+	}
 	return nil, fmt.Errorf("no such module %q", moduleID)
 }
 
-func (fakeHost) GetServiceConsumers(_ string) []service.Consumer { return nil }
-func (fakeHost) GetService(_ string) (service.Service, bool)     { return nil, false }
+func (*fakeHost) GetServiceConsumers(_ string) []service.Consumer { return nil }
+func (*fakeHost) GetService(_ string) (service.Service, bool)     { return nil, false }
 
-func (f fakeHost) NewController(id string) service.Controller {
+func (f *fakeHost) NewController(id string) service.Controller {
 	logger, _ := logging.New(io.Discard, logging.DefaultOptions)
 	ctrl := flow.New(flow.Options{
 		ControllerID:    ServiceName,
@@ -176,6 +596,10 @@ func (f fakeHost) NewController(id string) service.Controller {
 		Services:        []service.Service{},
 	})
 
+	f.mut.Lock()
+	f.ctrl = ctrl
+	f.mut.Unlock()
+
 	return serviceController{ctrl}
 }
 
@@ -0,0 +1,128 @@
+// Package signature verifies detached signatures of configuration content
+// loaded from remote sources.
+//
+// Public keys are PEM-encoded PKIX keys. Ed25519 signatures are computed over
+// the raw content, and ECDSA signatures over the SHA-256 digest of the
+// content, which matches the output of `cosign sign-blob`. Signatures are
+// base64-encoded.
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Suffix is appended to the name of a file to find its detached signature.
+const Suffix = ".sig"
+
+// ErrInvalidSignature is returned when a signature can't be verified with any
+// of the configured public keys.
+var ErrInvalidSignature = errors.New("signature does not match any of the configured public keys")
+
+// Arguments configures signature verification for a block.
+type Arguments struct {
+	PublicKeys []string `river:"public_keys,attr"`
+}
+
+// Validate implements river.Validator.
+func (args *Arguments) Validate() error {
+	_, err := NewVerifier(args.PublicKeys)
+	return err
+}
+
+// Verifier verifies detached signatures against a set of public keys.
+type Verifier struct {
+	keys []crypto.PublicKey
+}
+
+// NewVerifier returns a Verifier for the given PEM-encoded public keys. At
+// least one key must be provided.
+func NewVerifier(publicKeys []string) (*Verifier, error) {
+	if len(publicKeys) == 0 {
+		return nil, fmt.Errorf("at least one public key must be provided")
+	}
+
+	v := &Verifier{keys: make([]crypto.PublicKey, 0, len(publicKeys))}
+	for i, key := range publicKeys {
+		parsed, err := parsePublicKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("public key %d: %w", i, err)
+		}
+		v.keys = append(v.keys, parsed)
+	}
+	return v, nil
+}
+
+// FromArguments returns a Verifier for args, or nil if args is nil.
+func FromArguments(args *Arguments) (*Verifier, error) {
+	if args == nil {
+		return nil, nil
+	}
+	return NewVerifier(args.PublicKeys)
+}
+
+func parsePublicKey(key string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(strings.TrimSpace(key)))
+	if block == nil {
+		return nil, fmt.Errorf("expected a PEM-encoded public key")
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch parsed.(type) {
+	case ed25519.PublicKey, *ecdsa.PublicKey:
+		return parsed, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T, only Ed25519 and ECDSA keys are supported", parsed)
+	}
+}
+
+// Verify checks that signature is a valid base64-encoded signature of content
+// made by any of the keys of v.
+func (v *Verifier) Verify(content, signature []byte) error {
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return fmt.Errorf("decoding signature: %w", err)
+	}
+
+	digest := sha256.Sum256(content)
+	for _, key := range v.keys {
+		switch key := key.(type) {
+		case ed25519.PublicKey:
+			if ed25519.Verify(key, content, sig) {
+				return nil
+			}
+		case *ecdsa.PublicKey:
+			if ecdsa.VerifyASN1(key, digest[:], sig) {
+				return nil
+			}
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// VerifyFiles verifies every file in files against its signature, which is
+// looked up in signatures by the file name followed by Suffix.
+func (v *Verifier) VerifyFiles(files map[string]string, signatures map[string]string) error {
+	for name, content := range files {
+		sig, ok := signatures[name+Suffix]
+		if !ok {
+			return fmt.Errorf("missing signature %s for %s", name+Suffix, name)
+		}
+		if err := v.Verify([]byte(content), []byte(sig)); err != nil {
+			return fmt.Errorf("verifying %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package signature_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+
+	"github.com/grafana/agent/internal/signature"
+	"github.com/grafana/agent/internal/signature/signaturetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifier_Ed25519(t *testing.T) {
+	key := signaturetest.NewKey(t)
+	other := signaturetest.NewKey(t)
+
+	v, err := signature.NewVerifier([]string{other.PublicKey(), key.PublicKey()})
+	require.NoError(t, err)
+
+	content := `declare "add" {}`
+	require.NoError(t, v.Verify([]byte(content), []byte(key.Sign(content)+"\n")))
+	require.ErrorIs(t, v.Verify([]byte(content+" "), []byte(key.Sign(content))), signature.ErrInvalidSignature)
+	require.ErrorContains(t, v.Verify([]byte(content), []byte("not base64!")), "decoding signature")
+
+	v, err = signature.NewVerifier([]string{other.PublicKey()})
+	require.NoError(t, err)
+	require.ErrorIs(t, v.Verify([]byte(content), []byte(key.Sign(content))), signature.ErrInvalidSignature)
+}
+
+func TestVerifier_ECDSA(t *testing.T) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	require.NoError(t, err)
+	publicKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	content := []byte(`declare "add" {}`)
+	digest := sha256.Sum256(content)
+	sig, err := ecdsa.SignASN1(rand.Reader, private, digest[:])
+	require.NoError(t, err)
+
+	v, err := signature.NewVerifier([]string{publicKey})
+	require.NoError(t, err)
+	require.NoError(t, v.Verify(content, []byte(base64.StdEncoding.EncodeToString(sig))))
+	require.ErrorIs(t, v.Verify([]byte("tampered"), []byte(base64.StdEncoding.EncodeToString(sig))), signature.ErrInvalidSignature)
+}
+
+func TestVerifier_VerifyFiles(t *testing.T) {
+	key := signaturetest.NewKey(t)
+	v, err := signature.NewVerifier([]string{key.PublicKey()})
+	require.NoError(t, err)
+
+	files := map[string]string{"a.river": "a", "b.river": "b"}
+	require.NoError(t, v.VerifyFiles(files, map[string]string{
+		"a.river.sig": key.Sign("a"),
+		"b.river.sig": key.Sign("b"),
+	}))
+	require.ErrorContains(t, v.VerifyFiles(files, map[string]string{
+		"a.river.sig": key.Sign("a"),
+	}), "missing signature b.river.sig for b.river")
+	require.ErrorContains(t, v.VerifyFiles(files, map[string]string{
+		"a.river.sig": key.Sign("a"),
+		"b.river.sig": key.Sign("a"),
+	}), "verifying b.river")
+}
+
+func TestNewVerifier_InvalidKeys(t *testing.T) {
+	_, err := signature.NewVerifier(nil)
+	require.ErrorContains(t, err, "at least one public key must be provided")
+
+	_, err = signature.NewVerifier([]string{"not a key"})
+	require.ErrorContains(t, err, "public key 0: expected a PEM-encoded public key")
+}
@@ -0,0 +1,40 @@
+// Package signaturetest provides helpers to sign content in tests.
+package signaturetest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+)
+
+// Key is an Ed25519 key pair.
+type Key struct {
+	public  ed25519.PublicKey
+	private ed25519.PrivateKey
+}
+
+// NewKey generates a new Key.
+func NewKey(t testing.TB) *Key {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %s", err)
+	}
+	return &Key{public: public, private: private}
+}
+
+// PublicKey returns the PEM-encoded public key.
+func (k *Key) PublicKey() string {
+	der, err := x509.MarshalPKIXPublicKey(k.public)
+	if err != nil {
+		panic(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+// Sign returns the base64-encoded signature of content.
+func (k *Key) Sign(content string) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(k.private, []byte(content)))
+}
@@ -6,14 +6,24 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
 	"net/http"
+	"net/url"
 	"path"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/grafana/agent/internal/component"
 	"github.com/grafana/agent/internal/service"
 	"github.com/grafana/agent/internal/service/cluster"
+	"github.com/grafana/agent/internal/service/livedebugging"
 	"github.com/prometheus/prometheus/util/httputil"
+	"go.uber.org/atomic"
+	"golang.org/x/time/rate"
 )
 
 // FlowAPI is a wrapper around the component API.
@@ -34,6 +44,7 @@ func (f *FlowAPI) RegisterRoutes(urlPrefix string, r *mux.Router) {
 
 	r.Handle(path.Join(urlPrefix, "/modules/{moduleID:.+}/components"), httputil.CompressionHandler{Handler: f.listComponentsHandler()})
 	r.Handle(path.Join(urlPrefix, "/components"), httputil.CompressionHandler{Handler: f.listComponentsHandler()})
+	r.Handle(path.Join(urlPrefix, "/components/{id:.+}/stream"), f.streamComponentHandler())
 	r.Handle(path.Join(urlPrefix, "/components/{id:.+}"), httputil.CompressionHandler{Handler: f.getComponentHandler()})
 	r.Handle(path.Join(urlPrefix, "/peers"), httputil.CompressionHandler{Handler: f.getClusteringPeersHandler()})
 }
@@ -107,3 +118,140 @@ func (f *FlowAPI) getClusteringPeersHandler() http.HandlerFunc {
 		_, _ = w.Write(bb)
 	}
 }
+
+const (
+	// defaultStreamRate is the default maximum number of events per second sent
+	// to a client watching a component.
+	defaultStreamRate = 100
+
+	// streamBufferSize is how many events can be queued for a client before
+	// new events are dropped.
+	streamBufferSize = 1000
+)
+
+// streamOptions configure which data is sent to a client watching a
+// component.
+type streamOptions struct {
+	rate   float64 // Maximum number of events per second.
+	sample float64 // Fraction of events to keep, in (0, 1].
+}
+
+func parseStreamOptions(query url.Values) (streamOptions, error) {
+	opts := streamOptions{rate: defaultStreamRate, sample: 1}
+
+	if v := query.Get("rate"); v != "" {
+		r, err := strconv.ParseFloat(v, 64)
+		if err != nil || r <= 0 {
+			return opts, fmt.Errorf("rate must be a number greater than 0")
+		}
+		opts.rate = r
+	}
+	if v := query.Get("sample"); v != "" {
+		s, err := strconv.ParseFloat(v, 64)
+		if err != nil || s <= 0 || s > 1 {
+			return opts, fmt.Errorf("sample must be a number greater than 0 and at most 1")
+		}
+		opts.sample = s
+	}
+	return opts, nil
+}
+
+// streamComponentHandler streams the data published by a component to the
+// live debugging service as server-sent events. Events are sampled and rate
+// limited according to the sample and rate query parameters. Every second, the
+// number of events dropped because of the rate limit is sent as a "dropped"
+// event.
+func (f *FlowAPI) streamComponentHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		requestedComponent := component.ParseID(vars["id"])
+
+		if _, err := f.flow.GetComponent(requestedComponent, component.InfoOptions{}); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		svc, found := f.flow.GetService(livedebugging.ServiceName)
+		if !found {
+			http.Error(w, "live debugging service not running", http.StatusInternalServerError)
+			return
+		}
+		manager := svc.Data().(livedebugging.CallbackManager)
+
+		opts, err := parseStreamOptions(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var (
+			limiter = rate.NewLimiter(rate.Limit(opts.rate), max(1, int(opts.rate)))
+			events  = make(chan string, streamBufferSize)
+			dropped atomic.Uint64
+		)
+		remove := manager.AddCallback(requestedComponent.String(), func(data string) {
+			if opts.sample < 1 && rand.Float64() >= opts.sample {
+				return
+			}
+			if !limiter.Allow() {
+				dropped.Inc()
+				return
+			}
+			select {
+			case events <- data:
+			default:
+				dropped.Inc()
+			}
+		})
+		defer remove()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		rc := http.NewResponseController(w)
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+
+			case data := <-events:
+				writeEvent(w, "", data)
+
+			case <-ticker.C:
+				if n := dropped.Swap(0); n > 0 {
+					writeEvent(w, "dropped", strconv.FormatUint(n, 10))
+				} else {
+					// Send a comment so that proxies don't close idle streams.
+					_, _ = io.WriteString(w, ": keepalive\n\n")
+				}
+			}
+
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeEvent writes a server-sent event. Every line of data is sent as a
+// separate data field so that multi-line data is preserved.
+func writeEvent(w io.Writer, event string, data string) {
+	var sb strings.Builder
+	if event != "" {
+		sb.WriteString("event: " + event + "\n")
+	}
+	for _, line := range strings.Split(data, "\n") {
+		sb.WriteString("data: " + line + "\n")
+	}
+	sb.WriteString("\n")
+	_, _ = io.WriteString(w, sb.String())
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/grafana/agent/internal/component"
+	"github.com/grafana/agent/internal/service"
+	"github.com/grafana/agent/internal/service/livedebugging"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeHost is a service.Host with a single component and the live debugging
+// service.
+type fakeHost struct {
+	service.Host
+
+	componentID   component.ID
+	liveDebugging *livedebugging.Service
+}
+
+func (h *fakeHost) GetComponent(id component.ID, _ component.InfoOptions) (*component.Info, error) {
+	if id != h.componentID {
+		return nil, component.ErrComponentNotFound
+	}
+	return &component.Info{ID: id}, nil
+}
+
+func (h *fakeHost) GetService(name string) (service.Service, bool) {
+	if name != livedebugging.ServiceName {
+		return nil, false
+	}
+	return h.liveDebugging, true
+}
+
+func newTestServer(t *testing.T, host service.Host) *httptest.Server {
+	r := mux.NewRouter()
+	NewFlowAPI(host).RegisterRoutes("/api/v0/web", r)
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestStreamComponent(t *testing.T) {
+	host := &fakeHost{
+		componentID:   component.ID{ModuleID: "module.file.a", LocalID: "loki.process.default"},
+		liveDebugging: livedebugging.New(),
+	}
+	srv := newTestServer(t, host)
+
+	resp, err := http.Get(srv.URL + "/api/v0/web/components/module.file.a/loki.process.default/stream?rate=1")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	publisher := host.liveDebugging.Data().(livedebugging.DebugDataPublisher)
+	require.Eventually(t, func() bool {
+		return publisher.IsActive("module.file.a/loki.process.default")
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// With a rate of one event per second, only the first event is sent and
+	// the other is reported as dropped.
+	publisher.Publish("module.file.a/loki.process.default", "first\nline")
+	publisher.Publish("module.file.a/loki.process.default", "second")
+
+	events := readEvents(t, resp, 2)
+	require.Equal(t, "data: first\ndata: line\n", events[0])
+	require.Equal(t, "event: dropped\ndata: 1\n", events[1])
+}
+
+func TestStreamComponent_Errors(t *testing.T) {
+	host := &fakeHost{
+		componentID:   component.ID{LocalID: "loki.process.default"},
+		liveDebugging: livedebugging.New(),
+	}
+	srv := newTestServer(t, host)
+
+	tt := []struct {
+		path       string
+		expectCode int
+	}{
+		{"/api/v0/web/components/loki.process.missing/stream", http.StatusNotFound},
+		{"/api/v0/web/components/loki.process.default/stream?rate=0", http.StatusBadRequest},
+		{"/api/v0/web/components/loki.process.default/stream?sample=2", http.StatusBadRequest},
+	}
+	for _, tc := range tt {
+		resp, err := http.Get(srv.URL + tc.path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, tc.expectCode, resp.StatusCode, tc.path)
+	}
+}
+
+// readEvents reads n server-sent events from resp, skipping comments.
+func readEvents(t *testing.T, resp *http.Response, n int) []string {
+	t.Helper()
+
+	var (
+		events  []string
+		current strings.Builder
+		scanner = bufio.NewScanner(resp.Body)
+	)
+	for len(events) < n && scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, ":"):
+			continue
+		case line == "":
+			if current.Len() > 0 {
+				events = append(events, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteString(line + "\n")
+		}
+	}
+	require.NoError(t, scanner.Err())
+	require.Len(t, events, n)
+	return events
+}
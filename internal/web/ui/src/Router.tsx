@@ -5,6 +5,7 @@ import Navbar from './features/layout/Navbar';
 import PageClusteringPeers from './pages/Clustering';
 import ComponentDetailPage from './pages/ComponentDetailPage';
 import Graph from './pages/Graph';
+import PageLiveDebugging from './pages/LiveDebugging';
 import PageComponentList from './pages/PageComponentList';
 
 interface Props {
@@ -21,6 +22,7 @@ const Router = ({ basePath }: Props) => {
           <Route path="/component/*" element={<ComponentDetailPage />} />
           <Route path="/graph" element={<Graph />} />
           <Route path="/clustering" element={<PageClusteringPeers />} />
+          <Route path="/debug/*" element={<PageLiveDebugging />} />
         </Routes>
       </main>
     </BrowserRouter>
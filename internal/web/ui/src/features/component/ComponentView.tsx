@@ -1,6 +1,6 @@
 import { FC, Fragment, ReactElement } from 'react';
 import { Link } from 'react-router-dom';
-import { faCubes, faLink } from '@fortawesome/free-solid-svg-icons';
+import { faBug, faCubes, faLink } from '@fortawesome/free-solid-svg-icons';
 import { FontAwesomeIcon } from '@fortawesome/react-fontawesome';
 
 import { partitionBody } from '../../utils/partition';
@@ -94,10 +94,17 @@ export const ComponentView: FC<ComponentViewProps> = (props) => {
           </span>
         </h1>
 
-        <div className={styles.docsLink}>
-          <a href={`https://grafana.com/docs/agent/latest/flow/reference/components/${props.component.name}`}>
-            Documentation <FontAwesomeIcon icon={faLink} />
-          </a>
+        <div className={styles.links}>
+          <div className={styles.docsLink}>
+            <a href={`https://grafana.com/docs/agent/latest/flow/reference/components/${props.component.name}`}>
+              Documentation <FontAwesomeIcon icon={faLink} />
+            </a>
+          </div>
+          <div className={styles.docsLink}>
+            <Link to={`/debug/${props.component.moduleID ? props.component.moduleID + '/' : ''}${props.component.localID}`}>
+              Live debugging <FontAwesomeIcon icon={faBug} />
+            </Link>
+          </div>
         </div>
 
         {props.component.health.message && (
@@ -0,0 +1,55 @@
+import { FC, useState } from 'react';
+
+import { useLiveDebugging } from '../../hooks/liveDebugging';
+
+import styles from './LiveDebugging.module.css';
+
+interface LiveDebuggingProps {
+  id: string;
+}
+
+/**
+ * LiveDebugging displays the data flowing through a component as it is
+ * streamed from the API.
+ */
+const LiveDebugging: FC<LiveDebuggingProps> = (props) => {
+  const [paused, setPaused] = useState(false);
+  const [rate, setRate] = useState(100);
+  const { events, dropped, connected, clear } = useLiveDebugging(props.id, rate, paused);
+
+  return (
+    <div>
+      <div className={styles.controls}>
+        <button onClick={() => setPaused(!paused)}>{paused ? 'Resume' : 'Pause'}</button>
+        <button onClick={clear}>Clear</button>
+        <label>
+          Events per second{' '}
+          <input
+            type="number"
+            min={1}
+            value={rate}
+            onChange={(e) => {
+              const value = parseInt(e.target.value, 10);
+              if (value > 0) {
+                setRate(value);
+              }
+            }}
+          />
+        </label>
+        <span className={styles.status}>
+          {paused ? 'Paused' : connected ? 'Streaming' : 'Connecting'} &middot; {events.length} events &middot;{' '}
+          {dropped} dropped
+        </span>
+      </div>
+      <div className={styles.events}>
+        {events.length === 0 ? (
+          <em>Waiting for data. Only components which support live debugging send data.</em>
+        ) : (
+          events.map((event, index) => <p key={index}>{event}</p>)
+        )}
+      </div>
+    </div>
+  );
+};
+
+export default LiveDebugging;
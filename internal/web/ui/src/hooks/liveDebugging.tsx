@@ -0,0 +1,63 @@
+import { useEffect, useState } from 'react';
+
+/**
+ * maxEvents is the maximum number of events kept in memory. Older events are
+ * discarded first.
+ */
+const maxEvents = 1000;
+
+export interface LiveDebuggingState {
+  events: string[];
+  dropped: number;
+  connected: boolean;
+  clear: () => void;
+}
+
+/**
+ * useLiveDebugging streams the data flowing through a component from the API.
+ *
+ * @param id The full ID of the component to watch.
+ * @param rate The maximum number of events per second to receive.
+ * @param paused Whether to stop streaming events.
+ */
+export const useLiveDebugging = (id: string, rate: number, paused: boolean): LiveDebuggingState => {
+  const [events, setEvents] = useState<string[]>([]);
+  const [dropped, setDropped] = useState(0);
+  const [connected, setConnected] = useState(false);
+
+  useEffect(
+    function () {
+      if (paused) {
+        return;
+      }
+
+      // Request is relative to the <base> tag inside of <head>.
+      const source = new EventSource(`./api/v0/web/components/${id}/stream?rate=${rate}`, {
+        withCredentials: true,
+      });
+
+      source.onopen = () => setConnected(true);
+      source.onerror = () => setConnected(false);
+      source.onmessage = (e: MessageEvent<string>) => {
+        setEvents((prev) => prev.concat(e.data).slice(-maxEvents));
+      };
+      source.addEventListener('dropped', (e: Event) => {
+        const count = parseInt((e as MessageEvent<string>).data, 10);
+        setDropped((prev) => prev + (isNaN(count) ? 0 : count));
+      });
+
+      return () => {
+        source.close();
+        setConnected(false);
+      };
+    },
+    [id, rate, paused]
+  );
+
+  const clear = () => {
+    setEvents([]);
+    setDropped(0);
+  };
+
+  return { events, dropped, connected, clear };
+};
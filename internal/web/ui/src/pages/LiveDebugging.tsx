@@ -0,0 +1,18 @@
+import { FC } from 'react';
+import { useParams } from 'react-router-dom';
+import { faBug } from '@fortawesome/free-solid-svg-icons';
+
+import LiveDebugging from '../features/component/LiveDebugging';
+import Page from '../features/layout/Page';
+
+const PageLiveDebugging: FC = () => {
+  const { '*': id } = useParams();
+
+  return (
+    <Page name="Live debugging" desc={`Data flowing through ${id}`} icon={faBug}>
+      {id && <LiveDebugging id={id} />}
+    </Page>
+  );
+};
+
+export default PageLiveDebugging;